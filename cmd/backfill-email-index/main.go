@@ -0,0 +1,52 @@
+// Command backfill-email-index reserves the email addresses of users created before
+// email reservations existed. Those users can't login until their address is reserved.
+// It is safe to run more than once, and it lists addresses registered by several users,
+// which have to be resolved by hand.
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+func main() {
+	ctx := context.Background()
+	dynamoDBsvc, err := database.NewAWSCredsImpl().GetDynamodbSVC(&http.Client{Timeout: 15 * time.Second})
+	if err != nil {
+		log.Fatalf("Error creating DynamoDB client. %s", err.Error())
+	}
+	usersDBImpl := database.NewUsersDBImpl(dynamoDBsvc)
+
+	users, _, err := usersDBImpl.GetUsersInDynamoDB(ctx, models.DatabaseQuery{})
+	if err != nil {
+		log.Fatalf("Error listing users. %s", err.Error())
+	}
+	var reserved, skipped, duplicates int
+	for _, user := range users {
+		if user.EmailAddress == "" {
+			skipped++
+			continue
+		}
+		err := usersDBImpl.ReserveEmailInDynamoDB(ctx, user.EmailAddress, user.UserID)
+		switch {
+		case err == database.ErrEmailTaken:
+			duplicates++
+			log.Warnf("Email address %s of user %s is already reserved by another user", user.EmailAddress, user.UserID)
+		case err != nil:
+			log.Fatalf("Error reserving email address of user %s. %s", user.UserID, err.Error())
+		default:
+			reserved++
+		}
+	}
+	log.Infof("Reserved %d email addresses, skipped %d users without one, found %d duplicates", reserved, skipped, duplicates)
+	if duplicates > 0 {
+		os.Exit(1)
+	}
+}
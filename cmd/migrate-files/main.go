@@ -0,0 +1,50 @@
+// Command migrate-files moves the file metadata stored in the files map of user items to an item per file.
+// The service reads both layouts, so it runs while the service is up, once every instance runs a version
+// storing files as items. It is safe to run more than once, and files changed while they are moved are
+// left for the next run.
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+func main() {
+	ctx := context.Background()
+	dynamoDBsvc, err := database.NewAWSCredsImpl().GetDynamodbSVC(&http.Client{Timeout: 15 * time.Second})
+	if err != nil {
+		log.Fatalf("Error creating DynamoDB client. %s", err.Error())
+	}
+	usersDBImpl := database.NewUsersDBImpl(dynamoDBsvc)
+
+	users, _, err := usersDBImpl.GetUsersInDynamoDB(ctx, models.DatabaseQuery{})
+	if err != nil {
+		log.Fatalf("Error listing users. %s", err.Error())
+	}
+	var moved, migratedUsers, leftUsers int
+	for _, user := range users {
+		count, err := usersDBImpl.MigrateUserFilesInDynamoDB(ctx, user.UserID)
+		moved += count
+		if count > 0 {
+			migratedUsers++
+		}
+		switch {
+		case err == database.ErrUserChanged:
+			leftUsers++
+			log.Warnf("Files of user %s changed while they were moved", user.UserID)
+		case err != nil:
+			log.Fatalf("Error moving files of user %s. %s", user.UserID, err.Error())
+		}
+	}
+	log.Infof("Moved %d files of %d users, %d users have files left to move", moved, migratedUsers, leftUsers)
+	if leftUsers > 0 {
+		os.Exit(1)
+	}
+}
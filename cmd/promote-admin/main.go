@@ -0,0 +1,46 @@
+// Command promote-admin grants admin rights to the registered user with the given email address.
+// Signups never grant admin, so a new deployment gets its first admin with it; later admins are
+// promoted through the admin routes. It runs with the same DB environment as the service.
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+)
+
+func main() {
+	email := flag.String("email", "", "email address of the registered user to promote")
+	flag.Parse()
+	if *email == "" {
+		log.Fatal("Pass the email address of the user to promote with -email")
+	}
+
+	ctx := context.Background()
+	dynamoDBsvc, err := database.NewAWSCredsImpl().GetDynamodbSVC(&http.Client{Timeout: 15 * time.Second})
+	if err != nil {
+		log.Fatalf("Error creating DynamoDB client. %s", err.Error())
+	}
+	usersDBImpl := database.NewUsersDBImpl(dynamoDBsvc)
+
+	userCreds, err := usersDBImpl.GetUserCredentials(ctx, *email)
+	if err != nil {
+		log.Fatalf("Error finding user with email address %s. %s", *email, err.Error())
+	}
+	if userCreds.IsAdmin {
+		log.Infof("User %s is already an admin", userCreds.UserID)
+		return
+	}
+	if err := usersDBImpl.SetUserAttributesInDynamoDB(ctx, userCreds.UserID, map[string]interface{}{"IsAdmin": true}); err != nil {
+		log.Fatalf("Error promoting user %s. %s", userCreds.UserID, err.Error())
+	}
+	log.Infof("Promoted user %s to admin", userCreds.UserID)
+	if userCreds.EmailVerificationPending {
+		log.Warnf("User %s has to verify its email address before it can login", userCreds.UserID)
+	}
+}
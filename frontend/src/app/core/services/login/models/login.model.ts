@@ -1,9 +1,11 @@
 
 export  interface LoginResponse {
   EmailAddress: string;
-  Password: string;
   UserID: string;
   IsAdmin: boolean;
+  accessToken: string;
+  tokenType: string;
+  expiresAt: number;
 }
 
 export interface UserParams {
@@ -11,7 +13,6 @@ export interface UserParams {
     firstName: string;
     lastName: string;
     password: string;
-    isAdmin: boolean;
 }
 
 export interface RegisterResponse {
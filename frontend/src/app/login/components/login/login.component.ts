@@ -42,6 +42,7 @@ export class LoginComponent implements OnInit, OnDestroy {
        sessionStorage.setItem('EmailAddress', response.EmailAddress);
        sessionStorage.setItem('IsAdmin', JSON.stringify(response.IsAdmin));
        sessionStorage.setItem('UserID', response.UserID);
+       sessionStorage.setItem('token', response.accessToken);
        this.loginService.userLoggedIn.next(true);
        this.router.navigate(['/home']);
       }
@@ -16,8 +16,7 @@ export class SignUpComponent implements OnInit {
       emailAddress: ['', Validators.email],
       password: ['', Validators.required],
       firstName: ['', Validators.required],
-      lastName: ['', Validators.required],
-      isAdmin: [false, Validators.required]
+      lastName: ['', Validators.required]
     });
    }
 
@@ -25,11 +24,6 @@ export class SignUpComponent implements OnInit {
   }
 
   register() {
-    if(this.signupForm.controls.isAdmin.value === 'true') {
-      this.signupForm.controls.isAdmin.setValue(true);
-    } else {
-      this.signupForm.controls.isAdmin.setValue(false);
-    }
     this.loginService.registerUser(this.signupForm.value).subscribe(response => {
       if (response.EmailAddress) {
         this.openSnackBar('User registered. Please login', 'mat-primary');
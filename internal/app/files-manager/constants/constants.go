@@ -5,4 +5,14 @@ const (
 	UserIDKey = "user_id"
 
 	FileKey = "file"
+
+	// LimitKey and CursorKey are the query parameters paging through listings
+	LimitKey  = "limit"
+	CursorKey = "cursor"
+	// FieldsKey is the query parameter narrowing user responses to a comma separated list of fields
+	FieldsKey = "fields"
+	// DefaultPageSize is the page size of listings without a limit
+	DefaultPageSize = 50
+	// MaxPageSize caps the limit of listings, larger limits are lowered to it
+	MaxPageSize = 100
 )
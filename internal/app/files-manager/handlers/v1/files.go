@@ -10,17 +10,22 @@ import (
 	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/services"
 	userConsts "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/handlers/views"
 	userModels "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
 	usrSvc "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	indexHashKey             = ":user"
+	indexHashKey = ":user"
+	// multipartOverheadBytes is the room for the multipart headers and boundaries around an uploaded file
+	multipartOverheadBytes = 64 << 10
 )
 
 // FilesRouter holds the dependencies for files router
@@ -42,73 +47,160 @@ func CreateFileRouter(
 
 func (fr *FilesRouter) GetAllUsers(c *gin.Context) {
 	ctx := c.Request.Context()
-	dynamoQueryparams := &dynamodb.QueryInput{
-		TableName:              aws.String(userConsts.UsersTableName),
-		KeyConditionExpression: aws.String("#skey = :user"),
-		ExpressionAttributeNames: map[string]*string{
-			"#skey": aws.String("skey"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			indexHashKey: {
-				S: aws.String(userConsts.TypeUsersForSortKey),
-			},
-		},
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
+	limit, errResp := pageLimit(c)
+	if errResp != nil {
+		c.JSON(errResp.ErrorStatusCode, errResp)
+		return
+	}
+	filters := c.Request.URL.Query()
+	filters.Del(constants.LimitKey)
+	filters.Del(constants.CursorKey)
+	filters.Del(constants.FieldsKey)
+	conditions, errResp := usrSvc.UserFilterConditions(filters)
+	if errResp != nil {
+		c.JSON(errResp.ErrorStatusCode, errResp)
+		return
 	}
 	dbQuery := models.DatabaseQuery{
-		QueryParams: dynamoQueryparams,
+		QueryParams: usersQueryParams(),
+		Limit:       limit,
+		Cursor:      c.Query(constants.CursorKey),
+		Conditions:  conditions,
+		// files take a query per user, they are only listed when asked for
+		WithFiles: userModels.NamesFiles(fields),
 	}
 	usersResp, err := fr.UserService.GetUsers(ctx, dbQuery)
 	if err != nil {
 		errRes := models.ErrorResponse{
-			Message:         fmt.Sprintf("Failed to get users. Error: %s", err.Message),
-			ErrorStatusCode: err.ErrorStatusCode,
+			Message:              fmt.Sprintf("Failed to get users. Error: %s", err.Message),
+			RecommendationAction: err.RecommendationAction,
+			ErrorStatusCode:      err.ErrorStatusCode,
 		}
 		c.JSON(err.ErrorStatusCode, errRes)
 		return
 	}
 
-	c.JSON(http.StatusOK, usersResp)
+	// the listing is only served to admins
+	listing := userModels.UserListing{
+		Members:    []interface{}{},
+		NextCursor: usersResp.NextCursor,
+	}
+	for _, user := range usersResp.Members {
+		view, errView := userModels.NewUserView(user, true, fields)
+		if errView != nil {
+			errRes := models.ErrorResponse{
+				Message:         fmt.Sprintf("Failed to encode user. %s", errView.Error()),
+				ErrorStatusCode: http.StatusInternalServerError,
+			}
+			c.JSON(http.StatusInternalServerError, errRes)
+			return
+		}
+		listing.Members = append(listing.Members, view)
+	}
+	c.JSON(http.StatusOK, listing)
 }
 
 func (fr *FilesRouter) GetAllFiles(c *gin.Context) {
 	ctx := c.Request.Context()
-	dynamoQueryparams := &dynamodb.QueryInput{
-		TableName:              aws.String(userConsts.UsersTableName),
-		KeyConditionExpression: aws.String("#skey = :user"),
-		ExpressionAttributeNames: map[string]*string{
-			"#skey": aws.String("skey"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			indexHashKey: {
-				S: aws.String(userConsts.TypeUsersForSortKey),
-			},
-		},
+	limit, errResp := pageLimit(c)
+	if errResp != nil {
+		c.JSON(errResp.ErrorStatusCode, errResp)
+		return
 	}
 	dbQuery := models.DatabaseQuery{
-		QueryParams: dynamoQueryparams,
+		QueryParams: usersQueryParams(),
+		Limit:       limit,
+		Cursor:      c.Query(constants.CursorKey),
+		Conditions:  []models.QueryCondition{usrSvc.ActiveUsersCondition()},
+		WithFiles:   true,
 	}
 	usersResp, err := fr.UserService.GetUsers(ctx, dbQuery)
 	if err != nil {
 		errRes := models.ErrorResponse{
-			Message:         fmt.Sprintf("Failed to get users. Error: %s", err.Message),
-			ErrorStatusCode: err.ErrorStatusCode,
+			Message:              fmt.Sprintf("Failed to get users. Error: %s", err.Message),
+			RecommendationAction: err.RecommendationAction,
+			ErrorStatusCode:      err.ErrorStatusCode,
 		}
 		c.JSON(err.ErrorStatusCode, errRes)
 		return
 	}
-	filesResp := []map[string]fileModels.FileInfo{}
+	filesResp := fileModels.FileListing{
+		Members:    []map[string]fileModels.FileInfo{},
+		NextCursor: usersResp.NextCursor,
+	}
 	for _, value := range usersResp.Members {
-		filesResp = append(filesResp, value.FileInfo)
+		filesResp.Members = append(filesResp.Members, value.FileInfo)
 	}
 
 	c.JSON(http.StatusOK, filesResp)
 }
 
+// usersQueryParams returns the query of the user items, through the index keyed by the sort key
+func usersQueryParams() *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              aws.String(userConsts.UsersTableName),
+		IndexName:              aws.String(userConsts.UsersTableSortKeyIndex),
+		KeyConditionExpression: aws.String("#skey = :user"),
+		ExpressionAttributeNames: map[string]*string{
+			"#skey": aws.String(userConsts.UsersTableSortKey),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			indexHashKey: {
+				S: aws.String(userConsts.TypeUsersForSortKey),
+			},
+		},
+	}
+}
+
+// pageLimit reads the page size of a listing, limits above the maximum are lowered to it
+func pageLimit(c *gin.Context) (int64, *models.ErrorResponse) {
+	value := c.Query(constants.LimitKey)
+	if value == "" {
+		return constants.DefaultPageSize, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 1 {
+		return 0, &models.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid limit %q", value),
+			RecommendationAction: []string{fmt.Sprintf("Send a limit between 1 and %d", constants.MaxPageSize)},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	if limit > constants.MaxPageSize {
+		limit = constants.MaxPageSize
+	}
+	return limit, nil
+}
+
 // UploadFile uploads a file attachment to aws s3 bucket
 func (fr *FilesRouter) UploadFile(c *gin.Context) {
 	ctx := c.Request.Context()
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
 	userID := c.Param(constants.UserIDKey)
+	// a body larger than any file the user may upload is cut off before it is buffered
+	maxFileSize, errResp := fr.FileService.MaxFileSize(ctx, userID)
+	if errResp != nil {
+		c.JSON(errResp.ErrorStatusCode, errResp)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileSize+multipartOverheadBytes)
 	fileHeader, err := c.FormFile(constants.FileKey)
+	if err != nil && bodyTooLarge(err) {
+		errRes := models.ErrorResponse{
+			Message:              fmt.Sprintf("Upload is larger than the limit of %d bytes per file", maxFileSize),
+			RecommendationAction: []string{fmt.Sprintf("Upload a file of at most %d bytes", maxFileSize)},
+			ErrorStatusCode:      http.StatusRequestEntityTooLarge,
+		}
+		c.JSON(http.StatusRequestEntityTooLarge, errRes)
+		return
+	}
 	if err != nil {
 		errRes := models.ErrorResponse{
 			Message:         fmt.Sprintf("Failed to get form data from key file. Error: %v", err),
@@ -139,45 +231,36 @@ func (fr *FilesRouter) UploadFile(c *gin.Context) {
 		return
 	}
 
-	fileSizeBytes := fileHeader.Size
-	fileSize := CalculateFileSize(fileSizeBytes)
-	log.Printf("File size %s", fileSize)
-	if fileSize > 10 {
-		errFileRes := models.ErrorResponse{
-			Message: fmt.Sprintf("File size (%d MB) greater than 10 MB.", fileSize),
-			RecommendationAction: []string{fmt.Sprint("File size should be lesser than 10 MB")},
-			ErrorStatusCode: http.StatusBadRequest,
-		}
-		c.JSON(http.StatusBadRequest, errFileRes)
-	}
+	log.Printf("File size %d bytes", fileHeader.Size)
 	createdAt := time.Now().Format(time.RFC3339)
-	fileInfo := fileModels.FileInfo{FileName: fileName, UpdatedAt: createdAt, CreatedAt: createdAt}
+	fileInfo := fileModels.FileInfo{FileName: fileName, UpdatedAt: createdAt, CreatedAt: createdAt, Size: fileHeader.Size}
+	// the service checks the file against the storage limits of the user before uploading it
 	user, errResp := fr.FileService.UploadFile(ctx, userID, fileInfo, f)
 	if errResp != nil {
 		errRes := models.ErrorResponse{
-			Message:         fmt.Sprintf("Failed to upload file %s for User %s. Error: %v", fileName, userID, errResp),
-			ErrorStatusCode: http.StatusInternalServerError,
-		}
-		c.JSON(http.StatusInternalServerError, errRes)
-		return
-	}
-
-	updatedUser, errResp := fr.UserService.UpdateUser(ctx, user)
-	if errResp != nil {
-		errRes := models.ErrorResponse{
-			Message:         fmt.Sprintf("Upload successful but failed to update user in DB. Error: %s", errResp.Message),
-			ErrorStatusCode: errResp.ErrorStatusCode,
+			Message:              fmt.Sprintf("Failed to upload file %s for User %s. Error: %s", fileName, userID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
 		}
 		c.JSON(errResp.ErrorStatusCode, errRes)
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedUser)
+	views.RespondUser(c, http.StatusOK, user.User, fields)
+}
+
+// bodyTooLarge reports whether reading the body failed at the limit of http.MaxBytesReader, which only tells by its message
+func bodyTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "http: request body too large")
 }
 
 // UpdateFileDescription updates a file description
 func (fr *FilesRouter) UpdateFileDescription(c *gin.Context) {
 	ctx := c.Request.Context()
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
 	userID := c.Param(constants.UserIDKey)
 	queryMap := c.Request.URL.Query()
 	if _, ok := queryMap[constants.FileKey]; !ok {
@@ -255,16 +338,7 @@ func (fr *FilesRouter) UpdateFileDescription(c *gin.Context) {
 		c.JSON(updateErrResp.ErrorStatusCode, updateRes)
 		return
 	}
-	updatedUserResp, errResp := fr.UserService.UpdateUser(ctx, updatedFile)
-	if errResp != nil {
-		errRes := models.ErrorResponse{
-			Message:         fmt.Sprintf("Failed to update file description in DB. Error: %s", errResp.Message),
-			ErrorStatusCode: errResp.ErrorStatusCode,
-		}
-		c.JSON(errResp.ErrorStatusCode, errRes)
-		return
-	}
-	c.JSON(http.StatusOK, updatedUserResp)
+	views.RespondUser(c, http.StatusOK, updatedFile.User, fields)
 }
 
 // DownloadFile downloads a file from aws s3 bucket by presignedURL
@@ -307,6 +381,10 @@ func (fr *FilesRouter) DownloadFile(c *gin.Context) {
 // DeleteFile deletes a file attachment from aws s3 bucket
 func (fr *FilesRouter) DeleteFile(c *gin.Context) {
 	ctx := c.Request.Context()
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
 	delUserID := c.Param(constants.UserIDKey)
 	delQueryMap := c.Request.URL.Query()
 	var delFileName string
@@ -332,9 +410,9 @@ func (fr *FilesRouter) DeleteFile(c *gin.Context) {
 		validFileList = append(validFileList, delFileName)
 	}
 	var updatedUser userModels.UserDynamo
-	var errResp *models.ErrorResponse
 	for _, delFileName := range validFileList {
-		updatedUser, delErrResp := fr.FileService.DeleteFile(ctx, delUserID, delFileName)
+		var delErrResp *models.ErrorResponse
+		updatedUser, delErrResp = fr.FileService.DeleteFile(ctx, delUserID, delFileName)
 		if delErrResp != nil {
 			delRes := models.ErrorResponse{
 				Message:              fmt.Sprintf("unable to delete the quote attachment %s. Error: %s", delFileName, delErrResp.Message),
@@ -344,22 +422,6 @@ func (fr *FilesRouter) DeleteFile(c *gin.Context) {
 			c.JSON(delErrResp.ErrorStatusCode, delRes)
 			return
 		}
-		updatedUser, errResp = fr.UserService.UpdateUser(ctx, updatedUser)
-		if errResp != nil {
-			errRes := models.ErrorResponse{
-				Message:         fmt.Sprintf("Delete file is successful but failed to update user in DB. Error: %s", errResp.Message),
-				ErrorStatusCode: errResp.ErrorStatusCode,
-			}
-			c.JSON(errResp.ErrorStatusCode, errRes)
-			return
-		}
 	}
-	c.JSON(http.StatusOK, updatedUser.User)
-}
-
-//CalculateFileSize returns uploaded file size
-func CalculateFileSize(fileSizeBytes int64) int64 {
-	fileSizeInKB := fileSizeBytes / 1024
-	fileSizeInMB := fileSizeInKB / 1024
-	return fileSizeInMB
+	views.RespondUser(c, http.StatusOK, updatedUser.User, fields)
 }
@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/services"
+	userModels "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	usrSvc "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth/authtest"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// fakeFileService answers every file change with the stored user, the other methods of the interface are not used
+type fakeFileService struct {
+	services.FileService
+	user        userModels.UserDynamo
+	maxFileSize int64
+	uploads     int
+}
+
+func (f *fakeFileService) MaxFileSize(ctx context.Context, userID string) (int64, *models.ErrorResponse) {
+	return f.maxFileSize, nil
+}
+
+func (f *fakeFileService) CheckValidFileName(ctx context.Context, fileName string) (string, error) {
+	return fileName, nil
+}
+
+func (f *fakeFileService) CheckValidDescription(ctx context.Context, description string) *models.ErrorResponse {
+	return nil
+}
+
+func (f *fakeFileService) UploadFile(ctx context.Context, userID string, fileInfo fileModels.FileInfo, filereader io.Reader) (userModels.UserDynamo, *models.ErrorResponse) {
+	f.uploads++
+	return f.user, nil
+}
+
+func (f *fakeFileService) UpdateUserFileDescription(ctx context.Context, userID string, updateFiles []string, updateDescription fileModels.UpdateFileInfo) (userModels.UserDynamo, *models.ErrorResponse) {
+	return f.user, nil
+}
+
+func (f *fakeFileService) DeleteFile(ctx context.Context, userID string, fileName string) (userModels.UserDynamo, *models.ErrorResponse) {
+	return f.user, nil
+}
+
+type fakeUserService struct {
+	usrSvc.UserService
+	user userModels.UserDynamo
+}
+
+func (f *fakeUserService) GetUsers(ctx context.Context, query models.DatabaseQuery) (userModels.Users, *models.ErrorResponse) {
+	return userModels.Users{Members: []userModels.User{f.user.User}}, nil
+}
+
+func TestFileResponsesLeaveOutPassword(t *testing.T) {
+	for hashName, config := range authtest.PasswordHashConfigs() {
+		hash := authtest.HashPassword(t, config, "correct horse battery staple")
+		user := userModels.UserDynamo{
+			User: userModels.User{
+				UserID:   "user-1",
+				FileInfo: map[string]fileModels.FileInfo{"a.txt": {FileName: "a.txt", Size: 3}},
+				Credentials: userModels.Credentials{
+					EmailAddress: "ada@example.com",
+					Password:     hash,
+				},
+			},
+		}
+		fr := CreateFileRouter(&fakeFileService{user: user, maxFileSize: 1 << 20}, &fakeUserService{user: user})
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		filev1 := router.Group("/v1", func(c *gin.Context) {
+			c.Set(auth.ClaimsContextKey, auth.Claims{Subject: user.UserID})
+			c.Set(auth.PrincipalContextKey, auth.Principal{UserID: user.UserID, IsAdmin: true})
+		})
+		filev1.GET("/users", fr.GetAllUsers)
+		filev1.POST("/users/:user_id/upload", fr.UploadFile)
+		filev1.PUT("/users/:user_id/file-update", fr.UpdateFileDescription)
+		filev1.DELETE("/users/:user_id/file", fr.DeleteFile)
+
+		requests := map[string]*http.Request{
+			"list users":         httptest.NewRequest(http.MethodGet, "/v1/users", nil),
+			"upload file":        uploadRequest(t, []byte("abc")),
+			"update description": httptest.NewRequest(http.MethodPut, "/v1/users/user-1/file-update?file=a.txt", strings.NewReader(`{"description":"notes"}`)),
+			"delete file":        httptest.NewRequest(http.MethodDelete, "/v1/users/user-1/file?file=a.txt", nil),
+		}
+		for name, req := range requests {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s %s: status %d, body %s", hashName, name, w.Code, w.Body.String())
+			}
+			authtest.AssertNoSecrets(t, hashName+" "+name, w.Body.Bytes(), hash)
+		}
+	}
+}
+
+func TestUploadRejectsBodyOverMaxFileSize(t *testing.T) {
+	files := &fakeFileService{maxFileSize: 1024}
+	fr := CreateFileRouter(files, &fakeUserService{})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/users/:user_id/upload", fr.UploadFile)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, bytes.Repeat([]byte("a"), multipartOverheadBytes+2048)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413, body %s", w.Code, w.Body.String())
+	}
+	if files.uploads != 0 {
+		t.Errorf("file was uploaded")
+	}
+}
+
+// uploadRequest returns the multipart request uploading content as a.txt for user-1
+func uploadRequest(t *testing.T, content []byte) *http.Request {
+	t.Helper()
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("file", "a.txt")
+	if err != nil {
+		t.Fatalf("creating form: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+	upload := httptest.NewRequest(http.MethodPost, "/v1/users/user-1/upload", &form)
+	upload.Header.Set("Content-Type", writer.FormDataContentType())
+	return upload
+}
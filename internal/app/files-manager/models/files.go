@@ -6,6 +6,15 @@ type FileInfo struct {
 	Description string `json:"description"`
 	UpdatedAt   string `json:"updated_at"`
 	CreatedAt   string `json:"created_at"`
+	// Size is the size of the file in bytes, it is 0 for files uploaded before sizes were recorded
+	Size int64 `json:"size,omitempty"`
+}
+
+// FileListing is a page of the files of all users, grouped by user
+type FileListing struct {
+	Members []map[string]FileInfo `json:"members"`
+	// NextCursor fetches the next page, it is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // UpdateFileInfo is the file info for file update
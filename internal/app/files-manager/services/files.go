@@ -7,9 +7,11 @@ import (
 	usrModels "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
 	awss3pkg "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
 	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 )
@@ -21,6 +23,7 @@ const (
 // FileService - holds the functions used for file management
 type FileService interface {
 	UploadFile(ctx context.Context, userID string, fileInfo fileModels.FileInfo, filereader io.Reader) (usrModels.UserDynamo, *commonModels.ErrorResponse)
+	MaxFileSize(ctx context.Context, userID string) (int64, *commonModels.ErrorResponse)
 	DownloadFile(ctx context.Context, userID string, fileName string) (fileModels.DownloadFileInfo, *commonModels.ErrorResponse)
 	DeleteFile(ctx context.Context, userID string, fileName string) (usrModels.UserDynamo, *commonModels.ErrorResponse)
 	CheckValidFileName(ctx context.Context, fileName string) (string, error)
@@ -29,63 +32,98 @@ type FileService interface {
 }
 
 type FileManager struct {
-	UserSvc services.UserService
-	//UserDBSvc  database.UsersDynamoDBAPI
-	AWSS3Svc awss3pkg.IfAWSS3
+	UserSvc    services.UserService
+	UserDBSvc  database.UsersDynamoDBAPI
+	AWSS3Svc   awss3pkg.IfAWSS3
+	StorageSvc services.StorageService
 }
 
 // NewFileService creates an instance of File Service
-func NewFileService(userService services.UserService, awsS3Service awss3pkg.IfAWSS3) FileService {
+func NewFileService(userService services.UserService, userDBService database.UsersDynamoDBAPI, awsS3Service awss3pkg.IfAWSS3,
+	storageService services.StorageService) FileService {
 	return &FileManager{
-		UserSvc: userService,
-		//UserDBSvc: userDBService,
-		AWSS3Svc: awsS3Service,
+		UserSvc:    userService,
+		UserDBSvc:  userDBService,
+		AWSS3Svc:   awsS3Service,
+		StorageSvc: storageService,
 	}
 }
 
-//CheckValidFileName validates the file name
+//CheckValidFileName validates the file name, once unescaped it has to stay in the folder of the user
 func (fm *FileManager) CheckValidFileName(ctx context.Context, fileName string) (string, error) {
 	validFileName, err := url.QueryUnescape(fileName)
 	if err != nil {
 		return validFileName, err
 	}
+	if err := awss3pkg.ValidateFileName(validFileName); err != nil {
+		return validFileName, err
+	}
 	return validFileName, nil
 }
 
-// UploadFile uploads the file to aws s3
+// UploadFile stores the metadata of the file, uploads it to aws s3 and returns the user with the file. The upload has to
+// fit in the storage limits of the user, which then uses the size of the file in fileInfo. The metadata is written first,
+// so an upload the write rejects never replaces the stored file, and it is put back when the upload fails.
 func (fm *FileManager) UploadFile(ctx context.Context, userID string, fileInfo fileModels.FileInfo, f io.Reader) (usrModels.UserDynamo, *commonModels.ErrorResponse) {
-	log.Printf("User ID %s", userID)
-	user := usrModels.UserDynamo{}
-
 	user, err := fm.UserSvc.GetAndValidateUser(ctx, userID)
 	if err != nil {
-		log.Printf("error occure %v   and   %v", user, err)
 		return user, err
 	}
-	log.Printf("no error %v   and   %v", user, err)
+	limits, err := fm.StorageSvc.CheckUpload(ctx, user, fileInfo.FileName, fileInfo.Size)
+	if err != nil {
+		return user, err
+	}
+
+	// a replaced file no longer uses storage
+	if err := fm.UserDBSvc.PutUserFileInDynamoDB(ctx, user, fileInfo, limits.StorageQuotaBytes); err != nil {
+		return user, userFileDBError(userID, fileInfo.FileName, err)
+	}
 	uploadErr := fm.AWSS3Svc.UploadAttachmentTOS3Bucket(ctx, userID, fileInfo.FileName, f)
 	if uploadErr != nil {
+		fm.revertFileMetadata(ctx, user, fileInfo)
 		return user, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error while uploading the file. %s", uploadErr.Error()),
 			ErrorStatusCode: http.StatusInternalServerError,
 		}
 	}
+	return fm.UserSvc.GetAndValidateUser(ctx, userID)
+}
 
-	userFileMap := make(map[string]fileModels.FileInfo)
-	if user.FileInfo == nil {
-		user.FileInfo = userFileMap
+// revertFileMetadata puts back the metadata the user, as read before the upload, had for the file whose upload failed.
+// The metadata is left when the file was written again meanwhile.
+func (fm *FileManager) revertFileMetadata(ctx context.Context, user usrModels.UserDynamo, fileInfo fileModels.FileInfo) {
+	stored, errResp := fm.UserSvc.GetAndValidateUser(ctx, user.UserID)
+	if errResp != nil {
+		log.Printf("Error reverting file %s of user %s after a failed upload. %s", fileInfo.FileName, user.UserID, errResp.Message)
+		return
 	}
-	//if _, ok := user.FileInfo[fileInfo.FileName]; ok {
-	user.FileInfo[fileInfo.FileName] = fileInfo
-	//} else {
-	//	user.FileInfo[fileInfo.FileName] = fileInfo
-	//}
-	return user, nil
+	var err error
+	if previous, ok := user.FileInfo[fileInfo.FileName]; ok {
+		// the old file is still in s3, the quota can't refuse its size back
+		err = fm.UserDBSvc.PutUserFileInDynamoDB(ctx, stored, previous, math.MaxInt64)
+	} else {
+		err = fm.UserDBSvc.DeleteUserFileInDynamoDB(ctx, stored, fileInfo.FileName)
+	}
+	if err != nil {
+		log.Printf("Error reverting file %s of user %s after a failed upload. %s", fileInfo.FileName, user.UserID, err.Error())
+	}
+}
+
+// MaxFileSize returns the largest file the user can upload
+func (fm *FileManager) MaxFileSize(ctx context.Context, userID string) (int64, *commonModels.ErrorResponse) {
+	usage, err := fm.StorageSvc.GetUsage(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return usage.MaxFileSizeBytes, nil
 }
 
 // DownloadFile returns the presigned URL for downloading the attachment
 func (fm *FileManager) DownloadFile(ctx context.Context, userID string, fileName string) (fileModels.DownloadFileInfo, *commonModels.ErrorResponse) {
 	downloadAttachmentInfo := fileModels.DownloadFileInfo{}
+	if err := invalidFileName(fileName); err != nil {
+		return downloadAttachmentInfo, err
+	}
 
 	user, err := fm.UserSvc.GetAndValidateUser(ctx, userID)
 	if err != nil {
@@ -168,7 +206,7 @@ func (fm *FileManager) UpdateFileAttachmentDescription(ctx context.Context, user
 	return user, nil
 }
 
-// UpdateUserFileDescription updates the user file description
+// UpdateUserFileDescription sets the description of files of the user and returns the updated user
 func (fm *FileManager) UpdateUserFileDescription(ctx context.Context, userID string, updateFiles []string, updateDescription fileModels.UpdateFileInfo) (usrModels.UserDynamo, *commonModels.ErrorResponse) {
 	user, err := fm.UserSvc.GetAndValidateUser(ctx, userID)
 	if err != nil {
@@ -195,14 +233,18 @@ func (fm *FileManager) UpdateUserFileDescription(ctx context.Context, userID str
 				ErrorStatusCode:      http.StatusBadRequest,
 			}
 		}
-		fileInfo.Description = updateDescription.Description
-		user.FileInfo[updateFileName] = fileInfo
 	}
-	return user, nil
+	if err := fm.UserDBSvc.UpdateUserFileDescriptionsInDynamoDB(ctx, user, uniqueFileNames(updateFiles), updateDescription.Description); err != nil {
+		return user, userFileDBError(userID, updateFileName, err)
+	}
+	return fm.UserSvc.GetAndValidateUser(ctx, userID)
 }
 
-// DeleteFile deletes the attachment in s3
+// DeleteFile deletes the attachment in s3 and returns the user without it
 func (fm *FileManager) DeleteFile(ctx context.Context, userID string, fileName string) (usrModels.UserDynamo, *commonModels.ErrorResponse) {
+	if err := invalidFileName(fileName); err != nil {
+		return usrModels.UserDynamo{}, err
+	}
 	userDB, err := fm.UserSvc.GetAndValidateUser(ctx, userID)
 	if err != nil {
 		return userDB, err
@@ -226,11 +268,66 @@ func (fm *FileManager) DeleteFile(ctx context.Context, userID string, fileName s
 			ErrorStatusCode: http.StatusInternalServerError,
 		}
 	}
-	userDB, err = fm.UserSvc.GetAndValidateUser(ctx, userID)
-	if err != nil {
-		return userDB, err
+	if err := fm.UserDBSvc.DeleteUserFileInDynamoDB(ctx, userDB, fileName); err != nil {
+		return userDB, userFileDBError(userID, fileName, err)
+	}
+	return fm.UserSvc.GetAndValidateUser(ctx, userID)
+}
+
+// invalidFileName rejects names that would address an object outside the folder of the user
+func invalidFileName(fileName string) *commonModels.ErrorResponse {
+	if err := awss3pkg.ValidateFileName(fileName); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid file name %q. %s", fileName, err.Error()),
+			RecommendationAction: []string{"Check the file name"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// uniqueFileNames drops repeated names, a file can only be updated once per write
+func uniqueFileNames(fileNames []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, fileName := range fileNames {
+		if !seen[fileName] {
+			seen[fileName] = true
+			unique = append(unique, fileName)
+		}
 	}
-	delete(userDB.FileInfo, fileName)
+	return unique
+}
 
-	return userDB, nil
+// userFileDBError reports a failed write of the file metadata of a user
+func userFileDBError(userID string, fileName string, err error) *commonModels.ErrorResponse {
+	switch err {
+	case database.ErrUserChanged:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("File %s of user %s was changed by another request", fileName, userID),
+			RecommendationAction: []string{"Get the user again and retry the request"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	case database.ErrStorageQuotaExceeded:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("File %s doesn't fit in the storage quota of user %s anymore", fileName, userID),
+			RecommendationAction: []string{"Delete files you no longer need", "Ask an administrator to raise your storage quota"},
+			ErrorStatusCode:      http.StatusRequestEntityTooLarge,
+		}
+	case database.ErrUserFileNotFound:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error file of user %s not found", userID),
+			RecommendationAction: []string{"Check for attachment name"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	case database.ErrUserNotFound:
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("User %s doesn't exist", userID),
+			ErrorStatusCode: http.StatusNotFound,
+		}
+	}
+	return &commonModels.ErrorResponse{
+		Message:         fmt.Sprintf("Error updating file %s of user %s. %s", fileName, userID, err.Error()),
+		ErrorStatusCode: http.StatusInternalServerError,
+	}
 }
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	usrModels "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	awss3pkg "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// memoryUserFiles keeps the files of a user with the conditions of the table: a write fails when the file isn't the one
+// that was read, or when an added size exceeds the quota. The other methods of the interfaces are not used.
+type memoryUserFiles struct {
+	database.UsersDynamoDBAPI
+	services.UserService
+	user usrModels.UserDynamo
+}
+
+func (mf *memoryUserFiles) GetAndValidateUser(ctx context.Context, userID string) (usrModels.UserDynamo, *commonModels.ErrorResponse) {
+	user := mf.user
+	user.FileInfo = map[string]fileModels.FileInfo{}
+	for fileName, fileInfo := range mf.user.FileInfo {
+		user.FileInfo[fileName] = fileInfo
+	}
+	return user, nil
+}
+
+func (mf *memoryUserFiles) PutUserFileInDynamoDB(ctx context.Context, user usrModels.UserDynamo, fileInfo fileModels.FileInfo, storageQuota int64) error {
+	previous, replaced := user.FileInfo[fileInfo.FileName]
+	stored, ok := mf.user.FileInfo[fileInfo.FileName]
+	if ok != replaced || stored != previous {
+		return database.ErrUserChanged
+	}
+	sizeChange := fileInfo.Size - previous.Size
+	if sizeChange > 0 && mf.user.StorageUsedBytes > storageQuota-sizeChange {
+		return database.ErrStorageQuotaExceeded
+	}
+	mf.user.FileInfo[fileInfo.FileName] = fileInfo
+	mf.user.StorageUsedBytes += sizeChange
+	return nil
+}
+
+func (mf *memoryUserFiles) DeleteUserFileInDynamoDB(ctx context.Context, user usrModels.UserDynamo, fileName string) error {
+	stored, ok := mf.user.FileInfo[fileName]
+	if !ok || stored != user.FileInfo[fileName] {
+		return database.ErrUserChanged
+	}
+	delete(mf.user.FileInfo, fileName)
+	mf.user.StorageUsedBytes -= stored.Size
+	return nil
+}
+
+// fixedLimits lets every upload through, leaving the quota to the write
+type fixedLimits struct {
+	services.StorageService
+	limits usrModels.StorageLimits
+}
+
+func (fl *fixedLimits) CheckUpload(ctx context.Context, user usrModels.UserDynamo, fileName string, size int64) (usrModels.StorageLimits, *commonModels.ErrorResponse) {
+	return fl.limits, nil
+}
+
+type memoryS3 struct {
+	awss3pkg.IfAWSS3
+	objects map[string]string
+	err     error
+}
+
+func (ms *memoryS3) UploadAttachmentTOS3Bucket(ctx context.Context, userID string, filename string, filereader io.Reader) error {
+	if ms.err != nil {
+		return ms.err
+	}
+	content, err := ioutil.ReadAll(filereader)
+	if err != nil {
+		return err
+	}
+	ms.objects[userID+"/"+filename] = string(content)
+	return nil
+}
+
+func newUploadTest(files map[string]fileModels.FileInfo, quota int64) (*FileManager, *memoryUserFiles, *memoryS3) {
+	userFiles := &memoryUserFiles{user: usrModels.UserDynamo{User: usrModels.User{UserID: "user-1", FileInfo: files}}}
+	for _, fileInfo := range files {
+		userFiles.user.StorageUsedBytes += fileInfo.Size
+	}
+	objects := &memoryS3{objects: map[string]string{}}
+	for fileName := range files {
+		objects.objects["user-1/"+fileName] = "old"
+	}
+	limits := &fixedLimits{limits: usrModels.StorageLimits{StorageQuotaBytes: quota, MaxFileSizeBytes: quota}}
+	return &FileManager{UserSvc: userFiles, UserDBSvc: userFiles, AWSS3Svc: objects, StorageSvc: limits}, userFiles, objects
+}
+
+func TestUploadFileStoresMetadataBeforeContent(t *testing.T) {
+	ctx := context.Background()
+	old := fileModels.FileInfo{FileName: "a.txt", Size: 3, UpdatedAt: "1"}
+	upload := fileModels.FileInfo{FileName: "a.txt", Size: 5, UpdatedAt: "2"}
+
+	// a write refused for the quota leaves the stored file as it is
+	fm, userFiles, objects := newUploadTest(map[string]fileModels.FileInfo{"a.txt": old}, 4)
+	if _, errResp := fm.UploadFile(ctx, "user-1", upload, strings.NewReader("large")); errResp == nil || errResp.ErrorStatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over quota got %+v, want 413", errResp)
+	}
+	if objects.objects["user-1/a.txt"] != "old" || userFiles.user.FileInfo["a.txt"] != old {
+		t.Errorf("upload over quota replaced the file")
+	}
+
+	// a failed upload puts the metadata of the replaced file back
+	fm, userFiles, objects = newUploadTest(map[string]fileModels.FileInfo{"a.txt": old}, 10)
+	objects.err = errors.New("s3 unavailable")
+	if _, errResp := fm.UploadFile(ctx, "user-1", upload, strings.NewReader("large")); errResp == nil || errResp.ErrorStatusCode != http.StatusInternalServerError {
+		t.Fatalf("failed upload got %+v, want 500", errResp)
+	}
+	if userFiles.user.FileInfo["a.txt"] != old || userFiles.user.StorageUsedBytes != old.Size {
+		t.Errorf("failed upload left %+v using %d bytes, want %+v", userFiles.user.FileInfo["a.txt"], userFiles.user.StorageUsedBytes, old)
+	}
+
+	// and removes the metadata of a new file
+	fm, userFiles, objects = newUploadTest(map[string]fileModels.FileInfo{}, 10)
+	objects.err = errors.New("s3 unavailable")
+	if _, errResp := fm.UploadFile(ctx, "user-1", upload, strings.NewReader("large")); errResp == nil {
+		t.Fatal("failed upload succeeded")
+	}
+	if len(userFiles.user.FileInfo) != 0 || userFiles.user.StorageUsedBytes != 0 {
+		t.Errorf("failed upload left files %v using %d bytes", userFiles.user.FileInfo, userFiles.user.StorageUsedBytes)
+	}
+
+	fm, userFiles, objects = newUploadTest(map[string]fileModels.FileInfo{"a.txt": old}, 10)
+	user, errResp := fm.UploadFile(ctx, "user-1", upload, strings.NewReader("large"))
+	if errResp != nil {
+		t.Fatalf("UploadFile: %s", errResp.Message)
+	}
+	if user.FileInfo["a.txt"] != upload || objects.objects["user-1/a.txt"] != "large" || userFiles.user.StorageUsedBytes != upload.Size {
+		t.Errorf("upload stored %+v with %q using %d bytes", user.FileInfo["a.txt"], objects.objects["user-1/a.txt"], userFiles.user.StorageUsedBytes)
+	}
+}
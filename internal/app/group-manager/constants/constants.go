@@ -0,0 +1,15 @@
+package constants
+
+const (
+	// GroupIDKey is the route parameter of the group ID
+	GroupIDKey = "group_id"
+	// MemberIDKey is the route parameter of the user ID of a group member
+	MemberIDKey = "member_id"
+
+	// RoleAdmin members manage the members of the group, RoleMember members share its files
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+
+	// MaxFileSizeBytes is the largest file that can be uploaded to a group
+	MaxFileSizeBytes = 10 << 20
+)
@@ -0,0 +1,151 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	fileConsts "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// UploadFile uploads a file to the group
+func (gr *GroupsRouter) UploadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	fileHeader, err := c.FormFile(fileConsts.FileKey)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to get form data from key file. Error: %v", err),
+			ErrorStatusCode: http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	if fileHeader.Size > constants.MaxFileSizeBytes {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("File size (%d bytes) greater than %d MB", fileHeader.Size, constants.MaxFileSizeBytes>>20),
+			RecommendationAction: []string{fmt.Sprintf("File size should be lesser than %d MB", constants.MaxFileSizeBytes>>20)},
+			ErrorStatusCode:      http.StatusRequestEntityTooLarge,
+		}
+		c.JSON(http.StatusRequestEntityTooLarge, errRes)
+		return
+	}
+	fileName, err := gr.FileService.CheckValidFileName(ctx, fileHeader.Filename)
+	if err != nil || fileName == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Please check the File name. Error: %v", err),
+			RecommendationAction: []string{"Please provide file name in alphanumeric format"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to open the file. Error: %v", err),
+			ErrorStatusCode: http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	defer f.Close()
+
+	createdAt := time.Now().Format(time.RFC3339)
+	fileInfo := fileModels.FileInfo{FileName: fileName, UpdatedAt: createdAt, CreatedAt: createdAt}
+	group, errResp := gr.GroupFileService.UploadFile(ctx, claims.Subject, groupID, fileInfo, f)
+	if errResp != nil {
+		respondError(c, fmt.Sprintf("Failed to upload file %s to group %s", fileName, groupID), errResp)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// DownloadFile returns a presigned URL to download a file of the group
+func (gr *GroupsRouter) DownloadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	fileName, ok := queryFileName(c, "download file")
+	if !ok {
+		return
+	}
+
+	presignedURL, errResp := gr.GroupFileService.DownloadFile(ctx, claims.Subject, groupID, fileName)
+	if errResp != nil {
+		respondError(c, "unable to download the file", errResp)
+		return
+	}
+	c.JSON(http.StatusOK, presignedURL)
+}
+
+// DeleteFile deletes a file of the group
+func (gr *GroupsRouter) DeleteFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	fileName, ok := queryFileName(c, "delete file")
+	if !ok {
+		return
+	}
+
+	group, errResp := gr.GroupFileService.DeleteFile(ctx, claims.Subject, groupID, fileName)
+	if errResp != nil {
+		respondError(c, fmt.Sprintf("unable to delete the file %s", fileName), errResp)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateFileDescription updates the description of a file of the group
+func (gr *GroupsRouter) UpdateFileDescription(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	fileName, ok := queryFileName(c, "update file description")
+	if !ok {
+		return
+	}
+	var updateDescription fileModels.UpdateFileInfo
+	if err := c.BindJSON(&updateDescription); err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid request body. Error: %s", err.Error()),
+			RecommendationAction: []string{"Check file description update request body"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	if checkResp := gr.FileService.CheckValidDescription(ctx, updateDescription.Description); checkResp != nil {
+		c.JSON(checkResp.ErrorStatusCode, checkResp)
+		return
+	}
+
+	group, errResp := gr.GroupFileService.UpdateFileDescription(ctx, claims.Subject, groupID, fileName, updateDescription.Description)
+	if errResp != nil {
+		respondError(c, "unable to update the file description", errResp)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// queryFileName reads the file query parameter, a missing name is answered with 400
+func queryFileName(c *gin.Context, action string) (string, bool) {
+	fileName := c.Query(fileConsts.FileKey)
+	if fileName == "" {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to %s of group %s. Expected file name in query.", action, c.Param(constants.GroupIDKey)),
+			ErrorStatusCode: http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return "", false
+	}
+	return fileName, true
+}
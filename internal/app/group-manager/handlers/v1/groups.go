@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	fileSvc "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// GroupsRouter holds the dependencies for groups router
+type GroupsRouter struct {
+	GroupService     services.GroupService
+	GroupFileService services.GroupFileService
+	FileService      fileSvc.FileService
+}
+
+// CreateGroupRouter return a routing object
+func CreateGroupRouter(
+	groupService services.GroupService,
+	groupFileService services.GroupFileService,
+	fileService fileSvc.FileService,
+) *GroupsRouter {
+	return &GroupsRouter{
+		GroupService:     groupService,
+		GroupFileService: groupFileService,
+		FileService:      fileService,
+	}
+}
+
+// CreateGroup creates a group with the caller as its admin
+func (gr *GroupsRouter) CreateGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	var groupInput models.GroupInput
+	err := c.BindJSON(&groupInput)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the group name and optionally a description"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	group, errResp := gr.GroupService.CreateGroup(ctx, claims.Subject, groupInput)
+	if errResp != nil {
+		respondError(c, "Failed to create group", errResp)
+		return
+	}
+	c.JSON(http.StatusCreated, group)
+}
+
+// GetGroups lists the groups of the caller
+func (gr *GroupsRouter) GetGroups(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+
+	groups, errResp := gr.GroupService.GetGroups(ctx, claims.Subject)
+	if errResp != nil {
+		respondError(c, "Failed to get groups", errResp)
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// GetGroup returns a group of the caller with its members and files
+func (gr *GroupsRouter) GetGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+
+	group, errResp := gr.GroupService.GetGroup(ctx, claims.Subject, groupID)
+	if errResp != nil {
+		respondError(c, "Failed to get group", errResp)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup deletes a group with its files
+func (gr *GroupsRouter) DeleteGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+
+	errResp := gr.GroupService.DeleteGroup(ctx, claims.Subject, groupID)
+	if errResp != nil {
+		respondError(c, "Failed to delete group", errResp)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetMember adds a user to the group or changes its role
+func (gr *GroupsRouter) SetMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	memberID := c.Param(constants.MemberIDKey)
+	var memberInput models.GroupMemberInput
+	// the body is optional, members are added with the member role
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&memberInput); err != nil {
+			errRes := errModels.ErrorResponse{
+				Message:              "Invalid request body",
+				RecommendationAction: []string{fmt.Sprintf("Send the role %s or %s", constants.RoleMember, constants.RoleAdmin)},
+				ErrorStatusCode:      http.StatusBadRequest,
+			}
+			c.JSON(http.StatusBadRequest, errRes)
+			return
+		}
+	}
+
+	member, errResp := gr.GroupService.SetMember(ctx, claims.Subject, groupID, memberID, memberInput)
+	if errResp != nil {
+		respondError(c, "Failed to set group member", errResp)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember removes a user from the group, members can remove themselves to leave it
+func (gr *GroupsRouter) RemoveMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	groupID := c.Param(constants.GroupIDKey)
+	memberID := c.Param(constants.MemberIDKey)
+
+	errResp := gr.GroupService.RemoveMember(ctx, claims.Subject, groupID, memberID)
+	if errResp != nil {
+		respondError(c, "Failed to remove group member", errResp)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondError(c *gin.Context, message string, errResp *errModels.ErrorResponse) {
+	errRes := errModels.ErrorResponse{
+		Message:              fmt.Sprintf("%s. %s", message, errResp.Message),
+		RecommendationAction: errResp.RecommendationAction,
+		ErrorStatusCode:      errResp.ErrorStatusCode,
+	}
+	c.JSON(errResp.ErrorStatusCode, errRes)
+}
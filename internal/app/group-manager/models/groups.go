@@ -0,0 +1,71 @@
+package models
+
+import (
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	userModels "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// GroupDynamo is the item stored for a group, the files shared in the group are kept on it like on a user.
+// MembersVersion counts the writes of members, a member write based on an older read of them is rejected.
+type GroupDynamo struct {
+	userModels.DynamoKeys
+	GroupID        string
+	Name           string
+	Description    string
+	CreatedBy      string
+	CreatedAt      int64
+	FileInfo       map[string]fileModels.FileInfo
+	MembersVersion int64
+}
+
+// GroupMemberDynamo is stored twice for every member, under the group to list its members
+// and under the user to list its groups
+type GroupMemberDynamo struct {
+	userModels.DynamoKeys
+	GroupID   string
+	GroupName string
+	UserID    string
+	Role      string
+	AddedAt   int64
+}
+
+// Group describes a group to its members
+type Group struct {
+	GroupID     string                         `json:"groupID"`
+	Name        string                         `json:"name"`
+	Description string                         `json:"description"`
+	CreatedBy   string                         `json:"createdBy"`
+	CreatedAt   int64                          `json:"createdAt"`
+	Members     []GroupMember                  `json:"members"`
+	Files       map[string]fileModels.FileInfo `json:"files"`
+}
+
+// GroupMember is a member of a group with its role
+type GroupMember struct {
+	UserID  string `json:"userID"`
+	Role    string `json:"role"`
+	AddedAt int64  `json:"addedAt"`
+}
+
+// GroupMembership is a group the user is a member of
+type GroupMembership struct {
+	GroupID   string `json:"groupID"`
+	GroupName string `json:"groupName"`
+	Role      string `json:"role"`
+}
+
+// GroupMemberships lists the groups of a user
+type GroupMemberships struct {
+	Members []GroupMembership `json:"members"`
+}
+
+// GroupInput is the request body for creating a group
+type GroupInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GroupMemberInput is the request body for adding a member or changing its role, the role defaults to member
+type GroupMemberInput struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/models"
+	awss3pkg "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// GroupFileService - holds the functions used to manage the files shared in a group, every member can use them
+type GroupFileService interface {
+	UploadFile(ctx context.Context, callerID string, groupID string, fileInfo fileModels.FileInfo, filereader io.Reader) (models.Group, *commonModels.ErrorResponse)
+	DownloadFile(ctx context.Context, callerID string, groupID string, fileName string) (fileModels.DownloadFileInfo, *commonModels.ErrorResponse)
+	DeleteFile(ctx context.Context, callerID string, groupID string, fileName string) (models.Group, *commonModels.ErrorResponse)
+	UpdateFileDescription(ctx context.Context, callerID string, groupID string, fileName string, description string) (models.Group, *commonModels.ErrorResponse)
+}
+
+// GroupFileManager implements GroupFileService
+type GroupFileManager struct {
+	GroupDBSvc database.GroupsDynamoDBAPI
+	GroupSvc   GroupService
+	AWSS3Svc   awss3pkg.IfAWSS3
+}
+
+// NewGroupFileService creates an instance of Group File Service
+func NewGroupFileService(groupDBSvc database.GroupsDynamoDBAPI, groupService GroupService, awsS3Service awss3pkg.IfAWSS3) GroupFileService {
+	return &GroupFileManager{
+		GroupDBSvc: groupDBSvc,
+		GroupSvc:   groupService,
+		AWSS3Svc:   awsS3Service,
+	}
+}
+
+// UploadFile uploads the file to the folder of the group, a file with the same name is replaced
+func (gfm *GroupFileManager) UploadFile(ctx context.Context, callerID string, groupID string, fileInfo fileModels.FileInfo,
+	f io.Reader) (models.Group, *commonModels.ErrorResponse) {
+	if errResp := invalidFileName(fileInfo.FileName); errResp != nil {
+		return models.Group{}, errResp
+	}
+	group, errResp := gfm.GroupSvc.CheckAccess(ctx, callerID, groupID, constants.RoleMember)
+	if errResp != nil {
+		return models.Group{}, errResp
+	}
+	if err := gfm.AWSS3Svc.UploadAttachmentTOS3Bucket(ctx, awss3pkg.GroupFolder(groupID), fileInfo.FileName, f); err != nil {
+		return models.Group{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error while uploading the file. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	// a replaced file keeps its description and creation time
+	if existing, ok := group.FileInfo[fileInfo.FileName]; ok {
+		fileInfo.CreatedAt = existing.CreatedAt
+		fileInfo.Description = existing.Description
+	}
+	if err := gfm.GroupDBSvc.PutGroupFileInDynamoDB(ctx, groupID, fileInfo); err != nil {
+		return models.Group{}, groupDBError(groupID, err)
+	}
+	log.Printf("User %s uploaded file %s to group %s", callerID, fileInfo.FileName, groupID)
+	return gfm.GroupSvc.GetGroup(ctx, callerID, groupID)
+}
+
+// DownloadFile returns the presigned URL for downloading a file of the group
+func (gfm *GroupFileManager) DownloadFile(ctx context.Context, callerID string, groupID string, fileName string) (fileModels.DownloadFileInfo, *commonModels.ErrorResponse) {
+	if errResp := invalidFileName(fileName); errResp != nil {
+		return fileModels.DownloadFileInfo{}, errResp
+	}
+	group, errResp := gfm.GroupSvc.CheckAccess(ctx, callerID, groupID, constants.RoleMember)
+	if errResp != nil {
+		return fileModels.DownloadFileInfo{}, errResp
+	}
+	if _, ok := group.FileInfo[fileName]; !ok {
+		return fileModels.DownloadFileInfo{}, groupDBError(groupID, database.ErrGroupFileNotFound)
+	}
+	downloadInfo, err := gfm.AWSS3Svc.GenerateS3PresignedURL(ctx, awss3pkg.GroupFolder(groupID), fileName)
+	if err != nil {
+		return downloadInfo, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error while getting presigned URL for the file %s. Error: %s", fileName, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return downloadInfo, nil
+}
+
+// DeleteFile deletes a file of the group
+func (gfm *GroupFileManager) DeleteFile(ctx context.Context, callerID string, groupID string, fileName string) (models.Group, *commonModels.ErrorResponse) {
+	if errResp := invalidFileName(fileName); errResp != nil {
+		return models.Group{}, errResp
+	}
+	group, errResp := gfm.GroupSvc.CheckAccess(ctx, callerID, groupID, constants.RoleMember)
+	if errResp != nil {
+		return models.Group{}, errResp
+	}
+	if _, ok := group.FileInfo[fileName]; !ok {
+		return models.Group{}, groupDBError(groupID, database.ErrGroupFileNotFound)
+	}
+	if err := gfm.AWSS3Svc.DeleteFileInS3(ctx, awss3pkg.GroupFolder(groupID), fileName); err != nil {
+		return models.Group{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error while deleting file %s in S3. Error: %s", fileName, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if err := gfm.GroupDBSvc.DeleteGroupFileInDynamoDB(ctx, groupID, fileName); err != nil {
+		return models.Group{}, groupDBError(groupID, err)
+	}
+	log.Printf("User %s deleted file %s of group %s", callerID, fileName, groupID)
+	return gfm.GroupSvc.GetGroup(ctx, callerID, groupID)
+}
+
+// UpdateFileDescription sets the description of a file of the group
+func (gfm *GroupFileManager) UpdateFileDescription(ctx context.Context, callerID string, groupID string, fileName string,
+	description string) (models.Group, *commonModels.ErrorResponse) {
+	if _, errResp := gfm.GroupSvc.CheckAccess(ctx, callerID, groupID, constants.RoleMember); errResp != nil {
+		return models.Group{}, errResp
+	}
+	updatedAt := time.Now().Format(time.RFC3339)
+	if err := gfm.GroupDBSvc.UpdateGroupFileDescriptionInDynamoDB(ctx, groupID, fileName, description, updatedAt); err != nil {
+		return models.Group{}, groupDBError(groupID, err)
+	}
+	return gfm.GroupSvc.GetGroup(ctx, callerID, groupID)
+}
+
+// invalidFileName rejects names that would address an object outside the folder of the group
+func invalidFileName(fileName string) *commonModels.ErrorResponse {
+	if err := awss3pkg.ValidateFileName(fileName); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid file name %q. %s", fileName, err.Error()),
+			RecommendationAction: []string{"Check the file name"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/models"
+	usrSvc "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	awss3pkg "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	maxGroupNameLength        = 100
+	maxGroupDescriptionLength = 400
+)
+
+// GroupService - holds the functions used to manage groups and their members.
+// Site admins can act as an admin of every group.
+type GroupService interface {
+	CreateGroup(ctx context.Context, callerID string, input models.GroupInput) (models.Group, *commonModels.ErrorResponse)
+	GetGroups(ctx context.Context, callerID string) (models.GroupMemberships, *commonModels.ErrorResponse)
+	GetGroup(ctx context.Context, callerID string, groupID string) (models.Group, *commonModels.ErrorResponse)
+	DeleteGroup(ctx context.Context, callerID string, groupID string) *commonModels.ErrorResponse
+	SetMember(ctx context.Context, callerID string, groupID string, memberID string, input models.GroupMemberInput) (models.GroupMember, *commonModels.ErrorResponse)
+	RemoveMember(ctx context.Context, callerID string, groupID string, memberID string) *commonModels.ErrorResponse
+	CheckAccess(ctx context.Context, callerID string, groupID string, role string) (models.GroupDynamo, *commonModels.ErrorResponse)
+}
+
+// GroupManager implements GroupService
+type GroupManager struct {
+	GroupDBSvc database.GroupsDynamoDBAPI
+	UserSvc    usrSvc.UserService
+	AWSS3Svc   awss3pkg.IfAWSS3
+}
+
+// NewGroupService creates an instance of Group Service
+func NewGroupService(groupDBSvc database.GroupsDynamoDBAPI, userService usrSvc.UserService, awsS3Service awss3pkg.IfAWSS3) GroupService {
+	return &GroupManager{
+		GroupDBSvc: groupDBSvc,
+		UserSvc:    userService,
+		AWSS3Svc:   awsS3Service,
+	}
+}
+
+// CreateGroup creates a group with the caller as its admin
+func (gm *GroupManager) CreateGroup(ctx context.Context, callerID string, input models.GroupInput) (models.Group, *commonModels.ErrorResponse) {
+	name, description, errResp := validateGroupInput(input)
+	if errResp != nil {
+		return models.Group{}, errResp
+	}
+	now := time.Now().Unix()
+	group := models.GroupDynamo{
+		GroupID:     utils.GenerateUUID(),
+		Name:        name,
+		Description: description,
+		CreatedBy:   callerID,
+		CreatedAt:   now,
+		FileInfo:    map[string]fileModels.FileInfo{},
+	}
+	creator := models.GroupMemberDynamo{
+		GroupID:   group.GroupID,
+		GroupName: group.Name,
+		UserID:    callerID,
+		Role:      constants.RoleAdmin,
+		AddedAt:   now,
+	}
+	if err := gm.GroupDBSvc.CreateGroupInDynamoDB(ctx, group, creator); err != nil {
+		return models.Group{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error creating group. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	log.Printf("User %s created group %s", callerID, group.GroupID)
+	return groupView(group, []models.GroupMemberDynamo{creator}), nil
+}
+
+// GetGroups lists the groups the caller is a member of
+func (gm *GroupManager) GetGroups(ctx context.Context, callerID string) (models.GroupMemberships, *commonModels.ErrorResponse) {
+	memberships := models.GroupMemberships{Members: []models.GroupMembership{}}
+	items, err := gm.GroupDBSvc.GetUserGroupsInDynamoDB(ctx, callerID)
+	if err != nil {
+		return memberships, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting groups. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	for _, item := range items {
+		memberships.Members = append(memberships.Members, models.GroupMembership{
+			GroupID:   item.GroupID,
+			GroupName: item.GroupName,
+			Role:      item.Role,
+		})
+	}
+	return memberships, nil
+}
+
+// GetGroup returns the group with its members and files
+func (gm *GroupManager) GetGroup(ctx context.Context, callerID string, groupID string) (models.Group, *commonModels.ErrorResponse) {
+	group, errResp := gm.CheckAccess(ctx, callerID, groupID, constants.RoleMember)
+	if errResp != nil {
+		return models.Group{}, errResp
+	}
+	members, errResp := gm.getMembers(ctx, groupID)
+	if errResp != nil {
+		return models.Group{}, errResp
+	}
+	return groupView(group, members), nil
+}
+
+// DeleteGroup deletes the files, members and item of the group
+func (gm *GroupManager) DeleteGroup(ctx context.Context, callerID string, groupID string) *commonModels.ErrorResponse {
+	if _, errResp := gm.CheckAccess(ctx, callerID, groupID, constants.RoleAdmin); errResp != nil {
+		return errResp
+	}
+	// the files go first, a failure leaves the group in place to retry
+	deletedFiles, err := gm.AWSS3Svc.DeleteUserFolderInS3(ctx, awss3pkg.GroupFolder(groupID))
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error deleting files of group %s. %s", groupID, err.Error()),
+			RecommendationAction: []string{"Delete the group again"},
+			ErrorStatusCode:      http.StatusInternalServerError,
+		}
+	}
+	deletedItems, err := gm.GroupDBSvc.DeleteGroupInDynamoDB(ctx, groupID)
+	if err != nil && err != database.ErrGroupNotFound {
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error deleting group %s. %s", groupID, err.Error()),
+			RecommendationAction: []string{"Delete the group again"},
+			ErrorStatusCode:      http.StatusInternalServerError,
+		}
+	}
+	log.Printf("User %s deleted group %s with %d files and %d items", callerID, groupID, deletedFiles, deletedItems)
+	return nil
+}
+
+// SetMember adds the user to the group or changes its role, only group admins can manage members
+func (gm *GroupManager) SetMember(ctx context.Context, callerID string, groupID string, memberID string,
+	input models.GroupMemberInput) (models.GroupMember, *commonModels.ErrorResponse) {
+	role := input.Role
+	if role == "" {
+		role = constants.RoleMember
+	}
+	if role != constants.RoleMember && role != constants.RoleAdmin {
+		return models.GroupMember{}, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid role %q", input.Role),
+			RecommendationAction: []string{fmt.Sprintf("Send the role %s or %s", constants.RoleMember, constants.RoleAdmin)},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	group, errResp := gm.CheckAccess(ctx, callerID, groupID, constants.RoleAdmin)
+	if errResp != nil {
+		return models.GroupMember{}, errResp
+	}
+	if _, errResp := gm.UserSvc.GetAndValidateUser(ctx, memberID); errResp != nil {
+		if errResp.ErrorStatusCode == http.StatusBadRequest {
+			errResp = &commonModels.ErrorResponse{
+				Message:              fmt.Sprintf("User %s doesn't exist", memberID),
+				RecommendationAction: []string{"Check the user ID"},
+				ErrorStatusCode:      http.StatusNotFound,
+			}
+		}
+		return models.GroupMember{}, errResp
+	}
+
+	member := models.GroupMemberDynamo{
+		GroupID:   groupID,
+		GroupName: group.Name,
+		UserID:    memberID,
+		Role:      role,
+		AddedAt:   time.Now().Unix(),
+	}
+	existing, err := gm.GroupDBSvc.GetGroupMemberInDynamoDB(ctx, groupID, memberID)
+	switch {
+	case err == nil:
+		if existing.Role == constants.RoleAdmin && role != constants.RoleAdmin {
+			if errResp := gm.ensureNotLastGroupAdmin(ctx, groupID); errResp != nil {
+				return memberView(existing), errResp
+			}
+		}
+		member.AddedAt = existing.AddedAt
+	case err != database.ErrGroupMemberNotFound:
+		return models.GroupMember{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting group member. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	// the write fails when the members changed since the group was read, so the admin check above still holds
+	if err := gm.GroupDBSvc.PutGroupMemberInDynamoDB(ctx, member, group.MembersVersion); err != nil {
+		return models.GroupMember{}, groupDBError(groupID, err)
+	}
+	log.Printf("User %s set role of user %s in group %s to %s", callerID, memberID, groupID, role)
+	return memberView(member), nil
+}
+
+// RemoveMember removes the user from the group. Group admins can remove anyone, members can leave the group.
+func (gm *GroupManager) RemoveMember(ctx context.Context, callerID string, groupID string, memberID string) *commonModels.ErrorResponse {
+	role := constants.RoleAdmin
+	if memberID == callerID {
+		role = constants.RoleMember
+	}
+	group, errResp := gm.CheckAccess(ctx, callerID, groupID, role)
+	if errResp != nil {
+		return errResp
+	}
+	member, err := gm.GroupDBSvc.GetGroupMemberInDynamoDB(ctx, groupID, memberID)
+	if err != nil {
+		return groupDBError(groupID, err)
+	}
+	if member.Role == constants.RoleAdmin {
+		if errResp := gm.ensureNotLastGroupAdmin(ctx, groupID); errResp != nil {
+			return errResp
+		}
+	}
+	if err := gm.GroupDBSvc.DeleteGroupMemberInDynamoDB(ctx, groupID, memberID, group.MembersVersion); err != nil {
+		return groupDBError(groupID, err)
+	}
+	log.Printf("User %s removed user %s from group %s", callerID, memberID, groupID)
+	return nil
+}
+
+// CheckAccess returns the group when the caller has the role in it, admins of the group have every role.
+// Groups the caller isn't a member of are reported as not found, so their IDs can't be probed.
+func (gm *GroupManager) CheckAccess(ctx context.Context, callerID string, groupID string, role string) (models.GroupDynamo, *commonModels.ErrorResponse) {
+	group, err := gm.GroupDBSvc.GetGroupInDynamoDB(ctx, groupID)
+	if err != nil {
+		return group, groupDBError(groupID, err)
+	}
+	member, err := gm.GroupDBSvc.GetGroupMemberInDynamoDB(ctx, groupID, callerID)
+	if err != nil && err != database.ErrGroupMemberNotFound {
+		return group, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting group member. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	isMember := err == nil
+	if isMember && (role == constants.RoleMember || member.Role == constants.RoleAdmin) {
+		return group, nil
+	}
+	principal, errResp := gm.UserSvc.LoadPrincipal(ctx, callerID)
+	if errResp != nil {
+		return group, errResp
+	}
+	if principal.IsAdmin {
+		return group, nil
+	}
+	if !isMember {
+		return group, groupDBError(groupID, database.ErrGroupNotFound)
+	}
+	return group, &commonModels.ErrorResponse{
+		Message:              fmt.Sprintf("Only admins of group %s can do this", groupID),
+		RecommendationAction: []string{"Ask an admin of the group"},
+		ErrorStatusCode:      http.StatusForbidden,
+	}
+}
+
+func (gm *GroupManager) getMembers(ctx context.Context, groupID string) ([]models.GroupMemberDynamo, *commonModels.ErrorResponse) {
+	members, err := gm.GroupDBSvc.GetGroupMembersInDynamoDB(ctx, groupID)
+	if err != nil {
+		return members, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting members of group %s. %s", groupID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return members, nil
+}
+
+// ensureNotLastGroupAdmin rejects demoting or removing an admin of the group when no other admin is left.
+// The members are read after the group, the member write is then guarded by the members version of that read.
+func (gm *GroupManager) ensureNotLastGroupAdmin(ctx context.Context, groupID string) *commonModels.ErrorResponse {
+	members, errResp := gm.getMembers(ctx, groupID)
+	if errResp != nil {
+		return errResp
+	}
+	admins := 0
+	for _, member := range members {
+		if member.Role == constants.RoleAdmin {
+			admins++
+		}
+	}
+	if admins <= 1 {
+		return &commonModels.ErrorResponse{
+			Message:              "The last admin of a group can't be demoted or removed",
+			RecommendationAction: []string{"Make another member an admin of the group first, or delete the group"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	return nil
+}
+
+// groupDBError maps the not found errors of the group database to 404
+func groupDBError(groupID string, err error) *commonModels.ErrorResponse {
+	switch err {
+	case database.ErrGroupNotFound:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Group %s not found", groupID),
+			RecommendationAction: []string{"Check the group ID"},
+			ErrorStatusCode:      http.StatusNotFound,
+		}
+	case database.ErrGroupMemberNotFound:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("User is not a member of group %s", groupID),
+			RecommendationAction: []string{"Check the member ID"},
+			ErrorStatusCode:      http.StatusNotFound,
+		}
+	case database.ErrGroupChanged:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Members of group %s were changed by another request", groupID),
+			RecommendationAction: []string{"Get the group again and retry the request"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	case database.ErrGroupFileNotFound:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("File not found in group %s", groupID),
+			RecommendationAction: []string{"Check the file name"},
+			ErrorStatusCode:      http.StatusNotFound,
+		}
+	}
+	return &commonModels.ErrorResponse{
+		Message:         fmt.Sprintf("Error updating group %s. %s", groupID, err.Error()),
+		ErrorStatusCode: http.StatusInternalServerError,
+	}
+}
+
+func validateGroupInput(input models.GroupInput) (string, string, *commonModels.ErrorResponse) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+		return name, input.Description, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Group name must have 1 to %d characters", maxGroupNameLength),
+			RecommendationAction: []string{"Check the group name"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	description := strings.TrimSpace(input.Description)
+	if utf8.RuneCountInString(description) > maxGroupDescriptionLength {
+		return name, description, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Group description must have at most %d characters", maxGroupDescriptionLength),
+			RecommendationAction: []string{"Shorten the group description"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return name, description, nil
+}
+
+func groupView(group models.GroupDynamo, members []models.GroupMemberDynamo) models.Group {
+	view := models.Group{
+		GroupID:     group.GroupID,
+		Name:        group.Name,
+		Description: group.Description,
+		CreatedBy:   group.CreatedBy,
+		CreatedAt:   group.CreatedAt,
+		Members:     []models.GroupMember{},
+		Files:       group.FileInfo,
+	}
+	if view.Files == nil {
+		view.Files = map[string]fileModels.FileInfo{}
+	}
+	for _, member := range members {
+		view.Members = append(view.Members, memberView(member))
+	}
+	sort.Slice(view.Members, func(i, j int) bool {
+		return view.Members[i].AddedAt < view.Members[j].AddedAt
+	})
+	return view
+}
+
+func memberView(member models.GroupMemberDynamo) models.GroupMember {
+	return models.GroupMember{
+		UserID:  member.UserID,
+		Role:    member.Role,
+		AddedAt: member.AddedAt,
+	}
+}
@@ -9,4 +9,65 @@ const (
 	TypeUsersForSortKey = "user"
 	// UsersTableName is the table for Users
 	UsersTableName = "Users"
+	// UsersTableSortKeyIndex is the global secondary index of the table keyed by the sort key, it lists the items of a type
+	UsersTableSortKeyIndex = "SKeyIndex"
+	// UsersTableTTLAttribute is the attribute holding the expiry epoch of short lived items
+	UsersTableTTLAttribute = "ExpiresAt"
+	// SortKeySeparator separates the item type from its ID in sort keys
+	SortKeySeparator = "#"
+	// TypeRevokedSessionForSortKey is the sort key prefix of revoked session items
+	TypeRevokedSessionForSortKey = "revoked_session"
+	// AllSessionsID is the session ID used to revoke every session of a user
+	AllSessionsID = "all"
+	// TypePasswordResetForSortKey is the sort key value of password reset token items
+	TypePasswordResetForSortKey = "password_reset"
+	// TypeEmailVerificationForSortKey is the sort key value of email verification token items
+	TypeEmailVerificationForSortKey = "email_verification"
+	// TypeInvitationForSortKey is the sort key value of the tokens inviting imported users to set a password
+	TypeInvitationForSortKey = "invitation"
+	// TypeLoginAttemptsForSortKey is the sort key value of failed login tracking items
+	TypeLoginAttemptsForSortKey = "login_attempts"
+	// LoginSubjectAccount marks login attempts tracked per email address
+	LoginSubjectAccount = "account"
+	// LoginSubjectIP marks login attempts tracked per client IP
+	LoginSubjectIP = "ip"
+	// TypeTwoFactorForSortKey is the sort key value of the TOTP enrollment item of a user
+	TypeTwoFactorForSortKey = "totp"
+	// TypeAPITokenForSortKey is the sort key prefix of personal API token items
+	TypeAPITokenForSortKey = "api_token"
+	// TypeOIDCStateForSortKey is the sort key value of pending single sign-on logins
+	TypeOIDCStateForSortKey = "oidc_state"
+	// TypeOIDCIdentityForSortKey is the sort key value of items linking an identity provider account to a user
+	TypeOIDCIdentityForSortKey = "oidc_identity"
+	// TypeEmailForSortKey is the sort key value of the items reserving an email address for a user
+	TypeEmailForSortKey = "email"
+	// TypeGroupForSortKey is the sort key value of group items, and the prefix of their primary key
+	TypeGroupForSortKey = "group"
+	// TypeGroupMemberForSortKey is the sort key prefix of the member items of a group
+	TypeGroupMemberForSortKey = "member"
+	// TypeGroupMembershipForSortKey is the sort key prefix of the items listing the groups of a user
+	TypeGroupMembershipForSortKey = "group_membership"
+	// TypeFileForSortKey is the sort key prefix of the items holding the metadata of the files of a user
+	TypeFileForSortKey = "file"
+	// TypeExportForSortKey is the sort key prefix of the data export items of a user
+	TypeExportForSortKey = "export"
+	// SettingsPrimaryKey is the primary key of the items holding settings admins change at runtime
+	SettingsPrimaryKey = "settings"
+	// TypeStorageLimitsForSortKey is the sort key value of the item holding the default storage limits
+	TypeStorageLimitsForSortKey = "storage_limits"
+)
+
+// States of a data export
+const (
+	ExportStatusRunning = "running"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+)
+
+// Outcomes of a row of a user import
+const (
+	ImportRowValid    = "valid"
+	ImportRowImported = "imported"
+	ImportRowRejected = "rejected"
+	ImportRowFailed   = "failed"
 )
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	// purgeQueryKey makes an admin deletion permanent right away instead of after the grace period
+	purgeQueryKey = "purge"
+)
+
+// DeleteAccount deletes the account of the user, it can be restored by an admin until it is purged
+func (ur *UMSRest) DeleteAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	deactivation, errResp := ur.AccountService.DeactivateAccount(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to delete user %s. %s", userID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, deactivation)
+}
+
+// AdminDeleteAccount deletes the account of the user like DeleteAccount.
+// With purge=true the user is deleted permanently right away, with its files, and what was removed is reported.
+func (ur *UMSRest) AdminDeleteAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	purge, err := strconv.ParseBool(c.DefaultQuery(purgeQueryKey, "false"))
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid value of %s", purgeQueryKey),
+			RecommendationAction: []string{"Send true or false"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	if !purge {
+		ur.DeleteAccount(c)
+		return
+	}
+
+	report, errResp := ur.AccountService.DeleteAccount(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to delete user %s. %s", userID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RestoreAccount restores a deleted account that isn't purged yet
+func (ur *UMSRest) RestoreAccount(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AccountService.RestoreAccount(c.Request.Context(), userID)
+	ur.respondAccountStatus(c, status, errResp, "restore")
+}
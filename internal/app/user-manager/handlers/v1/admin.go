@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// GetAccountStatus returns the state of the account of the user
+func (ur *UMSRest) GetAccountStatus(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.GetAccountStatus(c.Request.Context(), userID)
+	ur.respondAccountStatus(c, status, errResp, "get status of")
+}
+
+// DisableUser disables the account of the user and ends its sessions
+func (ur *UMSRest) DisableUser(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.SetDisabled(c.Request.Context(), userID, true)
+	ur.respondAccountStatus(c, status, errResp, "disable")
+}
+
+// EnableUser enables the account of the user again
+func (ur *UMSRest) EnableUser(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.SetDisabled(c.Request.Context(), userID, false)
+	ur.respondAccountStatus(c, status, errResp, "enable")
+}
+
+// GrantAdmin makes the user an admin
+func (ur *UMSRest) GrantAdmin(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.SetAdmin(c.Request.Context(), userID, true)
+	ur.respondAccountStatus(c, status, errResp, "grant admin to")
+}
+
+// RevokeAdmin takes the admin rights of the user away
+func (ur *UMSRest) RevokeAdmin(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.SetAdmin(c.Request.Context(), userID, false)
+	ur.respondAccountStatus(c, status, errResp, "revoke admin from")
+}
+
+// ForcePasswordReset makes the user choose a new password before logging in again
+func (ur *UMSRest) ForcePasswordReset(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	status, errResp := ur.AdminService.ForcePasswordReset(c.Request.Context(), userID)
+	ur.respondAccountStatus(c, status, errResp, "force password reset of")
+}
+
+func (ur *UMSRest) respondAccountStatus(c *gin.Context, status models.AccountStatus, errResp *errModels.ErrorResponse, action string) {
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to %s user %s. %s", action, c.Param(constants.UserIDKey), errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
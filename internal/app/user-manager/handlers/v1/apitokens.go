@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	tokenIDParam = "token_id"
+)
+
+// CreateAPIToken creates a personal API token, the token is only included in this response
+func (ur *UMSRest) CreateAPIToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	var tokenInput models.APITokenInput
+	err := c.BindJSON(&tokenInput)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the token name, scopes and optionally expiresInDays"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	created, errResp := ur.APITokenService.CreateAPIToken(ctx, userID, tokenInput)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to create API token. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetAPITokens lists the personal API tokens of the user
+func (ur *UMSRest) GetAPITokens(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	tokens, errResp := ur.APITokenService.GetAPITokens(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to get API tokens. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeAPIToken deletes a personal API token of the user
+func (ur *UMSRest) RevokeAPIToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	tokenID := c.Param(tokenIDParam)
+
+	errResp := ur.APITokenService.RevokeAPIToken(ctx, userID, tokenID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to revoke API token. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
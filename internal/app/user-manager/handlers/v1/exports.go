@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	exportIDParam = "export_id"
+)
+
+// StartExport starts exporting the data of the user as an archive, the export is polled with GetExport
+func (ur *UMSRest) StartExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	export, errResp := ur.ExportService.StartExport(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to start data export of user %s. %s", userID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExport returns the state of a data export, with the download link once the archive is ready
+func (ur *UMSRest) GetExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	exportID := c.Param(exportIDParam)
+
+	export, errResp := ur.ExportService.GetExport(ctx, userID, exportID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to get data export %s. %s", exportID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	fileConsts "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	// dryRunQueryKey only validates an import file
+	dryRunQueryKey = "dry_run"
+	// maxImportFileBytes is the largest import file read, enough for thousands of users
+	maxImportFileBytes = 1 << 20
+)
+
+// ImportUsers creates the users of a CSV file, sent as the body or as the file of a multipart form.
+// With dry_run=true the rows are only validated.
+func (ur *UMSRest) ImportUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	dryRun, err := strconv.ParseBool(c.DefaultQuery(dryRunQueryKey, "false"))
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid value of %s", dryRunQueryKey),
+			RecommendationAction: []string{"Send true or false"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileBytes)
+	var file io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile(fileConsts.FileKey)
+		if err != nil {
+			errRes := errModels.ErrorResponse{
+				Message:         fmt.Sprintf("Failed to get form data from key file. Error: %v", err),
+				ErrorStatusCode: http.StatusBadRequest,
+			}
+			c.JSON(http.StatusBadRequest, errRes)
+			return
+		}
+		f, err := fileHeader.Open()
+		if err != nil {
+			errRes := errModels.ErrorResponse{
+				Message:         fmt.Sprintf("Failed to open the file. Error: %v", err),
+				ErrorStatusCode: http.StatusBadRequest,
+			}
+			c.JSON(http.StatusBadRequest, errRes)
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	report, errResp := ur.ImportService.ImportUsers(ctx, claims.Subject, file, dryRun)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to import users. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// AcceptInvitation sets the password of an imported user with the token of its invitation
+func (ur *UMSRest) AcceptInvitation(c *gin.Context) {
+	ctx := c.Request.Context()
+	var acceptInput models.ResetPasswordInput
+	err := c.BindJSON(&acceptInput)
+	if err != nil || acceptInput.Token == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the token from the invitation mail as token and the new password as password"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	errResp := ur.ImportService.AcceptInvitation(ctx, acceptInput)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to accept invitation. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
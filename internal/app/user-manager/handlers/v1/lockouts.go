@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	emailQueryKey = "email"
+	ipQueryKey    = "ip"
+)
+
+// checkLoginThrottle writes a 429 with Retry-After and returns false while the account or client IP is throttled
+func (ur *UMSRest) checkLoginThrottle(c *gin.Context, emailAddress string, clientIP string) bool {
+	retryAfter, errThrottle := ur.LockoutService.CheckLoginAllowed(c.Request.Context(), emailAddress, clientIP)
+	if errThrottle == nil {
+		return true
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	errRes := errModels.ErrorResponse{
+		Message:              fmt.Sprintf("Error validating user %s", errThrottle.Message),
+		RecommendationAction: errThrottle.RecommendationAction,
+		ErrorStatusCode:      errThrottle.ErrorStatusCode,
+	}
+	c.JSON(errThrottle.ErrorStatusCode, errRes)
+	return false
+}
+
+// GetLockouts lists the accounts and client IPs that are currently delayed or locked after failed logins
+func (ur *UMSRest) GetLockouts(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	lockouts, errResp := ur.LockoutService.GetLockouts(ctx)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to get lockouts. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// ClearLockout lets an admin clear the failed logins of an account and/or a client IP
+func (ur *UMSRest) ClearLockout(c *gin.Context) {
+	ctx := c.Request.Context()
+	emailAddress := c.Query(emailQueryKey)
+	clientIP := c.Query(ipQueryKey)
+	if emailAddress == "" && clientIP == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Failed to clear lockout. Expected email or ip in query.",
+			RecommendationAction: []string{"Pass the locked email address as email and/or the locked client IP as ip"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	errResp := ur.LockoutService.ClearLockout(ctx, emailAddress, clientIP)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to clear lockout. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
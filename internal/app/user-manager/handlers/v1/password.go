@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// ForgotPassword mails a password reset link to the user
+func (ur *UMSRest) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	var forgotInput models.ForgotPasswordInput
+	err := c.BindJSON(&forgotInput)
+	if err != nil || forgotInput.EmailAddress == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the email address of the account as emailAddress"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	errResp := ur.PasswordResetService.RequestPasswordReset(ctx, forgotInput.EmailAddress)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to request password reset. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	// the same response is sent whether or not the address belongs to a user
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using the token from the reset mail
+func (ur *UMSRest) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	var resetInput models.ResetPasswordInput
+	err := c.BindJSON(&resetInput)
+	if err != nil || resetInput.Token == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the token from the reset mail as token and the new password as password"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	errResp := ur.PasswordResetService.ResetPassword(ctx, resetInput)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to reset password. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/handlers/views"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/http/clientip"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// GetMe returns the user the request is authenticated as
+func (ur *UMSRest) GetMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
+
+	user, errResp := ur.UserService.GetAndValidateUser(ctx, claims.Subject)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to get user. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	views.RespondUser(c, http.StatusOK, user.User, fields)
+}
+
+// UpdateProfile changes the names and email address of the user, a new address is mailed a verification link
+func (ur *UMSRest) UpdateProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
+	var input models.UserProfileInput
+	err := c.BindJSON(&input)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send any of FirstName, LastName and EmailAddress"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	user, emailChanged, errResp := ur.UserService.UpdateProfile(ctx, userID, input)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to update profile. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	if emailChanged {
+		if errVerify := ur.VerificationService.SendVerification(ctx, user.User); errVerify != nil {
+			log.Printf("Error sending verification mail to user %s. %s", user.UserID, errVerify.Message)
+		}
+	}
+	views.RespondUser(c, http.StatusOK, user.User, fields)
+}
+
+// ChangePassword sets a new password of the user and ends every session, the user logs in again with the new password
+func (ur *UMSRest) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	var input models.ChangePasswordInput
+	err := c.BindJSON(&input)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send CurrentPassword and NewPassword"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+	user, errResp := ur.UserService.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to change password. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+
+	// wrong current passwords count towards the same lockout as wrong logins
+	clientIP := clientip.Get(c)
+	if !ur.checkLoginThrottle(c, user.EmailAddress, clientIP) {
+		return
+	}
+	errResp = ur.UserService.ChangePassword(ctx, userID, input)
+	if errResp != nil {
+		if errResp.ErrorStatusCode == http.StatusForbidden {
+			if errRecord := ur.LockoutService.RecordFailedLogin(ctx, user.EmailAddress, clientIP); errRecord != nil {
+				log.Printf("Error recording failed login for %s. %s", clientIP, errRecord.Message)
+			}
+		}
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to change password. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	if errClear := ur.LockoutService.RecordSuccessfulLogin(ctx, user.EmailAddress); errClear != nil {
+		log.Printf("Error clearing failed logins of user %s. %s", userID, errClear.Message)
+	}
+	if errRevoke := ur.SessionService.RevokeAllSessions(ctx, userID); errRevoke != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Password changed, but failed to end the sessions. %s", errRevoke.Message),
+			ErrorStatusCode: errRevoke.ErrorStatusCode,
+		}
+		c.JSON(errRevoke.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// RefreshToken exchanges a refresh token for a new pair of tokens
+func (ur *UMSRest) RefreshToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	var refreshInput models.RefreshTokenInput
+	err := c.BindJSON(&refreshInput)
+	if err != nil || refreshInput.RefreshToken == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the refresh token received on login as refreshToken"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	tokenResp, errRefresh := ur.SessionService.RefreshSession(ctx, refreshInput.RefreshToken)
+	if errRefresh != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to refresh session. %s", errRefresh.Message),
+			RecommendationAction: errRefresh.RecommendationAction,
+			ErrorStatusCode:      errRefresh.ErrorStatusCode,
+		}
+		c.JSON(errRefresh.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, tokenResp)
+}
+
+// Logout revokes the session of the access token used for the request
+func (ur *UMSRest) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, _ := auth.GetClaims(c)
+
+	errResp := ur.SessionService.EndSession(ctx, claims)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to logout. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserSessions revokes every session of a user
+func (ur *UMSRest) RevokeUserSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	if _, errResp := ur.UserService.GetAndValidateUser(ctx, userID); errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to revoke sessions of user %s. %s", userID, errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	errResp := ur.SessionService.RevokeAllSessions(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to revoke sessions of user %s. %s", userID, errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// StartSSOLogin returns the identity provider URL the frontend redirects the user to
+func (ur *UMSRest) StartSSOLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+	authorization, errResp := ur.SSOService.StartSSOLogin(ctx)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to start single sign-on login. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, authorization)
+}
+
+// CompleteSSOLogin logs in the user with the authorization code the identity provider redirected with.
+// Users with two-factor enabled still get a challenge unless the identity provider did a multi-factor login.
+func (ur *UMSRest) CompleteSSOLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input models.SSOCallbackInput
+	err := c.BindJSON(&input)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the code and state the identity provider redirected with"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	user, mfa, errResp := ur.SSOService.CompleteSSOLogin(ctx, input)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to complete single sign-on login. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+
+	// a multi-factor login at the identity provider doesn't stand in for TOTP of a user linked by email
+	if user.TwoFactorEnabled && !mfa {
+		challengeResp, errChallenge := ur.SessionService.StartLoginChallenge(ctx, user.UserID)
+		if errChallenge != nil {
+			errRes := errModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error starting two-factor login. %s", errChallenge.Message),
+				ErrorStatusCode: errChallenge.ErrorStatusCode,
+			}
+			c.JSON(errChallenge.ErrorStatusCode, errRes)
+			return
+		}
+		c.JSON(http.StatusOK, challengeResp)
+		return
+	}
+
+	tokenResp, errSession := ur.SessionService.StartSession(ctx, user.UserID, user.IsAdmin, mfa)
+	if errSession != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error starting session. %s", errSession.Message),
+			ErrorStatusCode: errSession.ErrorStatusCode,
+		}
+		c.JSON(errSession.ErrorStatusCode, errRes)
+		return
+	}
+	log.Printf("User %s logged in through single sign-on", user.UserID)
+	loginResp := models.LoginResponse{
+		UserID:        user.UserID,
+		EmailAddress:  user.EmailAddress,
+		IsAdmin:       user.IsAdmin,
+		TokenResponse: tokenResp,
+	}
+	c.JSON(http.StatusOK, loginResp)
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// GetStorageUsage returns the storage the user uses and its limits
+func (ur *UMSRest) GetStorageUsage(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	usage, errResp := ur.StorageService.GetUsage(c.Request.Context(), userID)
+	respondStorage(c, usage, errResp, fmt.Sprintf("get storage usage of user %s", userID))
+}
+
+// SetUserStorageLimits gives the user storage limits of its own
+func (ur *UMSRest) SetUserStorageLimits(c *gin.Context) {
+	userID := c.Param(constants.UserIDKey)
+	input, ok := bindStorageLimits(c)
+	if !ok {
+		return
+	}
+	usage, errResp := ur.StorageService.SetUserLimits(c.Request.Context(), userID, input)
+	respondStorage(c, usage, errResp, fmt.Sprintf("set storage limits of user %s", userID))
+}
+
+// GetDefaultStorageLimits returns the storage limits of users without limits of their own
+func (ur *UMSRest) GetDefaultStorageLimits(c *gin.Context) {
+	limits, errResp := ur.StorageService.GetDefaultLimits(c.Request.Context())
+	respondStorage(c, limits, errResp, "get default storage limits")
+}
+
+// SetDefaultStorageLimits changes the storage limits of users without limits of their own
+func (ur *UMSRest) SetDefaultStorageLimits(c *gin.Context) {
+	claims, _ := auth.GetClaims(c)
+	input, ok := bindStorageLimits(c)
+	if !ok {
+		return
+	}
+	limits, errResp := ur.StorageService.SetDefaultLimits(c.Request.Context(), claims.Subject, input)
+	respondStorage(c, limits, errResp, "set default storage limits")
+}
+
+func bindStorageLimits(c *gin.Context) (models.StorageLimitsInput, bool) {
+	var input models.StorageLimitsInput
+	if err := c.BindJSON(&input); err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send storageQuotaBytes, maxFileSizeBytes or both"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return input, false
+	}
+	return input, true
+}
+
+func respondStorage(c *gin.Context, body interface{}, errResp *errModels.ErrorResponse, action string) {
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to %s. %s", action, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
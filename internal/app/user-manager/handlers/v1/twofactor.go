@@ -0,0 +1,279 @@
+package v1
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/http/clientip"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// LoginTwoFactor completes the login of a user with two-factor enabled using the challenge token and a code
+func (ur *UMSRest) LoginTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input models.LoginTwoFactorInput
+	err := c.BindJSON(&input)
+	if err != nil || input.ChallengeToken == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the challengeToken from the login together with code or recoveryCode"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	claims, errResp := ur.SessionService.VerifyLoginChallenge(ctx, input.ChallengeToken)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error validating user %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	user, errResp := ur.UserService.GetAndValidateUser(ctx, claims.Subject)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error validating user %s", errResp.Message),
+			ErrorStatusCode: http.StatusUnauthorized,
+		}
+		c.JSON(http.StatusUnauthorized, errRes)
+		return
+	}
+	// the account may have been disabled or deleted after the password step
+	if user.Disabled {
+		errRes := errModels.ErrorResponse{
+			Message:              "Account is disabled",
+			RecommendationAction: []string{"Contact an administrator"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+		c.JSON(http.StatusForbidden, errRes)
+		return
+	}
+	if user.DeactivatedAt > 0 {
+		errRes := errModels.ErrorResponse{
+			Message:              "Account is deleted",
+			RecommendationAction: []string{"Contact an administrator to restore the account"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+		c.JSON(http.StatusForbidden, errRes)
+		return
+	}
+
+	// wrong codes count towards the same lockout as wrong passwords
+	clientIP := clientip.Get(c)
+	if !ur.checkLoginThrottle(c, user.EmailAddress, clientIP) {
+		return
+	}
+	errResp = ur.TwoFactorService.VerifySecondFactor(ctx, user.UserID, input.TwoFactorCodeInput)
+	if errResp != nil {
+		if errResp.ErrorStatusCode == http.StatusUnauthorized {
+			if errRecord := ur.LockoutService.RecordFailedLogin(ctx, user.EmailAddress, clientIP); errRecord != nil {
+				log.Printf("Error recording failed login for %s. %s", clientIP, errRecord.Message)
+			}
+		}
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error validating user %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	if errClear := ur.LockoutService.RecordSuccessfulLogin(ctx, user.EmailAddress); errClear != nil {
+		log.Printf("Error clearing failed logins of user %s. %s", user.UserID, errClear.Message)
+	}
+
+	tokenResp, errSession := ur.SessionService.StartSession(ctx, user.UserID, user.IsAdmin, true)
+	if errSession != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error starting session. %s", errSession.Message),
+			ErrorStatusCode: errSession.ErrorStatusCode,
+		}
+		c.JSON(errSession.ErrorStatusCode, errRes)
+		return
+	}
+	loginResp := models.LoginResponse{
+		UserID:        user.UserID,
+		EmailAddress:  user.EmailAddress,
+		IsAdmin:       user.IsAdmin,
+		TokenResponse: tokenResp,
+	}
+	c.JSON(http.StatusOK, loginResp)
+}
+
+// EnrollTOTP starts the enrollment of an authenticator app for the user
+func (ur *UMSRest) EnrollTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	enrollment, errResp := ur.TwoFactorService.EnrollTOTP(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to enroll authenticator. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP enables two-factor authentication with a code of the enrolled authenticator
+func (ur *UMSRest) ConfirmTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	input, ok := bindTwoFactorCode(c, false)
+	if !ok {
+		return
+	}
+	user, clientIP, ok := ur.checkCodeThrottle(c, userID, "Failed to confirm authenticator")
+	if !ok {
+		return
+	}
+
+	recoveryCodes, errResp := ur.TwoFactorService.ConfirmTOTP(ctx, userID, input.Code)
+	ur.recordCodeCheck(c, user, clientIP, errResp)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to confirm authenticator. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, recoveryCodes)
+}
+
+// DisableTOTP turns off two-factor authentication with a code or a recovery code
+func (ur *UMSRest) DisableTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	input, ok := bindTwoFactorCode(c, true)
+	if !ok {
+		return
+	}
+	user, clientIP, ok := ur.checkCodeThrottle(c, userID, "Failed to disable two-factor authentication")
+	if !ok {
+		return
+	}
+
+	errResp := ur.TwoFactorService.DisableTOTP(ctx, userID, input)
+	ur.recordCodeCheck(c, user, clientIP, errResp)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to disable two-factor authentication. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user
+func (ur *UMSRest) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+	input, ok := bindTwoFactorCode(c, false)
+	if !ok {
+		return
+	}
+	user, clientIP, ok := ur.checkCodeThrottle(c, userID, "Failed to regenerate recovery codes")
+	if !ok {
+		return
+	}
+
+	recoveryCodes, errResp := ur.TwoFactorService.RegenerateRecoveryCodes(ctx, userID, input.Code)
+	ur.recordCodeCheck(c, user, clientIP, errResp)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to regenerate recovery codes. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, recoveryCodes)
+}
+
+// ResetUserTwoFactor lets an admin turn off two-factor authentication of a user who lost their authenticator
+func (ur *UMSRest) ResetUserTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	errResp := ur.TwoFactorService.ResetTwoFactor(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to reset two-factor authentication. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkCodeThrottle loads the user and rejects the request while its account or the client IP is throttled.
+// Wrong codes sent with a session count towards the same lockout as wrong logins, so a stolen session can't guess them.
+func (ur *UMSRest) checkCodeThrottle(c *gin.Context, userID string, failure string) (models.UserDynamo, string, bool) {
+	user, errResp := ur.UserService.GetAndValidateUser(c.Request.Context(), userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("%s. %s", failure, errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return user, "", false
+	}
+	clientIP := clientip.Get(c)
+	if !ur.checkLoginThrottle(c, user.EmailAddress, clientIP) {
+		return user, clientIP, false
+	}
+	return user, clientIP, true
+}
+
+// recordCodeCheck counts a wrong code like a failed login, and clears the failures of the account after a valid one
+func (ur *UMSRest) recordCodeCheck(c *gin.Context, user models.UserDynamo, clientIP string, errResp *errModels.ErrorResponse) {
+	ctx := c.Request.Context()
+	switch {
+	case errResp == nil:
+		if errClear := ur.LockoutService.RecordSuccessfulLogin(ctx, user.EmailAddress); errClear != nil {
+			log.Printf("Error clearing failed logins of user %s. %s", user.UserID, errClear.Message)
+		}
+	case errResp.ErrorStatusCode == http.StatusUnauthorized:
+		if errRecord := ur.LockoutService.RecordFailedLogin(ctx, user.EmailAddress, clientIP); errRecord != nil {
+			log.Printf("Error recording failed code for %s. %s", clientIP, errRecord.Message)
+		}
+	}
+}
+
+func bindTwoFactorCode(c *gin.Context, allowRecoveryCode bool) (models.TwoFactorCodeInput, bool) {
+	var input models.TwoFactorCodeInput
+	err := c.BindJSON(&input)
+	if err == nil && (input.Code != "" || (allowRecoveryCode && input.RecoveryCode != "")) {
+		return input, true
+	}
+	recommendation := "Send the code of your authenticator app as code"
+	if allowRecoveryCode {
+		recommendation = "Send the code of your authenticator app as code, or a recovery code as recoveryCode"
+	}
+	errRes := errModels.ErrorResponse{
+		Message:              "Invalid request body",
+		RecommendationAction: []string{recommendation},
+		ErrorStatusCode:      http.StatusBadRequest,
+	}
+	c.JSON(http.StatusBadRequest, errRes)
+	return input, false
+}
@@ -0,0 +1,122 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const validCode = "123456"
+
+// countingLockouts locks the account after maxFailures wrong codes, the other methods of the interface are not used
+type countingLockouts struct {
+	services.LockoutService
+	maxFailures int
+	failures    map[string]int
+}
+
+func (cl *countingLockouts) CheckLoginAllowed(ctx context.Context, emailAddress string, clientIP string) (time.Duration, *errModels.ErrorResponse) {
+	if cl.failures[emailAddress] >= cl.maxFailures {
+		return time.Minute, &errModels.ErrorResponse{Message: "Too many failed logins", ErrorStatusCode: http.StatusTooManyRequests}
+	}
+	return 0, nil
+}
+
+func (cl *countingLockouts) RecordFailedLogin(ctx context.Context, emailAddress string, clientIP string) *errModels.ErrorResponse {
+	cl.failures[emailAddress]++
+	return nil
+}
+
+func (cl *countingLockouts) RecordSuccessfulLogin(ctx context.Context, emailAddress string) *errModels.ErrorResponse {
+	delete(cl.failures, emailAddress)
+	return nil
+}
+
+// fakeTwoFactor accepts validCode and counts the codes it checked
+type fakeTwoFactor struct {
+	services.TwoFactorService
+	checked int
+}
+
+func (ft *fakeTwoFactor) check(code string) *errModels.ErrorResponse {
+	ft.checked++
+	if code != validCode {
+		return &errModels.ErrorResponse{Message: "Invalid authenticator code", ErrorStatusCode: http.StatusUnauthorized}
+	}
+	return nil
+}
+
+func (ft *fakeTwoFactor) ConfirmTOTP(ctx context.Context, userID string, code string) (models.RecoveryCodes, *errModels.ErrorResponse) {
+	return models.RecoveryCodes{}, ft.check(code)
+}
+
+func (ft *fakeTwoFactor) DisableTOTP(ctx context.Context, userID string, input models.TwoFactorCodeInput) *errModels.ErrorResponse {
+	return ft.check(input.Code)
+}
+
+func (ft *fakeTwoFactor) RegenerateRecoveryCodes(ctx context.Context, userID string, code string) (models.RecoveryCodes, *errModels.ErrorResponse) {
+	return models.RecoveryCodes{}, ft.check(code)
+}
+
+func TestSessionCodeChecksAreThrottled(t *testing.T) {
+	routes := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"confirm", http.MethodPost, "/v1/users/user-1/2fa/totp/confirm"},
+		{"disable", http.MethodDelete, "/v1/users/user-1/2fa/totp"},
+		{"recovery codes", http.MethodPost, "/v1/users/user-1/2fa/recovery-codes"},
+	}
+	for _, route := range routes {
+		lockouts := &countingLockouts{maxFailures: 3, failures: map[string]int{}}
+		twoFactor := &fakeTwoFactor{}
+		ur := &UMSRest{
+			UserService:      &fakeUserService{user: models.UserDynamo{User: models.User{UserID: "user-1", Credentials: models.Credentials{EmailAddress: "ada@example.com"}}}},
+			LockoutService:   lockouts,
+			TwoFactorService: twoFactor,
+		}
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.POST("/v1/users/:user_id/2fa/totp/confirm", ur.ConfirmTOTP)
+		router.DELETE("/v1/users/:user_id/2fa/totp", ur.DisableTOTP)
+		router.POST("/v1/users/:user_id/2fa/recovery-codes", ur.RegenerateRecoveryCodes)
+		send := func(code string) int {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, strings.NewReader(`{"code":"`+code+`"}`)))
+			return w.Code
+		}
+
+		// a valid code clears the failures before the account is locked
+		send("000000")
+		if status := send(validCode); status >= http.StatusBadRequest {
+			t.Fatalf("%s: valid code got %d", route.name, status)
+		}
+		if lockouts.failures["ada@example.com"] != 0 {
+			t.Errorf("%s: valid code kept %d failures", route.name, lockouts.failures["ada@example.com"])
+		}
+
+		for i := 0; i < 3; i++ {
+			if status := send("000000"); status != http.StatusUnauthorized {
+				t.Fatalf("%s: wrong code got %d, want 401", route.name, status)
+			}
+		}
+		checked := twoFactor.checked
+		// once locked even the valid code isn't checked
+		if status := send(validCode); status != http.StatusTooManyRequests {
+			t.Errorf("%s: locked account got %d, want 429", route.name, status)
+		}
+		if twoFactor.checked != checked {
+			t.Errorf("%s: code was checked while the account is locked", route.name)
+		}
+	}
+}
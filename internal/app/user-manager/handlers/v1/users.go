@@ -4,26 +4,71 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/handlers/views"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/http/clientip"
 	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+	"log"
 	"net/http"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UMSRest struct {
-	UserService services.UserService
+	UserService          services.UserService
+	SessionService       services.SessionService
+	PasswordResetService services.PasswordResetService
+	VerificationService  services.VerificationService
+	LockoutService       services.LockoutService
+	TwoFactorService     services.TwoFactorService
+	APITokenService      services.APITokenService
+	// SSOService is nil when single sign-on isn't configured
+	SSOService     services.SSOService
+	AccountService services.AccountService
+	AdminService   services.AdminService
+	StorageService services.StorageService
+	ExportService  services.ExportService
+	ImportService  services.ImportService
 }
 
-func CreateUMSRouter(userService services.UserService) *UMSRest {
+func CreateUMSRouter(
+	userService services.UserService,
+	sessionService services.SessionService,
+	passwordResetService services.PasswordResetService,
+	verificationService services.VerificationService,
+	lockoutService services.LockoutService,
+	twoFactorService services.TwoFactorService,
+	apiTokenService services.APITokenService,
+	ssoService services.SSOService,
+	accountService services.AccountService,
+	adminService services.AdminService,
+	storageService services.StorageService,
+	exportService services.ExportService,
+	importService services.ImportService,
+) *UMSRest {
 	return &UMSRest{
-		UserService: userService,
+		UserService:          userService,
+		SessionService:       sessionService,
+		PasswordResetService: passwordResetService,
+		VerificationService:  verificationService,
+		LockoutService:       lockoutService,
+		TwoFactorService:     twoFactorService,
+		APITokenService:      apiTokenService,
+		SSOService:           ssoService,
+		AccountService:       accountService,
+		AdminService:         adminService,
+		StorageService:       storageService,
+		ExportService:        exportService,
+		ImportService:        importService,
 	}
 }
 
 func (ur *UMSRest) CreateUser(c *gin.Context) {
 	ctx := c.Request.Context()
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
 	var userInput models.UserInput
 	err := c.BindJSON(&userInput)
 	if err != nil {
@@ -37,15 +82,15 @@ func (ur *UMSRest) CreateUser(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userInput.Password), 8)
-	fmt.Printf("jas  %v", hashedPassword)
-	if err != nil {
+	hashedPassword, errPassword := ur.UserService.HashNewPassword(ctx, userInput.Password)
+	if errPassword != nil {
 		errRes := errModels.ErrorResponse{
-			Message:              "Invalid password entered",
-			RecommendationAction: []string{"Check password parameter"},
-			ErrorStatusCode:      http.StatusBadRequest,
+			Message:              fmt.Sprintf("Invalid password entered. %s", errPassword.Message),
+			RecommendationAction: errPassword.RecommendationAction,
+			ErrorStatusCode:      errPassword.ErrorStatusCode,
 		}
-		c.JSON(http.StatusBadRequest, errRes)
+		c.JSON(errPassword.ErrorStatusCode, errRes)
+		return
 	}
 	userUUID := utils.GenerateUUID()
 	userDynamo := models.UserDynamo{
@@ -54,10 +99,11 @@ func (ur *UMSRest) CreateUser(c *gin.Context) {
 			SKey: "user",
 		},
 		User: models.User{
-			UserID:       userUUID,
-			FirstName:    userInput.FirstName,
-			LastName:     userInput.LastName,
-			IsAdmin:      userInput.IsAdmin,
+			UserID:                   userUUID,
+			FirstName:                userInput.FirstName,
+			LastName:                 userInput.LastName,
+			IsAdmin:                  false,
+			EmailVerificationPending: true,
 			Credentials: models.Credentials{
 				EmailAddress: userInput.EmailAddress,
 				Password:     hashedPassword,
@@ -80,7 +126,11 @@ func (ur *UMSRest) CreateUser(c *gin.Context) {
 		return
 	}
 	//fmt.Printf("Successfully created user. %s with ID %s", userCreateResp.FirstName, userCreateResp.UserID)
-	c.JSON(http.StatusCreated, userCreateResp.User)
+	// the account exists at this point, a failed mail can be retried through the resend endpoint
+	if errVerify := ur.VerificationService.SendVerification(ctx, userCreateResp.User); errVerify != nil {
+		log.Printf("Error sending verification mail to user %s. %s", userCreateResp.UserID, errVerify.Message)
+	}
+	views.RespondUser(c, http.StatusCreated, userCreateResp.User, fields)
 	return
 }
 
@@ -99,21 +149,67 @@ func (ur *UMSRest) Login(c *gin.Context) {
 		return
 	}
 
+	clientIP := clientip.Get(c)
+	if !ur.checkLoginThrottle(c, credInput.EmailAddress, clientIP) {
+		return
+	}
+
 	userCredsIsAdmin, errValidate := ur.UserService.GetAndValidateCredentials(ctx, credInput)
 	if errValidate != nil {
+		if errValidate.ErrorStatusCode == http.StatusUnauthorized {
+			if errRecord := ur.LockoutService.RecordFailedLogin(ctx, credInput.EmailAddress, clientIP); errRecord != nil {
+				log.Printf("Error recording failed login for %s. %s", clientIP, errRecord.Message)
+			}
+		}
 		errMsg := fmt.Sprintf("Error validating user %s", errValidate.Message)
 		errCode := errValidate.ErrorStatusCode
 		if errCode == 0 {
 			errCode = http.StatusInternalServerError
 		}
 		errResp := errModels.ErrorResponse{
-			Message:         errMsg,
-			ErrorStatusCode: errCode,
+			Message:              errMsg,
+			RecommendationAction: errValidate.RecommendationAction,
+			ErrorStatusCode:      errCode,
 		}
 		c.JSON(errCode, errResp)
 		return
 	}
-	c.JSON(http.StatusOK, userCredsIsAdmin)
+
+	// failed logins are only cleared after the second factor, so the password can't be used to reset them
+	if userCredsIsAdmin.TwoFactorEnabled {
+		challengeResp, errChallenge := ur.SessionService.StartLoginChallenge(ctx, userCredsIsAdmin.UserID)
+		if errChallenge != nil {
+			errRes := errModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error starting two-factor login. %s", errChallenge.Message),
+				ErrorStatusCode: errChallenge.ErrorStatusCode,
+			}
+			c.JSON(errChallenge.ErrorStatusCode, errRes)
+			return
+		}
+		c.JSON(http.StatusOK, challengeResp)
+		return
+	}
+
+	if errClear := ur.LockoutService.RecordSuccessfulLogin(ctx, userCredsIsAdmin.EmailAddress); errClear != nil {
+		log.Printf("Error clearing failed logins of user %s. %s", userCredsIsAdmin.UserID, errClear.Message)
+	}
+
+	tokenResp, errSession := ur.SessionService.StartSession(ctx, userCredsIsAdmin.UserID, userCredsIsAdmin.IsAdmin, false)
+	if errSession != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error starting session. %s", errSession.Message),
+			ErrorStatusCode: errSession.ErrorStatusCode,
+		}
+		c.JSON(errSession.ErrorStatusCode, errRes)
+		return
+	}
+	loginResp := models.LoginResponse{
+		UserID:        userCredsIsAdmin.UserID,
+		EmailAddress:  userCredsIsAdmin.EmailAddress,
+		IsAdmin:       userCredsIsAdmin.IsAdmin,
+		TokenResponse: tokenResp,
+	}
+	c.JSON(http.StatusOK, loginResp)
 	return
 }
 
@@ -122,6 +218,10 @@ func (ur *UMSRest) GetUser(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userID := c.Param(constants.UserIDKey)
+	fields, ok := views.UserFields(c)
+	if !ok {
+		return
+	}
 
 	userResp, err := ur.UserService.GetUser(ctx, userID)
 	if err != nil {
@@ -132,5 +232,5 @@ func (ur *UMSRest) GetUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, errRes)
 		return
 	}
-	c.JSON(http.StatusOK, userResp)
+	views.RespondUser(c, http.StatusOK, userResp.User, fields)
 }
\ No newline at end of file
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth/authtest"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const testPassword = "correct horse battery staple"
+
+// fakeUserService returns the stored user for every lookup, the other methods of the interface are not used
+type fakeUserService struct {
+	services.UserService
+	user models.UserDynamo
+}
+
+func (f *fakeUserService) HashNewPassword(ctx context.Context, password string) ([]byte, *errModels.ErrorResponse) {
+	return f.user.Password, nil
+}
+
+func (f *fakeUserService) CreateUser(ctx context.Context, input models.UserDynamo) (models.UserDynamo, *errModels.ErrorResponse) {
+	return input, nil
+}
+
+func (f *fakeUserService) GetUser(ctx context.Context, userID string) (models.UserDynamo, *errModels.ErrorResponse) {
+	return f.user, nil
+}
+
+func (f *fakeUserService) GetAndValidateUser(ctx context.Context, userID string) (models.UserDynamo, *errModels.ErrorResponse) {
+	return f.user, nil
+}
+
+func (f *fakeUserService) UpdateProfile(ctx context.Context, userID string, input models.UserProfileInput) (models.UserDynamo, bool, *errModels.ErrorResponse) {
+	return f.user, false, nil
+}
+
+func (f *fakeUserService) GetAndValidateCredentials(ctx context.Context, userCred models.UserInputLogin) (models.CredIsAdmin, *errModels.ErrorResponse) {
+	return models.CredIsAdmin{
+		UserID:       f.user.UserID,
+		EmailAddress: f.user.EmailAddress,
+		Password:     f.user.Password,
+		IsAdmin:      f.user.IsAdmin,
+	}, nil
+}
+
+type fakeSessionService struct {
+	services.SessionService
+}
+
+func (f *fakeSessionService) StartSession(ctx context.Context, userID string, isAdmin bool, mfa bool) (models.TokenResponse, *errModels.ErrorResponse) {
+	return models.TokenResponse{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}, nil
+}
+
+type fakeLockoutService struct {
+	services.LockoutService
+}
+
+func (f *fakeLockoutService) CheckLoginAllowed(ctx context.Context, emailAddress string, clientIP string) (time.Duration, *errModels.ErrorResponse) {
+	return 0, nil
+}
+
+func (f *fakeLockoutService) RecordSuccessfulLogin(ctx context.Context, emailAddress string) *errModels.ErrorResponse {
+	return nil
+}
+
+type fakeVerificationService struct {
+	services.VerificationService
+	user models.UserDynamo
+}
+
+func (f *fakeVerificationService) SendVerification(ctx context.Context, user models.User) *errModels.ErrorResponse {
+	return nil
+}
+
+func (f *fakeVerificationService) VerifyEmail(ctx context.Context, token string) (models.UserDynamo, *errModels.ErrorResponse) {
+	return f.user, nil
+}
+
+func (f *fakeVerificationService) MarkVerified(ctx context.Context, userID string) (models.UserDynamo, *errModels.ErrorResponse) {
+	return f.user, nil
+}
+
+// storedUser returns a user holding the password hashed like the service stores it
+func storedUser(t *testing.T, config auth.PasswordHashConfig) models.UserDynamo {
+	hash := authtest.HashPassword(t, config, testPassword)
+	return models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{PKey: "user-1", SKey: "user"},
+		User: models.User{
+			UserID:    "user-1",
+			FirstName: "Ada",
+			LastName:  "Lovelace",
+			Credentials: models.Credentials{
+				EmailAddress: "ada@example.com",
+				Password:     hash,
+			},
+		},
+	}
+}
+
+// testRouter serves the user returning routes, authenticated as the caller with the given stored admin flag
+func testRouter(user models.UserDynamo, principalIsAdmin bool) *gin.Engine {
+	ur := &UMSRest{
+		UserService:         &fakeUserService{user: user},
+		SessionService:      &fakeSessionService{},
+		LockoutService:      &fakeLockoutService{},
+		VerificationService: &fakeVerificationService{user: user},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authenticated := router.Group("/v1", func(c *gin.Context) {
+		c.Set(auth.ClaimsContextKey, auth.Claims{Subject: user.UserID, IsAdmin: true})
+		if principalIsAdmin {
+			c.Set(auth.PrincipalContextKey, auth.Principal{UserID: user.UserID, IsAdmin: true})
+		}
+	})
+	authenticated.POST("/users", ur.CreateUser)
+	authenticated.POST("/login", ur.Login)
+	authenticated.GET("/users/:user_id", ur.GetUser)
+	authenticated.GET("/me", ur.GetMe)
+	authenticated.PUT("/users/:user_id/profile", ur.UpdateProfile)
+	authenticated.GET("/verify-email", ur.VerifyEmail)
+	authenticated.PUT("/users/:user_id/verified", ur.MarkUserVerified)
+	return router
+}
+
+var userRequests = []struct {
+	name   string
+	method string
+	path   string
+	body   string
+}{
+	{"create user", http.MethodPost, "/v1/users", `{"FirstName":"Ada","LastName":"Lovelace","EmailAddress":"ada@example.com","Password":"` + testPassword + `"}`},
+	{"login", http.MethodPost, "/v1/login", `{"EmailAddress":"ada@example.com","Password":"` + testPassword + `"}`},
+	{"get user", http.MethodGet, "/v1/users/user-1", ""},
+	{"get me", http.MethodGet, "/v1/me", ""},
+	{"update profile", http.MethodPut, "/v1/users/user-1/profile", `{"FirstName":"Augusta"}`},
+	{"verify email", http.MethodGet, "/v1/verify-email?token=token", ""},
+	{"mark verified", http.MethodPut, "/v1/users/user-1/verified", ""},
+}
+
+func TestUserResponsesLeaveOutPassword(t *testing.T) {
+	for hashName, config := range authtest.PasswordHashConfigs() {
+		user := storedUser(t, config)
+		for _, admin := range []bool{false, true} {
+			router := testRouter(user, admin)
+			for _, req := range userRequests {
+				var body io.Reader
+				if req.body != "" {
+					body = strings.NewReader(req.body)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(req.method, req.path, body))
+				if w.Code >= http.StatusBadRequest {
+					t.Fatalf("%s %s (admin %v): status %d, body %s", hashName, req.name, admin, w.Code, w.Body.String())
+				}
+				authtest.AssertNoSecrets(t, hashName+" "+req.name, w.Body.Bytes(), user.Password)
+			}
+		}
+	}
+}
+
+func TestUserAdminViewNeedsStoredAdmin(t *testing.T) {
+	user := storedUser(t, auth.PasswordHashConfig{Algorithm: auth.PasswordHashBcrypt, BcryptCost: 4})
+	for _, admin := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		testRouter(user, admin).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users/user-1", nil))
+		view := map[string]interface{}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+			t.Fatalf("decoding user: %v", err)
+		}
+		// the token claims an admin in both cases, only the stored account decides
+		if _, ok := view["Disabled"]; ok != admin {
+			t.Errorf("admin view given %v, want %v", ok, admin)
+		}
+	}
+}
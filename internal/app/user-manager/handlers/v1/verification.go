@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	tokenQueryKey = "token"
+)
+
+// VerifyEmail verifies the email address of a user with the token from the verification mail
+func (ur *UMSRest) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	token := c.Query(tokenQueryKey)
+	if token == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Failed to verify email address. Expected token in query.",
+			RecommendationAction: []string{"Open the link from the verification mail"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	user, errResp := ur.VerificationService.VerifyEmail(ctx, token)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to verify email address. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, verificationResponse(user))
+}
+
+// ResendVerification mails a new verification link
+func (ur *UMSRest) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+	var resendInput models.ResendVerificationInput
+	err := c.BindJSON(&resendInput)
+	if err != nil || resendInput.EmailAddress == "" {
+		errRes := errModels.ErrorResponse{
+			Message:              "Invalid request body",
+			RecommendationAction: []string{"Send the email address of the account as emailAddress"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return
+	}
+
+	errResp := ur.VerificationService.ResendVerification(ctx, resendInput.EmailAddress)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to send verification mail. %s", errResp.Message),
+			ErrorStatusCode: errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	// the same response is sent whether or not the address belongs to an unverified user
+	c.Status(http.StatusAccepted)
+}
+
+// MarkUserVerified lets an admin mark the email address of a user as verified
+func (ur *UMSRest) MarkUserVerified(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Param(constants.UserIDKey)
+
+	user, errResp := ur.VerificationService.MarkVerified(ctx, userID)
+	if errResp != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Failed to mark user %s as verified. %s", userID, errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errResp.ErrorStatusCode,
+		}
+		c.JSON(errResp.ErrorStatusCode, errRes)
+		return
+	}
+	c.JSON(http.StatusOK, verificationResponse(user))
+}
+
+func verificationResponse(user models.UserDynamo) models.VerificationResponse {
+	return models.VerificationResponse{
+		UserID:        user.UserID,
+		EmailAddress:  user.EmailAddress,
+		EmailVerified: !user.EmailVerificationPending,
+	}
+}
@@ -0,0 +1,46 @@
+// Package views writes the views of users for the handlers of every manager returning users
+package views
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	errModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+// UserFields reads the fields query parameter before the request does anything, an unknown field is answered with 400
+func UserFields(c *gin.Context) ([]string, bool) {
+	fields := utils.SplitFields(c.Query(constants.FieldsKey))
+	if err := models.ValidateUserViewFields(fields); err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid fields. %s", err.Error()),
+			RecommendationAction: []string{fmt.Sprintf("Select any of %v", models.UserViewFields())},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+		c.JSON(http.StatusBadRequest, errRes)
+		return nil, false
+	}
+	return fields, true
+}
+
+// RespondUser writes the view of the user the caller may see. Only callers whose stored account was checked
+// to be an admin get the admin view, the admin flag of the token may be stale.
+func RespondUser(c *gin.Context, status int, user models.User, fields []string) {
+	principal, _ := auth.GetPrincipal(c)
+	view, err := models.NewUserView(user, principal.IsAdmin, fields)
+	if err != nil {
+		errRes := errModels.ErrorResponse{
+			Message:         fmt.Sprintf("Failed to encode user. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+		c.JSON(http.StatusInternalServerError, errRes)
+		return
+	}
+	c.JSON(status, view)
+}
@@ -0,0 +1,41 @@
+package models
+
+// AccountDeletionReport tells what was removed together with an account
+type AccountDeletionReport struct {
+	UserID string `json:"userID"`
+	// DeletedFiles is the number of the user's objects deleted from S3
+	DeletedFiles int `json:"deletedFiles"`
+	// DeletedRecords is the number of database items deleted, the user item included
+	DeletedRecords  int  `json:"deletedRecords"`
+	SessionsRevoked bool `json:"sessionsRevoked"`
+}
+
+// AccountPurgeReport tells which deactivated accounts a purge deleted
+type AccountPurgeReport struct {
+	Purged int
+	// FailedUserIDs are the accounts that couldn't be purged, the next purge tries them again
+	FailedUserIDs []string
+}
+
+// AccountStatus is the admin view of the state of an account
+type AccountStatus struct {
+	UserID                   string `json:"userID"`
+	EmailAddress             string `json:"emailAddress"`
+	IsAdmin                  bool   `json:"isAdmin"`
+	Disabled                 bool   `json:"disabled"`
+	EmailVerificationPending bool   `json:"emailVerificationPending"`
+	TwoFactorEnabled         bool   `json:"twoFactorEnabled"`
+	PasswordResetRequired    bool   `json:"passwordResetRequired"`
+	// HasPassword is false for users who only login through single sign-on
+	HasPassword bool `json:"hasPassword"`
+	// DeactivatedAt is set while a deleted account can still be restored
+	DeactivatedAt int64 `json:"deactivatedAt,omitempty"`
+}
+
+// AccountDeactivation tells when a deleted account is purged, until then an admin can restore it
+type AccountDeactivation struct {
+	UserID          string `json:"userID"`
+	DeactivatedAt   int64  `json:"deactivatedAt"`
+	PurgeAt         int64  `json:"purgeAt"`
+	SessionsRevoked bool   `json:"sessionsRevoked"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// APITokenDynamo is the item stored for a personal API token, only the hash of the token is kept.
+// The item is removed by the table TTL once the token has expired.
+type APITokenDynamo struct {
+	DynamoKeys
+	UserID    string
+	TokenID   string
+	TokenHash string
+	Name      string
+	Scopes    []string
+	CreatedAt int64
+	ExpiresAt int64
+}
+
+// APIToken describes a personal API token without its secret
+type APIToken struct {
+	TokenID   string   `json:"tokenID"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"createdAt"`
+	ExpiresAt int64    `json:"expiresAt"`
+}
+
+// APITokens lists the API tokens of a user
+type APITokens struct {
+	Members []APIToken `json:"members"`
+}
+
+// APITokenInput is the request body for creating an API token
+type APITokenInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to 30 days
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+// CreatedAPIToken is returned once when an API token is created, the token can't be read again
+type CreatedAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+}
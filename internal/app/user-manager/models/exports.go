@@ -0,0 +1,39 @@
+package models
+
+// ExportDynamo is the item tracking a data export of a user, it expires through TTL together with the archive link
+type ExportDynamo struct {
+	DynamoKeys
+	ExportID    string
+	UserID      string
+	Status      string
+	CreatedAt   int64
+	CompletedAt int64
+	// FileCount is the number of files in the archive, MissingFiles the files whose content wasn't found in S3
+	FileCount    int
+	MissingFiles []string
+	Error        string
+	ExpiresAt    int64
+}
+
+// ExportJob describes a data export, the download link is set once the archive is ready
+type ExportJob struct {
+	ExportID     string   `json:"exportID"`
+	Status       string   `json:"status"`
+	CreatedAt    int64    `json:"createdAt"`
+	CompletedAt  int64    `json:"completedAt,omitempty"`
+	FileCount    int      `json:"fileCount"`
+	MissingFiles []string `json:"missingFiles,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	// ExpiresAt is when the archive can no longer be downloaded
+	ExpiresAt    int64  `json:"expiresAt"`
+	PresignedURL string `json:"presignedURL,omitempty"`
+}
+
+// ExportManifest is written to the archive, it tells what the archive holds
+type ExportManifest struct {
+	ExportID     string   `json:"exportID"`
+	UserID       string   `json:"userID"`
+	CreatedAt    string   `json:"createdAt"`
+	Files        []string `json:"files"`
+	MissingFiles []string `json:"missingFiles,omitempty"`
+}
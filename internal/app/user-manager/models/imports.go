@@ -0,0 +1,22 @@
+package models
+
+// UserImportReport tells what became of every row of an imported CSV file
+type UserImportReport struct {
+	DryRun bool `json:"dryRun"`
+	// Total counts the rows holding a user, Imported the users created, or that would be created in a dry run,
+	// and Rejected the rows that weren't imported
+	Total    int             `json:"total"`
+	Imported int             `json:"imported"`
+	Rejected int             `json:"rejected"`
+	Rows     []UserImportRow `json:"rows"`
+}
+
+// UserImportRow is the outcome of a row, Row is its row in the file counting the header but not empty lines
+type UserImportRow struct {
+	Row            int      `json:"row"`
+	EmailAddress   string   `json:"emailAddress"`
+	Status         string   `json:"status"`
+	UserID         string   `json:"userID,omitempty"`
+	InvitationSent bool     `json:"invitationSent,omitempty"`
+	Errors         []string `json:"errors,omitempty"`
+}
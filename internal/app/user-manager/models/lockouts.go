@@ -0,0 +1,22 @@
+package models
+
+// LoginAttemptsDynamo tracks the failed logins of an account or of a client IP
+type LoginAttemptsDynamo struct {
+	DynamoKeys
+	// Subject is the email address or the IP address the attempts were made for
+	Subject     string
+	SubjectType string
+	// FailedAttempts counts the failures since the last successful login or since the window expired
+	FailedAttempts int
+	LastFailureAt  int64
+	// NextAttemptAt is the earliest time the next attempt is evaluated, it grows with every failure
+	NextAttemptAt int64
+	// LockedUntil is set once the failures reach the configured maximum
+	LockedUntil int64
+	ExpiresAt   int64
+}
+
+// Lockouts represents the throttled and locked login subjects
+type Lockouts struct {
+	Members []LoginAttemptsDynamo `json:"members"`
+}
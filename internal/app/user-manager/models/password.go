@@ -0,0 +1,12 @@
+package models
+
+// ForgotPasswordInput is the request body for requesting a password reset
+type ForgotPasswordInput struct {
+	EmailAddress string
+}
+
+// ResetPasswordInput is the request body for resetting a password with a reset token
+type ResetPasswordInput struct {
+	Token    string
+	Password string
+}
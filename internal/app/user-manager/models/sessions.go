@@ -0,0 +1,28 @@
+package models
+
+// TokenResponse holds the tokens issued for a session
+type TokenResponse struct {
+	AccessToken      string `json:"accessToken"`
+	RefreshToken     string `json:"refreshToken"`
+	TokenType        string `json:"tokenType"`
+	ExpiresAt        int64  `json:"expiresAt"`
+	RefreshExpiresAt int64  `json:"refreshExpiresAt"`
+}
+
+// RefreshTokenInput is the request body for refreshing a session
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RevokedSessionDynamo is the item stored for a revoked session.
+// The item is removed by the table TTL once every token of the session has expired.
+type RevokedSessionDynamo struct {
+	DynamoKeys
+	UserID        string
+	SessionID     string
+	RevokedAt     int64
+	RevokedBefore int64 `json:",omitempty"`
+	// RevokedBeforeNano is RevokedBefore in nanoseconds, so a session started right after the revocation stays valid
+	RevokedBeforeNano int64 `json:",omitempty"`
+	ExpiresAt         int64
+}
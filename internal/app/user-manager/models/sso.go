@@ -0,0 +1,27 @@
+package models
+
+// IdentityDynamo links an account at the identity provider to a user
+type IdentityDynamo struct {
+	DynamoKeys
+	Issuer  string
+	Subject string
+	UserID  string
+	// LinkedByEmail is set when the account was linked to a user that existed before by its email address.
+	// Multi-factor logins at the identity provider don't stand in for the two-factor authentication of such users.
+	LinkedByEmail bool
+	CreatedAt     int64
+}
+
+// SSOAuthorization is returned when a single sign-on login starts.
+// The frontend keeps the state to compare it with the one the identity provider sends back.
+type SSOAuthorization struct {
+	AuthorizationURL string `json:"authorizationURL"`
+	State            string `json:"state"`
+	ExpiresAt        int64  `json:"expiresAt"`
+}
+
+// SSOCallbackInput is the request body carrying what the identity provider sent to the redirect page
+type SSOCallbackInput struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
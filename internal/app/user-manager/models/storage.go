@@ -0,0 +1,35 @@
+package models
+
+// StorageLimitsDynamo is the item holding the default storage limits set by an admin
+type StorageLimitsDynamo struct {
+	DynamoKeys
+	StorageQuotaBytes int64
+	MaxFileSizeBytes  int64
+	UpdatedBy         string
+	UpdatedAt         int64
+}
+
+// StorageLimits are the storage quota and the largest file a user can upload, in bytes
+type StorageLimits struct {
+	StorageQuotaBytes int64 `json:"storageQuotaBytes"`
+	MaxFileSizeBytes  int64 `json:"maxFileSizeBytes"`
+}
+
+// StorageLimitsInput is the request body for changing storage limits, limits that are left out keep their value.
+// For a user, a limit of 0 makes the default apply again.
+type StorageLimitsInput struct {
+	StorageQuotaBytes *int64 `json:"storageQuotaBytes"`
+	MaxFileSizeBytes  *int64 `json:"maxFileSizeBytes"`
+}
+
+// StorageUsage tells how much storage the user uses and the limits that apply to it
+type StorageUsage struct {
+	UserID         string `json:"userID"`
+	UsedBytes      int64  `json:"usedBytes"`
+	RemainingBytes int64  `json:"remainingBytes"`
+	FileCount      int    `json:"fileCount"`
+	StorageLimits
+	// CustomStorageQuota and CustomMaxFileSize are set when an admin gave the user its own limit instead of the default
+	CustomStorageQuota bool `json:"customStorageQuota"`
+	CustomMaxFileSize  bool `json:"customMaxFileSize"`
+}
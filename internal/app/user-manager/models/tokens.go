@@ -0,0 +1,15 @@
+package models
+
+// OneTimeTokenDynamo is the item stored for a single use token such as a password reset token.
+// The item is keyed by the token hash so the token itself is never stored.
+type OneTimeTokenDynamo struct {
+	DynamoKeys
+	UserID string
+	// EmailAddress is the address a verification token was sent to
+	EmailAddress string `json:",omitempty"`
+	// Nonce and CodeVerifier belong to a pending single sign-on login
+	Nonce        string `json:",omitempty"`
+	CodeVerifier string `json:",omitempty"`
+	CreatedAt    int64
+	ExpiresAt    int64
+}
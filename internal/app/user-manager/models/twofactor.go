@@ -0,0 +1,47 @@
+package models
+
+// TwoFactorDynamo is the TOTP enrollment item of a user.
+// It is kept apart from the user item so the secret is never returned with the user.
+type TwoFactorDynamo struct {
+	DynamoKeys
+	UserID string
+	Secret string
+	// Confirmed is set once the user proved the authenticator works with a valid code
+	Confirmed bool
+	// RecoveryCodes holds the hashes of the unused recovery codes
+	RecoveryCodes []string
+	// LastUsedStep is the TOTP time step of the last accepted code, older steps are refused
+	LastUsedStep int64
+	CreatedAt    int64
+}
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
+}
+
+// RecoveryCodes are the single use codes shown once to the user
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorCodeInput is the request body carrying an authenticator code or a recovery code
+type TwoFactorCodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// LoginTwoFactorInput is the request body of the second login step
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challengeToken"`
+	TwoFactorCodeInput
+}
+
+// LoginChallengeResponse is returned by the login instead of the tokens when the user has two-factor enabled
+type LoginChallengeResponse struct {
+	UserID            string
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresAt         int64  `json:"expiresAt"`
+}
@@ -5,30 +5,63 @@ import fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/mod
 // User represents the users
 type Users struct {
 	Members []User `json:"members"`
+	// NextCursor fetches the next page, it is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type DynamoKeys struct {
-	PKey string `json:PKey`
-	SKey string `json:SKey`
+	PKey string
+	SKey string
 }
 
+// Credentials holds the login of a user. The password hash is stored but never encoded to JSON.
 type Credentials struct {
-	EmailAddress string                         `json:emailAddress`
-	Password     []byte
+	EmailAddress string
+	Password     []byte `json:"-" dynamodbav:"Password"`
 }
 
 type CredIsAdmin struct {
-	EmailAddress string                         `json:emailAddress`
-	Password     []byte
-	IsAdmin      bool                           `json:isAdmin`
+	UserID       string
+	EmailAddress string
+	Password     []byte `json:"-" dynamodbav:"Password"`
+	IsAdmin      bool
+	// EmailVerificationPending is set until the user opens the mailed verification link
+	EmailVerificationPending bool
+	TwoFactorEnabled         bool
+	Disabled                 bool
+	PasswordResetRequired    bool
+	DeactivatedAt            int64
 }
 
 type User struct {
-	UserID       string                         `json:userID`
-	FirstName    string                         `json:firstName`
-	LastName     string                         `json:lastName,omitempty`
-	IsAdmin      bool                           `json:isAdmin`
-	FileInfo     map[string]fileModels.FileInfo `json:"files,omitempty"`
+	UserID    string
+	FirstName string
+	LastName  string
+	IsAdmin   bool
+	// FileInfo holds the metadata of the files of the user, each file is stored as an item of its own
+	FileInfo map[string]fileModels.FileInfo `json:"files,omitempty" dynamodbav:"-"`
+	// LegacyFileInfo holds the files stored on the user item before files became items, until they are migrated
+	LegacyFileInfo map[string]fileModels.FileInfo `json:"-" dynamodbav:"files,omitempty"`
+	// EmailVerificationPending is set until the user opens the mailed verification link.
+	// Accounts created before verification existed don't have it and count as verified.
+	EmailVerificationPending bool
+	// TwoFactorEnabled is set once the user confirmed a TOTP authenticator
+	TwoFactorEnabled bool
+	// Disabled is set by an admin, a disabled user can't login or use its tokens
+	Disabled bool
+	// PasswordResetRequired is set by an admin, the user has to reset the password before logging in again
+	PasswordResetRequired bool
+	// DeactivatedAt is the epoch second the account was deleted, it is purged after a grace period unless an admin restores it
+	DeactivatedAt int64
+	// CreatedAt is the epoch second the user registered, users created before it was recorded don't have it
+	CreatedAt int64
+	// StorageQuotaBytes and MaxFileSizeBytes are limits an admin set for the user, the defaults apply while they are 0
+	StorageQuotaBytes int64
+	MaxFileSizeBytes  int64
+	// StorageUsedBytes is the total size of the files of the user, files uploaded before sizes were recorded don't count
+	StorageUsedBytes int64
+	// Version counts the writes of the user, an update of a user read before another write is rejected
+	Version int64 `json:"-" dynamodbav:"Version"`
 	Credentials
 }
 
@@ -37,22 +70,57 @@ type UserDynamo struct {
 	User
 }
 
+// UserFileDynamo holds the metadata of a file of a user, keyed by the user and the file name
+type UserFileDynamo struct {
+	DynamoKeys
+	fileModels.FileInfo
+}
+
+// EmailReservationDynamo holds an email address for a user, so two users can't register the same address.
+// It is keyed by the normalized address and makes logins a single item lookup.
+type EmailReservationDynamo struct {
+	DynamoKeys
+	UserID       string
+	EmailAddress string
+}
+
+// UserInput is the request body of a signup, admin rights are only granted by admins
 type UserInput struct {
-	FirstName    string `json:firstName`
-	LastName     string `json:lastName, omitempty`
-	EmailAddress string `json:emailAddress`
-	IsAdmin      bool   `json:isAdmin`
-	Password     string `json:password`
+	FirstName    string
+	LastName     string
+	EmailAddress string
+	Password     string
+}
+
+// UserProfileInput is the request body of a profile update, fields that are left out keep their value
+type UserProfileInput struct {
+	FirstName    *string
+	LastName     *string
+	EmailAddress *string
+}
+
+// ChangePasswordInput is the request body of a password change by the user
+type ChangePasswordInput struct {
+	CurrentPassword string
+	NewPassword     string
 }
 
 type UserInputLogin struct {
-	EmailAddress string `json:emailAddress`
-	Password string `json:password`
+	EmailAddress string
+	Password     string
+}
+
+// LoginResponse is returned on a successful login
+type LoginResponse struct {
+	UserID       string
+	EmailAddress string
+	IsAdmin      bool
+	TokenResponse
 }
 
 type UserOutput struct {
-	FirstName string `json:firstName`
-	LastName  string `json:lastName, omitempty`
+	FirstName string
+	LastName  string
 }
 
 // DefaultQuery is default query for building expression
@@ -60,3 +128,15 @@ type DefaultQuery struct {
 	Key   string
 	Value string
 }
+
+// ResendVerificationInput is the request body for mailing a new verification link
+type ResendVerificationInput struct {
+	EmailAddress string
+}
+
+// VerificationResponse is returned once an email address is verified
+type VerificationResponse struct {
+	UserID        string
+	EmailAddress  string
+	EmailVerified bool
+}
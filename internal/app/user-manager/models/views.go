@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+// FilesField is the field of the user views holding the files of the user
+const FilesField = "files"
+
+// PublicUser is the view of a user returned to the user itself. It only holds fields that are safe to show,
+// handlers return it instead of User so stored secrets can't reach a response.
+type PublicUser struct {
+	UserID                   string
+	FirstName                string
+	LastName                 string
+	EmailAddress             string
+	IsAdmin                  bool
+	EmailVerificationPending bool
+	TwoFactorEnabled         bool
+	CreatedAt                int64                          `json:",omitempty"`
+	FileInfo                 map[string]fileModels.FileInfo `json:"files,omitempty"`
+}
+
+// AdminUser is the view of a user returned to admins, with the account state they manage
+type AdminUser struct {
+	PublicUser
+	Disabled              bool
+	PasswordResetRequired bool
+	DeactivatedAt         int64 `json:",omitempty"`
+}
+
+// UserListing is a page of the user listing, with a view of each user
+type UserListing struct {
+	Members []interface{} `json:"members"`
+	// NextCursor fetches the next page, it is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPublicUser returns the view of the user shown to the user itself
+func NewPublicUser(user User) PublicUser {
+	return PublicUser{
+		UserID:                   user.UserID,
+		FirstName:                user.FirstName,
+		LastName:                 user.LastName,
+		EmailAddress:             user.EmailAddress,
+		IsAdmin:                  user.IsAdmin,
+		EmailVerificationPending: user.EmailVerificationPending,
+		TwoFactorEnabled:         user.TwoFactorEnabled,
+		CreatedAt:                user.CreatedAt,
+		FileInfo:                 user.FileInfo,
+	}
+}
+
+// NewAdminUser returns the view of the user shown to admins
+func NewAdminUser(user User) AdminUser {
+	return AdminUser{
+		PublicUser:            NewPublicUser(user),
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		DeactivatedAt:         user.DeactivatedAt,
+	}
+}
+
+// UserViewFields returns the fields of the user views, the ones a fields query parameter can name
+func UserViewFields() []string {
+	return utils.JSONFieldNames(reflect.TypeOf(AdminUser{}))
+}
+
+// ValidateUserViewFields reports the first field that isn't a field of the user views
+func ValidateUserViewFields(fields []string) error {
+	if unknown := utils.UnknownFields(reflect.TypeOf(AdminUser{}), fields); len(unknown) > 0 {
+		return fmt.Errorf("unknown field %s", unknown[0])
+	}
+	return nil
+}
+
+// NamesFiles reports whether the fields name the files of the user, listings only read files then
+func NamesFiles(fields []string) bool {
+	for _, field := range fields {
+		if field == FilesField {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUserView returns the admin or the public view of the user, narrowed to the given fields when there are any.
+// Fields only the admin view has are left out of the public view.
+func NewUserView(user User, admin bool, fields []string) (interface{}, error) {
+	var view interface{} = NewPublicUser(user)
+	if admin {
+		view = NewAdminUser(user)
+	}
+	if len(fields) == 0 {
+		return view, nil
+	}
+	return utils.SelectFields(view, fields)
+}
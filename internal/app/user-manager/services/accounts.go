@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	awss3 "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// AccountConfig holds the settings of account deletion
+type AccountConfig struct {
+	// PurgeGracePeriod is how long a deleted account can be restored before it is purged
+	PurgeGracePeriod time.Duration
+}
+
+// AccountService - holds the functions acting on a whole account
+type AccountService interface {
+	DeactivateAccount(ctx context.Context, userID string) (models.AccountDeactivation, *commonModels.ErrorResponse)
+	RestoreAccount(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse)
+	DeleteAccount(ctx context.Context, userID string) (models.AccountDeletionReport, *commonModels.ErrorResponse)
+	PurgeDeactivatedAccounts(ctx context.Context) (models.AccountPurgeReport, *commonModels.ErrorResponse)
+}
+
+// AccountManager implements AccountService
+type AccountManager struct {
+	UserDBSvc  database.UsersDynamoDBAPI
+	UserSvc    UserService
+	SessionSvc SessionService
+	FileSvc    awss3.IfAWSS3
+	Config     AccountConfig
+}
+
+// NewAccountService creates an instance of Account Service
+func NewAccountService(
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	sessionService SessionService,
+	fileSvc awss3.IfAWSS3,
+	config AccountConfig,
+) AccountService {
+	return &AccountManager{
+		UserDBSvc:  userDBSvc,
+		UserSvc:    userService,
+		SessionSvc: sessionService,
+		FileSvc:    fileSvc,
+		Config:     config,
+	}
+}
+
+// DeactivateAccount deletes the account of the user so that it can be restored until the grace period ends.
+// The sessions of the user are revoked, and its logins and tokens are rejected from then on.
+func (am *AccountManager) DeactivateAccount(ctx context.Context, userID string) (models.AccountDeactivation, *commonModels.ErrorResponse) {
+	deactivation := models.AccountDeactivation{UserID: userID}
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return deactivation, errResp
+	}
+	deactivation.DeactivatedAt = user.DeactivatedAt
+	if user.DeactivatedAt == 0 {
+		deactivation.DeactivatedAt = time.Now().Unix()
+		values := map[string]interface{}{"DeactivatedAt": deactivation.DeactivatedAt}
+		if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, values, isActiveAdmin(user)); errResp != nil {
+			return deactivation, errResp
+		}
+	}
+	deactivation.PurgeAt = am.purgeAt(deactivation.DeactivatedAt)
+
+	if errResp := am.SessionSvc.RevokeAllSessions(ctx, userID); errResp != nil {
+		return deactivation, errResp
+	}
+	deactivation.SessionsRevoked = true
+	log.Printf("Deactivated user %s, it is purged after %s", userID, time.Unix(deactivation.PurgeAt, 0).UTC().Format(time.RFC3339))
+	return deactivation, nil
+}
+
+// RestoreAccount makes a deleted account usable again, as long as it isn't purged.
+// The sessions revoked on deletion stay revoked, so the user logs in again.
+func (am *AccountManager) RestoreAccount(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountStatus{}, errResp
+	}
+	if user.DeactivatedAt == 0 {
+		return accountStatus(user), &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("User %s is not deleted", userID),
+			RecommendationAction: []string{"Only deleted accounts awaiting their purge can be restored"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, map[string]interface{}{"DeactivatedAt": 0}, false); errResp != nil {
+		return accountStatus(user), errResp
+	}
+	user.DeactivatedAt = 0
+	log.Printf("Restored user %s", userID)
+	return accountStatus(user), nil
+}
+
+// DeleteAccount permanently deletes the user with its files and everything stored under it.
+// The sessions are revoked first and the user item is deleted last, so a failed deletion can be retried.
+// An active admin is deactivated before anything is deleted, by the write that keeps another active admin.
+func (am *AccountManager) DeleteAccount(ctx context.Context, userID string) (models.AccountDeletionReport, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountDeletionReport{UserID: userID}, errResp
+	}
+	return am.deleteAccount(ctx, user, false)
+}
+
+// deleteAccount deletes the account read as user. A purge only deletes the user item when it is still deactivated
+// at the time it was read with, so an account restored during the purge is kept.
+func (am *AccountManager) deleteAccount(ctx context.Context, user models.UserDynamo, purge bool) (models.AccountDeletionReport, *commonModels.ErrorResponse) {
+	userID := user.UserID
+	report := models.AccountDeletionReport{UserID: userID}
+	if isActiveAdmin(user) {
+		values := map[string]interface{}{"DeactivatedAt": time.Now().Unix()}
+		if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, values, true); errResp != nil {
+			return report, errResp
+		}
+	}
+
+	if errResp := am.SessionSvc.RevokeAllSessions(ctx, userID); errResp != nil {
+		return report, errResp
+	}
+	report.SessionsRevoked = true
+
+	deletedFiles, err := am.FileSvc.DeleteUserFolderInS3(ctx, userID)
+	report.DeletedFiles = deletedFiles
+	if err != nil {
+		return report, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error deleting files of user %s after deleting %d. %s", userID, deletedFiles, err.Error()),
+			RecommendationAction: []string{"Delete the account again to retry"},
+			ErrorStatusCode:      http.StatusInternalServerError,
+		}
+	}
+	// data export archives hold copies of the files
+	deletedExports, err := am.FileSvc.DeleteUserFolderInS3(ctx, awss3.ExportFolder(userID))
+	report.DeletedFiles += deletedExports
+	if err != nil {
+		return report, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error deleting data exports of user %s after deleting %d. %s", userID, deletedExports, err.Error()),
+			RecommendationAction: []string{"Delete the account again to retry"},
+			ErrorStatusCode:      http.StatusInternalServerError,
+		}
+	}
+
+	deletedRecords, err := am.UserDBSvc.DeleteUserDataInDynamoDB(ctx, userID)
+	report.DeletedRecords = deletedRecords
+	if err != nil {
+		return report, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Error deleting data of user %s. %s", userID, err.Error()),
+			RecommendationAction: []string{"Delete the account again to retry"},
+			ErrorStatusCode:      http.StatusInternalServerError,
+		}
+	}
+
+	if purge {
+		err = am.UserDBSvc.DeleteDeactivatedUserInDynamoDB(ctx, userID, user.EmailAddress, user.DeactivatedAt)
+		if err == database.ErrUserChanged {
+			return report, &commonModels.ErrorResponse{
+				Message:         fmt.Sprintf("User %s was restored or deleted again while it was purged, only its files and data are deleted", userID),
+				ErrorStatusCode: http.StatusConflict,
+			}
+		}
+		if err != nil {
+			return report, &commonModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error deleting user. %s", err.Error()),
+				ErrorStatusCode: http.StatusInternalServerError,
+			}
+		}
+	} else if _, errResp := am.UserSvc.DeleteUser(ctx, userID); errResp != nil {
+		return report, errResp
+	}
+	report.DeletedRecords++
+	log.Printf("Deleted user %s with %d files and %d records", userID, report.DeletedFiles, report.DeletedRecords)
+	return report, nil
+}
+
+// PurgeDeactivatedAccounts permanently deletes the accounts whose grace period ended and reports which were purged.
+// The index listing them is eventually consistent, so every account is read again and skipped when it was restored
+// or deleted again since. An account that fails to purge is left for the next run.
+func (am *AccountManager) PurgeDeactivatedAccounts(ctx context.Context) (models.AccountPurgeReport, *commonModels.ErrorResponse) {
+	report := models.AccountPurgeReport{}
+	cutoff := time.Now().Add(-am.Config.PurgeGracePeriod).Unix()
+	userIDs, err := am.UserDBSvc.GetDeactivatedUserIDsInDynamoDB(ctx, cutoff)
+	if err != nil {
+		return report, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error listing deactivated users. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	for _, userID := range userIDs {
+		user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+		if errResp != nil {
+			log.Printf("Error reading user %s to purge. %s", userID, errResp.Message)
+			report.FailedUserIDs = append(report.FailedUserIDs, userID)
+			continue
+		}
+		if user.DeactivatedAt == 0 || user.DeactivatedAt > cutoff {
+			log.Printf("Skipped purging user %s, it was restored or deleted again", userID)
+			continue
+		}
+		if _, errResp := am.deleteAccount(ctx, user, true); errResp != nil {
+			log.Printf("Error purging user %s. %s", userID, errResp.Message)
+			report.FailedUserIDs = append(report.FailedUserIDs, userID)
+			continue
+		}
+		report.Purged++
+	}
+	return report, nil
+}
+
+func (am *AccountManager) purgeAt(deactivatedAt int64) int64 {
+	return time.Unix(deactivatedAt, 0).Add(am.Config.PurgeGracePeriod).Unix()
+}
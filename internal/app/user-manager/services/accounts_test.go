@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	awss3pkg "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+)
+
+// failingFolders fails to delete the folder of one user, the other methods of the interface are not used
+type failingFolders struct {
+	awss3pkg.IfAWSS3
+	failUserID string
+}
+
+func (ff *failingFolders) DeleteUserFolderInS3(ctx context.Context, userID string) (int, error) {
+	if userID == ff.failUserID {
+		return 0, errors.New("s3 unavailable")
+	}
+	return 0, nil
+}
+
+func deactivatedUser(userID string, deactivatedAt time.Time) models.UserDynamo {
+	return models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{PKey: userID, SKey: "user"},
+		User: models.User{
+			UserID:        userID,
+			Credentials:   models.Credentials{EmailAddress: userID + "@example.com"},
+			DeactivatedAt: deactivatedAt.Unix(),
+		},
+	}
+}
+
+func TestPurgeDeactivatedAccountsReportsFailures(t *testing.T) {
+	ctx := context.Background()
+	expired := time.Now().Add(-48 * time.Hour)
+	users := newMemoryUsers(
+		deactivatedUser("user-1", expired),
+		deactivatedUser("user-2", expired),
+		deactivatedUser("user-3", time.Now()),
+	)
+	sessions := &countingSessions{revoked: map[string]int{}}
+	accounts := NewAccountService(users, NewUserService(users, nil, nil), sessions, &failingFolders{failUserID: "user-2"}, AccountConfig{PurgeGracePeriod: 24 * time.Hour})
+
+	report, errResp := accounts.PurgeDeactivatedAccounts(ctx)
+	if errResp != nil {
+		t.Fatalf("PurgeDeactivatedAccounts: %s", errResp.Message)
+	}
+	if report.Purged != 1 || len(report.FailedUserIDs) != 1 || report.FailedUserIDs[0] != "user-2" {
+		t.Errorf("got %+v, want user-1 purged and user-2 failed", report)
+	}
+	if _, ok := users.users["user-1"]; ok {
+		t.Error("user-1 wasn't purged")
+	}
+	// the failed account and the one still in its grace period are kept for a later run
+	for _, userID := range []string{"user-2", "user-3"} {
+		if _, ok := users.users[userID]; !ok {
+			t.Errorf("%s was purged", userID)
+		}
+	}
+}
+
+// staleIndex lists the users that were deactivated when the index was last updated
+type staleIndex struct {
+	*memoryUsers
+	userIDs []string
+}
+
+func (si *staleIndex) GetDeactivatedUserIDsInDynamoDB(ctx context.Context, deactivatedBefore int64) ([]string, error) {
+	return si.userIDs, nil
+}
+
+// restoringFolders restores the user while its files are deleted, like a restore racing the purge
+type restoringFolders struct {
+	awss3pkg.IfAWSS3
+	users *memoryUsers
+}
+
+func (rf *restoringFolders) DeleteUserFolderInS3(ctx context.Context, userID string) (int, error) {
+	user := rf.users.users[userID]
+	user.DeactivatedAt = 0
+	rf.users.users[userID] = user
+	return 0, nil
+}
+
+func TestPurgeDeactivatedAccountsKeepsRestoredAccounts(t *testing.T) {
+	ctx := context.Background()
+	expired := time.Now().Add(-48 * time.Hour)
+	restored := deactivatedUser("user-1", expired)
+	restored.DeactivatedAt = 0
+	users := newMemoryUsers(restored, deactivatedUser("user-2", time.Now()))
+	sessions := &countingSessions{revoked: map[string]int{}}
+	config := AccountConfig{PurgeGracePeriod: 24 * time.Hour}
+
+	// the index still lists a restored account and one deleted again since
+	index := &staleIndex{memoryUsers: users, userIDs: []string{"user-1", "user-2"}}
+	accounts := NewAccountService(index, NewUserService(users, nil, nil), sessions, &failingFolders{}, config)
+	report, errResp := accounts.PurgeDeactivatedAccounts(ctx)
+	if errResp != nil {
+		t.Fatalf("PurgeDeactivatedAccounts: %s", errResp.Message)
+	}
+	if report.Purged != 0 || len(report.FailedUserIDs) != 0 || len(users.users) != 2 || len(sessions.revoked) != 0 {
+		t.Errorf("got %+v with %d users left, want both skipped", report, len(users.users))
+	}
+
+	// an account restored during its purge keeps its user
+	users.users["user-1"] = deactivatedUser("user-1", expired)
+	accounts = NewAccountService(users, NewUserService(users, nil, nil), sessions, &restoringFolders{users: users}, config)
+	report, errResp = accounts.PurgeDeactivatedAccounts(ctx)
+	if errResp != nil {
+		t.Fatalf("PurgeDeactivatedAccounts: %s", errResp.Message)
+	}
+	if report.Purged != 0 || len(report.FailedUserIDs) != 1 || report.FailedUserIDs[0] != "user-1" {
+		t.Errorf("got %+v, want user-1 failed", report)
+	}
+	if _, ok := users.users["user-1"]; !ok {
+		t.Error("user restored during the purge was deleted")
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// AdminService - holds the functions admins use to manage accounts
+type AdminService interface {
+	GetAccountStatus(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse)
+	SetDisabled(ctx context.Context, userID string, disabled bool) (models.AccountStatus, *commonModels.ErrorResponse)
+	SetAdmin(ctx context.Context, userID string, isAdmin bool) (models.AccountStatus, *commonModels.ErrorResponse)
+	ForcePasswordReset(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse)
+}
+
+// AdminManager implements AdminService
+type AdminManager struct {
+	UserDBSvc        database.UsersDynamoDBAPI
+	UserSvc          UserService
+	SessionSvc       SessionService
+	PasswordResetSvc PasswordResetService
+}
+
+// NewAdminService creates an instance of Admin Service
+func NewAdminService(
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	sessionService SessionService,
+	passwordResetService PasswordResetService,
+) AdminService {
+	return &AdminManager{
+		UserDBSvc:        userDBSvc,
+		UserSvc:          userService,
+		SessionSvc:       sessionService,
+		PasswordResetSvc: passwordResetService,
+	}
+}
+
+// GetAccountStatus returns the state of the account of the user
+func (am *AdminManager) GetAccountStatus(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountStatus{}, errResp
+	}
+	return accountStatus(user), nil
+}
+
+// SetDisabled disables or enables the account of the user. Disabling ends every session of the user.
+func (am *AdminManager) SetDisabled(ctx context.Context, userID string, disabled bool) (models.AccountStatus, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountStatus{}, errResp
+	}
+	revokesAdmin := disabled && isActiveAdmin(user)
+	if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, map[string]interface{}{"Disabled": disabled}, revokesAdmin); errResp != nil {
+		return accountStatus(user), errResp
+	}
+	user.Disabled = disabled
+	if disabled {
+		if errResp := am.SessionSvc.RevokeAllSessions(ctx, userID); errResp != nil {
+			return accountStatus(user), errResp
+		}
+	}
+	log.Printf("Set disabled of user %s to %t", userID, disabled)
+	return accountStatus(user), nil
+}
+
+// SetAdmin grants or revokes admin rights of the user. The sessions of the user pick up the change on the next request.
+func (am *AdminManager) SetAdmin(ctx context.Context, userID string, isAdmin bool) (models.AccountStatus, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountStatus{}, errResp
+	}
+	revokesAdmin := !isAdmin && isActiveAdmin(user)
+	if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, map[string]interface{}{"IsAdmin": isAdmin}, revokesAdmin); errResp != nil {
+		return accountStatus(user), errResp
+	}
+	user.IsAdmin = isAdmin
+	log.Printf("Set admin of user %s to %t", userID, isAdmin)
+	return accountStatus(user), nil
+}
+
+// ForcePasswordReset ends every session of the user and blocks password logins until the password is reset.
+// A reset link is mailed to the user.
+func (am *AdminManager) ForcePasswordReset(ctx context.Context, userID string) (models.AccountStatus, *commonModels.ErrorResponse) {
+	user, errResp := am.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.AccountStatus{}, errResp
+	}
+	if errResp := setUserAttributes(ctx, am.UserDBSvc, userID, map[string]interface{}{"PasswordResetRequired": true}, false); errResp != nil {
+		return accountStatus(user), errResp
+	}
+	user.PasswordResetRequired = true
+	if errResp := am.SessionSvc.RevokeAllSessions(ctx, userID); errResp != nil {
+		return accountStatus(user), errResp
+	}
+	if errResp := am.PasswordResetSvc.RequestPasswordReset(ctx, user.EmailAddress); errResp != nil {
+		log.Printf("Error mailing password reset link to user %s. %s", userID, errResp.Message)
+	}
+	log.Printf("Forced password reset of user %s", userID)
+	return accountStatus(user), nil
+}
+
+// setUserAttributes sets attributes of the user. Attributes taking the rights of an active admin away are only set
+// while another active admin is left, which the write checks itself so concurrent requests can't remove every admin.
+func setUserAttributes(ctx context.Context, userDBSvc database.UsersDynamoDBAPI, userID string, values map[string]interface{},
+	revokesAdmin bool) *commonModels.ErrorResponse {
+	var err error
+	if revokesAdmin {
+		err = userDBSvc.RevokeAdminInDynamoDB(ctx, userID, values)
+	} else {
+		err = userDBSvc.SetUserAttributesInDynamoDB(ctx, userID, values)
+	}
+	switch err {
+	case nil:
+		return nil
+	case database.ErrLastActiveAdmin:
+		return &commonModels.ErrorResponse{
+			Message:              "The last active admin can't be disabled, demoted or deleted",
+			RecommendationAction: []string{"Grant admin rights to another user first"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	case database.ErrUserChanged:
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Admins were changed by other requests while user %s was updated", userID),
+			RecommendationAction: []string{"Retry the request"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	case database.ErrUserNotFound:
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("User %s doesn't exist", userID),
+			ErrorStatusCode: http.StatusNotFound,
+		}
+	}
+	return &commonModels.ErrorResponse{
+		Message:         fmt.Sprintf("Error updating user. %s", err.Error()),
+		ErrorStatusCode: http.StatusInternalServerError,
+	}
+}
+
+// isActiveAdmin reports whether the user has admin rights, which disabled and deactivated admins don't
+func isActiveAdmin(user models.UserDynamo) bool {
+	return user.IsAdmin && !user.Disabled && user.DeactivatedAt == 0
+}
+
+func accountStatus(user models.UserDynamo) models.AccountStatus {
+	return models.AccountStatus{
+		UserID:                   user.UserID,
+		EmailAddress:             user.EmailAddress,
+		IsAdmin:                  user.IsAdmin,
+		Disabled:                 user.Disabled,
+		EmailVerificationPending: user.EmailVerificationPending,
+		TwoFactorEnabled:         user.TwoFactorEnabled,
+		PasswordResetRequired:    user.PasswordResetRequired,
+		HasPassword:              len(user.Password) > 0,
+		DeactivatedAt:            user.DeactivatedAt,
+	}
+}
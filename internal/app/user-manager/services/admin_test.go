@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+func newAdmin(userID string) models.UserDynamo {
+	return models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{PKey: userID, SKey: "user"},
+		User:       models.User{UserID: userID, IsAdmin: true},
+	}
+}
+
+func TestLastActiveAdminIsKept(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		revoke func(admins AdminService, accounts AccountService, userID string) *commonModels.ErrorResponse
+	}{
+		{"demote", func(admins AdminService, accounts AccountService, userID string) *commonModels.ErrorResponse {
+			_, errResp := admins.SetAdmin(ctx, userID, false)
+			return errResp
+		}},
+		{"disable", func(admins AdminService, accounts AccountService, userID string) *commonModels.ErrorResponse {
+			_, errResp := admins.SetDisabled(ctx, userID, true)
+			return errResp
+		}},
+		{"deactivate", func(admins AdminService, accounts AccountService, userID string) *commonModels.ErrorResponse {
+			_, errResp := accounts.DeactivateAccount(ctx, userID)
+			return errResp
+		}},
+	}
+	for _, test := range tests {
+		users := newMemoryUsers(newAdmin("admin-1"), newAdmin("admin-2"))
+		sessions := &countingSessions{revoked: map[string]int{}}
+		userService := NewUserService(users, nil, nil)
+		admins := NewAdminService(users, userService, sessions, nil)
+		accounts := NewAccountService(users, userService, sessions, nil, AccountConfig{})
+
+		if errResp := test.revoke(admins, accounts, "admin-1"); errResp != nil {
+			t.Fatalf("%s: first admin: %s", test.name, errResp.Message)
+		}
+		errResp := test.revoke(admins, accounts, "admin-2")
+		if errResp == nil || errResp.ErrorStatusCode != http.StatusConflict {
+			t.Errorf("%s: last admin got %+v, want 409", test.name, errResp)
+		}
+		if !isActiveAdmin(users.users["admin-2"]) {
+			t.Errorf("%s: last admin lost its rights", test.name)
+		}
+		if users.unguardedRevokes != 0 {
+			t.Errorf("%s: admin rights were taken without keeping another admin", test.name)
+		}
+	}
+}
+
+func TestDeleteAccountKeepsLastActiveAdmin(t *testing.T) {
+	users := newMemoryUsers(newAdmin("admin-1"))
+	sessions := &countingSessions{revoked: map[string]int{}}
+	accounts := NewAccountService(users, NewUserService(users, nil, nil), sessions, nil, AccountConfig{})
+
+	_, errResp := accounts.DeleteAccount(context.Background(), "admin-1")
+	if errResp == nil || errResp.ErrorStatusCode != http.StatusConflict {
+		t.Fatalf("deleting the last admin got %+v, want 409", errResp)
+	}
+	if !isActiveAdmin(users.users["admin-1"]) || sessions.revoked["admin-1"] != 0 {
+		t.Errorf("deleting the last admin changed the account")
+	}
+}
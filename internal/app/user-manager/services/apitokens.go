@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	defaultAPITokenExpiryDays = 30
+	maxAPITokenExpiryDays     = 365
+	maxAPITokensPerUser       = 50
+	maxAPITokenNameLength     = 100
+)
+
+// APITokenService - holds the functions used to manage personal API tokens
+type APITokenService interface {
+	CreateAPIToken(ctx context.Context, userID string, input models.APITokenInput) (models.CreatedAPIToken, *commonModels.ErrorResponse)
+	GetAPITokens(ctx context.Context, userID string) (models.APITokens, *commonModels.ErrorResponse)
+	RevokeAPIToken(ctx context.Context, userID string, tokenID string) *commonModels.ErrorResponse
+	ValidateAPIToken(ctx context.Context, token string) (auth.Claims, *commonModels.ErrorResponse)
+}
+
+// APITokenManager implements APITokenService
+type APITokenManager struct {
+	APITokenDBSvc database.APITokensDynamoDBAPI
+	UserSvc       UserService
+}
+
+// NewAPITokenService creates an instance of API Token Service
+func NewAPITokenService(apiTokenDBSvc database.APITokensDynamoDBAPI, userService UserService) APITokenService {
+	return &APITokenManager{
+		APITokenDBSvc: apiTokenDBSvc,
+		UserSvc:       userService,
+	}
+}
+
+// CreateAPIToken creates a scoped API token for the user. The token is only returned here, it is stored hashed.
+func (am *APITokenManager) CreateAPIToken(ctx context.Context, userID string, input models.APITokenInput) (models.CreatedAPIToken, *commonModels.ErrorResponse) {
+	created := models.CreatedAPIToken{}
+	if errResp := validateAPITokenInput(&input); errResp != nil {
+		return created, errResp
+	}
+	if _, errResp := am.UserSvc.GetAndValidateUser(ctx, userID); errResp != nil {
+		return created, errResp
+	}
+	existing, err := am.APITokenDBSvc.GetAPITokensInDynamoDB(ctx, userID)
+	if err != nil {
+		return created, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting API tokens from database. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if len(existing) >= maxAPITokensPerUser {
+		return created, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("A user can have at most %d API tokens", maxAPITokensPerUser),
+			RecommendationAction: []string{"Revoke API tokens that are no longer used"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+
+	secret, _, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return created, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error generating API token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	tokenID := utils.GenerateUUID()
+	token := auth.FormatAPIToken(userID, tokenID, secret)
+	now := time.Now()
+	tokenDynamo := models.APITokenDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: userID,
+			SKey: database.APITokenSortKey(tokenID),
+		},
+		UserID:    userID,
+		TokenID:   tokenID,
+		TokenHash: auth.HashOpaqueToken(token),
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.AddDate(0, 0, input.ExpiresInDays).Unix(),
+	}
+	if err := am.APITokenDBSvc.CreateAPITokenInDynamoDB(ctx, tokenDynamo); err != nil {
+		return created, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error storing API token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	created.APIToken = apiTokenView(tokenDynamo)
+	created.Token = token
+	return created, nil
+}
+
+// GetAPITokens lists the unexpired API tokens of the user
+func (am *APITokenManager) GetAPITokens(ctx context.Context, userID string) (models.APITokens, *commonModels.ErrorResponse) {
+	tokens := models.APITokens{Members: []models.APIToken{}}
+	tokensDynamo, err := am.APITokenDBSvc.GetAPITokensInDynamoDB(ctx, userID)
+	if err != nil {
+		return tokens, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting API tokens from database. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	now := time.Now().Unix()
+	for _, tokenDynamo := range tokensDynamo {
+		// the table TTL deletes expired items lazily
+		if now >= tokenDynamo.ExpiresAt {
+			continue
+		}
+		tokens.Members = append(tokens.Members, apiTokenView(tokenDynamo))
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes an API token of the user, it stops working immediately
+func (am *APITokenManager) RevokeAPIToken(ctx context.Context, userID string, tokenID string) *commonModels.ErrorResponse {
+	err := am.APITokenDBSvc.DeleteAPITokenInDynamoDB(ctx, userID, tokenID)
+	if err == database.ErrAPITokenNotFound {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("No API token %s for user %s", tokenID, userID),
+			ErrorStatusCode: http.StatusNotFound,
+		}
+	}
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error deleting API token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ValidateAPIToken checks an API token against its stored hash and returns the claims it grants
+func (am *APITokenManager) ValidateAPIToken(ctx context.Context, token string) (auth.Claims, *commonModels.ErrorResponse) {
+	claims := auth.Claims{}
+	invalid := &commonModels.ErrorResponse{
+		Message:              "Invalid or expired API token",
+		RecommendationAction: []string{"Create a new API token"},
+		ErrorStatusCode:      http.StatusUnauthorized,
+	}
+	userID, tokenID, ok := auth.ParseAPIToken(token)
+	if !ok {
+		return claims, invalid
+	}
+	tokenDynamo, err := am.APITokenDBSvc.GetAPITokenInDynamoDB(ctx, userID, tokenID)
+	if err == database.ErrAPITokenNotFound {
+		return claims, invalid
+	}
+	if err != nil {
+		return claims, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error reading API token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(tokenDynamo.TokenHash), []byte(auth.HashOpaqueToken(token))) != 1 ||
+		time.Now().Unix() >= tokenDynamo.ExpiresAt {
+		return claims, invalid
+	}
+	// tokens stop working while the account is disabled and for good once it is deleted
+	if _, errResp := am.UserSvc.LoadPrincipal(ctx, tokenDynamo.UserID); errResp != nil {
+		if errResp.ErrorStatusCode == http.StatusBadRequest {
+			return claims, invalid
+		}
+		return claims, errResp
+	}
+	claims = auth.Claims{
+		Subject:   tokenDynamo.UserID,
+		SessionID: tokenDynamo.TokenID,
+		Scopes:    tokenDynamo.Scopes,
+		TokenType: auth.TokenTypeAPI,
+		IssuedAt:  tokenDynamo.CreatedAt,
+		ExpiresAt: tokenDynamo.ExpiresAt,
+	}
+	return claims, nil
+}
+
+// validateAPITokenInput checks the input and fills in the default expiry
+func validateAPITokenInput(input *models.APITokenInput) *commonModels.ErrorResponse {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > maxAPITokenNameLength {
+		return &commonModels.ErrorResponse{
+			Message:              "Invalid API token name",
+			RecommendationAction: []string{fmt.Sprintf("Name the token with 1 to %d characters", maxAPITokenNameLength)},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	if len(input.Scopes) == 0 {
+		return &commonModels.ErrorResponse{
+			Message:              "API token needs at least one scope",
+			RecommendationAction: []string{fmt.Sprintf("Choose scopes from %s", strings.Join(auth.APITokenScopes, ", "))},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	for _, scope := range input.Scopes {
+		valid := false
+		for _, known := range auth.APITokenScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return &commonModels.ErrorResponse{
+				Message:              fmt.Sprintf("Unknown API token scope %s", scope),
+				RecommendationAction: []string{fmt.Sprintf("Choose scopes from %s", strings.Join(auth.APITokenScopes, ", "))},
+				ErrorStatusCode:      http.StatusBadRequest,
+			}
+		}
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = defaultAPITokenExpiryDays
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAPITokenExpiryDays {
+		return &commonModels.ErrorResponse{
+			Message:              "Invalid API token expiry",
+			RecommendationAction: []string{fmt.Sprintf("Set expiresInDays between 1 and %d", maxAPITokenExpiryDays)},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+func apiTokenView(tokenDynamo models.APITokenDynamo) models.APIToken {
+	return models.APIToken{
+		TokenID:   tokenDynamo.TokenID,
+		Name:      tokenDynamo.Name,
+		Scopes:    tokenDynamo.Scopes,
+		CreatedAt: tokenDynamo.CreatedAt,
+		ExpiresAt: tokenDynamo.ExpiresAt,
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+)
+
+// memoryAPITokens keeps API tokens by user and token ID
+type memoryAPITokens struct {
+	tokens map[string]models.APITokenDynamo
+}
+
+func (mt *memoryAPITokens) CreateAPITokenInDynamoDB(ctx context.Context, token models.APITokenDynamo) error {
+	mt.tokens[token.UserID+"|"+token.TokenID] = token
+	return nil
+}
+
+func (mt *memoryAPITokens) GetAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) (models.APITokenDynamo, error) {
+	token, ok := mt.tokens[userID+"|"+tokenID]
+	if !ok {
+		return token, database.ErrAPITokenNotFound
+	}
+	return token, nil
+}
+
+func (mt *memoryAPITokens) GetAPITokensInDynamoDB(ctx context.Context, userID string) ([]models.APITokenDynamo, error) {
+	tokens := []models.APITokenDynamo{}
+	for _, token := range mt.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (mt *memoryAPITokens) DeleteAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) error {
+	if _, ok := mt.tokens[userID+"|"+tokenID]; !ok {
+		return database.ErrAPITokenNotFound
+	}
+	delete(mt.tokens, userID+"|"+tokenID)
+	return nil
+}
+
+func TestAPITokenIsCheckedAgainstItsHash(t *testing.T) {
+	ctx := context.Background()
+	tokens := &memoryAPITokens{tokens: map[string]models.APITokenDynamo{}}
+	users := newMemoryUsers(
+		models.UserDynamo{User: models.User{UserID: "user-1"}},
+		models.UserDynamo{User: models.User{UserID: "user-2"}},
+	)
+	service := NewAPITokenService(tokens, NewUserService(users, nil, nil))
+
+	created, errResp := service.CreateAPIToken(ctx, "user-1", models.APITokenInput{Name: "ci", Scopes: []string{auth.ScopeRead}})
+	if errResp != nil {
+		t.Fatalf("CreateAPIToken: %s", errResp.Message)
+	}
+	stored := tokens.tokens["user-1|"+created.TokenID]
+	if stored.TokenHash != auth.HashOpaqueToken(created.Token) || strings.Contains(stored.TokenHash, created.Token) {
+		t.Errorf("stored %q, want only the hash of the token", stored.TokenHash)
+	}
+
+	claims, errResp := service.ValidateAPIToken(ctx, created.Token)
+	if errResp != nil {
+		t.Fatalf("ValidateAPIToken: %s", errResp.Message)
+	}
+	if claims.Subject != "user-1" || claims.TokenType != auth.TokenTypeAPI || !claims.HasScope(auth.ScopeRead) || claims.HasScope(auth.ScopeDelete) {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	userID, tokenID, _ := auth.ParseAPIToken(created.Token)
+	secret := strings.TrimPrefix(created.Token, auth.FormatAPIToken(userID, tokenID, ""))
+	otherSecret := "x" + secret[1:]
+	if otherSecret == secret {
+		otherSecret = "y" + secret[1:]
+	}
+	invalid := map[string]string{
+		"other secret": auth.FormatAPIToken(userID, tokenID, otherSecret),
+		// the secret only opens the token it was issued with
+		"other user":    auth.FormatAPIToken("user-2", tokenID, secret),
+		"unknown token": auth.FormatAPIToken(userID, "token-2", secret),
+		"malformed":     "uat_" + secret,
+	}
+	for name, token := range invalid {
+		if _, errResp := service.ValidateAPIToken(ctx, token); errResp == nil || errResp.ErrorStatusCode != http.StatusUnauthorized {
+			t.Errorf("%s got %+v, want 401", name, errResp)
+		}
+	}
+
+	stored.ExpiresAt = time.Now().Unix()
+	tokens.tokens["user-1|"+created.TokenID] = stored
+	if _, errResp := service.ValidateAPIToken(ctx, created.Token); errResp == nil || errResp.ErrorStatusCode != http.StatusUnauthorized {
+		t.Errorf("expired token got %+v, want 401", errResp)
+	}
+}
+
+func TestAPITokenStopsWithItsAccount(t *testing.T) {
+	ctx := context.Background()
+	tokens := &memoryAPITokens{tokens: map[string]models.APITokenDynamo{}}
+	users := newMemoryUsers(models.UserDynamo{User: models.User{UserID: "user-1"}})
+	service := NewAPITokenService(tokens, NewUserService(users, nil, nil))
+	created, errResp := service.CreateAPIToken(ctx, "user-1", models.APITokenInput{Name: "ci", Scopes: []string{auth.ScopeUpload}})
+	if errResp != nil {
+		t.Fatalf("CreateAPIToken: %s", errResp.Message)
+	}
+
+	disabled := users.users["user-1"]
+	disabled.Disabled = true
+	users.users["user-1"] = disabled
+	if _, errResp := service.ValidateAPIToken(ctx, created.Token); errResp == nil {
+		t.Error("token of a disabled account was accepted")
+	}
+	disabled.Disabled = false
+	users.users["user-1"] = disabled
+
+	if errResp := service.RevokeAPIToken(ctx, "user-1", created.TokenID); errResp != nil {
+		t.Fatalf("RevokeAPIToken: %s", errResp.Message)
+	}
+	if _, errResp := service.ValidateAPIToken(ctx, created.Token); errResp == nil || errResp.ErrorStatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token got %+v, want 401", errResp)
+	}
+}
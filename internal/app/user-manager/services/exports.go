@@ -0,0 +1,271 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	awss3 "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+// ExportConfig holds the settings of data exports
+type ExportConfig struct {
+	// TTL is how long a finished archive can be downloaded
+	TTL time.Duration
+	// MaxRunTime is how long an export may run, a running export older than it was interrupted
+	MaxRunTime time.Duration
+}
+
+// ExportService - holds the functions used to export the data of a user as a downloadable archive
+type ExportService interface {
+	StartExport(ctx context.Context, userID string) (models.ExportJob, *commonModels.ErrorResponse)
+	GetExport(ctx context.Context, userID string, exportID string) (models.ExportJob, *commonModels.ErrorResponse)
+}
+
+// ExportManager implements ExportService
+type ExportManager struct {
+	ExportDBSvc database.ExportsDynamoDBAPI
+	UserSvc     UserService
+	FileSvc     awss3.IfAWSS3
+	Config      ExportConfig
+}
+
+// NewExportService creates an instance of Export Service
+func NewExportService(
+	exportDBSvc database.ExportsDynamoDBAPI,
+	userService UserService,
+	fileSvc awss3.IfAWSS3,
+	config ExportConfig,
+) ExportService {
+	return &ExportManager{
+		ExportDBSvc: exportDBSvc,
+		UserSvc:     userService,
+		FileSvc:     fileSvc,
+		Config:      config,
+	}
+}
+
+// StartExport starts building the archive of the user in the background and returns the running export.
+// While an export of the user is running it is returned instead of starting another one.
+func (em *ExportManager) StartExport(ctx context.Context, userID string) (models.ExportJob, *commonModels.ErrorResponse) {
+	user, errResp := em.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.ExportJob{}, errResp
+	}
+	exports, err := em.ExportDBSvc.GetExportsInDynamoDB(ctx, userID)
+	if err != nil {
+		return models.ExportJob{}, exportDBError(userID, err)
+	}
+	now := time.Now()
+	for _, export := range exports {
+		if export.Status == constants.ExportStatusRunning && !em.interrupted(export, now) {
+			return exportJob(export), nil
+		}
+	}
+
+	export := models.ExportDynamo{
+		ExportID:  utils.GenerateUUID(),
+		UserID:    userID,
+		Status:    constants.ExportStatusRunning,
+		CreatedAt: now.Unix(),
+		// an export that never finishes still expires
+		ExpiresAt: now.Add(em.Config.MaxRunTime + em.Config.TTL).Unix(),
+	}
+	if err := em.ExportDBSvc.PutExportInDynamoDB(ctx, export); err != nil {
+		return models.ExportJob{}, exportDBError(userID, err)
+	}
+	go em.runExport(user.User, export)
+	log.Printf("Started data export %s of user %s", export.ExportID, userID)
+	return exportJob(export), nil
+}
+
+// GetExport returns the state of an export of the user, with a link to download the archive once it is ready
+func (em *ExportManager) GetExport(ctx context.Context, userID string, exportID string) (models.ExportJob, *commonModels.ErrorResponse) {
+	export, err := em.ExportDBSvc.GetExportInDynamoDB(ctx, userID, exportID)
+	if err != nil {
+		return models.ExportJob{}, exportDBError(userID, err)
+	}
+	now := time.Now()
+	// TTL removes expired items some time after they expire
+	if now.Unix() >= export.ExpiresAt {
+		return models.ExportJob{}, exportDBError(userID, database.ErrExportNotFound)
+	}
+	if export.Status == constants.ExportStatusRunning && em.interrupted(export, now) {
+		export.Status = constants.ExportStatusFailed
+		export.Error = "The export was interrupted"
+	}
+	job := exportJob(export)
+	if export.Status != constants.ExportStatusReady {
+		return job, nil
+	}
+	downloadInfo, err := em.FileSvc.GenerateS3PresignedURL(ctx, awss3.ExportFolder(userID), exportFileName(exportID))
+	if err != nil {
+		return job, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error while getting presigned URL for export %s. Error: %s", exportID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	job.PresignedURL = downloadInfo.PresignedURL
+	return job, nil
+}
+
+// runExport builds the archive and records how the export ended, it runs detached from the request that started it
+func (em *ExportManager) runExport(user models.User, export models.ExportDynamo) {
+	ctx, cancel := context.WithTimeout(context.Background(), em.Config.MaxRunTime)
+	defer cancel()
+	manifest, err := em.uploadArchive(ctx, user, export)
+	completedAt := time.Now()
+	export.CompletedAt = completedAt.Unix()
+	if err != nil {
+		log.Printf("Data export %s of user %s failed. %s", export.ExportID, user.UserID, err.Error())
+		export.Status = constants.ExportStatusFailed
+		export.Error = err.Error()
+	} else {
+		log.Printf("Data export %s of user %s is ready with %d files", export.ExportID, user.UserID, len(manifest.Files))
+		export.Status = constants.ExportStatusReady
+		export.FileCount = len(manifest.Files)
+		export.MissingFiles = manifest.MissingFiles
+		export.ExpiresAt = completedAt.Add(em.Config.TTL).Unix()
+	}
+	if err := em.ExportDBSvc.PutExportInDynamoDB(context.Background(), export); err != nil {
+		log.Printf("Error recording the end of data export %s of user %s. %s", export.ExportID, user.UserID, err.Error())
+	}
+}
+
+// uploadArchive streams the archive to S3 while it is written, so files are never held in memory as a whole
+func (em *ExportManager) uploadArchive(ctx context.Context, user models.User, export models.ExportDynamo) (models.ExportManifest, error) {
+	reader, writer := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() {
+		err := em.FileSvc.UploadAttachmentTOS3Bucket(ctx, awss3.ExportFolder(user.UserID), exportFileName(export.ExportID), reader)
+		// a failed upload stops the archive from being written
+		reader.CloseWithError(err)
+		uploaded <- err
+	}()
+	manifest, err := em.writeArchive(ctx, writer, user, export)
+	writer.CloseWithError(err)
+	uploadErr := <-uploaded
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, uploadErr
+}
+
+// writeArchive writes the profile, the file metadata, the files and a manifest as a zip archive.
+// Files whose content is missing in S3 are left out and listed in the manifest.
+func (em *ExportManager) writeArchive(ctx context.Context, w io.Writer, user models.User, export models.ExportDynamo) (models.ExportManifest, error) {
+	manifest := models.ExportManifest{
+		ExportID:  export.ExportID,
+		UserID:    user.UserID,
+		CreatedAt: time.Unix(export.CreatedAt, 0).UTC().Format(time.RFC3339),
+		Files:     []string{},
+	}
+	archive := zip.NewWriter(w)
+	profile := models.NewPublicUser(user)
+	profile.FileInfo = nil
+	if err := writeArchiveJSON(archive, "profile.json", profile); err != nil {
+		return manifest, err
+	}
+	if err := writeArchiveJSON(archive, "files.json", user.FileInfo); err != nil {
+		return manifest, err
+	}
+
+	fileNames := make([]string, 0, len(user.FileInfo))
+	for fileName := range user.FileInfo {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		found, err := em.writeArchiveFile(ctx, archive, user.UserID, fileName)
+		if err != nil {
+			return manifest, fmt.Errorf("Error adding file %s to the archive. %s", fileName, err.Error())
+		}
+		if !found {
+			manifest.MissingFiles = append(manifest.MissingFiles, fileName)
+			continue
+		}
+		manifest.Files = append(manifest.Files, fileName)
+	}
+
+	if err := writeArchiveJSON(archive, "export.json", manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, archive.Close()
+}
+
+// writeArchiveFile copies a file of the user from S3 into the archive, it reports false when S3 has no such file
+func (em *ExportManager) writeArchiveFile(ctx context.Context, archive *zip.Writer, userID string, fileName string) (bool, error) {
+	body, err := em.FileSvc.GetFileFromS3(ctx, userID, fileName)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	entry, err := archive.Create("files/" + fileName)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(entry, body)
+	return true, err
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, value interface{}) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func (em *ExportManager) interrupted(export models.ExportDynamo, now time.Time) bool {
+	return now.After(time.Unix(export.CreatedAt, 0).Add(em.Config.MaxRunTime))
+}
+
+func exportFileName(exportID string) string {
+	return exportID + ".zip"
+}
+
+func exportJob(export models.ExportDynamo) models.ExportJob {
+	return models.ExportJob{
+		ExportID:     export.ExportID,
+		Status:       export.Status,
+		CreatedAt:    export.CreatedAt,
+		CompletedAt:  export.CompletedAt,
+		FileCount:    export.FileCount,
+		MissingFiles: export.MissingFiles,
+		Error:        export.Error,
+		ExpiresAt:    export.ExpiresAt,
+	}
+}
+
+func exportDBError(userID string, err error) *commonModels.ErrorResponse {
+	if err == database.ErrExportNotFound {
+		return &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("User %s has no such data export", userID),
+			RecommendationAction: []string{"Start a new data export, archives expire after a while"},
+			ErrorStatusCode:      http.StatusNotFound,
+		}
+	}
+	return &commonModels.ErrorResponse{
+		Message:         fmt.Sprintf("Error getting data exports of user %s. %s", userID, err.Error()),
+		ErrorStatusCode: http.StatusInternalServerError,
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+)
+
+// memoryTokens keeps one-time tokens like the table does, consuming a token deletes it
+type memoryTokens struct {
+	tokens map[string]models.OneTimeTokenDynamo
+}
+
+func newMemoryTokens() *memoryTokens {
+	return &memoryTokens{tokens: map[string]models.OneTimeTokenDynamo{}}
+}
+
+func (mt *memoryTokens) CreateOneTimeTokenInDynamoDB(ctx context.Context, token models.OneTimeTokenDynamo) error {
+	key := token.PKey + "|" + token.SKey
+	if _, ok := mt.tokens[key]; ok {
+		return errors.New("token exists")
+	}
+	mt.tokens[key] = token
+	return nil
+}
+
+func (mt *memoryTokens) ConsumeOneTimeTokenInDynamoDB(ctx context.Context, tokenHash string, tokenType string) (models.OneTimeTokenDynamo, error) {
+	key := tokenHash + "|" + tokenType
+	token, ok := mt.tokens[key]
+	if !ok {
+		return models.OneTimeTokenDynamo{}, database.ErrTokenNotFound
+	}
+	delete(mt.tokens, key)
+	return token, nil
+}
+
+// memoryUsers keeps users by ID with the version check of the table, the other methods of the interface are not used
+type memoryUsers struct {
+	database.UsersDynamoDBAPI
+	users map[string]models.UserDynamo
+	// unguardedRevokes counts the writes that took the rights of an active admin away without keeping another one
+	unguardedRevokes int
+}
+
+func newMemoryUsers(users ...models.UserDynamo) *memoryUsers {
+	mu := &memoryUsers{users: map[string]models.UserDynamo{}}
+	for _, user := range users {
+		mu.users[user.UserID] = user
+	}
+	return mu
+}
+
+func (mu *memoryUsers) GetUserInDynamoDB(ctx context.Context, pkey string, skey string) (models.UserDynamo, error) {
+	return mu.users[pkey], nil
+}
+
+func (mu *memoryUsers) GetUserCredentials(ctx context.Context, userEmail string) (models.CredIsAdmin, error) {
+	for _, user := range mu.users {
+		if database.NormalizeEmail(user.EmailAddress) == database.NormalizeEmail(userEmail) {
+			return models.CredIsAdmin{
+				UserID:                   user.UserID,
+				EmailAddress:             user.EmailAddress,
+				Password:                 user.Password,
+				IsAdmin:                  user.IsAdmin,
+				EmailVerificationPending: user.EmailVerificationPending,
+			}, nil
+		}
+	}
+	return models.CredIsAdmin{}, database.ErrUserNotFound
+}
+
+func (mu *memoryUsers) CreateNewUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error) {
+	if _, err := mu.GetUserCredentials(ctx, user.EmailAddress); err == nil {
+		return models.UserDynamo{}, database.ErrEmailTaken
+	}
+	mu.users[user.UserID] = user
+	return user, nil
+}
+
+func (mu *memoryUsers) UpdateUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error) {
+	stored, ok := mu.users[user.UserID]
+	if !ok {
+		return user, database.ErrUserNotFound
+	}
+	if stored.Version != user.Version {
+		return user, database.ErrUserChanged
+	}
+	user.Version++
+	mu.users[user.UserID] = user
+	return user, nil
+}
+
+func (mu *memoryUsers) SetUserAttributesInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error {
+	user, ok := mu.users[userID]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	wasActiveAdmin := isActiveAdmin(user)
+	user = withAttributes(user, values)
+	if wasActiveAdmin && !isActiveAdmin(user) {
+		mu.unguardedRevokes++
+	}
+	mu.users[userID] = user
+	return nil
+}
+
+// RevokeAdminInDynamoDB keeps another active admin like the transaction of the table does
+func (mu *memoryUsers) RevokeAdminInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error {
+	user, ok := mu.users[userID]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	for otherID, other := range mu.users {
+		if otherID != userID && isActiveAdmin(other) {
+			mu.users[userID] = withAttributes(user, values)
+			return nil
+		}
+	}
+	return database.ErrLastActiveAdmin
+}
+
+func (mu *memoryUsers) GetDeactivatedUserIDsInDynamoDB(ctx context.Context, deactivatedBefore int64) ([]string, error) {
+	var userIDs []string
+	for userID, user := range mu.users {
+		if user.DeactivatedAt > 0 && user.DeactivatedAt <= deactivatedBefore {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+func (mu *memoryUsers) DeleteUserDataInDynamoDB(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+func (mu *memoryUsers) DeleteUserAndEmailInDynamoDB(ctx context.Context, userID string, email string) error {
+	delete(mu.users, userID)
+	return nil
+}
+
+func (mu *memoryUsers) DeleteDeactivatedUserInDynamoDB(ctx context.Context, userID string, email string, deactivatedAt int64) error {
+	if mu.users[userID].DeactivatedAt != deactivatedAt {
+		return database.ErrUserChanged
+	}
+	delete(mu.users, userID)
+	return nil
+}
+
+func withAttributes(user models.UserDynamo, values map[string]interface{}) models.UserDynamo {
+	for name, value := range values {
+		switch name {
+		case "IsAdmin":
+			user.IsAdmin = value.(bool)
+		case "Disabled":
+			user.Disabled = value.(bool)
+		case "DeactivatedAt":
+			user.DeactivatedAt = reflect.ValueOf(value).Int()
+		case "PasswordResetRequired":
+			user.PasswordResetRequired = value.(bool)
+		}
+	}
+	user.Version++
+	return user
+}
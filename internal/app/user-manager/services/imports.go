@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+// importColumns are the columns of an import file in their order, isAdmin can be left out
+var importColumns = []string{"firstName", "lastName", "email", "isAdmin"}
+
+// ImportConfig holds the settings of user imports
+type ImportConfig struct {
+	// InviteURL is the frontend page the invitation token is appended to
+	InviteURL     string
+	InvitationTTL time.Duration
+	// MaxRows is the most users one file can hold
+	MaxRows int
+}
+
+// ImportService - holds the functions used to create users in bulk and let them into their accounts
+type ImportService interface {
+	ImportUsers(ctx context.Context, adminID string, file io.Reader, dryRun bool) (models.UserImportReport, *commonModels.ErrorResponse)
+	AcceptInvitation(ctx context.Context, input models.ResetPasswordInput) *commonModels.ErrorResponse
+}
+
+// ImportManager implements ImportService
+type ImportManager struct {
+	UserDBSvc  database.UsersDynamoDBAPI
+	UserSvc    UserService
+	TokenDBSvc database.OneTimeTokensDynamoDBAPI
+	Mailer     mailer.Mailer
+	Config     ImportConfig
+}
+
+// NewImportService creates an instance of Import Service
+func NewImportService(
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	tokenDBSvc database.OneTimeTokensDynamoDBAPI,
+	mail mailer.Mailer,
+	config ImportConfig,
+) ImportService {
+	return &ImportManager{
+		UserDBSvc:  userDBSvc,
+		UserSvc:    userService,
+		TokenDBSvc: tokenDBSvc,
+		Mailer:     mail,
+		Config:     config,
+	}
+}
+
+// importRecord is a row of the file holding a user, line is its line in the file
+type importRecord struct {
+	line   int
+	fields []string
+}
+
+// importRow is the outcome of a record with the user it describes
+type importRow struct {
+	report *models.UserImportRow
+	user   models.UserDynamo
+}
+
+// ImportUsers creates the users of a CSV file and mails each an invitation to set its password.
+// Every row is validated first and rows with errors, or with an address that is registered or repeated, are rejected
+// without stopping the others. A dry run only validates.
+func (im *ImportManager) ImportUsers(ctx context.Context, adminID string, file io.Reader, dryRun bool) (models.UserImportReport, *commonModels.ErrorResponse) {
+	report := models.UserImportReport{DryRun: dryRun, Rows: []models.UserImportRow{}}
+	records, errResp := im.readImportFile(file)
+	if errResp != nil {
+		return report, errResp
+	}
+	report.Rows = make([]models.UserImportRow, len(records))
+	rows := make([]importRow, 0, len(records))
+	firstRow := map[string]int{}
+	emails := []string{}
+	for i, record := range records {
+		report.Rows[i] = parseImportRow(record)
+		row := importRow{report: &report.Rows[i], user: newImportedUser(record.fields)}
+		if len(row.report.Errors) == 0 {
+			email := database.NormalizeEmail(row.user.EmailAddress)
+			if first, ok := firstRow[email]; ok {
+				row.report.Errors = append(row.report.Errors, fmt.Sprintf("Email address is already used in row %d", first))
+			} else {
+				firstRow[email] = row.report.Row
+				emails = append(emails, row.user.EmailAddress)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	reservations, err := im.UserDBSvc.GetEmailReservationsInDynamoDB(ctx, emails)
+	if err != nil {
+		return report, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error checking registered email addresses. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	valid := []importRow{}
+	for _, row := range rows {
+		if len(row.report.Errors) == 0 {
+			if _, ok := reservations[database.NormalizeEmail(row.user.EmailAddress)]; ok {
+				row.report.Errors = append(row.report.Errors, "A user with this email address already exists")
+			}
+		}
+		if len(row.report.Errors) > 0 {
+			row.report.Status = constants.ImportRowRejected
+			continue
+		}
+		row.report.Status = constants.ImportRowValid
+		valid = append(valid, row)
+	}
+	if !dryRun {
+		im.createUsers(ctx, valid)
+	}
+	for _, row := range report.Rows {
+		report.Total++
+		if row.Status == constants.ImportRowValid || row.Status == constants.ImportRowImported {
+			report.Imported++
+		} else {
+			report.Rejected++
+		}
+	}
+	if !dryRun {
+		log.Printf("Admin %s imported %d of %d users", adminID, report.Imported, report.Total)
+	}
+	return report, nil
+}
+
+// createUsers reserves the address of every user, so one registered since the check is still rejected,
+// writes the users in batches and mails the invitations
+func (im *ImportManager) createUsers(ctx context.Context, rows []importRow) {
+	reserved := []models.UserDynamo{}
+	byID := map[string]importRow{}
+	for _, row := range rows {
+		err := im.UserDBSvc.ReserveEmailInDynamoDB(ctx, row.user.EmailAddress, row.user.UserID)
+		if err == database.ErrEmailTaken {
+			row.report.Status = constants.ImportRowRejected
+			row.report.Errors = append(row.report.Errors, "A user with this email address already exists")
+			continue
+		}
+		if err != nil {
+			row.report.Status = constants.ImportRowFailed
+			row.report.Errors = append(row.report.Errors, fmt.Sprintf("Error reserving email address. %s", err.Error()))
+			continue
+		}
+		reserved = append(reserved, row.user)
+		byID[row.user.UserID] = row
+	}
+
+	unwritten, err := im.UserDBSvc.BatchCreateUsersInDynamoDB(ctx, reserved)
+	if err != nil {
+		log.Printf("Error writing imported users. %s", err.Error())
+	}
+	for _, user := range unwritten {
+		row := byID[user.UserID]
+		delete(byID, user.UserID)
+		row.report.Status = constants.ImportRowFailed
+		row.report.Errors = append(row.report.Errors, "Error creating user, import the row again")
+		// the address is released so the row can be imported again
+		if err := im.UserDBSvc.DeleteUserAndEmailInDynamoDB(ctx, user.UserID, user.EmailAddress); err != nil {
+			log.Printf("Error releasing email address of imported user %s. %s", user.UserID, err.Error())
+		}
+	}
+
+	for _, row := range rows {
+		if _, ok := byID[row.user.UserID]; !ok {
+			continue
+		}
+		row.report.Status = constants.ImportRowImported
+		row.report.UserID = row.user.UserID
+		// the user exists at this point, a failed mail leaves it to get in with a password reset and a verification mail
+		if errResp := im.sendInvitation(ctx, row.user.User); errResp != nil {
+			log.Printf("Error sending invitation to imported user %s. %s", row.user.UserID, errResp.Message)
+			row.report.Errors = append(row.report.Errors,
+				"Invitation mail failed, the user can get in with POST /v1/password/forgot and POST /v1/verify-email/resend")
+			continue
+		}
+		row.report.InvitationSent = true
+	}
+}
+
+// AcceptInvitation sets the first password of an imported user. The invitation was mailed to the user,
+// so its address counts as verified.
+func (im *ImportManager) AcceptInvitation(ctx context.Context, input models.ResetPasswordInput) *commonModels.ErrorResponse {
+	// the policy is checked first, so a rejected password doesn't use up the token
+	hashedPassword, errResp := im.UserSvc.HashNewPassword(ctx, input.Password)
+	if errResp != nil {
+		return errResp
+	}
+	invitation, errResp := consumeOneTimeToken(ctx, im.TokenDBSvc, constants.TypeInvitationForSortKey, input.Token, "Request a password reset mail")
+	if errResp != nil {
+		return errResp
+	}
+	user, errResp := im.UserSvc.GetAndValidateUser(ctx, invitation.UserID)
+	if errResp != nil {
+		return errResp
+	}
+	if invitation.EmailAddress == user.EmailAddress {
+		user.EmailVerificationPending = false
+	}
+	user.Password = hashedPassword
+	user.PasswordResetRequired = false
+	_, errResp = im.UserSvc.UpdateUser(ctx, user)
+	return errResp
+}
+
+func (im *ImportManager) sendInvitation(ctx context.Context, user models.User) *commonModels.ErrorResponse {
+	token, errResp := issueOneTimeToken(ctx, im.TokenDBSvc, constants.TypeInvitationForSortKey, user.UserID, user.EmailAddress, im.Config.InvitationTTL)
+	if errResp != nil {
+		return errResp
+	}
+	msg := mailer.Message{
+		To:      []string{user.EmailAddress},
+		Subject: "You have been invited to File Explorer",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"An account was created for you. Open the link below within %s to choose your password:\n%s\n",
+			user.FirstName, im.Config.InvitationTTL, im.Config.InviteURL+"?token="+url.QueryEscape(token)),
+	}
+	if err := im.Mailer.Send(ctx, msg); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error sending invitation mail. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// readImportFile returns the rows of the file holding users, a header row is skipped.
+// A file that isn't CSV, has no users or more than MaxRows is rejected as a whole.
+func (im *ImportManager) readImportFile(file io.Reader) ([]importRecord, *commonModels.ErrorResponse) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, invalidImportFile(fmt.Sprintf("File is not valid CSV. %s", err.Error()))
+	}
+	start := 0
+	if len(records) > 0 && isImportHeader(records[0]) {
+		start = 1
+	}
+	users := make([]importRecord, 0, len(records))
+	for i := start; i < len(records); i++ {
+		if isBlankRecord(records[i]) {
+			continue
+		}
+		users = append(users, importRecord{line: i + 1, fields: records[i]})
+	}
+	if len(users) == 0 {
+		return nil, invalidImportFile("File has no users")
+	}
+	if len(users) > im.Config.MaxRows {
+		return nil, invalidImportFile(fmt.Sprintf("File has %d users, at most %d can be imported at once", len(users), im.Config.MaxRows))
+	}
+	return users, nil
+}
+
+// parseImportRow validates a record of the file
+func parseImportRow(record importRecord) models.UserImportRow {
+	fields := record.fields
+	report := models.UserImportRow{Row: record.line}
+	if len(fields) < len(importColumns)-1 || len(fields) > len(importColumns) {
+		report.Errors = append(report.Errors, fmt.Sprintf("Row has %d columns, expected %s", len(fields), strings.Join(importColumns, ",")))
+		return report
+	}
+	report.EmailAddress = strings.TrimSpace(fields[2])
+	if _, errResp := validateName("First name", fields[0]); errResp != nil {
+		report.Errors = append(report.Errors, errResp.Message)
+	}
+	if _, errResp := validateName("Last name", fields[1]); errResp != nil {
+		report.Errors = append(report.Errors, errResp.Message)
+	}
+	if errResp := validateEmail(report.EmailAddress); errResp != nil {
+		report.Errors = append(report.Errors, errResp.Message)
+	}
+	if _, err := parseImportBool(fields); err != nil {
+		report.Errors = append(report.Errors, "isAdmin must be true or false")
+	}
+	return report
+}
+
+// newImportedUser returns the user of a valid row. It has no password until it accepts its invitation.
+func newImportedUser(fields []string) models.UserDynamo {
+	if len(fields) < len(importColumns)-1 {
+		return models.UserDynamo{}
+	}
+	isAdmin, _ := parseImportBool(fields)
+	userID := utils.GenerateUUID()
+	return models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: userID,
+			SKey: constants.TypeUsersForSortKey,
+		},
+		User: models.User{
+			UserID:                   userID,
+			FirstName:                strings.TrimSpace(fields[0]),
+			LastName:                 strings.TrimSpace(fields[1]),
+			IsAdmin:                  isAdmin,
+			EmailVerificationPending: true,
+			CreatedAt:                time.Now().Unix(),
+			Credentials: models.Credentials{
+				EmailAddress: strings.TrimSpace(fields[2]),
+			},
+		},
+	}
+}
+
+// parseImportBool reads the optional isAdmin column, an empty value is false and spreadsheets' yes and no are accepted
+func parseImportBool(fields []string) (bool, error) {
+	if len(fields) < len(importColumns) {
+		return false, nil
+	}
+	switch value := strings.ToLower(strings.TrimSpace(fields[3])); value {
+	case "", "no":
+		return false, nil
+	case "yes":
+		return true, nil
+	default:
+		return strconv.ParseBool(value)
+	}
+}
+
+// isImportHeader reports whether the row names the columns, e.g. "First Name,Last Name,Email,Is Admin"
+func isImportHeader(record []string) bool {
+	if len(record) < 3 {
+		return false
+	}
+	column := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(record[2]))
+	return column == "email" || column == "emailaddress"
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func invalidImportFile(message string) *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message: message,
+		RecommendationAction: []string{
+			fmt.Sprintf("Send a CSV file with the columns %s, one user per row", strings.Join(importColumns, ",")),
+		},
+		ErrorStatusCode: http.StatusBadRequest,
+	}
+}
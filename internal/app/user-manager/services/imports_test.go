@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+)
+
+// memoryImports keeps the email reservations of the users next to them
+type memoryImports struct {
+	*memoryUsers
+	reserved map[string]string
+}
+
+func newMemoryImports(users ...models.UserDynamo) *memoryImports {
+	mi := &memoryImports{memoryUsers: newMemoryUsers(users...), reserved: map[string]string{}}
+	for _, user := range users {
+		mi.reserved[database.NormalizeEmail(user.EmailAddress)] = user.UserID
+	}
+	return mi
+}
+
+func (mi *memoryImports) GetEmailReservationsInDynamoDB(ctx context.Context, emails []string) (map[string]string, error) {
+	reservations := map[string]string{}
+	for _, email := range emails {
+		if userID, ok := mi.reserved[database.NormalizeEmail(email)]; ok {
+			reservations[database.NormalizeEmail(email)] = userID
+		}
+	}
+	return reservations, nil
+}
+
+func (mi *memoryImports) ReserveEmailInDynamoDB(ctx context.Context, email string, userID string) error {
+	if reservedBy, ok := mi.reserved[database.NormalizeEmail(email)]; ok && reservedBy != userID {
+		return database.ErrEmailTaken
+	}
+	mi.reserved[database.NormalizeEmail(email)] = userID
+	return nil
+}
+
+func (mi *memoryImports) BatchCreateUsersInDynamoDB(ctx context.Context, users []models.UserDynamo) ([]models.UserDynamo, error) {
+	for _, user := range users {
+		mi.users[user.UserID] = user
+	}
+	return nil, nil
+}
+
+func newImportTest(t *testing.T, users *memoryImports) (ImportService, string) {
+	outbox := t.TempDir()
+	mail, err := mailer.NewOutboxMailer(outbox, "no-reply@example.com")
+	if err != nil {
+		t.Fatalf("creating outbox mailer: %v", err)
+	}
+	config := ImportConfig{InviteURL: "https://app.example.com/accept-invitation", InvitationTTL: time.Hour, MaxRows: 6}
+	return NewImportService(users, NewUserService(users, nil, nil), newMemoryTokens(), mail, config), outbox
+}
+
+func sentMails(t *testing.T, outbox string) int {
+	t.Helper()
+	mails, err := filepath.Glob(filepath.Join(outbox, "*.eml"))
+	if err != nil {
+		t.Fatalf("listing outbox: %v", err)
+	}
+	return len(mails)
+}
+
+const importFile = `First Name,Last Name,Email,Is Admin
+Ada,Lovelace,ada@example.com,yes
+Grace,Hopper,grace@example.com,
+
+Alan,Turing,Grace@Example.com,no
+Edsger,Dijkstra,edsger@example.com,maybe
+Barbara,Liskov,not-an-email
+Linus,Torvalds,linus@example.com
+`
+
+func importStatuses(report models.UserImportReport) []string {
+	statuses := []string{}
+	for _, row := range report.Rows {
+		statuses = append(statuses, row.Status)
+	}
+	return statuses
+}
+
+func TestImportUsersReportsEveryRow(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryImports(models.UserDynamo{User: models.User{UserID: "user-1", Credentials: models.Credentials{EmailAddress: "Linus@example.com"}}})
+	imports, outbox := newImportTest(t, users)
+
+	report, errResp := imports.ImportUsers(ctx, "admin-1", strings.NewReader(importFile), false)
+	if errResp != nil {
+		t.Fatalf("ImportUsers: %s", errResp.Message)
+	}
+	// the header is counted and the empty line skipped, like CSV readers number rows
+	rows := []int{}
+	for _, row := range report.Rows {
+		rows = append(rows, row.Row)
+	}
+	if !reflect.DeepEqual(rows, []int{2, 3, 4, 5, 6, 7}) {
+		t.Errorf("got rows %v", rows)
+	}
+	// a repeated address, an invalid isAdmin, a missing column and a registered address are rejected
+	want := []string{
+		constants.ImportRowImported, constants.ImportRowImported, constants.ImportRowRejected,
+		constants.ImportRowRejected, constants.ImportRowRejected, constants.ImportRowRejected,
+	}
+	if statuses := importStatuses(report); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got statuses %v, want %v", statuses, want)
+	}
+	if report.Total != 6 || report.Imported != 2 || report.Rejected != 4 {
+		t.Errorf("got %d total, %d imported and %d rejected, want 6, 2 and 4", report.Total, report.Imported, report.Rejected)
+	}
+	if errs := report.Rows[2].Errors; len(errs) != 1 || !strings.Contains(errs[0], "row 3") {
+		t.Errorf("repeated address got errors %v, want one naming row 3", errs)
+	}
+
+	ada := users.users[report.Rows[0].UserID]
+	if !ada.IsAdmin || !ada.EmailVerificationPending || len(ada.Password) != 0 || users.users[report.Rows[1].UserID].IsAdmin {
+		t.Errorf("unexpected imported users %+v and %+v", ada.User, users.users[report.Rows[1].UserID].User)
+	}
+	if len(users.users) != 3 || sentMails(t, outbox) != 2 || !report.Rows[0].InvitationSent {
+		t.Errorf("stored %d users and sent %d invitations, want 3 and 2", len(users.users), sentMails(t, outbox))
+	}
+
+	// importing the file again rejects the users it created
+	report, errResp = imports.ImportUsers(ctx, "admin-1", strings.NewReader(importFile), false)
+	if errResp != nil {
+		t.Fatalf("ImportUsers: %s", errResp.Message)
+	}
+	if report.Imported != 0 || len(users.users) != 3 {
+		t.Errorf("second import created %d users", report.Imported)
+	}
+}
+
+func TestImportUsersDryRunOnlyValidates(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryImports()
+	imports, outbox := newImportTest(t, users)
+
+	report, errResp := imports.ImportUsers(ctx, "admin-1", strings.NewReader(importFile), true)
+	if errResp != nil {
+		t.Fatalf("ImportUsers: %s", errResp.Message)
+	}
+	if !report.DryRun || report.Imported != 3 || report.Rejected != 3 || report.Rows[0].Status != constants.ImportRowValid || report.Rows[0].UserID != "" {
+		t.Errorf("unexpected dry run report %+v", report)
+	}
+	if len(users.users) != 0 || len(users.reserved) != 0 || sentMails(t, outbox) != 0 {
+		t.Errorf("dry run stored %d users, %d reservations and sent %d mails", len(users.users), len(users.reserved), sentMails(t, outbox))
+	}
+}
+
+func TestImportUsersRejectsFile(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"not CSV":       "Ada,\"Lovelace,ada@example.com\n",
+		"header only":   "firstName,lastName,email,isAdmin\n",
+		"too many rows": strings.Repeat("Ada,Lovelace,ada@example.com\n", 7),
+	}
+	for name, file := range files {
+		imports, _ := newImportTest(t, newMemoryImports())
+		if _, errResp := imports.ImportUsers(ctx, "admin-1", strings.NewReader(file), false); errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+			t.Errorf("%s got %+v, want 400", name, errResp)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// recordFailureAttempts is how often counting a failure is tried while concurrent failures start counting again
+const recordFailureAttempts = 3
+
+// LockoutConfig holds the brute-force protection settings
+type LockoutConfig struct {
+	// MaxAccountFailures is the number of failures after which an account is locked
+	MaxAccountFailures int
+	// MaxIPFailures is the number of failures after which a client IP is locked
+	MaxIPFailures   int
+	LockoutDuration time.Duration
+	// FailureWindow is how long a failure counts towards the maximum
+	FailureWindow time.Duration
+	// BaseDelay is the wait after the first failure, doubled with every further failure
+	BaseDelay time.Duration
+}
+
+// LockoutService - holds the functions used to throttle and lock logins after failures
+type LockoutService interface {
+	CheckLoginAllowed(ctx context.Context, emailAddress string, clientIP string) (time.Duration, *commonModels.ErrorResponse)
+	RecordFailedLogin(ctx context.Context, emailAddress string, clientIP string) *commonModels.ErrorResponse
+	RecordSuccessfulLogin(ctx context.Context, emailAddress string) *commonModels.ErrorResponse
+	GetLockouts(ctx context.Context) (models.Lockouts, *commonModels.ErrorResponse)
+	ClearLockout(ctx context.Context, emailAddress string, clientIP string) *commonModels.ErrorResponse
+}
+
+// LockoutManager implements LockoutService
+type LockoutManager struct {
+	AttemptsDBSvc database.LoginAttemptsDynamoDBAPI
+	Config        LockoutConfig
+}
+
+// NewLockoutService creates an instance of Lockout Service
+func NewLockoutService(attemptsDBSvc database.LoginAttemptsDynamoDBAPI, config LockoutConfig) LockoutService {
+	return &LockoutManager{
+		AttemptsDBSvc: attemptsDBSvc,
+		Config:        config,
+	}
+}
+
+// CheckLoginAllowed rejects a login while the account or the client IP is delayed or locked.
+// It returns how long the caller has to wait before trying again.
+func (lm *LockoutManager) CheckLoginAllowed(ctx context.Context, emailAddress string, clientIP string) (time.Duration, *commonModels.ErrorResponse) {
+	attempts, err := lm.AttemptsDBSvc.GetLoginAttemptsInDynamoDB(ctx, loginAttemptsKeys(emailAddress, clientIP))
+	if err != nil {
+		return 0, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error reading failed login attempts. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	now := time.Now()
+	for _, attempt := range attempts {
+		if attempt.LockedUntil > now.Unix() {
+			lockedUntil := time.Unix(attempt.LockedUntil, 0)
+			return lockedUntil.Sub(now), &commonModels.ErrorResponse{
+				Message: fmt.Sprintf("Too many failed logins, the %s is locked until %s", attempt.SubjectType, lockedUntil.UTC().Format(time.RFC3339)),
+				RecommendationAction: []string{
+					fmt.Sprintf("Try again after %s", lockedUntil.UTC().Format(time.RFC3339)),
+					"Reset your password if you don't remember it",
+				},
+				ErrorStatusCode: http.StatusTooManyRequests,
+			}
+		}
+		if attempt.NextAttemptAt > now.Unix() {
+			nextAttempt := time.Unix(attempt.NextAttemptAt, 0)
+			return nextAttempt.Sub(now), &commonModels.ErrorResponse{
+				Message:              "Too many failed logins, slow down",
+				RecommendationAction: []string{fmt.Sprintf("Try again after %s", nextAttempt.UTC().Format(time.RFC3339))},
+				ErrorStatusCode:      http.StatusTooManyRequests,
+			}
+		}
+	}
+	return 0, nil
+}
+
+// RecordFailedLogin counts a failure for the account and the client IP and delays or locks them
+func (lm *LockoutManager) RecordFailedLogin(ctx context.Context, emailAddress string, clientIP string) *commonModels.ErrorResponse {
+	if errResp := lm.recordFailure(ctx, constants.LoginSubjectAccount, emailAddress, lm.Config.MaxAccountFailures); errResp != nil {
+		return errResp
+	}
+	if clientIP == "" {
+		return nil
+	}
+	return lm.recordFailure(ctx, constants.LoginSubjectIP, clientIP, lm.Config.MaxIPFailures)
+}
+
+// RecordSuccessfulLogin clears the failures of the account.
+// Failures of the client IP are kept so one valid account can't be used to reset them.
+func (lm *LockoutManager) RecordSuccessfulLogin(ctx context.Context, emailAddress string) *commonModels.ErrorResponse {
+	err := lm.AttemptsDBSvc.DeleteLoginAttemptsInDynamoDB(ctx, database.LoginAttemptsKey(constants.LoginSubjectAccount, emailAddress))
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error clearing failed login attempts. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// GetLockouts gets the accounts and client IPs that are currently delayed or locked
+func (lm *LockoutManager) GetLockouts(ctx context.Context) (models.Lockouts, *commonModels.ErrorResponse) {
+	lockouts := models.Lockouts{Members: []models.LoginAttemptsDynamo{}}
+	attempts, err := lm.AttemptsDBSvc.GetThrottledLoginAttemptsInDynamoDB(ctx, time.Now().Unix())
+	if err != nil {
+		return lockouts, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting lockouts from database. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	lockouts.Members = append(lockouts.Members, attempts...)
+	return lockouts, nil
+}
+
+// ClearLockout removes the failures, delay and lock of an account and/or a client IP
+func (lm *LockoutManager) ClearLockout(ctx context.Context, emailAddress string, clientIP string) *commonModels.ErrorResponse {
+	for _, pkey := range loginAttemptsKeys(emailAddress, clientIP) {
+		if err := lm.AttemptsDBSvc.DeleteLoginAttemptsInDynamoDB(ctx, pkey); err != nil {
+			return &commonModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error clearing lockout %s. %s", pkey, err.Error()),
+				ErrorStatusCode: http.StatusInternalServerError,
+			}
+		}
+	}
+	return nil
+}
+
+func (lm *LockoutManager) recordFailure(ctx context.Context, subjectType string, subject string, maxFailures int) *commonModels.ErrorResponse {
+	now := time.Now()
+	pkey := database.LoginAttemptsKey(subjectType, subject)
+	attempt := models.LoginAttemptsDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: pkey,
+			SKey: constants.TypeLoginAttemptsForSortKey,
+		},
+		Subject:        subject,
+		SubjectType:    subjectType,
+		FailedAttempts: 1,
+		LastFailureAt:  now.Unix(),
+		ExpiresAt:      now.Add(lm.Config.FailureWindow + lm.Config.LockoutDuration).Unix(),
+	}
+
+	// count the failure in one write, and start counting again once the failures are outside the window or
+	// a lock has run out. Only one of concurrent failures starts again, the others are counted to it.
+	windowStart := now.Add(-lm.Config.FailureWindow).Unix()
+	var err error
+	for i := 0; i < recordFailureAttempts; i++ {
+		var counted models.LoginAttemptsDynamo
+		counted, err = lm.AttemptsDBSvc.IncrementFailedLoginInDynamoDB(ctx, attempt, windowStart)
+		if err != database.ErrLoginAttemptsExpired {
+			attempt = counted
+			break
+		}
+		err = lm.AttemptsDBSvc.ResetFailedLoginInDynamoDB(ctx, attempt, windowStart)
+		if err != database.ErrLoginAttemptsChanged {
+			break
+		}
+	}
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error recording failed login attempt. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+
+	var nextAttemptAt, lockedUntil int64
+	if attempt.FailedAttempts >= maxFailures {
+		lockedUntil = now.Add(lm.Config.LockoutDuration).Unix()
+		nextAttemptAt = lockedUntil
+	} else {
+		nextAttemptAt = now.Add(lm.delay(attempt.FailedAttempts)).Unix()
+	}
+	// a failure counted after this one sets a longer delay or the lock itself
+	err = lm.AttemptsDBSvc.SetLoginThrottleInDynamoDB(ctx, pkey, attempt.FailedAttempts, nextAttemptAt, lockedUntil)
+	if err != nil && err != database.ErrLoginAttemptsChanged {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error recording login delay. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// delay doubles the base delay with every failure, never waiting longer than a lockout
+func (lm *LockoutManager) delay(failedAttempts int) time.Duration {
+	d := lm.Config.BaseDelay
+	for i := 1; i < failedAttempts && d < lm.Config.LockoutDuration; i++ {
+		d *= 2
+	}
+	if d > lm.Config.LockoutDuration {
+		d = lm.Config.LockoutDuration
+	}
+	return d
+}
+
+func loginAttemptsKeys(emailAddress string, clientIP string) []string {
+	pkeys := []string{}
+	if emailAddress != "" {
+		pkeys = append(pkeys, database.LoginAttemptsKey(constants.LoginSubjectAccount, emailAddress))
+	}
+	if clientIP != "" {
+		pkeys = append(pkeys, database.LoginAttemptsKey(constants.LoginSubjectIP, clientIP))
+	}
+	return pkeys
+}
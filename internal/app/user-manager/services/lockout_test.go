@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+)
+
+// memoryAttempts keeps login attempts with the conditions of the table, the other methods of the interface are not used
+type memoryAttempts struct {
+	database.LoginAttemptsDynamoDBAPI
+	mu    sync.Mutex
+	items map[string]models.LoginAttemptsDynamo
+}
+
+func newMemoryAttempts() *memoryAttempts {
+	return &memoryAttempts{items: map[string]models.LoginAttemptsDynamo{}}
+}
+
+func (ma *memoryAttempts) GetLoginAttemptsInDynamoDB(ctx context.Context, pkeys []string) ([]models.LoginAttemptsDynamo, error) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	attempts := []models.LoginAttemptsDynamo{}
+	for _, pkey := range pkeys {
+		if item, ok := ma.items[pkey]; ok {
+			attempts = append(attempts, item)
+		}
+	}
+	return attempts, nil
+}
+
+func (ma *memoryAttempts) IncrementFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) (models.LoginAttemptsDynamo, error) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	item, ok := ma.items[attempts.PKey]
+	if !ok || expiredAttempts(item, windowStart, attempts.LastFailureAt) {
+		return models.LoginAttemptsDynamo{}, database.ErrLoginAttemptsExpired
+	}
+	item.FailedAttempts++
+	item.LastFailureAt = attempts.LastFailureAt
+	item.ExpiresAt = attempts.ExpiresAt
+	ma.items[attempts.PKey] = item
+	return item, nil
+}
+
+func (ma *memoryAttempts) ResetFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) error {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	if item, ok := ma.items[attempts.PKey]; ok && !expiredAttempts(item, windowStart, attempts.LastFailureAt) {
+		return database.ErrLoginAttemptsChanged
+	}
+	ma.items[attempts.PKey] = attempts
+	return nil
+}
+
+func (ma *memoryAttempts) SetLoginThrottleInDynamoDB(ctx context.Context, pkey string, failedAttempts int, nextAttemptAt int64, lockedUntil int64) error {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	item := ma.items[pkey]
+	if item.FailedAttempts != failedAttempts {
+		return database.ErrLoginAttemptsChanged
+	}
+	item.NextAttemptAt = nextAttemptAt
+	item.LockedUntil = lockedUntil
+	ma.items[pkey] = item
+	return nil
+}
+
+func (ma *memoryAttempts) DeleteLoginAttemptsInDynamoDB(ctx context.Context, pkey string) error {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	delete(ma.items, pkey)
+	return nil
+}
+
+func expiredAttempts(item models.LoginAttemptsDynamo, windowStart int64, now int64) bool {
+	return item.LastFailureAt < windowStart || (item.LockedUntil != 0 && item.LockedUntil <= now)
+}
+
+func newLockoutTest() (LockoutService, *memoryAttempts) {
+	attempts := newMemoryAttempts()
+	return NewLockoutService(attempts, LockoutConfig{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		LockoutDuration:    15 * time.Minute,
+		FailureWindow:      15 * time.Minute,
+		BaseDelay:          time.Second,
+	}), attempts
+}
+
+func TestFailedLoginsDelayThenLockTheAccount(t *testing.T) {
+	ctx := context.Background()
+	lockouts, attempts := newLockoutTest()
+	accountKey := database.LoginAttemptsKey(constants.LoginSubjectAccount, "victim@example.com")
+	ipKey := database.LoginAttemptsKey(constants.LoginSubjectIP, "203.0.113.7")
+
+	if errResp := lockouts.RecordFailedLogin(ctx, "victim@example.com", "203.0.113.7"); errResp != nil {
+		t.Fatalf("RecordFailedLogin: %s", errResp.Message)
+	}
+	wait, errResp := lockouts.CheckLoginAllowed(ctx, "victim@example.com", "")
+	if errResp == nil || errResp.ErrorStatusCode != http.StatusTooManyRequests || wait > time.Second {
+		t.Fatalf("after a failure got %+v waiting %s, want 429 within the base delay", errResp, wait)
+	}
+
+	// other spellings of the address count towards the same account
+	for _, spelling := range []string{"Victim@Example.com", " victim@example.com", "VICTIM@example.com ", "victim@example.com"} {
+		if errResp := lockouts.RecordFailedLogin(ctx, spelling, "203.0.113.7"); errResp != nil {
+			t.Fatalf("RecordFailedLogin: %s", errResp.Message)
+		}
+	}
+	account := attempts.items[accountKey]
+	if account.FailedAttempts != 5 || account.LockedUntil <= time.Now().Unix() {
+		t.Fatalf("account has %d failures locked until %d, want 5 and a lock", account.FailedAttempts, account.LockedUntil)
+	}
+	if _, errResp := lockouts.CheckLoginAllowed(ctx, " Victim@example.com", "198.51.100.1"); errResp == nil || errResp.ErrorStatusCode != http.StatusTooManyRequests {
+		t.Errorf("locked account got %+v, want 429", errResp)
+	}
+
+	// a login clears the account, not the client IP
+	if errResp := lockouts.RecordSuccessfulLogin(ctx, "VICTIM@example.com"); errResp != nil {
+		t.Fatalf("RecordSuccessfulLogin: %s", errResp.Message)
+	}
+	if _, ok := attempts.items[accountKey]; ok {
+		t.Error("login kept the failures of the account")
+	}
+	if attempts.items[ipKey].FailedAttempts != 5 {
+		t.Errorf("client IP has %d failures, want 5", attempts.items[ipKey].FailedAttempts)
+	}
+}
+
+func TestFailedLoginsStartAgainAfterTheWindow(t *testing.T) {
+	ctx := context.Background()
+	lockouts, attempts := newLockoutTest()
+	accountKey := database.LoginAttemptsKey(constants.LoginSubjectAccount, "victim@example.com")
+	expiredLock := time.Now().Add(-time.Minute).Unix()
+	attempts.items[accountKey] = models.LoginAttemptsDynamo{
+		DynamoKeys:     models.DynamoKeys{PKey: accountKey, SKey: constants.TypeLoginAttemptsForSortKey},
+		FailedAttempts: 5,
+		LastFailureAt:  expiredLock,
+		NextAttemptAt:  expiredLock,
+		LockedUntil:    expiredLock,
+	}
+	if errResp := lockouts.RecordFailedLogin(ctx, "victim@example.com", ""); errResp != nil {
+		t.Fatalf("RecordFailedLogin: %s", errResp.Message)
+	}
+	if account := attempts.items[accountKey]; account.FailedAttempts != 1 || account.LockedUntil != 0 {
+		t.Errorf("after the lock ran out the account has %d failures locked until %d, want 1 and no lock", account.FailedAttempts, account.LockedUntil)
+	}
+}
+
+func TestConcurrentFailedLoginsAreAllCounted(t *testing.T) {
+	ctx := context.Background()
+	lockouts, attempts := newLockoutTest()
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errResp := lockouts.RecordFailedLogin(ctx, "victim@example.com", "203.0.113.7"); errResp != nil {
+				t.Errorf("RecordFailedLogin: %s", errResp.Message)
+			}
+		}()
+	}
+	wg.Wait()
+
+	account := attempts.items[database.LoginAttemptsKey(constants.LoginSubjectAccount, "victim@example.com")]
+	ip := attempts.items[database.LoginAttemptsKey(constants.LoginSubjectIP, "203.0.113.7")]
+	if account.FailedAttempts != 30 || ip.FailedAttempts != 30 {
+		t.Errorf("counted %d account and %d IP failures, want 30", account.FailedAttempts, ip.FailedAttempts)
+	}
+	// the throttle of an earlier failure doesn't replace the lock set by a later one
+	if account.LockedUntil == 0 || ip.LockedUntil == 0 {
+		t.Errorf("account locked until %d and IP until %d, want both locked", account.LockedUntil, ip.LockedUntil)
+	}
+}
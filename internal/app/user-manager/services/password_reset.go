@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// PasswordResetConfig holds the settings of the password reset flow
+type PasswordResetConfig struct {
+	// ResetURL is the frontend page the reset token is appended to
+	ResetURL string
+	TokenTTL time.Duration
+}
+
+// PasswordResetService - holds the functions used to recover an account
+type PasswordResetService interface {
+	RequestPasswordReset(ctx context.Context, emailAddress string) *commonModels.ErrorResponse
+	ResetPassword(ctx context.Context, input models.ResetPasswordInput) *commonModels.ErrorResponse
+}
+
+// PasswordResetManager implements PasswordResetService
+type PasswordResetManager struct {
+	TokenDBSvc database.OneTimeTokensDynamoDBAPI
+	UserDBSvc  database.UsersDynamoDBAPI
+	UserSvc    UserService
+	SessionSvc SessionService
+	Mailer     mailer.Mailer
+	Config     PasswordResetConfig
+}
+
+// NewPasswordResetService creates an instance of Password Reset Service
+func NewPasswordResetService(
+	tokenDBSvc database.OneTimeTokensDynamoDBAPI,
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	sessionService SessionService,
+	mail mailer.Mailer,
+	config PasswordResetConfig,
+) PasswordResetService {
+	return &PasswordResetManager{
+		TokenDBSvc: tokenDBSvc,
+		UserDBSvc:  userDBSvc,
+		UserSvc:    userService,
+		SessionSvc: sessionService,
+		Mailer:     mail,
+		Config:     config,
+	}
+}
+
+// RequestPasswordReset mails a reset link to the address if it belongs to a user.
+// Unknown addresses are not reported to the caller so the endpoint can't be used to find accounts.
+func (pm *PasswordResetManager) RequestPasswordReset(ctx context.Context, emailAddress string) *commonModels.ErrorResponse {
+	userCreds, err := pm.UserDBSvc.GetUserCredentials(ctx, emailAddress)
+	if err != nil {
+		log.Printf("Password reset requested for unknown email. %s", err.Error())
+		return nil
+	}
+
+	token, errResp := issueOneTimeToken(ctx, pm.TokenDBSvc, constants.TypePasswordResetForSortKey, userCreds.UserID, "", pm.Config.TokenTTL)
+	if errResp != nil {
+		return errResp
+	}
+
+	msg := mailer.Message{
+		To:      []string{userCreds.EmailAddress},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account.\n\n"+
+			"Open the link below within %s to choose a new password:\n%s\n\n"+
+			"If you didn't request this, you can ignore this mail.\n",
+			pm.Config.TokenTTL, pm.resetLink(token)),
+	}
+	if err := pm.Mailer.Send(ctx, msg); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error sending password reset mail. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and revokes every session of the user
+func (pm *PasswordResetManager) ResetPassword(ctx context.Context, input models.ResetPasswordInput) *commonModels.ErrorResponse {
+	// the policy is checked first, so a rejected password doesn't use up the token
+	hashedPassword, errResp := pm.UserSvc.HashNewPassword(ctx, input.Password)
+	if errResp != nil {
+		return errResp
+	}
+	resetToken, errResp := consumeOneTimeToken(ctx, pm.TokenDBSvc, constants.TypePasswordResetForSortKey, input.Token, "Request a new password reset mail")
+	if errResp != nil {
+		return errResp
+	}
+
+	user, errResp := pm.UserSvc.GetAndValidateUser(ctx, resetToken.UserID)
+	if errResp != nil {
+		return errResp
+	}
+	user.Password = hashedPassword
+	user.PasswordResetRequired = false
+	if _, errResp := pm.UserSvc.UpdateUser(ctx, user); errResp != nil {
+		return errResp
+	}
+	return pm.SessionSvc.RevokeAllSessions(ctx, user.UserID)
+}
+
+func (pm *PasswordResetManager) resetLink(token string) string {
+	return pm.Config.ResetURL + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const resetURL = "https://app.example.com/reset-password"
+
+// countingSessions counts the revocations, the other methods of the interface are not used
+type countingSessions struct {
+	SessionService
+	revoked map[string]int
+}
+
+func (cs *countingSessions) RevokeAllSessions(ctx context.Context, userID string) *commonModels.ErrorResponse {
+	cs.revoked[userID]++
+	return nil
+}
+
+// sentResetLinks returns the reset links of the mails in the outbox
+func sentResetLinks(t *testing.T, outbox string) []string {
+	t.Helper()
+	mails, err := filepath.Glob(filepath.Join(outbox, "*.eml"))
+	if err != nil {
+		t.Fatalf("listing outbox: %v", err)
+	}
+	linkPattern := regexp.MustCompile(regexp.QuoteMeta(resetURL) + `\?token=\S+`)
+	var links []string
+	for _, mail := range mails {
+		content, err := ioutil.ReadFile(mail)
+		if err != nil {
+			t.Fatalf("reading %s: %v", mail, err)
+		}
+		links = append(links, linkPattern.FindAllString(string(content), -1)...)
+	}
+	return links
+}
+
+func TestPasswordResetThroughOutbox(t *testing.T) {
+	ctx := context.Background()
+	hasher, err := auth.NewPasswordHasher(auth.PasswordHashConfig{Algorithm: auth.PasswordHashBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+	oldHash, err := hasher.Hash("old password 1")
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+	users := newMemoryUsers(models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{PKey: "user-1", SKey: "user"},
+		User: models.User{
+			UserID:      "user-1",
+			Credentials: models.Credentials{EmailAddress: "ada@example.com", Password: oldHash},
+		},
+	})
+	outbox := t.TempDir()
+	mail, err := mailer.NewOutboxMailer(outbox, "no-reply@example.com")
+	if err != nil {
+		t.Fatalf("creating outbox mailer: %v", err)
+	}
+	sessions := &countingSessions{revoked: map[string]int{}}
+	userService := NewUserService(users, hasher, &auth.PasswordPolicy{MinLength: 8, MaxLength: 64, MinCharacterClasses: 1})
+	resets := NewPasswordResetService(newMemoryTokens(), users, userService, sessions, mail, PasswordResetConfig{ResetURL: resetURL, TokenTTL: time.Hour})
+
+	// an unknown address gets the same answer and no mail
+	if errResp := resets.RequestPasswordReset(ctx, "nobody@example.com"); errResp != nil {
+		t.Fatalf("reset for unknown email: %s", errResp.Message)
+	}
+	if links := sentResetLinks(t, outbox); len(links) != 0 {
+		t.Fatalf("mail sent for unknown email: %v", links)
+	}
+
+	if errResp := resets.RequestPasswordReset(ctx, "Ada@Example.com"); errResp != nil {
+		t.Fatalf("RequestPasswordReset: %s", errResp.Message)
+	}
+	links := sentResetLinks(t, outbox)
+	if len(links) != 1 {
+		t.Fatalf("found reset links %v, want 1", links)
+	}
+	link, err := url.Parse(links[0])
+	if err != nil {
+		t.Fatalf("parsing reset link %s: %v", links[0], err)
+	}
+	token := link.Query().Get("token")
+
+	// a password the policy rejects doesn't use up the token
+	if errResp := resets.ResetPassword(ctx, models.ResetPasswordInput{Token: token, Password: "short"}); errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+		t.Fatalf("weak password got %+v, want 400", errResp)
+	}
+	if errResp := resets.ResetPassword(ctx, models.ResetPasswordInput{Token: token, Password: "new password 2"}); errResp != nil {
+		t.Fatalf("ResetPassword: %s", errResp.Message)
+	}
+	stored := users.users["user-1"]
+	if match, _ := hasher.Verify(stored.Password, "new password 2"); !match {
+		t.Error("new password doesn't match the stored hash")
+	}
+	if match, _ := hasher.Verify(stored.Password, "old password 1"); match {
+		t.Error("old password still matches the stored hash")
+	}
+	if sessions.revoked["user-1"] != 1 {
+		t.Errorf("sessions revoked %d times, want 1", sessions.revoked["user-1"])
+	}
+
+	// the token can't be used again
+	errResp := resets.ResetPassword(ctx, models.ResetPasswordInput{Token: token, Password: "other password 3"})
+	if errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+		t.Fatalf("reused token got %+v, want 400", errResp)
+	}
+	if match, _ := hasher.Verify(users.users["user-1"].Password, "new password 2"); !match {
+		t.Error("reused token changed the password")
+	}
+	if sessions.revoked["user-1"] != 1 {
+		t.Errorf("reused token revoked sessions again")
+	}
+}
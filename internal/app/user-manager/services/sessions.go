@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	bearerTokenType = "Bearer"
+)
+
+// SessionService - holds the functions used to manage login sessions
+type SessionService interface {
+	StartSession(ctx context.Context, userID string, isAdmin bool, mfa bool) (models.TokenResponse, *commonModels.ErrorResponse)
+	RefreshSession(ctx context.Context, refreshToken string) (models.TokenResponse, *commonModels.ErrorResponse)
+	EndSession(ctx context.Context, claims auth.Claims) *commonModels.ErrorResponse
+	RevokeAllSessions(ctx context.Context, userID string) *commonModels.ErrorResponse
+	ValidateSession(ctx context.Context, claims auth.Claims) *commonModels.ErrorResponse
+	StartLoginChallenge(ctx context.Context, userID string) (models.LoginChallengeResponse, *commonModels.ErrorResponse)
+	VerifyLoginChallenge(ctx context.Context, challengeToken string) (auth.Claims, *commonModels.ErrorResponse)
+}
+
+// SessionManager implements SessionService
+type SessionManager struct {
+	SessionDBSvc database.SessionsDynamoDBAPI
+	UserSvc      UserService
+	Tokens       auth.TokenManager
+}
+
+// NewSessionService creates an instance of Session Service
+func NewSessionService(sessionDBSvc database.SessionsDynamoDBAPI, userService UserService, tokens auth.TokenManager) SessionService {
+	return &SessionManager{
+		SessionDBSvc: sessionDBSvc,
+		UserSvc:      userService,
+		Tokens:       tokens,
+	}
+}
+
+// StartSession issues the access and refresh tokens of a new session.
+// mfa records that the user passed a second factor, it is kept when the session is refreshed.
+func (sm *SessionManager) StartSession(ctx context.Context, userID string, isAdmin bool, mfa bool) (models.TokenResponse, *commonModels.ErrorResponse) {
+	tokenResp := models.TokenResponse{}
+	sessionID := utils.GenerateUUID()
+
+	accessToken, accessClaims, err := sm.Tokens.IssueAccessToken(ctx, userID, sessionID, isAdmin, mfa)
+	if err != nil {
+		return tokenResp, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error issuing access token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	refreshToken, refreshClaims, err := sm.Tokens.IssueRefreshToken(ctx, userID, sessionID, mfa)
+	if err != nil {
+		return tokenResp, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error issuing refresh token. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+
+	tokenResp = models.TokenResponse{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        bearerTokenType,
+		ExpiresAt:        accessClaims.ExpiresAt,
+		RefreshExpiresAt: refreshClaims.ExpiresAt,
+	}
+	return tokenResp, nil
+}
+
+// RefreshSession exchanges a refresh token for a new session.
+// The old session is revoked so a refresh token can only be used once.
+func (sm *SessionManager) RefreshSession(ctx context.Context, refreshToken string) (models.TokenResponse, *commonModels.ErrorResponse) {
+	claims, err := sm.Tokens.VerifyToken(ctx, refreshToken, auth.TokenTypeRefresh)
+	if err != nil {
+		return models.TokenResponse{}, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid refresh token. %s", err.Error()),
+			RecommendationAction: []string{"Login again to start a new session"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
+	if errResp := sm.ValidateSession(ctx, claims); errResp != nil {
+		return models.TokenResponse{}, errResp
+	}
+	// the admin flag may have changed since the session started
+	principal, errResp := sm.UserSvc.LoadPrincipal(ctx, claims.Subject)
+	if errResp != nil {
+		return models.TokenResponse{}, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Unable to refresh the session. %s", errResp.Message),
+			RecommendationAction: []string{"Login again to start a new session"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
+	if errResp := sm.EndSession(ctx, claims); errResp != nil {
+		return models.TokenResponse{}, errResp
+	}
+	return sm.StartSession(ctx, principal.UserID, principal.IsAdmin, claims.MFA)
+}
+
+// EndSession revokes the session the given token belongs to
+func (sm *SessionManager) EndSession(ctx context.Context, claims auth.Claims) *commonModels.ErrorResponse {
+	now := time.Now()
+	revoked := models.RevokedSessionDynamo{
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		RevokedAt: now.Unix(),
+		ExpiresAt: now.Add(sm.Tokens.RefreshTokenTTL()).Unix(),
+	}
+	if err := sm.SessionDBSvc.RevokeSessionInDynamoDB(ctx, revoked); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error revoking session. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every session of the user issued up to now
+func (sm *SessionManager) RevokeAllSessions(ctx context.Context, userID string) *commonModels.ErrorResponse {
+	now := time.Now()
+	revoked := models.RevokedSessionDynamo{
+		UserID:            userID,
+		SessionID:         constants.AllSessionsID,
+		RevokedAt:         now.Unix(),
+		RevokedBefore:     now.Unix(),
+		RevokedBeforeNano: now.UnixNano(),
+		ExpiresAt:         now.Add(sm.Tokens.RefreshTokenTTL()).Unix(),
+	}
+	if err := sm.SessionDBSvc.RevokeSessionInDynamoDB(ctx, revoked); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error revoking sessions of user %s. %s", userID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ValidateSession checks that neither the session nor all sessions of the user were revoked
+func (sm *SessionManager) ValidateSession(ctx context.Context, claims auth.Claims) *commonModels.ErrorResponse {
+	revocations, err := sm.SessionDBSvc.GetSessionRevocationsInDynamoDB(ctx, claims.Subject, claims.SessionID)
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error checking session. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	for _, revoked := range revocations {
+		if revoked.SessionID == claims.SessionID ||
+			(revoked.SessionID == constants.AllSessionsID && issuedBefore(claims, revoked)) {
+			return &commonModels.ErrorResponse{
+				Message:              "Session has been revoked",
+				RecommendationAction: []string{"Login again to start a new session"},
+				ErrorStatusCode:      http.StatusUnauthorized,
+			}
+		}
+	}
+	return nil
+}
+
+// issuedBefore reports whether the token was issued before every session of the user was revoked. Tokens and revocations
+// without nanoseconds are compared in whole seconds, where a token of the second of the revocation counts as revoked.
+func issuedBefore(claims auth.Claims, revoked models.RevokedSessionDynamo) bool {
+	if claims.IssuedAtNano == 0 || revoked.RevokedBeforeNano == 0 {
+		return claims.IssuedAt <= revoked.RevokedBefore
+	}
+	return claims.IssuedAtNano < revoked.RevokedBeforeNano
+}
+
+// StartLoginChallenge issues the token a user with two-factor enabled exchanges for a session with a second factor
+func (sm *SessionManager) StartLoginChallenge(ctx context.Context, userID string) (models.LoginChallengeResponse, *commonModels.ErrorResponse) {
+	challengeToken, claims, err := sm.Tokens.IssueChallengeToken(ctx, userID)
+	if err != nil {
+		return models.LoginChallengeResponse{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error issuing two-factor challenge. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return models.LoginChallengeResponse{
+		UserID:            userID,
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresAt:         claims.ExpiresAt,
+	}, nil
+}
+
+// VerifyLoginChallenge checks a challenge token and returns its claims
+func (sm *SessionManager) VerifyLoginChallenge(ctx context.Context, challengeToken string) (auth.Claims, *commonModels.ErrorResponse) {
+	claims, err := sm.Tokens.VerifyToken(ctx, challengeToken, auth.TokenTypeChallenge)
+	if err != nil {
+		return claims, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Invalid two-factor challenge. %s", err.Error()),
+			RecommendationAction: []string{"Login again with your email address and password"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
+	return claims, nil
+}
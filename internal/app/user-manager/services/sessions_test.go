@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+)
+
+type memorySessions struct {
+	revocations map[string]models.RevokedSessionDynamo
+}
+
+func (ms *memorySessions) RevokeSessionInDynamoDB(ctx context.Context, revoked models.RevokedSessionDynamo) error {
+	ms.revocations[revoked.UserID+"|"+revoked.SessionID] = revoked
+	return nil
+}
+
+func (ms *memorySessions) GetSessionRevocationsInDynamoDB(ctx context.Context, userID string, sessionID string) ([]models.RevokedSessionDynamo, error) {
+	var revocations []models.RevokedSessionDynamo
+	for _, id := range []string{sessionID, constants.AllSessionsID} {
+		if revoked, ok := ms.revocations[userID+"|"+id]; ok {
+			revocations = append(revocations, revoked)
+		}
+	}
+	return revocations, nil
+}
+
+func TestRevokeAllSessionsKeepsLaterSessions(t *testing.T) {
+	ctx := context.Background()
+	tokens, err := auth.NewHMACTokenManager([]byte("0123456789abcdef0123456789abcdef"), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("creating token manager: %v", err)
+	}
+	sessions := &memorySessions{revocations: map[string]models.RevokedSessionDynamo{}}
+	service := NewSessionService(sessions, nil, tokens)
+	session := func() auth.Claims {
+		t.Helper()
+		tokenResp, errResp := service.StartSession(ctx, "user-1", false, false)
+		if errResp != nil {
+			t.Fatalf("StartSession: %s", errResp.Message)
+		}
+		claims, err := tokens.VerifyToken(ctx, tokenResp.AccessToken, auth.TokenTypeAccess)
+		if err != nil {
+			t.Fatalf("VerifyToken: %v", err)
+		}
+		return claims
+	}
+
+	before := session()
+	if errResp := service.RevokeAllSessions(ctx, "user-1"); errResp != nil {
+		t.Fatalf("RevokeAllSessions: %s", errResp.Message)
+	}
+	// e.g. the login right after a password reset, most likely in the second of the revocation
+	after := session()
+	if errResp := service.ValidateSession(ctx, before); errResp == nil {
+		t.Error("session started before the revocation is still valid")
+	}
+	if errResp := service.ValidateSession(ctx, after); errResp != nil {
+		t.Errorf("session started after the revocation was rejected: %s", errResp.Message)
+	}
+
+	// tokens issued before issue times had nanoseconds are revoked up to the second of the revocation
+	legacy := after
+	legacy.IssuedAtNano = 0
+	legacy.IssuedAt = sessions.revocations["user-1|"+constants.AllSessionsID].RevokedBefore
+	if errResp := service.ValidateSession(ctx, legacy); errResp == nil {
+		t.Error("token without nanoseconds from the second of the revocation is still valid")
+	}
+}
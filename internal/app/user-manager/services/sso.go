@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/oidc"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	// mfaAuthMethod is the amr value identity providers send when the login used several factors
+	mfaAuthMethod = "mfa"
+)
+
+// SSOConfig holds the settings of single sign-on logins
+type SSOConfig struct {
+	// AdminClaim and AdminClaimValue map an ID token claim to IsAdmin, it is left alone when AdminClaim is empty
+	AdminClaim      string
+	AdminClaimValue string
+	// StateTTL is how long a started login can be completed
+	StateTTL time.Duration
+}
+
+// OIDCProvider - holds the functions of the identity provider used by single sign-on
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (oidc.IDToken, error)
+}
+
+// SSOService - holds the functions used to login through the identity provider
+type SSOService interface {
+	StartSSOLogin(ctx context.Context) (models.SSOAuthorization, *commonModels.ErrorResponse)
+	CompleteSSOLogin(ctx context.Context, input models.SSOCallbackInput) (models.UserDynamo, bool, *commonModels.ErrorResponse)
+}
+
+// SSOManager implements SSOService
+type SSOManager struct {
+	Provider      OIDCProvider
+	StateDBSvc    database.OneTimeTokensDynamoDBAPI
+	IdentityDBSvc database.IdentitiesDynamoDBAPI
+	UserDBSvc     database.UsersDynamoDBAPI
+	UserSvc       UserService
+	Config        SSOConfig
+}
+
+// NewSSOService creates an instance of SSO Service
+func NewSSOService(
+	provider OIDCProvider,
+	stateDBSvc database.OneTimeTokensDynamoDBAPI,
+	identityDBSvc database.IdentitiesDynamoDBAPI,
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	config SSOConfig,
+) SSOService {
+	return &SSOManager{
+		Provider:      provider,
+		StateDBSvc:    stateDBSvc,
+		IdentityDBSvc: identityDBSvc,
+		UserDBSvc:     userDBSvc,
+		UserSvc:       userService,
+		Config:        config,
+	}
+}
+
+// StartSSOLogin stores a pending login and returns the identity provider URL to send the user to
+func (sm *SSOManager) StartSSOLogin(ctx context.Context) (models.SSOAuthorization, *commonModels.ErrorResponse) {
+	authorization := models.SSOAuthorization{}
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.GenerateRandomValue()
+		if err != nil {
+			return authorization, &commonModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error generating login state. %s", err.Error()),
+				ErrorStatusCode: http.StatusInternalServerError,
+			}
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	authURL, err := sm.Provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		return authorization, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error contacting the identity provider. %s", err.Error()),
+			ErrorStatusCode: http.StatusBadGateway,
+		}
+	}
+	now := time.Now()
+	pending := models.OneTimeTokenDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: auth.HashOpaqueToken(state),
+			SKey: constants.TypeOIDCStateForSortKey,
+		},
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(sm.Config.StateTTL).Unix(),
+	}
+	if err := sm.StateDBSvc.CreateOneTimeTokenInDynamoDB(ctx, pending); err != nil {
+		return authorization, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error storing login state. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	authorization.AuthorizationURL = authURL
+	authorization.State = state
+	authorization.ExpiresAt = pending.ExpiresAt
+	return authorization, nil
+}
+
+// CompleteSSOLogin redeems the authorization code and returns the user it belongs to, creating the user on first login.
+// The second return value is set when the identity provider reports a multi-factor login that stands in for the
+// two-factor authentication of the user, which it doesn't for users linked by their email address.
+func (sm *SSOManager) CompleteSSOLogin(ctx context.Context, input models.SSOCallbackInput) (models.UserDynamo, bool, *commonModels.ErrorResponse) {
+	if input.Code == "" || input.State == "" {
+		return models.UserDynamo{}, false, &commonModels.ErrorResponse{
+			Message:              "Expected code and state",
+			RecommendationAction: []string{"Send the code and state the identity provider redirected with"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	pending, errResp := consumeOneTimeToken(ctx, sm.StateDBSvc, constants.TypeOIDCStateForSortKey, input.State, "Start the single sign-on login again")
+	if errResp != nil {
+		return models.UserDynamo{}, false, errResp
+	}
+	idToken, err := sm.Provider.Exchange(ctx, input.Code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return models.UserDynamo{}, false, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("Identity provider login failed. %s", err.Error()),
+			RecommendationAction: []string{"Start the single sign-on login again"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
+	if idToken.EmailVerified != nil && !*idToken.EmailVerified {
+		return models.UserDynamo{}, false, &commonModels.ErrorResponse{
+			Message:              "Email address is not verified at the identity provider",
+			RecommendationAction: []string{"Verify your email address with the identity provider"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+	}
+
+	user, linkedByEmail, errResp := sm.resolveUser(ctx, idToken)
+	if errResp != nil {
+		return user, false, errResp
+	}
+	if user.Disabled {
+		return user, false, accountDisabled()
+	}
+	if user.DeactivatedAt > 0 {
+		return user, false, accountDeactivated()
+	}
+	user, errResp = sm.syncUser(ctx, user, idToken)
+	if errResp != nil {
+		return user, false, errResp
+	}
+	return user, !linkedByEmail && idToken.ClaimHasValue("amr", mfaAuthMethod), nil
+}
+
+// resolveUser finds the user linked to the identity provider account and reports whether it was linked by email.
+// An unlinked account is linked to the user with the same email address, only when the identity provider verified
+// the address, or to a new user.
+func (sm *SSOManager) resolveUser(ctx context.Context, idToken oidc.IDToken) (models.UserDynamo, bool, *commonModels.ErrorResponse) {
+	identity, err := sm.IdentityDBSvc.GetIdentityInDynamoDB(ctx, idToken.Issuer, idToken.Subject)
+	if err == nil {
+		user, errUser := sm.UserDBSvc.GetUserInDynamoDB(ctx, identity.UserID, constants.TypeUsersForSortKey)
+		if errUser != nil {
+			return user, false, &commonModels.ErrorResponse{
+				Message:         fmt.Sprintf("Error getting user. %s", errUser.Error()),
+				ErrorStatusCode: http.StatusInternalServerError,
+			}
+		}
+		if user.UserID != "" {
+			return user, identity.LinkedByEmail, nil
+		}
+		// the linked user was deleted, the account is linked again like a new one
+		err = sm.IdentityDBSvc.DeleteIdentityInDynamoDB(ctx, idToken.Issuer, idToken.Subject)
+		if err == nil {
+			err = database.ErrIdentityNotFound
+		}
+	}
+	if err != database.ErrIdentityNotFound {
+		return models.UserDynamo{}, false, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error reading identity link. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if idToken.Email == "" {
+		return models.UserDynamo{}, false, &commonModels.ErrorResponse{
+			Message:              "Identity provider didn't send an email address",
+			RecommendationAction: []string{"Allow the email scope for this application at the identity provider"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+	}
+
+	var user models.UserDynamo
+	var errResp *commonModels.ErrorResponse
+	userCreds, err := sm.UserDBSvc.GetUserCredentials(ctx, idToken.Email)
+	linkedByEmail := err == nil
+	switch {
+	// anyone can claim an address at an identity provider, only a verified one proves it owns the user
+	case err == nil && (idToken.EmailVerified == nil || !*idToken.EmailVerified):
+		errResp = &commonModels.ErrorResponse{
+			Message:              "A user with this email address exists, and the identity provider didn't verify the address",
+			RecommendationAction: []string{"Login with your password", "Verify your email address with the identity provider"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+	case err == nil:
+		user, errResp = sm.UserSvc.GetAndValidateUser(ctx, userCreds.UserID)
+	case err == database.ErrUserNotFound:
+		user, errResp = sm.provisionUser(ctx, idToken)
+	default:
+		errResp = &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting user credentials from database. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if errResp != nil {
+		return user, false, errResp
+	}
+
+	link := models.IdentityDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: database.IdentityKey(idToken.Issuer, idToken.Subject),
+			SKey: constants.TypeOIDCIdentityForSortKey,
+		},
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		UserID:        user.UserID,
+		LinkedByEmail: linkedByEmail,
+		CreatedAt:     time.Now().Unix(),
+	}
+	if err := sm.IdentityDBSvc.CreateIdentityInDynamoDB(ctx, link); err != nil {
+		return user, false, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error linking identity to user %s. %s", user.UserID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	log.Printf("Linked identity %s of %s to user %s", idToken.Subject, idToken.Issuer, user.UserID)
+	return user, linkedByEmail, nil
+}
+
+// provisionUser creates the user of an identity provider account on its first login.
+// The user has no password and can only login through the identity provider until one is set with a reset.
+func (sm *SSOManager) provisionUser(ctx context.Context, idToken oidc.IDToken) (models.UserDynamo, *commonModels.ErrorResponse) {
+	userID := utils.GenerateUUID()
+	user := models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: userID,
+			SKey: constants.TypeUsersForSortKey,
+		},
+		User: models.User{
+			UserID:    userID,
+			FirstName: idToken.GivenName,
+			LastName:  idToken.FamilyName,
+			// an address the identity provider didn't verify has to be verified before a password login
+			EmailVerificationPending: idToken.EmailVerified == nil || !*idToken.EmailVerified,
+			Credentials: models.Credentials{
+				EmailAddress: idToken.Email,
+			},
+		},
+	}
+	return sm.UserSvc.CreateUser(ctx, user)
+}
+
+// syncUser applies what the identity provider says about the user on every login
+func (sm *SSOManager) syncUser(ctx context.Context, user models.UserDynamo, idToken oidc.IDToken) (models.UserDynamo, *commonModels.ErrorResponse) {
+	changed := false
+	if user.EmailVerificationPending && idToken.EmailVerified != nil && *idToken.EmailVerified && idToken.Email == user.EmailAddress {
+		user.EmailVerificationPending = false
+		changed = true
+	}
+	if sm.Config.AdminClaim != "" {
+		isAdmin := idToken.ClaimHasValue(sm.Config.AdminClaim, sm.Config.AdminClaimValue)
+		if isAdmin != user.IsAdmin {
+			log.Printf("Setting admin of user %s to %t from the %s claim", user.UserID, isAdmin, sm.Config.AdminClaim)
+			user.IsAdmin = isAdmin
+			changed = true
+		}
+	}
+	if !changed {
+		return user, nil
+	}
+	return sm.UserSvc.UpdateUser(ctx, user)
+}
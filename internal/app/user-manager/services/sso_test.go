@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/oidc"
+)
+
+// fakeIdentityProvider binds the code it hands out to the PKCE challenge and nonce of the login it was sent,
+// like an identity provider does. The provider itself is tested against an identity provider in the oidc package.
+type fakeIdentityProvider struct {
+	challenge string
+	nonce     string
+	idToken   oidc.IDToken
+	exchanges int
+}
+
+func (fp *fakeIdentityProvider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	fp.challenge = codeChallenge
+	fp.nonce = nonce
+	return "https://idp.example.com/authorize?" + url.Values{"state": {state}, "nonce": {nonce}, "code_challenge": {codeChallenge}}.Encode(), nil
+}
+
+func (fp *fakeIdentityProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (oidc.IDToken, error) {
+	fp.exchanges++
+	if oidc.CodeChallenge(codeVerifier) != fp.challenge {
+		return oidc.IDToken{}, errors.New("token endpoint returned 400 invalid_grant")
+	}
+	if nonce != fp.nonce {
+		return oidc.IDToken{}, fmt.Errorf("%w, nonce doesn't match the login request", oidc.ErrInvalidIDToken)
+	}
+	return fp.idToken, nil
+}
+
+type memoryIdentities struct {
+	identities map[string]models.IdentityDynamo
+}
+
+func (mi *memoryIdentities) CreateIdentityInDynamoDB(ctx context.Context, identity models.IdentityDynamo) error {
+	mi.identities[database.IdentityKey(identity.Issuer, identity.Subject)] = identity
+	return nil
+}
+
+func (mi *memoryIdentities) GetIdentityInDynamoDB(ctx context.Context, issuer string, subject string) (models.IdentityDynamo, error) {
+	identity, ok := mi.identities[database.IdentityKey(issuer, subject)]
+	if !ok {
+		return identity, database.ErrIdentityNotFound
+	}
+	return identity, nil
+}
+
+func (mi *memoryIdentities) DeleteIdentityInDynamoDB(ctx context.Context, issuer string, subject string) error {
+	delete(mi.identities, database.IdentityKey(issuer, subject))
+	return nil
+}
+
+type ssoTest struct {
+	service    SSOService
+	provider   *fakeIdentityProvider
+	states     *memoryTokens
+	identities *memoryIdentities
+	users      *memoryUsers
+}
+
+func newSSOTest(stateTTL time.Duration, users ...models.UserDynamo) *ssoTest {
+	verified := true
+	st := &ssoTest{
+		provider: &fakeIdentityProvider{idToken: oidc.IDToken{
+			Issuer:        "https://idp.example.com",
+			Subject:       "subject-1",
+			Email:         "ada@example.com",
+			EmailVerified: &verified,
+			GivenName:     "Ada",
+		}},
+		states:     newMemoryTokens(),
+		identities: &memoryIdentities{identities: map[string]models.IdentityDynamo{}},
+		users:      newMemoryUsers(users...),
+	}
+	userService := NewUserService(st.users, nil, nil)
+	st.service = NewSSOService(st.provider, st.states, st.identities, st.users, userService, SSOConfig{StateTTL: stateTTL})
+	return st
+}
+
+func TestSSOLoginUsesStateOnce(t *testing.T) {
+	st := newSSOTest(10 * time.Minute)
+	ctx := context.Background()
+	authorization, errResp := st.service.StartSSOLogin(ctx)
+	if errResp != nil {
+		t.Fatalf("StartSSOLogin: %s", errResp.Message)
+	}
+	parsed, err := url.Parse(authorization.AuthorizationURL)
+	if err != nil || parsed.Query().Get("state") != authorization.State {
+		t.Fatalf("authorization URL %s doesn't carry the state %s", authorization.AuthorizationURL, authorization.State)
+	}
+	// only the hash of the state is stored, with the verifier of the challenge sent to the identity provider
+	if len(st.states.tokens) != 1 {
+		t.Fatalf("%d pending logins stored, want 1", len(st.states.tokens))
+	}
+	for _, pending := range st.states.tokens {
+		if pending.PKey != auth.HashOpaqueToken(authorization.State) {
+			t.Errorf("pending login is keyed by %s, want the hash of the state", pending.PKey)
+		}
+		if oidc.CodeChallenge(pending.CodeVerifier) != parsed.Query().Get("code_challenge") || pending.Nonce != parsed.Query().Get("nonce") {
+			t.Errorf("pending login doesn't hold the verifier and nonce of the authorization URL")
+		}
+	}
+
+	callback := models.SSOCallbackInput{Code: "code", State: authorization.State}
+	user, _, errResp := st.service.CompleteSSOLogin(ctx, callback)
+	if errResp != nil {
+		t.Fatalf("CompleteSSOLogin: %s", errResp.Message)
+	}
+	if user.EmailAddress != "ada@example.com" || user.UserID == "" {
+		t.Errorf("unexpected user %+v", user.User)
+	}
+	if identity, err := st.identities.GetIdentityInDynamoDB(ctx, "https://idp.example.com", "subject-1"); err != nil || identity.UserID != user.UserID {
+		t.Errorf("identity linked to %q, want %q (%v)", identity.UserID, user.UserID, err)
+	}
+
+	// a replayed callback can't log in again
+	_, _, errResp = st.service.CompleteSSOLogin(ctx, callback)
+	if errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+		t.Fatalf("replayed state got %+v, want 400", errResp)
+	}
+	if st.provider.exchanges != 1 {
+		t.Errorf("code exchanged %d times, want 1", st.provider.exchanges)
+	}
+}
+
+func TestSSOLoginRejectsState(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		stateTTL time.Duration
+		state    func(authorization models.SSOAuthorization) string
+	}{
+		{"unknown state", 10 * time.Minute, func(models.SSOAuthorization) string { return "forged-state" }},
+		{"missing state", 10 * time.Minute, func(models.SSOAuthorization) string { return "" }},
+		{"expired state", -time.Minute, func(authorization models.SSOAuthorization) string { return authorization.State }},
+	}
+	for _, test := range tests {
+		st := newSSOTest(test.stateTTL)
+		authorization, errResp := st.service.StartSSOLogin(ctx)
+		if errResp != nil {
+			t.Fatalf("%s: StartSSOLogin: %s", test.name, errResp.Message)
+		}
+		_, _, errResp = st.service.CompleteSSOLogin(ctx, models.SSOCallbackInput{Code: "code", State: test.state(authorization)})
+		if errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %+v, want 400", test.name, errResp)
+		}
+		if st.provider.exchanges != 0 {
+			t.Errorf("%s: code was exchanged", test.name)
+		}
+	}
+}
+
+func TestSSOLoginRejectsFailedExchange(t *testing.T) {
+	ctx := context.Background()
+	unverified := false
+	tests := []struct {
+		name   string
+		tamper func(st *ssoTest)
+		status int
+	}{
+		// a login started elsewhere has another verifier and nonce than the one the code was issued for
+		{"other PKCE challenge", func(st *ssoTest) { st.provider.challenge = oidc.CodeChallenge("other-verifier") }, http.StatusUnauthorized},
+		{"other nonce", func(st *ssoTest) { st.provider.nonce = "other-nonce" }, http.StatusUnauthorized},
+		{"unverified email", func(st *ssoTest) { st.provider.idToken.EmailVerified = &unverified }, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		st := newSSOTest(10 * time.Minute)
+		authorization, errResp := st.service.StartSSOLogin(ctx)
+		if errResp != nil {
+			t.Fatalf("%s: StartSSOLogin: %s", test.name, errResp.Message)
+		}
+		test.tamper(st)
+		_, _, errResp = st.service.CompleteSSOLogin(ctx, models.SSOCallbackInput{Code: "code", State: authorization.State})
+		if errResp == nil || errResp.ErrorStatusCode != test.status {
+			t.Errorf("%s: got %+v, want %d", test.name, errResp, test.status)
+		}
+		if len(st.users.users) != 0 {
+			t.Errorf("%s: user was created", test.name)
+		}
+	}
+}
+
+func TestSSOLoginLinksExistingUserOnlyByVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	existing := models.UserDynamo{User: models.User{
+		UserID:           "user-1",
+		TwoFactorEnabled: true,
+		Credentials:      models.Credentials{EmailAddress: "Ada@example.com"},
+	}}
+
+	// without an email_verified claim the account isn't linked to the user with the address
+	st := newSSOTest(10*time.Minute, existing)
+	st.provider.idToken.EmailVerified = nil
+	authorization, errResp := st.service.StartSSOLogin(ctx)
+	if errResp != nil {
+		t.Fatalf("StartSSOLogin: %s", errResp.Message)
+	}
+	_, _, errResp = st.service.CompleteSSOLogin(ctx, models.SSOCallbackInput{Code: "code", State: authorization.State})
+	if errResp == nil || errResp.ErrorStatusCode != http.StatusForbidden {
+		t.Errorf("missing email_verified got %+v, want 403", errResp)
+	}
+	if len(st.identities.identities) != 0 || len(st.users.users) != 1 {
+		t.Errorf("missing email_verified linked %d identities and kept %d users", len(st.identities.identities), len(st.users.users))
+	}
+
+	// a verified address links it, and the multi-factor login of the identity provider doesn't replace TOTP
+	verified := true
+	st.provider.idToken.EmailVerified = &verified
+	st.provider.idToken.Claims = map[string]interface{}{"amr": []interface{}{"pwd", "mfa"}}
+	for i := 0; i < 2; i++ {
+		authorization, errResp = st.service.StartSSOLogin(ctx)
+		if errResp != nil {
+			t.Fatalf("StartSSOLogin: %s", errResp.Message)
+		}
+		user, mfa, errResp := st.service.CompleteSSOLogin(ctx, models.SSOCallbackInput{Code: "code", State: authorization.State})
+		if errResp != nil {
+			t.Fatalf("CompleteSSOLogin: %s", errResp.Message)
+		}
+		if user.UserID != "user-1" || mfa {
+			t.Errorf("login %d got user %q with mfa %v, want user-1 without mfa", i+1, user.UserID, mfa)
+		}
+	}
+	if identity := st.identities.identities[database.IdentityKey("https://idp.example.com", "subject-1")]; !identity.LinkedByEmail {
+		t.Error("identity isn't marked as linked by email")
+	}
+}
+
+func TestSSOLoginProvisionsUnverifiedEmailAsPending(t *testing.T) {
+	ctx := context.Background()
+	st := newSSOTest(10 * time.Minute)
+	st.provider.idToken.EmailVerified = nil
+	st.provider.idToken.Claims = map[string]interface{}{"amr": []interface{}{"mfa"}}
+	authorization, errResp := st.service.StartSSOLogin(ctx)
+	if errResp != nil {
+		t.Fatalf("StartSSOLogin: %s", errResp.Message)
+	}
+	user, mfa, errResp := st.service.CompleteSSOLogin(ctx, models.SSOCallbackInput{Code: "code", State: authorization.State})
+	if errResp != nil {
+		t.Fatalf("CompleteSSOLogin: %s", errResp.Message)
+	}
+	if !user.EmailVerificationPending || !mfa {
+		t.Errorf("new user pending %v with mfa %v, want a pending address and mfa", user.EmailVerificationPending, mfa)
+	}
+}
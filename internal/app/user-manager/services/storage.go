@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// StorageConfig holds the storage limits that apply until an admin sets other defaults
+type StorageConfig struct {
+	DefaultStorageQuotaBytes int64
+	DefaultMaxFileSizeBytes  int64
+}
+
+// StorageService - holds the functions used to limit and report the storage of users
+type StorageService interface {
+	GetDefaultLimits(ctx context.Context) (models.StorageLimits, *commonModels.ErrorResponse)
+	SetDefaultLimits(ctx context.Context, adminID string, input models.StorageLimitsInput) (models.StorageLimits, *commonModels.ErrorResponse)
+	GetUsage(ctx context.Context, userID string) (models.StorageUsage, *commonModels.ErrorResponse)
+	SetUserLimits(ctx context.Context, userID string, input models.StorageLimitsInput) (models.StorageUsage, *commonModels.ErrorResponse)
+	CheckUpload(ctx context.Context, user models.UserDynamo, fileName string, size int64) (models.StorageLimits, *commonModels.ErrorResponse)
+}
+
+// StorageManager implements StorageService
+type StorageManager struct {
+	SettingsDBSvc database.SettingsDynamoDBAPI
+	UserDBSvc     database.UsersDynamoDBAPI
+	UserSvc       UserService
+	Config        StorageConfig
+}
+
+// NewStorageService creates an instance of Storage Service
+func NewStorageService(
+	settingsDBSvc database.SettingsDynamoDBAPI,
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	config StorageConfig,
+) StorageService {
+	return &StorageManager{
+		SettingsDBSvc: settingsDBSvc,
+		UserDBSvc:     userDBSvc,
+		UserSvc:       userService,
+		Config:        config,
+	}
+}
+
+// GetDefaultLimits returns the limits of users without limits of their own
+func (sm *StorageManager) GetDefaultLimits(ctx context.Context) (models.StorageLimits, *commonModels.ErrorResponse) {
+	limits := models.StorageLimits{
+		StorageQuotaBytes: sm.Config.DefaultStorageQuotaBytes,
+		MaxFileSizeBytes:  sm.Config.DefaultMaxFileSizeBytes,
+	}
+	stored, err := sm.SettingsDBSvc.GetStorageLimitsInDynamoDB(ctx)
+	if err == database.ErrStorageLimitsNotFound {
+		return limits, nil
+	}
+	if err != nil {
+		return limits, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error getting storage limits. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if stored.StorageQuotaBytes > 0 {
+		limits.StorageQuotaBytes = stored.StorageQuotaBytes
+	}
+	if stored.MaxFileSizeBytes > 0 {
+		limits.MaxFileSizeBytes = stored.MaxFileSizeBytes
+	}
+	return limits, nil
+}
+
+// SetDefaultLimits changes the limits of users without limits of their own
+func (sm *StorageManager) SetDefaultLimits(ctx context.Context, adminID string, input models.StorageLimitsInput) (models.StorageLimits, *commonModels.ErrorResponse) {
+	limits, errResp := sm.GetDefaultLimits(ctx)
+	if errResp != nil {
+		return limits, errResp
+	}
+	if input.StorageQuotaBytes == nil && input.MaxFileSizeBytes == nil {
+		return limits, invalidStorageLimit("Send storageQuotaBytes, maxFileSizeBytes or both")
+	}
+	if input.StorageQuotaBytes != nil {
+		if *input.StorageQuotaBytes <= 0 {
+			return limits, invalidStorageLimit("Send a default storageQuotaBytes above 0")
+		}
+		limits.StorageQuotaBytes = *input.StorageQuotaBytes
+	}
+	if input.MaxFileSizeBytes != nil {
+		if *input.MaxFileSizeBytes <= 0 {
+			return limits, invalidStorageLimit("Send a default maxFileSizeBytes above 0")
+		}
+		limits.MaxFileSizeBytes = *input.MaxFileSizeBytes
+	}
+	stored := models.StorageLimitsDynamo{
+		StorageQuotaBytes: limits.StorageQuotaBytes,
+		MaxFileSizeBytes:  limits.MaxFileSizeBytes,
+		UpdatedBy:         adminID,
+		UpdatedAt:         time.Now().Unix(),
+	}
+	if err := sm.SettingsDBSvc.PutStorageLimitsInDynamoDB(ctx, stored); err != nil {
+		return limits, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error storing storage limits. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	log.Printf("Admin %s set the default storage quota to %d bytes and the max file size to %d bytes",
+		adminID, limits.StorageQuotaBytes, limits.MaxFileSizeBytes)
+	return limits, nil
+}
+
+// GetUsage returns the storage the user uses and the limits that apply to it
+func (sm *StorageManager) GetUsage(ctx context.Context, userID string) (models.StorageUsage, *commonModels.ErrorResponse) {
+	user, errResp := sm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.StorageUsage{}, errResp
+	}
+	return sm.usage(ctx, user)
+}
+
+// SetUserLimits gives the user limits of its own, a limit of 0 makes the default apply again
+func (sm *StorageManager) SetUserLimits(ctx context.Context, userID string, input models.StorageLimitsInput) (models.StorageUsage, *commonModels.ErrorResponse) {
+	user, errResp := sm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.StorageUsage{}, errResp
+	}
+	values := map[string]interface{}{}
+	if input.StorageQuotaBytes != nil {
+		if *input.StorageQuotaBytes < 0 {
+			return models.StorageUsage{}, invalidStorageLimit("Send a storageQuotaBytes of 0 or more, 0 applies the default")
+		}
+		values["StorageQuotaBytes"] = *input.StorageQuotaBytes
+		user.StorageQuotaBytes = *input.StorageQuotaBytes
+	}
+	if input.MaxFileSizeBytes != nil {
+		if *input.MaxFileSizeBytes < 0 {
+			return models.StorageUsage{}, invalidStorageLimit("Send a maxFileSizeBytes of 0 or more, 0 applies the default")
+		}
+		values["MaxFileSizeBytes"] = *input.MaxFileSizeBytes
+		user.MaxFileSizeBytes = *input.MaxFileSizeBytes
+	}
+	if len(values) == 0 {
+		return models.StorageUsage{}, invalidStorageLimit("Send storageQuotaBytes, maxFileSizeBytes or both")
+	}
+	err := sm.UserDBSvc.SetUserAttributesInDynamoDB(ctx, userID, values)
+	if err == database.ErrUserNotFound {
+		return models.StorageUsage{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("User %s doesn't exist", userID),
+			ErrorStatusCode: http.StatusNotFound,
+		}
+	}
+	if err != nil {
+		return models.StorageUsage{}, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error updating user. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	log.Printf("Set storage limits of user %s to %v", userID, values)
+	return sm.usage(ctx, user)
+}
+
+// CheckUpload rejects an upload that is larger than the max file size of the user
+// or doesn't fit in its storage quota. A file replacing one with the same name frees the size of the old file.
+// It returns the limits it checked, the quota has to be checked again when the file is stored.
+func (sm *StorageManager) CheckUpload(ctx context.Context, user models.UserDynamo, fileName string, size int64) (models.StorageLimits, *commonModels.ErrorResponse) {
+	limits, errResp := sm.userLimits(ctx, user)
+	if errResp != nil {
+		return limits, errResp
+	}
+	if size > limits.MaxFileSizeBytes {
+		return limits, &commonModels.ErrorResponse{
+			Message: fmt.Sprintf("File %s is %s, larger than the limit of %s per file", fileName,
+				formatBytes(size), formatBytes(limits.MaxFileSizeBytes)),
+			RecommendationAction: []string{
+				fmt.Sprintf("Upload a file of at most %s", formatBytes(limits.MaxFileSizeBytes)),
+				"Ask an administrator to raise your file size limit",
+			},
+			ErrorStatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	used := user.StorageUsedBytes
+	if existing, ok := user.FileInfo[fileName]; ok {
+		used -= existing.Size
+	}
+	if used+size > limits.StorageQuotaBytes {
+		return limits, &commonModels.ErrorResponse{
+			Message: fmt.Sprintf("File %s is %s but only %s of your %s storage quota is left", fileName,
+				formatBytes(size), formatBytes(remainingBytes(used, limits.StorageQuotaBytes)), formatBytes(limits.StorageQuotaBytes)),
+			RecommendationAction: []string{
+				"Delete files you no longer need",
+				"Ask an administrator to raise your storage quota",
+			},
+			ErrorStatusCode: http.StatusRequestEntityTooLarge,
+		}
+	}
+	return limits, nil
+}
+
+func (sm *StorageManager) usage(ctx context.Context, user models.UserDynamo) (models.StorageUsage, *commonModels.ErrorResponse) {
+	limits, errResp := sm.userLimits(ctx, user)
+	if errResp != nil {
+		return models.StorageUsage{}, errResp
+	}
+	return models.StorageUsage{
+		UserID:             user.UserID,
+		UsedBytes:          user.StorageUsedBytes,
+		RemainingBytes:     remainingBytes(user.StorageUsedBytes, limits.StorageQuotaBytes),
+		FileCount:          len(user.FileInfo),
+		StorageLimits:      limits,
+		CustomStorageQuota: user.StorageQuotaBytes > 0,
+		CustomMaxFileSize:  user.MaxFileSizeBytes > 0,
+	}, nil
+}
+
+// userLimits returns the limits of the user, the defaults fill in the limits the user has none of its own
+func (sm *StorageManager) userLimits(ctx context.Context, user models.UserDynamo) (models.StorageLimits, *commonModels.ErrorResponse) {
+	limits := models.StorageLimits{
+		StorageQuotaBytes: user.StorageQuotaBytes,
+		MaxFileSizeBytes:  user.MaxFileSizeBytes,
+	}
+	if limits.StorageQuotaBytes > 0 && limits.MaxFileSizeBytes > 0 {
+		return limits, nil
+	}
+	defaults, errResp := sm.GetDefaultLimits(ctx)
+	if errResp != nil {
+		return limits, errResp
+	}
+	if limits.StorageQuotaBytes <= 0 {
+		limits.StorageQuotaBytes = defaults.StorageQuotaBytes
+	}
+	if limits.MaxFileSizeBytes <= 0 {
+		limits.MaxFileSizeBytes = defaults.MaxFileSizeBytes
+	}
+	return limits, nil
+}
+
+func remainingBytes(used int64, quota int64) int64 {
+	if used >= quota {
+		return 0
+	}
+	return quota - used
+}
+
+func invalidStorageLimit(recommendation string) *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:              "Invalid storage limits",
+		RecommendationAction: []string{recommendation},
+		ErrorStatusCode:      http.StatusBadRequest,
+	}
+}
+
+// formatBytes writes a size in the largest unit it reaches, e.g. 1.5 MB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	units := []string{"KB", "MB", "GB", "TB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
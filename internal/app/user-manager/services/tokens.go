@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// issueOneTimeToken stores the hash of a new single use token and returns the token
+func issueOneTimeToken(ctx context.Context, tokenDBSvc database.OneTimeTokensDynamoDBAPI, tokenType string, userID string, emailAddress string, ttl time.Duration) (string, *commonModels.ErrorResponse) {
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error generating %s token. %s", tokenType, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	now := time.Now()
+	oneTimeToken := models.OneTimeTokenDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: tokenHash,
+			SKey: tokenType,
+		},
+		UserID:       userID,
+		EmailAddress: emailAddress,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(ttl).Unix(),
+	}
+	if err := tokenDBSvc.CreateOneTimeTokenInDynamoDB(ctx, oneTimeToken); err != nil {
+		return "", &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error storing %s token. %s", tokenType, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return token, nil
+}
+
+// consumeOneTimeToken uses up a single use token and returns its item if it was valid
+func consumeOneTimeToken(ctx context.Context, tokenDBSvc database.OneTimeTokensDynamoDBAPI, tokenType string, token string, recommendation string) (models.OneTimeTokenDynamo, *commonModels.ErrorResponse) {
+	oneTimeToken, err := tokenDBSvc.ConsumeOneTimeTokenInDynamoDB(ctx, auth.HashOpaqueToken(token), tokenType)
+	// the table TTL deletes expired items lazily, so the expiry is checked here as well
+	if err == database.ErrTokenNotFound || (err == nil && time.Now().Unix() >= oneTimeToken.ExpiresAt) {
+		return oneTimeToken, &commonModels.ErrorResponse{
+			Message:              "Token is invalid, expired or already used",
+			RecommendationAction: []string{recommendation},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	if err != nil {
+		return oneTimeToken, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error reading %s token. %s", tokenType, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return oneTimeToken, nil
+}
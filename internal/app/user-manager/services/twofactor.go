@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// TwoFactorConfig holds the settings of TOTP two-factor authentication
+type TwoFactorConfig struct {
+	// Issuer is the account issuer shown by authenticator apps
+	Issuer            string
+	RecoveryCodeCount int
+}
+
+// TwoFactorService - holds the functions used to enroll and check TOTP authenticators
+type TwoFactorService interface {
+	EnrollTOTP(ctx context.Context, userID string) (models.TOTPEnrollment, *commonModels.ErrorResponse)
+	ConfirmTOTP(ctx context.Context, userID string, code string) (models.RecoveryCodes, *commonModels.ErrorResponse)
+	DisableTOTP(ctx context.Context, userID string, input models.TwoFactorCodeInput) *commonModels.ErrorResponse
+	RegenerateRecoveryCodes(ctx context.Context, userID string, code string) (models.RecoveryCodes, *commonModels.ErrorResponse)
+	VerifySecondFactor(ctx context.Context, userID string, input models.TwoFactorCodeInput) *commonModels.ErrorResponse
+	ResetTwoFactor(ctx context.Context, userID string) *commonModels.ErrorResponse
+}
+
+// TwoFactorManager implements TwoFactorService
+type TwoFactorManager struct {
+	TwoFactorDBSvc database.TwoFactorDynamoDBAPI
+	UserSvc        UserService
+	Config         TwoFactorConfig
+}
+
+// NewTwoFactorService creates an instance of Two Factor Service
+func NewTwoFactorService(twoFactorDBSvc database.TwoFactorDynamoDBAPI, userService UserService, config TwoFactorConfig) TwoFactorService {
+	return &TwoFactorManager{
+		TwoFactorDBSvc: twoFactorDBSvc,
+		UserSvc:        userService,
+		Config:         config,
+	}
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. It has to be confirmed with a code before it is used.
+func (tm *TwoFactorManager) EnrollTOTP(ctx context.Context, userID string) (models.TOTPEnrollment, *commonModels.ErrorResponse) {
+	enrollment := models.TOTPEnrollment{}
+	user, errResp := tm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return enrollment, errResp
+	}
+	if user.TwoFactorEnabled {
+		return enrollment, &commonModels.ErrorResponse{
+			Message:              "Two-factor authentication is already enabled",
+			RecommendationAction: []string{"Disable two-factor authentication before enrolling a new authenticator"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return enrollment, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error generating TOTP secret. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	twoFactor := models.TwoFactorDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: userID,
+			SKey: constants.TypeTwoFactorForSortKey,
+		},
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := tm.TwoFactorDBSvc.PutTwoFactorInDynamoDB(ctx, twoFactor); err != nil {
+		return enrollment, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error saving TOTP enrollment. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	enrollment.Secret = secret
+	enrollment.ProvisioningURI = auth.TOTPProvisioningURI(tm.Config.Issuer, user.EmailAddress, secret)
+	return enrollment, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user sends a valid code from the new authenticator.
+// The recovery codes are returned only here, they are stored hashed.
+func (tm *TwoFactorManager) ConfirmTOTP(ctx context.Context, userID string, code string) (models.RecoveryCodes, *commonModels.ErrorResponse) {
+	recoveryCodes := models.RecoveryCodes{}
+	user, errResp := tm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return recoveryCodes, errResp
+	}
+	twoFactor, err := tm.TwoFactorDBSvc.GetTwoFactorInDynamoDB(ctx, userID)
+	if err == database.ErrTwoFactorNotFound || (err == nil && twoFactor.Confirmed && !user.TwoFactorEnabled) {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:              "No authenticator enrollment to confirm",
+			RecommendationAction: []string{"Start the enrollment with POST /v1/users/{user_id}/2fa/totp"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	if err != nil {
+		return recoveryCodes, twoFactorReadError(err)
+	}
+	if twoFactor.Confirmed {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:         "Two-factor authentication is already enabled",
+			ErrorStatusCode: http.StatusConflict,
+		}
+	}
+	step, ok := auth.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return recoveryCodes, invalidTOTPCodeError()
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(tm.Config.RecoveryCodeCount)
+	if err != nil {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error generating recovery codes. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	err = tm.TwoFactorDBSvc.ConfirmTwoFactorInDynamoDB(ctx, userID, twoFactor.Secret, step, hashes)
+	if err == database.ErrTwoFactorConflict {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:              "Authenticator enrollment was replaced while confirming",
+			RecommendationAction: []string{"Confirm with a code of the latest enrolled secret"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	if err != nil {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error confirming TOTP enrollment. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	user.TwoFactorEnabled = true
+	if _, errResp := tm.UserSvc.UpdateUser(ctx, user); errResp != nil {
+		return recoveryCodes, errResp
+	}
+	recoveryCodes.RecoveryCodes = codes
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns off two-factor authentication after checking a code or recovery code
+func (tm *TwoFactorManager) DisableTOTP(ctx context.Context, userID string, input models.TwoFactorCodeInput) *commonModels.ErrorResponse {
+	if errResp := tm.VerifySecondFactor(ctx, userID, input); errResp != nil {
+		return errResp
+	}
+	return tm.ResetTwoFactor(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking an authenticator code
+func (tm *TwoFactorManager) RegenerateRecoveryCodes(ctx context.Context, userID string, code string) (models.RecoveryCodes, *commonModels.ErrorResponse) {
+	recoveryCodes := models.RecoveryCodes{}
+	if errResp := tm.VerifySecondFactor(ctx, userID, models.TwoFactorCodeInput{Code: code}); errResp != nil {
+		return recoveryCodes, errResp
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes(tm.Config.RecoveryCodeCount)
+	if err != nil {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error generating recovery codes. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	if err := tm.TwoFactorDBSvc.SetRecoveryCodesInDynamoDB(ctx, userID, hashes); err != nil {
+		return recoveryCodes, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error saving recovery codes. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	recoveryCodes.RecoveryCodes = codes
+	return recoveryCodes, nil
+}
+
+// VerifySecondFactor checks an authenticator code or uses up a recovery code of the user.
+// A code is only accepted once, a replayed code fails like a wrong one.
+func (tm *TwoFactorManager) VerifySecondFactor(ctx context.Context, userID string, input models.TwoFactorCodeInput) *commonModels.ErrorResponse {
+	if input.Code == "" && input.RecoveryCode == "" {
+		return &commonModels.ErrorResponse{
+			Message:              "Expected an authenticator code or a recovery code",
+			RecommendationAction: []string{"Send the code of your authenticator app as code, or a recovery code as recoveryCode"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	twoFactor, err := tm.TwoFactorDBSvc.GetTwoFactorInDynamoDB(ctx, userID)
+	if err == database.ErrTwoFactorNotFound || (err == nil && !twoFactor.Confirmed) {
+		return &commonModels.ErrorResponse{
+			Message:         "Two-factor authentication is not enabled",
+			ErrorStatusCode: http.StatusBadRequest,
+		}
+	}
+	if err != nil {
+		return twoFactorReadError(err)
+	}
+
+	if input.Code != "" {
+		step, ok := auth.ValidateTOTP(twoFactor.Secret, input.Code, time.Now())
+		if !ok {
+			return invalidTOTPCodeError()
+		}
+		err = tm.TwoFactorDBSvc.UseTOTPStepInDynamoDB(ctx, userID, step)
+	} else {
+		hash := auth.HashRecoveryCode(input.RecoveryCode)
+		index := -1
+		for i, stored := range twoFactor.RecoveryCodes {
+			if stored == hash {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return &commonModels.ErrorResponse{
+				Message:              "Invalid recovery code",
+				RecommendationAction: []string{"Each recovery code can only be used once"},
+				ErrorStatusCode:      http.StatusUnauthorized,
+			}
+		}
+		err = tm.TwoFactorDBSvc.UseRecoveryCodeInDynamoDB(ctx, userID, index, hash)
+	}
+	if err == database.ErrTwoFactorConflict {
+		return &commonModels.ErrorResponse{
+			Message:              "Code was already used",
+			RecommendationAction: []string{"Wait for the next code of your authenticator app"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error recording used code. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ResetTwoFactor turns off two-factor authentication without a code, used by admins for users who lost their authenticator
+func (tm *TwoFactorManager) ResetTwoFactor(ctx context.Context, userID string) *commonModels.ErrorResponse {
+	user, errResp := tm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return errResp
+	}
+	// the flag goes first, an enrollment left behind without it is replaced on the next enrollment
+	if user.TwoFactorEnabled {
+		user.TwoFactorEnabled = false
+		if _, errResp := tm.UserSvc.UpdateUser(ctx, user); errResp != nil {
+			return errResp
+		}
+	}
+	if err := tm.TwoFactorDBSvc.DeleteTwoFactorInDynamoDB(ctx, userID); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error deleting TOTP enrollment. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func invalidTOTPCodeError() *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:              "Invalid authenticator code",
+		RecommendationAction: []string{"Enter the current 6 digit code of your authenticator app", "Check that the clock of your device is correct"},
+		ErrorStatusCode:      http.StatusUnauthorized,
+	}
+}
+
+func twoFactorReadError(err error) *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:         fmt.Sprintf("Error reading TOTP enrollment. %s", err.Error()),
+		ErrorStatusCode: http.StatusInternalServerError,
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+)
+
+// memoryTwoFactor keeps an enrollment with the conditions of the table, the other methods of the interface are not used
+type memoryTwoFactor struct {
+	database.TwoFactorDynamoDBAPI
+	enrollment models.TwoFactorDynamo
+}
+
+func (mt *memoryTwoFactor) GetTwoFactorInDynamoDB(ctx context.Context, userID string) (models.TwoFactorDynamo, error) {
+	return mt.enrollment, nil
+}
+
+func (mt *memoryTwoFactor) UseTOTPStepInDynamoDB(ctx context.Context, userID string, step int64) error {
+	if mt.enrollment.LastUsedStep >= step {
+		return database.ErrTwoFactorConflict
+	}
+	mt.enrollment.LastUsedStep = step
+	return nil
+}
+
+// totpCodeAt computes the code of the secret for the step of the time like an authenticator app
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestVerifySecondFactorRefusesUsedSteps(t *testing.T) {
+	ctx := context.Background()
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	twoFactor := &memoryTwoFactor{enrollment: models.TwoFactorDynamo{UserID: "user-1", Secret: secret, Confirmed: true}}
+	service := NewTwoFactorService(twoFactor, nil, TwoFactorConfig{})
+
+	now := time.Now()
+	current := models.TwoFactorCodeInput{Code: totpCodeAt(t, secret, now)}
+	if errResp := service.VerifySecondFactor(ctx, "user-1", current); errResp != nil {
+		t.Fatalf("VerifySecondFactor: %s", errResp.Message)
+	}
+	// the same code, and a code of the step before, can't be used after it
+	refused := []struct {
+		name  string
+		input models.TwoFactorCodeInput
+	}{
+		{"replayed code", current},
+		{"earlier code", models.TwoFactorCodeInput{Code: totpCodeAt(t, secret, now.Add(-30*time.Second))}},
+	}
+	for _, test := range refused {
+		if errResp := service.VerifySecondFactor(ctx, "user-1", test.input); errResp == nil || errResp.ErrorStatusCode != http.StatusUnauthorized {
+			t.Errorf("%s got %+v, want 401", test.name, errResp)
+		}
+	}
+	// a code of the next step is still accepted
+	if errResp := service.VerifySecondFactor(ctx, "user-1", models.TwoFactorCodeInput{Code: totpCodeAt(t, secret, now.Add(30*time.Second))}); errResp != nil {
+		t.Errorf("next code got %s", errResp.Message)
+	}
+}
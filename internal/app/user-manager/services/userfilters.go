@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+type filterKind int
+
+const (
+	filterString filterKind = iota
+	filterBool
+	filterTime
+	// filterSet matches users on whether a timestamp attribute is set
+	filterSet
+)
+
+// maxFilterValueLength bounds string filter values, no filterable attribute is longer
+const maxFilterValueLength = 254
+
+// userFilter is a query parameter that filters the user listing
+type userFilter struct {
+	attribute string
+	operator  string
+	kind      filterKind
+}
+
+// userFilters is the allow-list of query parameters filtering the user listing.
+// Names filter on equality, the suffixes _prefix and _contains match part of a string and _after and _before take a time.
+// deactivated lists deleted accounts awaiting their purge, which are left out otherwise.
+var userFilters = buildUserFilters()
+
+func buildUserFilters() map[string]userFilter {
+	filters := map[string]userFilter{}
+	for param, attribute := range map[string]string{
+		"firstName": "FirstName",
+		"lastName":  "LastName",
+		"email":     "EmailAddress",
+	} {
+		filters[param] = userFilter{attribute: attribute, operator: commonModels.OpEqual, kind: filterString}
+		filters[param+"_prefix"] = userFilter{attribute: attribute, operator: commonModels.OpBeginsWith, kind: filterString}
+		filters[param+"_contains"] = userFilter{attribute: attribute, operator: commonModels.OpContains, kind: filterString}
+	}
+	for param, attribute := range map[string]string{
+		"isAdmin":                  "IsAdmin",
+		"disabled":                 "Disabled",
+		"emailVerificationPending": "EmailVerificationPending",
+		"twoFactorEnabled":         "TwoFactorEnabled",
+	} {
+		filters[param] = userFilter{attribute: attribute, operator: commonModels.OpEqual, kind: filterBool}
+	}
+	filters["created_after"] = userFilter{attribute: "CreatedAt", operator: commonModels.OpGreaterThan, kind: filterTime}
+	filters["created_before"] = userFilter{attribute: "CreatedAt", operator: commonModels.OpLessThan, kind: filterTime}
+	filters["deactivated"] = userFilter{attribute: "DeactivatedAt", kind: filterSet}
+	return filters
+}
+
+// UserFilterConditions turns the filter query parameters of the user listing into query conditions.
+// Parameters outside the allow-list are rejected, so callers remove the ones they handle themselves first.
+func UserFilterConditions(params url.Values) ([]commonModels.QueryCondition, *commonModels.ErrorResponse) {
+	var conditions []commonModels.QueryCondition
+	deactivated := false
+	for param, values := range params {
+		filter, ok := userFilters[param]
+		if !ok {
+			return nil, &commonModels.ErrorResponse{
+				Message:              fmt.Sprintf("Unknown filter %s", param),
+				RecommendationAction: []string{fmt.Sprintf("Filter on any of %v", userFilterNames())},
+				ErrorStatusCode:      http.StatusBadRequest,
+			}
+		}
+		if len(values) != 1 {
+			return nil, invalidFilter(param, "Send the filter once")
+		}
+		value, errResp := parseFilterValue(param, filter.kind, values[0])
+		if errResp != nil {
+			return nil, errResp
+		}
+		if filter.kind == filterSet {
+			deactivated = value.(bool)
+			continue
+		}
+		conditions = append(conditions, commonModels.QueryCondition{
+			Key:      filter.attribute,
+			Operator: filter.operator,
+			Values:   []interface{}{value},
+		})
+	}
+	if deactivated {
+		conditions = append(conditions, commonModels.QueryCondition{
+			Key:      "DeactivatedAt",
+			Operator: commonModels.OpGreaterThan,
+			Values:   []interface{}{int64(0)},
+		})
+	} else {
+		conditions = append(conditions, ActiveUsersCondition())
+	}
+	// a stable order keeps the filter expression the same between pages
+	sort.Slice(conditions, func(i, j int) bool {
+		if conditions[i].Key != conditions[j].Key {
+			return conditions[i].Key < conditions[j].Key
+		}
+		return conditions[i].Operator < conditions[j].Operator
+	})
+	return conditions, nil
+}
+
+// ActiveUsersCondition matches the users whose accounts are not deactivated
+func ActiveUsersCondition() commonModels.QueryCondition {
+	return commonModels.QueryCondition{
+		Key:      "DeactivatedAt",
+		Operator: commonModels.OpEqual,
+		Values:   []interface{}{int64(0)},
+	}
+}
+
+func parseFilterValue(param string, kind filterKind, value string) (interface{}, *commonModels.ErrorResponse) {
+	switch kind {
+	case filterBool, filterSet:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalidFilter(param, "Send true or false")
+		}
+		return parsed, nil
+	case filterTime:
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return seconds, nil
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, invalidFilter(param, "Send a time like 2021-01-31T00:00:00Z or epoch seconds")
+		}
+		return parsed.Unix(), nil
+	}
+	if value == "" || len(value) > maxFilterValueLength {
+		return nil, invalidFilter(param, fmt.Sprintf("Send 1 to %d characters", maxFilterValueLength))
+	}
+	return value, nil
+}
+
+func invalidFilter(param string, recommendation string) *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:              fmt.Sprintf("Invalid value of filter %s", param),
+		RecommendationAction: []string{recommendation},
+		ErrorStatusCode:      http.StatusBadRequest,
+	}
+}
+
+func userFilterNames() []string {
+	names := make([]string, 0, len(userFilters))
+	for name := range userFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+func TestUserFilterConditions(t *testing.T) {
+	params := url.Values{
+		"email_prefix":      {"ada@"},
+		"lastName_contains": {"love"},
+		"isAdmin":           {"true"},
+		"created_after":     {"2021-01-31T00:00:00Z"},
+		"created_before":    {"1700000000"},
+	}
+	conditions, errResp := UserFilterConditions(params)
+	if errResp != nil {
+		t.Fatalf("UserFilterConditions: %s", errResp.Message)
+	}
+	want := []commonModels.QueryCondition{
+		{Key: "CreatedAt", Operator: commonModels.OpGreaterThan, Values: []interface{}{int64(1612051200)}},
+		{Key: "CreatedAt", Operator: commonModels.OpLessThan, Values: []interface{}{int64(1700000000)}},
+		ActiveUsersCondition(),
+		{Key: "EmailAddress", Operator: commonModels.OpBeginsWith, Values: []interface{}{"ada@"}},
+		{Key: "IsAdmin", Operator: commonModels.OpEqual, Values: []interface{}{true}},
+		{Key: "LastName", Operator: commonModels.OpContains, Values: []interface{}{"love"}},
+	}
+	if !reflect.DeepEqual(conditions, want) {
+		t.Errorf("got conditions %+v, want %+v", conditions, want)
+	}
+
+	// deactivated lists the deleted accounts instead of the active ones
+	conditions, errResp = UserFilterConditions(url.Values{"deactivated": {"true"}})
+	if errResp != nil {
+		t.Fatalf("UserFilterConditions: %s", errResp.Message)
+	}
+	deactivated := []commonModels.QueryCondition{{Key: "DeactivatedAt", Operator: commonModels.OpGreaterThan, Values: []interface{}{int64(0)}}}
+	if !reflect.DeepEqual(conditions, deactivated) {
+		t.Errorf("deactivated got conditions %+v", conditions)
+	}
+}
+
+func TestUserFilterConditionsRejectsFilters(t *testing.T) {
+	tests := map[string]url.Values{
+		"unknown filter":    {"password": {"secret"}},
+		"unknown operator":  {"email_suffix": {"example.com"}},
+		"attribute name":    {"EmailAddress": {"ada@example.com"}},
+		"repeated filter":   {"email": {"ada@example.com", "grace@example.com"}},
+		"empty value":       {"firstName": {""}},
+		"long value":        {"email_contains": {string(make([]byte, maxFilterValueLength+1))}},
+		"not a boolean":     {"disabled": {"maybe"}},
+		"not a time":        {"created_after": {"yesterday"}},
+		"deactivated value": {"deactivated": {"soon"}},
+	}
+	for name, params := range tests {
+		if _, errResp := UserFilterConditions(params); errResp == nil || errResp.ErrorStatusCode != http.StatusBadRequest {
+			t.Errorf("%s got %+v, want 400", name, errResp)
+		}
+	}
+}
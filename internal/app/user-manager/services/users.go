@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
 	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type UserService interface {
@@ -20,20 +24,42 @@ type UserService interface {
 	UpdateUser(ctx context.Context, user models.UserDynamo) (models.UserDynamo, *commonModels.ErrorResponse)
 	DeleteUser(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse)
 	GetAndValidateUser(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse)
+	LoadPrincipal(ctx context.Context, userID string) (auth.Principal, *commonModels.ErrorResponse)
+	HashNewPassword(ctx context.Context, password string) ([]byte, *commonModels.ErrorResponse)
+	UpdateProfile(ctx context.Context, userID string, input models.UserProfileInput) (models.UserDynamo, bool, *commonModels.ErrorResponse)
+	ChangePassword(ctx context.Context, userID string, input models.ChangePasswordInput) *commonModels.ErrorResponse
 }
 
+const (
+	maxNameLength = 100
+	// maxEmailLength is the longest address SMTP can deliver to
+	maxEmailLength = 254
+)
+
 type UserManager struct {
-	UserSvc database.UsersDynamoDBAPI
+	UserSvc        database.UsersDynamoDBAPI
+	Passwords      auth.PasswordHasher
+	PasswordPolicy *auth.PasswordPolicy
 }
 
-func NewUserService(dbSvc database.UsersDynamoDBAPI) UserService {
+func NewUserService(dbSvc database.UsersDynamoDBAPI, passwords auth.PasswordHasher, passwordPolicy *auth.PasswordPolicy) UserService {
 	return &UserManager{
-		UserSvc: dbSvc,
+		UserSvc:        dbSvc,
+		Passwords:      passwords,
+		PasswordPolicy: passwordPolicy,
 	}
 }
 
 func (qm *UserManager) GetAndValidateCredentials(ctx context.Context, userCred models.UserInputLogin) (models.CredIsAdmin, *commonModels.ErrorResponse) {
 	userCredResp, err := qm.UserSvc.GetUserCredentials(ctx, userCred.EmailAddress)
+	if err == database.ErrUserNotFound {
+		// reported like a wrong password so logins can't be used to find accounts
+		return userCredResp, &commonModels.ErrorResponse{
+			Message:              "Error validating password",
+			RecommendationAction: []string{"Enter the correct email address and password"},
+			ErrorStatusCode:      http.StatusUnauthorized,
+		}
+	}
 	if err != nil {
 		return userCredResp, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error getting user credentials from database. %s", err.Error()),
@@ -41,7 +67,8 @@ func (qm *UserManager) GetAndValidateCredentials(ctx context.Context, userCred m
 		}
 	}
 	// Compare the stored hashed password, with the hashed version of the password that was received
-	if err = bcrypt.CompareHashAndPassword([]byte(userCredResp.Password), []byte(userCred.Password)); err != nil {
+	match, needsRehash := qm.Passwords.Verify(userCredResp.Password, userCred.Password)
+	if !match {
 		// If the two passwords don't match, return a 401 status
 		return userCredResp, &commonModels.ErrorResponse{
 			Message: fmt.Sprintf("Error validating password"),
@@ -49,13 +76,79 @@ func (qm *UserManager) GetAndValidateCredentials(ctx context.Context, userCred m
 			ErrorStatusCode: http.StatusUnauthorized,
 		}
 	}
+	if userCredResp.EmailVerificationPending {
+		return userCredResp, &commonModels.ErrorResponse{
+			Message: "Email address is not verified",
+			RecommendationAction: []string{
+				"Open the verification link mailed to you when you registered",
+				"Request a new verification link with POST /v1/verify-email/resend",
+			},
+			ErrorStatusCode: http.StatusForbidden,
+		}
+	}
+	if userCredResp.Disabled {
+		return userCredResp, accountDisabled()
+	}
+	if userCredResp.DeactivatedAt > 0 {
+		return userCredResp, accountDeactivated()
+	}
+	if userCredResp.PasswordResetRequired {
+		return userCredResp, &commonModels.ErrorResponse{
+			Message:              "Password reset required",
+			RecommendationAction: []string{"Request a password reset link with POST /v1/password/forgot"},
+			ErrorStatusCode:      http.StatusForbidden,
+		}
+	}
+	if needsRehash {
+		qm.rehashPassword(ctx, userCredResp, userCred.Password)
+	}
 
 	return userCredResp, nil
 }
 
+// rehashPassword replaces a hash made with outdated parameters, a failure only leaves the old hash in place
+func (qm *UserManager) rehashPassword(ctx context.Context, userCreds models.CredIsAdmin, password string) {
+	newHash, err := qm.Passwords.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password of user %s. %s", userCreds.UserID, err.Error())
+		return
+	}
+	if err := qm.UserSvc.UpdateUserPasswordInDynamoDB(ctx, userCreds.UserID, userCreds.Password, newHash); err != nil {
+		log.Printf("Error storing rehashed password of user %s. %s", userCreds.UserID, err.Error())
+		return
+	}
+	log.Printf("Rehashed password of user %s with the current parameters", userCreds.UserID)
+}
+
+// HashNewPassword checks a password chosen by the user against the password policy and hashes it
+func (qm *UserManager) HashNewPassword(ctx context.Context, password string) ([]byte, *commonModels.ErrorResponse) {
+	if violations := qm.PasswordPolicy.Validate(password); len(violations) > 0 {
+		return nil, &commonModels.ErrorResponse{
+			Message:              "Password doesn't meet the password policy",
+			RecommendationAction: violations,
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	hashedPassword, err := qm.Passwords.Hash(password)
+	if err != nil {
+		return nil, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error hashing password. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return hashedPassword, nil
+}
+
 func (qm *UserManager) GetUsers(ctx context.Context, dbQuery commonModels.DatabaseQuery) (models.Users, *commonModels.ErrorResponse) {
 	var users models.Users
-	usersResp, err := qm.UserSvc.GetUsersInDynamoDB(ctx, dbQuery)
+	usersResp, nextCursor, err := qm.UserSvc.GetUsersInDynamoDB(ctx, dbQuery)
+	if err == database.ErrInvalidCursor {
+		return users, &commonModels.ErrorResponse{
+			Message:              "Invalid cursor",
+			RecommendationAction: []string{"Use the next_cursor of the previous page, or leave cursor out for the first page"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
 	if err != nil {
 		return users, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error getting users from database. %s", err.Error()),
@@ -66,14 +159,30 @@ func (qm *UserManager) GetUsers(ctx context.Context, dbQuery commonModels.Databa
 	for _, userDynamo := range usersResp {
 		users.Members = append(users.Members, userDynamo.User)
 	}
+	users.NextCursor = nextCursor
 	return users, nil
 }
 
+// CreateUser stores a new user, an email address can only be registered once
 func (um *UserManager) CreateUser(ctx context.Context, input models.UserDynamo) (models.UserDynamo, *commonModels.ErrorResponse) {
 	var err error
 	var userCreateResp models.UserDynamo
 
-	userCreateResp, err = um.UserSvc.CreateUserInDynamoDB(ctx, input, "")
+	input.EmailAddress = strings.TrimSpace(input.EmailAddress)
+	if errResp := validateEmail(input.EmailAddress); errResp != nil {
+		return userCreateResp, errResp
+	}
+	if input.CreatedAt == 0 {
+		input.CreatedAt = time.Now().Unix()
+	}
+	userCreateResp, err = um.UserSvc.CreateNewUserInDynamoDB(ctx, input)
+	if err == database.ErrEmailTaken {
+		return userCreateResp, &commonModels.ErrorResponse{
+			Message:              "A user with this email address already exists",
+			RecommendationAction: []string{"Login with this email address or reset its password"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
 	if err != nil {
 		return userCreateResp, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error creating user. %s", err.Error()),
@@ -89,7 +198,7 @@ func (um *UserManager) GetUser(ctx context.Context, userID string) (models.UserD
 	userResp, err := um.UserSvc.GetUserInDynamoDB(ctx, userID, constants.TypeUsersForSortKey)
 	if err != nil {
 		return models.UserDynamo{}, &commonModels.ErrorResponse{
-			Message:         fmt.Sprintf("Erro getting user. %s", err.Error),
+			Message:         fmt.Sprintf("Erro getting user. %s", err.Error()),
 			ErrorStatusCode: http.StatusInternalServerError,
 		}
 	}
@@ -104,9 +213,7 @@ func (um *UserManager) GetUser(ctx context.Context, userID string) (models.UserD
 
 // GetAndValidateUser will get the user from db and validate
 func (um *UserManager) GetAndValidateUser(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse) {
-	log.Printf("entering get and validate user mentsh")
 	user, err := um.UserSvc.GetUserInDynamoDB(ctx, userID, constants.TypeUsersForSortKey)
-	log.Printf("User details %v %v", user, err)
 	if err != nil {
 		return user, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error getting user. %s", err.Error()),
@@ -122,18 +229,24 @@ func (um *UserManager) GetAndValidateUser(ctx context.Context, userID string) (m
 	return user, nil
 }
 
-// UpdateUser updates user
+// UpdateUser stores the user if nothing else wrote it since it was read
 func (um *UserManager) UpdateUser(ctx context.Context, userInput models.UserDynamo) (models.UserDynamo, *commonModels.ErrorResponse) {
-	err := um.UserSvc.DeleteUserInDynamoDB(ctx, userInput.UserID, "user")
-	if err != nil {
-		return models.UserDynamo{}, &commonModels.ErrorResponse{
-			Message:         fmt.Sprintf("Error occured while updating the user. %s", err.Error()),
-			ErrorStatusCode: http.StatusInternalServerError,
+	userUpdateResp, err := um.UserSvc.UpdateUserInDynamoDB(ctx, userInput)
+	if err == database.ErrUserChanged {
+		return userInput, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("User %s was changed by another request", userInput.UserID),
+			RecommendationAction: []string{"Get the user again and retry the request"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	if err == database.ErrUserNotFound {
+		return userInput, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("User %s doesn't exist", userInput.UserID),
+			ErrorStatusCode: http.StatusNotFound,
 		}
 	}
-	userUpdateResp, err := um.UserSvc.CreateUserInDynamoDB(ctx, userInput, "")
 	if err != nil {
-		return userUpdateResp, &commonModels.ErrorResponse{
+		return userInput, &commonModels.ErrorResponse{
 			Message:         fmt.Sprintf("Error updating user. %s", err.Error()),
 			ErrorStatusCode: http.StatusInternalServerError,
 		}
@@ -141,15 +254,165 @@ func (um *UserManager) UpdateUser(ctx context.Context, userInput models.UserDyna
 	return userUpdateResp, nil
 }
 
-// DeleteUser deletes the user from dynamo db
+// DeleteUser deletes the user from dynamo db and frees its email address
 func (um *UserManager) DeleteUser(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse) {
-	userResp := models.UserDynamo{}
-	err := um.UserSvc.DeleteUserInDynamoDB(ctx, userID, constants.TypeUsersForSortKey)
+	userResp, errResp := um.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return models.UserDynamo{}, errResp
+	}
+	err := um.UserSvc.DeleteUserAndEmailInDynamoDB(ctx, userID, userResp.EmailAddress)
 	if err != nil {
 		return models.UserDynamo{}, &commonModels.ErrorResponse{
-			Message:         fmt.Sprintf("Error deleting user. %s", err.Error),
+			Message:         fmt.Sprintf("Error deleting user. %s", err.Error()),
 			ErrorStatusCode: http.StatusInternalServerError,
 		}
 	}
 	return userResp, nil
-}
\ No newline at end of file
+}
+
+// LoadPrincipal loads the stored account state used for authorization decisions
+func (um *UserManager) LoadPrincipal(ctx context.Context, userID string) (auth.Principal, *commonModels.ErrorResponse) {
+	user, err := um.GetAndValidateUser(ctx, userID)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if user.Disabled {
+		return auth.Principal{}, accountDisabled()
+	}
+	if user.DeactivatedAt > 0 {
+		return auth.Principal{}, accountDeactivated()
+	}
+	return auth.Principal{
+		UserID:  user.UserID,
+		IsAdmin: user.IsAdmin,
+	}, nil
+}
+
+// UpdateProfile changes the names and email address of the user.
+// A new email address has to be verified again, the second return value reports that it changed.
+func (um *UserManager) UpdateProfile(ctx context.Context, userID string, input models.UserProfileInput) (models.UserDynamo, bool, *commonModels.ErrorResponse) {
+	user, errResp := um.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return user, false, errResp
+	}
+	previousEmail := user.EmailAddress
+	if input.FirstName != nil {
+		if user.FirstName, errResp = validateName("First name", *input.FirstName); errResp != nil {
+			return user, false, errResp
+		}
+	}
+	if input.LastName != nil {
+		if user.LastName, errResp = validateName("Last name", *input.LastName); errResp != nil {
+			return user, false, errResp
+		}
+	}
+	emailChanged := false
+	if input.EmailAddress != nil {
+		email := strings.TrimSpace(*input.EmailAddress)
+		if errResp := validateEmail(email); errResp != nil {
+			return user, false, errResp
+		}
+		// a change of case only is kept without verifying the address again
+		emailChanged = database.NormalizeEmail(email) != database.NormalizeEmail(previousEmail)
+		user.EmailAddress = email
+		if emailChanged {
+			user.EmailVerificationPending = true
+		}
+	}
+
+	err := um.UserSvc.UpdateUserProfileInDynamoDB(ctx, user, previousEmail)
+	if err == database.ErrEmailTaken {
+		return user, false, &commonModels.ErrorResponse{
+			Message:              "A user with this email address already exists",
+			RecommendationAction: []string{"Choose another email address"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	if err != nil {
+		return user, false, &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error updating profile of user %s. %s", userID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return user, emailChanged, nil
+}
+
+// ChangePassword sets a new password after checking the current one
+func (um *UserManager) ChangePassword(ctx context.Context, userID string, input models.ChangePasswordInput) *commonModels.ErrorResponse {
+	user, errResp := um.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return errResp
+	}
+	if match, _ := um.Passwords.Verify(user.Password, input.CurrentPassword); !match {
+		return &commonModels.ErrorResponse{
+			Message: "Current password is wrong",
+			RecommendationAction: []string{
+				"Enter the current password",
+				"Users without a password, e.g. from single sign-on, set one with POST /v1/password/forgot",
+			},
+			ErrorStatusCode: http.StatusForbidden,
+		}
+	}
+	hashedPassword, errResp := um.HashNewPassword(ctx, input.NewPassword)
+	if errResp != nil {
+		return errResp
+	}
+	err := um.UserSvc.UpdateUserPasswordInDynamoDB(ctx, userID, user.Password, hashedPassword)
+	if err == database.ErrPasswordChanged {
+		return &commonModels.ErrorResponse{
+			Message:              "Password was changed by another request",
+			RecommendationAction: []string{"Login again with the new password"},
+			ErrorStatusCode:      http.StatusConflict,
+		}
+	}
+	if err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error changing password of user %s. %s", userID, err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+func validateName(field string, name string) (string, *commonModels.ErrorResponse) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return name, &commonModels.ErrorResponse{
+			Message:              fmt.Sprintf("%s must have 1 to %d characters", field, maxNameLength),
+			RecommendationAction: []string{fmt.Sprintf("Check the %s", strings.ToLower(field))},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return name, nil
+}
+
+// validateEmail accepts a bare address like user@example.com, display names are rejected
+func validateEmail(email string) *commonModels.ErrorResponse {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > maxEmailLength {
+		return &commonModels.ErrorResponse{
+			Message:              "Invalid email address",
+			RecommendationAction: []string{"Enter an email address like name@example.com"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// accountDisabled is the error of every way into an account an admin disabled
+func accountDisabled() *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:              "Account is disabled",
+		RecommendationAction: []string{"Contact an administrator"},
+		ErrorStatusCode:      http.StatusForbidden,
+	}
+}
+
+// accountDeactivated is the error of every way into a deleted account that isn't purged yet
+func accountDeactivated() *commonModels.ErrorResponse {
+	return &commonModels.ErrorResponse{
+		Message:              "Account is deleted",
+		RecommendationAction: []string{"Contact an administrator to restore the account"},
+		ErrorStatusCode:      http.StatusForbidden,
+	}
+}
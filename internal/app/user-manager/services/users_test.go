@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+func TestCreateUserWithRegisteredEmailIsAConflict(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryUsers(models.UserDynamo{User: models.User{UserID: "user-1", Credentials: models.Credentials{EmailAddress: "ada@example.com"}}})
+	service := NewUserService(users, nil, nil)
+
+	for _, email := range []string{"ada@example.com", " ADA@example.com "} {
+		input := models.UserDynamo{User: models.User{UserID: "user-2", Credentials: models.Credentials{EmailAddress: email}}}
+		if _, errResp := service.CreateUser(ctx, input); errResp == nil || errResp.ErrorStatusCode != http.StatusConflict {
+			t.Errorf("%q got %+v, want 409", email, errResp)
+		}
+	}
+	if _, ok := users.users["user-2"]; ok {
+		t.Error("user with a registered address was stored")
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+	commonModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+// VerificationConfig holds the settings of the email verification flow
+type VerificationConfig struct {
+	// VerifyURL is the endpoint the verification token is appended to
+	VerifyURL string
+	TokenTTL  time.Duration
+}
+
+// VerificationService - holds the functions used to verify email addresses
+type VerificationService interface {
+	SendVerification(ctx context.Context, user models.User) *commonModels.ErrorResponse
+	ResendVerification(ctx context.Context, emailAddress string) *commonModels.ErrorResponse
+	VerifyEmail(ctx context.Context, token string) (models.UserDynamo, *commonModels.ErrorResponse)
+	MarkVerified(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse)
+}
+
+// VerificationManager implements VerificationService
+type VerificationManager struct {
+	TokenDBSvc database.OneTimeTokensDynamoDBAPI
+	UserDBSvc  database.UsersDynamoDBAPI
+	UserSvc    UserService
+	Mailer     mailer.Mailer
+	Config     VerificationConfig
+}
+
+// NewVerificationService creates an instance of Verification Service
+func NewVerificationService(
+	tokenDBSvc database.OneTimeTokensDynamoDBAPI,
+	userDBSvc database.UsersDynamoDBAPI,
+	userService UserService,
+	mail mailer.Mailer,
+	config VerificationConfig,
+) VerificationService {
+	return &VerificationManager{
+		TokenDBSvc: tokenDBSvc,
+		UserDBSvc:  userDBSvc,
+		UserSvc:    userService,
+		Mailer:     mail,
+		Config:     config,
+	}
+}
+
+// SendVerification mails a verification link for the current address of the user
+func (vm *VerificationManager) SendVerification(ctx context.Context, user models.User) *commonModels.ErrorResponse {
+	token, errResp := issueOneTimeToken(ctx, vm.TokenDBSvc, constants.TypeEmailVerificationForSortKey, user.UserID, user.EmailAddress, vm.Config.TokenTTL)
+	if errResp != nil {
+		return errResp
+	}
+	msg := mailer.Message{
+		To:      []string{user.EmailAddress},
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open the link below within %s to verify your email address:\n%s\n",
+			user.FirstName, vm.Config.TokenTTL, vm.verifyLink(token)),
+	}
+	if err := vm.Mailer.Send(ctx, msg); err != nil {
+		return &commonModels.ErrorResponse{
+			Message:         fmt.Sprintf("Error sending verification mail. %s", err.Error()),
+			ErrorStatusCode: http.StatusInternalServerError,
+		}
+	}
+	return nil
+}
+
+// ResendVerification mails a new verification link if the address belongs to an unverified user.
+// Unknown or already verified addresses are not reported to the caller.
+func (vm *VerificationManager) ResendVerification(ctx context.Context, emailAddress string) *commonModels.ErrorResponse {
+	userCreds, err := vm.UserDBSvc.GetUserCredentials(ctx, emailAddress)
+	if err != nil {
+		log.Printf("Verification mail requested for unknown email. %s", err.Error())
+		return nil
+	}
+	if !userCreds.EmailVerificationPending {
+		return nil
+	}
+	user, errResp := vm.UserSvc.GetAndValidateUser(ctx, userCreds.UserID)
+	if errResp != nil {
+		return errResp
+	}
+	return vm.SendVerification(ctx, user.User)
+}
+
+// VerifyEmail marks the address of the token owner as verified
+func (vm *VerificationManager) VerifyEmail(ctx context.Context, token string) (models.UserDynamo, *commonModels.ErrorResponse) {
+	verificationToken, errResp := consumeOneTimeToken(ctx, vm.TokenDBSvc, constants.TypeEmailVerificationForSortKey, token, "Request a new verification mail")
+	if errResp != nil {
+		return models.UserDynamo{}, errResp
+	}
+	user, errResp := vm.UserSvc.GetAndValidateUser(ctx, verificationToken.UserID)
+	if errResp != nil {
+		return user, errResp
+	}
+	// the link is only valid for the address it was sent to
+	if verificationToken.EmailAddress != user.EmailAddress {
+		return user, &commonModels.ErrorResponse{
+			Message:              "Verification link was sent to a previous email address of the user",
+			RecommendationAction: []string{"Request a new verification mail"},
+			ErrorStatusCode:      http.StatusBadRequest,
+		}
+	}
+	return vm.setVerified(ctx, user)
+}
+
+// MarkVerified marks the address of the user as verified without a token, used by admins
+func (vm *VerificationManager) MarkVerified(ctx context.Context, userID string) (models.UserDynamo, *commonModels.ErrorResponse) {
+	user, errResp := vm.UserSvc.GetAndValidateUser(ctx, userID)
+	if errResp != nil {
+		return user, errResp
+	}
+	return vm.setVerified(ctx, user)
+}
+
+func (vm *VerificationManager) setVerified(ctx context.Context, user models.UserDynamo) (models.UserDynamo, *commonModels.ErrorResponse) {
+	if !user.EmailVerificationPending {
+		return user, nil
+	}
+	user.EmailVerificationPending = false
+	return vm.UserSvc.UpdateUser(ctx, user)
+}
+
+func (vm *VerificationManager) verifyLink(token string) string {
+	return vm.Config.VerifyURL + "?token=" + url.QueryEscape(token)
+}
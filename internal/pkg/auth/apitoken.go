@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+)
+
+const (
+	// APITokenPrefix marks personal API tokens so they can be told apart from signed session tokens
+	APITokenPrefix = "uat_"
+	// TokenTypeAPI identifies the claims of a personal API token
+	TokenTypeAPI = "api_token"
+
+	apiTokenSeparator = "_"
+
+	// ScopeRead lets an API token read the user and download files
+	ScopeRead = "read"
+	// ScopeUpload lets an API token upload files and update their description
+	ScopeUpload = "upload"
+	// ScopeDelete lets an API token delete files
+	ScopeDelete = "delete"
+)
+
+// APITokenScopes are the scopes an API token can be created with
+var APITokenScopes = []string{ScopeRead, ScopeUpload, ScopeDelete}
+
+// FormatAPIToken builds the API token handed to the user.
+// The user and token IDs are part of it so the stored hash can be found with a single read.
+func FormatAPIToken(userID string, tokenID string, secret string) string {
+	return APITokenPrefix + userID + apiTokenSeparator + tokenID + apiTokenSeparator + secret
+}
+
+// ParseAPIToken splits an API token into the user ID and token ID it was issued for
+func ParseAPIToken(token string) (string, string, bool) {
+	if !IsAPIToken(token) {
+		return "", "", false
+	}
+	// the secret is base64url encoded and may itself contain the separator
+	parts := strings.SplitN(strings.TrimPrefix(token, APITokenPrefix), apiTokenSeparator, 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// IsAPIToken reports whether the bearer token is a personal API token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// HasScope reports whether the claims allow the scope. Session tokens are not scoped and allow everything.
+func (c Claims) HasScope(scope string) bool {
+	if c.TokenType != TokenTypeAPI {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package auth
+
+import "testing"
+
+func TestParseAPIToken(t *testing.T) {
+	// base64url secrets can hold the separator, it stays part of the secret
+	token := FormatAPIToken("user-1", "token-1", "se_cr_et")
+	userID, tokenID, ok := ParseAPIToken(token)
+	if !ok || userID != "user-1" || tokenID != "token-1" {
+		t.Errorf("parsed %s into %q, %q, %v", token, userID, tokenID, ok)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"uat_",
+		"uat_user-1",
+		"uat_user-1_token-1",
+		"uat_user-1_token-1_",
+		"uat__token-1_secret",
+		"uat_user-1__secret",
+		"user-1_token-1_secret",
+		"eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ1c2VyLTEifQ.signature",
+	} {
+		if _, _, ok := ParseAPIToken(invalid); ok {
+			t.Errorf("%q was parsed as an API token", invalid)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	apiClaims := Claims{TokenType: TokenTypeAPI, Scopes: []string{ScopeRead}}
+	if !apiClaims.HasScope(ScopeRead) || apiClaims.HasScope(ScopeUpload) || apiClaims.HasScope(ScopeDelete) {
+		t.Errorf("API token with %v got the wrong scopes", apiClaims.Scopes)
+	}
+	if (Claims{TokenType: TokenTypeAPI}).HasScope(ScopeRead) {
+		t.Error("API token without scopes was allowed")
+	}
+	if !(Claims{}).HasScope(ScopeDelete) {
+		t.Error("session token was limited by scopes")
+	}
+}
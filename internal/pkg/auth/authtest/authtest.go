@@ -0,0 +1,68 @@
+// Package authtest holds the checks the handler tests share to keep passwords out of responses
+package authtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
+)
+
+// PasswordHashConfigs returns every supported password hash algorithm with parameters cheap enough for tests
+func PasswordHashConfigs() map[string]auth.PasswordHashConfig {
+	return map[string]auth.PasswordHashConfig{
+		"bcrypt":   {Algorithm: auth.PasswordHashBcrypt, BcryptCost: 4},
+		"argon2id": {Algorithm: auth.PasswordHashArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Threads: 1},
+	}
+}
+
+// HashPassword hashes the password like the user service stores it
+func HashPassword(t *testing.T, config auth.PasswordHashConfig, password string) []byte {
+	t.Helper()
+	hasher, err := auth.NewPasswordHasher(config)
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+	return hash
+}
+
+// AssertNoSecrets fails when the JSON response has a password field or holds the hash, raw or base64 encoded
+func AssertNoSecrets(t *testing.T, name string, body []byte, hash []byte) {
+	t.Helper()
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("%s: decoding response %q: %v", name, body, err)
+	}
+	if hasPasswordField(decoded) {
+		t.Errorf("%s: response has a password field: %s", name, body)
+	}
+	for _, secret := range []string{string(hash), base64.StdEncoding.EncodeToString(hash), "$2a$", "$argon2id$"} {
+		if strings.Contains(string(body), secret) {
+			t.Errorf("%s: response holds the password hash: %s", name, body)
+		}
+	}
+}
+
+func hasPasswordField(v interface{}) bool {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if strings.EqualFold(key, "password") || hasPasswordField(field) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if hasPasswordField(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
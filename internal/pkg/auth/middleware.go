@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	bearerScheme        = "Bearer"
+
+	// ClaimsContextKey is the gin context key holding the verified token claims
+	ClaimsContextKey = "authClaims"
+	// PrincipalContextKey is the gin context key holding the stored account of the caller
+	PrincipalContextKey = "authPrincipal"
+	// UserIDParam is the route parameter compared against the token subject
+	UserIDParam = "user_id"
+
+	fileQueryKey = "file"
+)
+
+// Principal is the stored account state of an authenticated caller
+type Principal struct {
+	UserID  string
+	IsAdmin bool
+}
+
+// PrincipalLoader - loads the stored account of an authenticated caller
+type PrincipalLoader interface {
+	LoadPrincipal(ctx context.Context, userID string) (Principal, *models.ErrorResponse)
+}
+
+// APITokenValidator - checks a personal API token and returns the claims it grants
+type APITokenValidator interface {
+	ValidateAPIToken(ctx context.Context, token string) (Claims, *models.ErrorResponse)
+}
+
+// SessionValidator - checks that the session of a verified token has not been revoked
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, claims Claims) *models.ErrorResponse
+}
+
+// Authenticator holds the dependencies of the authentication middleware
+type Authenticator struct {
+	Tokens     TokenManager
+	Principals PrincipalLoader
+	Sessions   SessionValidator
+	APITokens  APITokenValidator
+	// RequireAdminMFA only lets admins use admin routes from sessions started with a second factor
+	RequireAdminMFA bool
+}
+
+// NewAuthenticator creates the authentication middleware
+func NewAuthenticator(
+	tokens TokenManager,
+	principals PrincipalLoader,
+	sessions SessionValidator,
+	apiTokens APITokenValidator,
+	requireAdminMFA bool,
+) *Authenticator {
+	return &Authenticator{
+		Tokens:          tokens,
+		Principals:      principals,
+		Sessions:        sessions,
+		APITokens:       apiTokens,
+		RequireAdminMFA: requireAdminMFA,
+	}
+}
+
+// Authenticate verifies the bearer token of the request and stores its claims in the context.
+// Only session tokens are accepted, routes open to API tokens use AuthenticateScoped.
+func (a *Authenticator) Authenticate(c *gin.Context) {
+	a.authenticate(c, "")
+}
+
+// AuthenticateScoped is Authenticate for routes that also accept API tokens carrying the scope
+func (a *Authenticator) AuthenticateScoped(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.authenticate(c, scope)
+	}
+}
+
+func (a *Authenticator) authenticate(c *gin.Context, scope string) {
+	ctx := c.Request.Context()
+	header := c.GetHeader(authorizationHeader)
+	if header == "" {
+		abortUnauthorized(c, "Missing Authorization header", "Login and send the access token as 'Authorization: Bearer <token>'")
+		return
+	}
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], bearerScheme) || strings.TrimSpace(parts[1]) == "" {
+		abortUnauthorized(c, "Malformed Authorization header", "Send the access token as 'Authorization: Bearer <token>'")
+		return
+	}
+
+	token := strings.TrimSpace(parts[1])
+	if IsAPIToken(token) {
+		a.authenticateAPIToken(c, token, scope)
+		return
+	}
+
+	claims, err := a.Tokens.VerifyToken(ctx, token, TokenTypeAccess)
+	if err == ErrExpiredToken {
+		abortUnauthorized(c, "Access token has expired", "Login again to get a new access token")
+		return
+	}
+	if err != nil {
+		abortUnauthorized(c, fmt.Sprintf("Invalid access token. %s", err.Error()), "Login again to get a new access token")
+		return
+	}
+	if errResp := a.Sessions.ValidateSession(ctx, claims); errResp != nil {
+		errCode := errResp.ErrorStatusCode
+		if errCode == 0 {
+			errCode = http.StatusInternalServerError
+		}
+		if errCode == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", bearerScheme)
+		}
+		c.AbortWithStatusJSON(errCode, errResp)
+		return
+	}
+	c.Set(ClaimsContextKey, claims)
+	c.Next()
+}
+
+func (a *Authenticator) authenticateAPIToken(c *gin.Context, token string, scope string) {
+	if scope == "" {
+		abortForbidden(c, "API tokens can't be used for this route", "Login and use the access token of a session")
+		return
+	}
+	claims, errResp := a.APITokens.ValidateAPIToken(c.Request.Context(), token)
+	if errResp != nil {
+		errCode := errResp.ErrorStatusCode
+		if errCode == 0 {
+			errCode = http.StatusInternalServerError
+		}
+		if errCode == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", bearerScheme)
+		}
+		c.AbortWithStatusJSON(errCode, errResp)
+		return
+	}
+	if !claims.HasScope(scope) {
+		abortForbidden(c, fmt.Sprintf("API token doesn't have the %s scope", scope),
+			fmt.Sprintf("Create an API token with the %s scope", scope))
+		return
+	}
+	c.Set(ClaimsContextKey, claims)
+	c.Next()
+}
+
+// RequireSelf rejects requests whose token subject doesn't match the user_id route parameter
+func (a *Authenticator) RequireSelf(c *gin.Context) {
+	claims, ok := GetClaims(c)
+	if !ok {
+		abortUnauthorized(c, "Request is not authenticated", "Login and send the access token")
+		return
+	}
+	if userID := c.Param(UserIDParam); userID != claims.Subject {
+		abortForbidden(c, fmt.Sprintf("Access token is not valid for user %s", userID), "Use the access token issued for this user")
+		return
+	}
+	c.Next()
+}
+
+// RequireAdmin rejects requests from callers whose stored account is not an admin.
+// The admin flag in the token is not trusted as it may have been revoked after the token was issued.
+func (a *Authenticator) RequireAdmin(c *gin.Context) {
+	ctx := c.Request.Context()
+	claims, ok := GetClaims(c)
+	if !ok {
+		abortUnauthorized(c, "Request is not authenticated", "Login and send the access token")
+		return
+	}
+	if claims.TokenType == TokenTypeAPI {
+		abortForbidden(c, "API tokens can't be used for admin routes", "Login with an admin account")
+		return
+	}
+	principal, errResp := a.Principals.LoadPrincipal(ctx, claims.Subject)
+	if errResp != nil {
+		errCode := errResp.ErrorStatusCode
+		if errCode == 0 || errCode == http.StatusBadRequest {
+			errCode = http.StatusUnauthorized
+		}
+		errRes := models.ErrorResponse{
+			Message:              fmt.Sprintf("Unable to load the caller account. %s", errResp.Message),
+			RecommendationAction: errResp.RecommendationAction,
+			ErrorStatusCode:      errCode,
+		}
+		c.AbortWithStatusJSON(errCode, errRes)
+		return
+	}
+	if !principal.IsAdmin {
+		log.WithFields(log.Fields{
+			"caller": claims.Subject,
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+		}).Warn("non admin user denied access to admin route")
+		abortForbidden(c, "Admin privileges are required", "Login with an admin account")
+		return
+	}
+	if a.RequireAdminMFA && !claims.MFA {
+		log.WithFields(log.Fields{
+			"caller": claims.Subject,
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+		}).Warn("admin without two-factor session denied access to admin route")
+		abortForbidden(c, "Two-factor authentication is required for admin actions",
+			"Enable two-factor authentication on your account and login again with your authenticator code")
+		return
+	}
+	c.Set(PrincipalContextKey, principal)
+	c.Next()
+}
+
+// AuditAdminAction records which admin acted on which user and file once the request completes
+func (a *Authenticator) AuditAdminAction(c *gin.Context) {
+	c.Next()
+
+	claims, _ := GetClaims(c)
+	log.WithFields(log.Fields{
+		"audit":      "admin_action",
+		"admin":      claims.Subject,
+		"targetUser": c.Param(UserIDParam),
+		"files":      c.QueryArray(fileQueryKey),
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+		"status":     c.Writer.Status(),
+	}).Info("admin action")
+}
+
+// GetClaims returns the verified token claims of the request
+func GetClaims(c *gin.Context) (Claims, bool) {
+	v, ok := c.Get(ClaimsContextKey)
+	if !ok {
+		return Claims{}, false
+	}
+	claims, ok := v.(Claims)
+	return claims, ok
+}
+
+// GetPrincipal returns the stored account of the caller, it is only loaded on routes that check it
+func GetPrincipal(c *gin.Context) (Principal, bool) {
+	v, ok := c.Get(PrincipalContextKey)
+	if !ok {
+		return Principal{}, false
+	}
+	principal, ok := v.(Principal)
+	return principal, ok
+}
+
+func abortUnauthorized(c *gin.Context, message string, recommendation string) {
+	c.Header("WWW-Authenticate", bearerScheme)
+	errRes := models.ErrorResponse{
+		Message:              message,
+		RecommendationAction: []string{recommendation},
+		ErrorStatusCode:      http.StatusUnauthorized,
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, errRes)
+}
+
+func abortForbidden(c *gin.Context, message string, recommendation string) {
+	errRes := models.ErrorResponse{
+		Message:              message,
+		RecommendationAction: []string{recommendation},
+		ErrorStatusCode:      http.StatusForbidden,
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, errRes)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	opaqueTokenBytes = 32
+)
+
+// GenerateOpaqueToken returns a random URL safe token and the hash to store in its place
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 hash of a token.
+// Opaque tokens are random and long, so a fast unsalted hash is enough to keep them unusable if the table leaks.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	// PasswordHashBcrypt and PasswordHashArgon2id are the supported password hashing algorithms
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+
+	passwordHashAlgorithm   = "PASSWORD_HASH_ALGORITHM"
+	passwordBcryptCost      = "PASSWORD_BCRYPT_COST"
+	passwordArgon2Memory    = "PASSWORD_ARGON2_MEMORY_KIB"
+	passwordArgon2Time      = "PASSWORD_ARGON2_ITERATIONS"
+	passwordArgon2Threads   = "PASSWORD_ARGON2_PARALLELISM"
+	defaultArgon2MemoryKiB  = 64 * 1024
+	defaultArgon2Iterations = 3
+	defaultArgon2Threads    = 2
+	argon2SaltBytes         = 16
+	argon2KeyBytes          = 32
+	argon2Prefix            = "$argon2id$"
+	// bcrypt ignores the bytes of a password after the first 72
+	bcryptMaxPasswordBytes = 72
+)
+
+// PasswordHashConfig holds the algorithm and parameters new password hashes are made with
+type PasswordHashConfig struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB
+	Argon2Memory     uint32
+	Argon2Iterations uint32
+	Argon2Threads    uint8
+}
+
+// PasswordHasher hashes passwords and checks them against stored hashes.
+// Verify also reports when a matching hash was made with other parameters than the configured ones,
+// so it can be replaced while the plain password is at hand.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (match bool, needsRehash bool)
+	// MaxPasswordBytes is the length in bytes up to which new passwords are hashed in full, 0 for no limit
+	MaxPasswordBytes() int
+}
+
+type passwordHasher struct {
+	config PasswordHashConfig
+}
+
+// NewPasswordHasherFromEnv creates a password hasher configured from the environment, by default bcrypt with cost 10
+func NewPasswordHasherFromEnv() (PasswordHasher, error) {
+	config := PasswordHashConfig{
+		Algorithm: utils.GetEnvOrDefault(passwordHashAlgorithm, PasswordHashBcrypt),
+	}
+	var err error
+	if config.BcryptCost, err = utils.GetIntEnvOrDefault(passwordBcryptCost, bcrypt.DefaultCost); err != nil {
+		return nil, err
+	}
+	memory, err := utils.GetIntEnvOrDefault(passwordArgon2Memory, defaultArgon2MemoryKiB)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := utils.GetIntEnvOrDefault(passwordArgon2Time, defaultArgon2Iterations)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := utils.GetIntEnvOrDefault(passwordArgon2Threads, defaultArgon2Threads)
+	if err != nil {
+		return nil, err
+	}
+	if memory < 0 || iterations < 0 || threads < 0 || threads > 255 {
+		return nil, fmt.Errorf("argon2 parameters are out of range")
+	}
+	config.Argon2Memory = uint32(memory)
+	config.Argon2Iterations = uint32(iterations)
+	config.Argon2Threads = uint8(threads)
+	return NewPasswordHasher(config)
+}
+
+// NewPasswordHasher creates a password hasher making new hashes with the given algorithm and parameters
+func NewPasswordHasher(config PasswordHashConfig) (PasswordHasher, error) {
+	switch config.Algorithm {
+	case PasswordHashBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHashArgon2id:
+		if config.Argon2Memory < 8*uint32(config.Argon2Threads) || config.Argon2Iterations < 1 || config.Argon2Threads < 1 {
+			return nil, fmt.Errorf("argon2 needs at least 1 iteration, 1 thread and 8 KiB of memory per thread")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", config.Algorithm)
+	}
+	return &passwordHasher{config: config}, nil
+}
+
+func (ph *passwordHasher) Hash(password string) ([]byte, error) {
+	if ph.config.Algorithm == PasswordHashArgon2id {
+		return ph.hashArgon2id(password)
+	}
+	if len(password) > bcryptMaxPasswordBytes {
+		return nil, fmt.Errorf("password is longer than the %d bytes bcrypt hashes", bcryptMaxPasswordBytes)
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), ph.config.BcryptCost)
+}
+
+func (ph *passwordHasher) MaxPasswordBytes() int {
+	if ph.config.Algorithm == PasswordHashBcrypt {
+		return bcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+func (ph *passwordHasher) Verify(hash []byte, password string) (bool, bool) {
+	if bytes.HasPrefix(hash, []byte(argon2Prefix)) {
+		params, salt, key, err := decodeArgon2id(string(hash))
+		if err != nil {
+			return false, false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Argon2Iterations, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false
+		}
+		outdated := ph.config.Algorithm != PasswordHashArgon2id ||
+			params.Argon2Memory != ph.config.Argon2Memory ||
+			params.Argon2Iterations != ph.config.Argon2Iterations ||
+			params.Argon2Threads != ph.config.Argon2Threads
+		return true, outdated
+	}
+
+	// accounts without a password, e.g. created by single sign-on, never match
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost(hash)
+	return true, ph.config.Algorithm != PasswordHashBcrypt || err != nil || cost != ph.config.BcryptCost
+}
+
+// hashArgon2id returns the hash in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$salt$key
+func (ph *passwordHasher) hashArgon2id(password string) ([]byte, error) {
+	salt := make([]byte, argon2SaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(password), salt, ph.config.Argon2Iterations, ph.config.Argon2Memory, ph.config.Argon2Threads, argon2KeyBytes)
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+		ph.config.Argon2Memory, ph.config.Argon2Iterations, ph.config.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+func decodeArgon2id(encoded string) (PasswordHashConfig, []byte, []byte, error) {
+	params := PasswordHashConfig{Algorithm: PasswordHashArgon2id}
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Iterations, &params.Argon2Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
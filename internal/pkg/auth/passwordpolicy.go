@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	passwordMinLength        = "PASSWORD_MIN_LENGTH"
+	passwordMaxLength        = "PASSWORD_MAX_LENGTH"
+	passwordCharacterClasses = "PASSWORD_MIN_CHARACTER_CLASSES"
+	passwordBreachedList     = "PASSWORD_BREACHED_LIST_FILE"
+	defaultPasswordMinLength = 8
+	// bcrypt only uses the first 72 bytes of a password, longer ones are only useful with argon2id
+	defaultPasswordMaxLength = 72
+	defaultCharacterClasses  = 3
+	characterClassCount      = 4
+)
+
+// PasswordPolicy holds the rules a new password has to follow
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes limits the UTF-8 length of passwords the hasher can't hash in full, 0 for no limit
+	MaxBytes int
+	// MinCharacterClasses is how many of lower case letters, upper case letters, digits and symbols are needed
+	MinCharacterClasses int
+	// breached holds the lower cased passwords and the SHA-1 hashes of the passwords of the breached list
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicyFromEnv reads the password policy from the environment.
+// The breached password list is a file with one password per line, a line can also hold the upper case
+// SHA-1 hex of a password as in the Have I Been Pwned downloads, optionally followed by ":count".
+func NewPasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{}
+	var err error
+	if policy.MinLength, err = utils.GetIntEnvOrDefault(passwordMinLength, defaultPasswordMinLength); err != nil {
+		return nil, err
+	}
+	if policy.MaxLength, err = utils.GetIntEnvOrDefault(passwordMaxLength, defaultPasswordMaxLength); err != nil {
+		return nil, err
+	}
+	if policy.MinCharacterClasses, err = utils.GetIntEnvOrDefault(passwordCharacterClasses, defaultCharacterClasses); err != nil {
+		return nil, err
+	}
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength {
+		return nil, fmt.Errorf("password length limits %d to %d are invalid", policy.MinLength, policy.MaxLength)
+	}
+	if policy.MinCharacterClasses < 0 || policy.MinCharacterClasses > characterClassCount {
+		return nil, fmt.Errorf("password character classes must be between 0 and %d", characterClassCount)
+	}
+	if path := utils.GetEnvOrDefault(passwordBreachedList, ""); path != "" {
+		if err := policy.LoadBreachedPasswords(path); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// LoadBreachedPasswords reads the list of passwords that are rejected because they are known from breaches
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening breached password list. %s", err.Error())
+	}
+	defer file.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash := breachedHash(line); hash != "" {
+			breached[hash] = struct{}{}
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading breached password list. %s", err.Error())
+	}
+	p.breached = breached
+	return nil
+}
+
+// Validate returns what is wrong with the password, nothing when it follows the policy
+func (p *PasswordPolicy) Validate(password string) []string {
+	var violations []string
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("Use at least %d characters", p.MinLength))
+	}
+	if length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("Use at most %d characters", p.MaxLength))
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, fmt.Sprintf("Use at most %d bytes, letters with accents and other characters beyond ASCII take 2 to 4 bytes", p.MaxBytes))
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, fmt.Sprintf("Use at least %d of lower case letters, upper case letters, digits and symbols", p.MinCharacterClasses))
+	}
+	if p.isBreached(password) {
+		violations = append(violations, "This password is known from a data breach, choose another one")
+	}
+	return violations
+}
+
+func (p *PasswordPolicy) isBreached(password string) bool {
+	if len(p.breached) == 0 {
+		return false
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return true
+	}
+	sum := sha1.Sum([]byte(password))
+	_, ok := p.breached[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok
+}
+
+// breachedHash returns the SHA-1 of a breached list line in the "HASH" or "HASH:count" form
+func breachedHash(line string) string {
+	hash := line
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		hash = line[:i]
+	}
+	if len(hash) != 2*sha1.Size {
+		return ""
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return ""
+	}
+	return strings.ToUpper(hash)
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyLimitsBytesForBcrypt(t *testing.T) {
+	hasher, err := NewPasswordHasher(PasswordHashConfig{Algorithm: PasswordHashBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+	policy := &PasswordPolicy{MinLength: 8, MaxLength: 72, MinCharacterClasses: 1, MaxBytes: hasher.MaxPasswordBytes()}
+
+	// 72 characters of which the accented ones take two bytes each
+	accented := strings.Repeat("é", 10) + strings.Repeat("a", 62)
+	if violations := policy.Validate(accented); len(violations) != 1 || !strings.Contains(violations[0], "72 bytes") {
+		t.Errorf("72 characters in 82 bytes got %v, want the byte limit", violations)
+	}
+	if _, err := hasher.Hash(accented); err == nil {
+		t.Error("bcrypt hashed a password longer than 72 bytes")
+	}
+	if violations := policy.Validate(strings.Repeat("a", 72)); len(violations) != 0 {
+		t.Errorf("72 bytes got %v", violations)
+	}
+
+	argon2id, err := NewPasswordHasher(PasswordHashConfig{Algorithm: PasswordHashArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Threads: 1})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher: %v", err)
+	}
+	policy.MaxBytes = argon2id.MaxPasswordBytes()
+	if violations := policy.Validate(accented); len(violations) != 0 {
+		t.Errorf("argon2id policy got %v", violations)
+	}
+}
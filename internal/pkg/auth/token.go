@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	authTokenSecret        = "AUTH_TOKEN_SECRET"
+	authAccessTokenTTL     = "AUTH_ACCESS_TOKEN_TTL"
+	authRefreshTokenTTL    = "AUTH_REFRESH_TOKEN_TTL"
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	challengeTokenTTL      = 5 * time.Minute
+	minTokenSecretLength   = 32
+
+	tokenIssuer     = "cloud-ums"
+	tokenAlgorithm  = "HS256"
+	tokenHeaderType = "JWT"
+
+	// TokenTypeAccess identifies the short lived tokens used to call the API
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh identifies the long lived tokens used to get new access tokens
+	TokenTypeRefresh = "refresh"
+	// TokenTypeChallenge identifies the tokens handed out between the password and the second login factor
+	TokenTypeChallenge = "2fa"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed or its signature does not match
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned when a token is past its expiry time
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are the claims carried by a signed token
+type Claims struct {
+	Subject   string `json:"sub"`
+	SessionID string `json:"sid"`
+	IsAdmin   bool   `json:"adm,omitempty"`
+	// MFA is set when the session was started with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// Scopes limit what an API token can do, session tokens have none
+	Scopes    []string `json:"scp,omitempty"`
+	TokenType string   `json:"typ"`
+	Issuer    string   `json:"iss"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	// IssuedAtNano is the issue time in nanoseconds, iat only holds whole seconds.
+	// Tokens issued before it was added don't have it.
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// TokenManager - holds the functions used to issue and verify signed tokens
+type TokenManager interface {
+	IssueAccessToken(ctx context.Context, userID string, sessionID string, isAdmin bool, mfa bool) (string, Claims, error)
+	IssueRefreshToken(ctx context.Context, userID string, sessionID string, mfa bool) (string, Claims, error)
+	IssueChallengeToken(ctx context.Context, userID string) (string, Claims, error)
+	VerifyToken(ctx context.Context, token string, tokenType string) (Claims, error)
+	RefreshTokenTTL() time.Duration
+}
+
+type hmacTokenManager struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenManagerFromEnv creates a HMAC-SHA256 token manager configured from the environment
+func NewTokenManagerFromEnv() (TokenManager, error) {
+	secret, set := os.LookupEnv(authTokenSecret)
+	if !set {
+		return nil, fmt.Errorf("token signing secret is not set in ENV %s", authTokenSecret)
+	}
+	accessTTL, err := utils.GetDurationEnvOrDefault(authAccessTokenTTL, defaultAccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := utils.GetDurationEnvOrDefault(authRefreshTokenTTL, defaultRefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return NewHMACTokenManager([]byte(secret), accessTTL, refreshTTL)
+}
+
+// NewHMACTokenManager creates a token manager signing JWTs with HMAC-SHA256
+func NewHMACTokenManager(secret []byte, accessTTL time.Duration, refreshTTL time.Duration) (TokenManager, error) {
+	if len(secret) < minTokenSecretLength {
+		return nil, fmt.Errorf("token signing secret should be at least %d bytes long", minTokenSecretLength)
+	}
+	return &hmacTokenManager{
+		secret:     secret,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}, nil
+}
+
+// IssueAccessToken signs an access token for the given user session
+func (tm *hmacTokenManager) IssueAccessToken(ctx context.Context, userID string, sessionID string, isAdmin bool, mfa bool) (string, Claims, error) {
+	claims := tm.newClaims(userID, sessionID, TokenTypeAccess, tm.accessTTL)
+	claims.IsAdmin = isAdmin
+	claims.MFA = mfa
+	token, err := tm.sign(claims)
+	if err != nil {
+		return "", claims, err
+	}
+	return token, claims, nil
+}
+
+// IssueRefreshToken signs a refresh token for the given user session
+func (tm *hmacTokenManager) IssueRefreshToken(ctx context.Context, userID string, sessionID string, mfa bool) (string, Claims, error) {
+	claims := tm.newClaims(userID, sessionID, TokenTypeRefresh, tm.refreshTTL)
+	claims.MFA = mfa
+	token, err := tm.sign(claims)
+	if err != nil {
+		return "", claims, err
+	}
+	return token, claims, nil
+}
+
+// IssueChallengeToken signs a short lived token proving the password of the user was checked.
+// It can only be exchanged for a session together with a second factor.
+func (tm *hmacTokenManager) IssueChallengeToken(ctx context.Context, userID string) (string, Claims, error) {
+	claims := tm.newClaims(userID, utils.GenerateUUID(), TokenTypeChallenge, challengeTokenTTL)
+	token, err := tm.sign(claims)
+	if err != nil {
+		return "", claims, err
+	}
+	return token, claims, nil
+}
+
+// RefreshTokenTTL returns the lifetime of refresh tokens, which is the longest lifetime of any token
+func (tm *hmacTokenManager) RefreshTokenTTL() time.Duration {
+	return tm.refreshTTL
+}
+
+func (tm *hmacTokenManager) newClaims(userID string, sessionID string, tokenType string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		Subject:      userID,
+		SessionID:    sessionID,
+		TokenType:    tokenType,
+		Issuer:       tokenIssuer,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.Add(ttl).Unix(),
+		IssuedAtNano: now.UnixNano(),
+	}
+}
+
+// VerifyToken checks the signature, expiry and type of the token and returns its claims
+func (tm *hmacTokenManager) VerifyToken(ctx context.Context, token string, tokenType string) (Claims, error) {
+	claims := Claims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+
+	header := tokenHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if header.Algorithm != tokenAlgorithm {
+		return claims, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, tm.signature(parts[0]+"."+parts[1])) {
+		return claims, ErrInvalidToken
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.Issuer != tokenIssuer || claims.TokenType != tokenType || claims.Subject == "" || claims.SessionID == "" {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (tm *hmacTokenManager) sign(claims Claims) (string, error) {
+	header, err := encodeSegment(tokenHeader{Algorithm: tokenAlgorithm, Type: tokenHeaderType})
+	if err != nil {
+		return "", err
+	}
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + payload
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(tm.signature(signingInput)), nil
+}
+
+func (tm *hmacTokenManager) signature(signingInput string) []byte {
+	mac := hmac.New(sha256.New, tm.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPWithRFC6238Vectors(t *testing.T) {
+	// the RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, vector := range vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, vector.code, time.Unix(vector.unix, 0))
+		if !ok {
+			t.Errorf("code %s at %d was rejected", vector.code, vector.unix)
+			continue
+		}
+		if step != vector.unix/totpPeriod {
+			t.Errorf("code %s at %d got step %d, want %d", vector.code, vector.unix, step, vector.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := at.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"previous step", totpCode(key, step-1), true},
+		{"next step", totpCode(key, step+1), true},
+		{"two steps back", totpCode(key, step-2), false},
+		{"two steps ahead", totpCode(key, step+2), false},
+		{"surrounding spaces", " " + totpCode(key, step) + " ", true},
+		{"too short", totpCode(key, step)[:5], false},
+		{"too long", totpCode(key, step) + "0", false},
+	}
+	for _, test := range tests {
+		if _, ok := ValidateTOTP(rfc6238Secret, test.code, at); ok != test.ok {
+			t.Errorf("%s: accepted %v, want %v", test.name, ok, test.ok)
+		}
+	}
+	// secrets are typed in lower case too, an invalid one rejects every code
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), "050471", at); !ok {
+		t.Error("lower case secret was rejected")
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", at); ok {
+		t.Error("invalid secret accepted a code")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("File Explorer", "ada@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatalf("parsing provisioning URI: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/File Explorer:ada@example.com" {
+		t.Errorf("unexpected provisioning URI %s", uri)
+	}
+	if uri.Query().Get("secret") != rfc6238Secret || uri.Query().Get("digits") != "6" || uri.Query().Get("period") != "30" {
+		t.Errorf("unexpected parameters %s", uri.RawQuery)
+	}
+	if strings.Contains(uri.RawQuery, "+") {
+		t.Errorf("spaces encoded as + in %s", uri.RawQuery)
+	}
+}
+
+func TestRecoveryCodesAreHashedAsTyped(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("recovery code %s repeated", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.Replace(code, "-", " ", 1))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("recovery code typed as %q doesn't match its hash", typed)
+		}
+	}
+}
@@ -6,9 +6,12 @@ package awss3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -23,18 +26,69 @@ import (
 )
 
 const (
-	presignTime = 2
+	presignTime  = 2
+	groupFolder  = "groups"
+	exportFolder = "exports"
 )
 
-// IfAWSS3 holds the aws s3 functions
+// IfAWSS3 holds the aws s3 functions. The files of a user are stored in the folder of its user ID,
+// the files of a group in the folder GroupFolder returns and the data exports of a user in the folder ExportFolder returns.
 type IfAWSS3 interface {
 	GenerateS3PresignedURL(ctx context.Context, userID string, filename string) (fileModels.DownloadFileInfo, error)
 	UploadAttachmentTOS3Bucket(ctx context.Context, userID string, filename string, filereader io.Reader) error
+	GetFileFromS3(ctx context.Context, userID string, filename string) (io.ReadCloser, error)
 	DeleteFileInS3(ctx context.Context, quoteID string, filename string) error
-	//DeleteQuoteAttachmentFolderInS3(ctx context.Context, quoteID string, tenantID string) error
+	DeleteUserFolderInS3(ctx context.Context, userID string) (int, error)
 	GetAWSS3Session() (*session.Session, error)
 }
 
+// ErrInvalidFileName is returned for a file name that would address an object outside its folder
+var ErrInvalidFileName = errors.New("file name can't be empty, . or .. and can't contain / or \\")
+
+// ValidateFileName checks that a file name, once unescaped, is a single segment of an object key
+func ValidateFileName(fileName string) error {
+	if fileName == "" || fileName == "." || fileName == ".." || strings.ContainsAny(fileName, `/\`) {
+		return ErrInvalidFileName
+	}
+	return nil
+}
+
+// folderPrefix returns the key prefix of the objects of a folder
+func folderPrefix(folder string) (string, error) {
+	prefix := "/" + folder + "/"
+	// the SDK cleans the request path, so a folder only holds its objects when cleaning keeps it
+	if folder == "" || path.Clean(prefix)+"/" != prefix {
+		return "", fmt.Errorf("invalid folder %q", folder)
+	}
+	return prefix, nil
+}
+
+// objectKey returns the key of a file in a folder, it fails for keys that would leave the folder once cleaned
+func objectKey(folder string, fileName string) (string, error) {
+	if err := ValidateFileName(fileName); err != nil {
+		return "", err
+	}
+	prefix, err := folderPrefix(folder)
+	if err != nil {
+		return "", err
+	}
+	key := prefix + fileName
+	if !strings.HasPrefix(path.Clean(key), prefix) {
+		return "", ErrInvalidFileName
+	}
+	return key, nil
+}
+
+// GroupFolder returns the folder holding the files of a group, it can't clash with a user ID
+func GroupFolder(groupID string) string {
+	return groupFolder + "/" + groupID
+}
+
+// ExportFolder returns the folder holding the data exports of a user
+func ExportFolder(userID string) string {
+	return exportFolder + "/" + userID
+}
+
 // IfAWSS3SvcImpl returns the aws s3 service
 type IfAWSS3SvcImpl interface {
 	GetS3SVC() (*s3.S3, error)
@@ -83,8 +137,10 @@ func (awss3 s3ifimpl) GetS3SVC() (*s3.S3, error) {
 func (awss3 awsS3) GenerateS3PresignedURL(ctx context.Context, quoteID string, fileName string) (fileModels.DownloadFileInfo, error) {
 	downloadAttachInfo := fileModels.DownloadFileInfo{}
 	awsS3BucketName := awss3.awsCreds.GetAwsS3BucketName(ctx)
-	objectURL := "/" + "/" + quoteID + "/"
-	oURL := objectURL + fileName
+	oURL, err := objectKey(quoteID, fileName)
+	if err != nil {
+		return downloadAttachInfo, err
+	}
 	req, _ := awss3.awsS3API.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: aws.String(awsS3BucketName),
 		Key:    aws.String(oURL),
@@ -118,7 +174,10 @@ func (awss3 awsS3) GetAWSS3Session() (*session.Session, error) {
 
 func (awss3 awsS3) UploadAttachmentTOS3Bucket(ctx context.Context, userID string, filename string, filereader io.Reader) error {
 	awsS3BucketName := awss3.awsCreds.GetAwsS3BucketName(ctx)
-	objectURL := "/" + userID + "/" + filename
+	objectURL, err := objectKey(userID, filename)
+	if err != nil {
+		return err
+	}
 	sess, err := awss3.GetAWSS3Session()
 	if err != nil {
 		sessErr := fmt.Sprintf("Error while getting aws s3 session. Error: %s", err.Error())
@@ -139,14 +198,35 @@ func (awss3 awsS3) UploadAttachmentTOS3Bucket(ctx context.Context, userID string
 	return nil
 }
 
+// GetFileFromS3 opens a file for reading, the caller closes it.
+// A missing file is reported with the s3.ErrCodeNoSuchKey code.
+func (awss3 awsS3) GetFileFromS3(ctx context.Context, userID string, filename string) (io.ReadCloser, error) {
+	awsS3BucketName := awss3.awsCreds.GetAwsS3BucketName(ctx)
+	objectURL, err := objectKey(userID, filename)
+	if err != nil {
+		return nil, err
+	}
+	out, err := awss3.awsS3API.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(awsS3BucketName),
+		Key:    aws.String(objectURL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
 func (awss3 awsS3) DeleteFileInS3(ctx context.Context, userID string, filename string) error {
 	awsS3BucketName := awss3.awsCreds.GetAwsS3BucketName(ctx)
-	objectURL := "/" + userID + "/" + filename
+	objectURL, err := objectKey(userID, filename)
+	if err != nil {
+		return err
+	}
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(awsS3BucketName),
 		Key:    aws.String(objectURL),
 	}
-	_, err := awss3.awsS3API.DeleteObject(input)
+	_, err = awss3.awsS3API.DeleteObject(input)
 	if err != nil {
 		delErr := fmt.Sprintf("Error while file %s for user  %s. Error: %s", filename, userID, err.Error())
 		return fmt.Errorf(delErr)
@@ -154,34 +234,52 @@ func (awss3 awsS3) DeleteFileInS3(ctx context.Context, userID string, filename s
 	return nil
 }
 
-func (awss3 awsS3) DeleteQuoteAttachmentFolderInS3(ctx context.Context, quoteID string, tenantID string) error {
+// DeleteUserFolderInS3 deletes every object of the user and returns how many were deleted.
+// The objects are listed and deleted a page of at most 1000 keys at a time.
+func (awss3 awsS3) DeleteUserFolderInS3(ctx context.Context, userID string) (int, error) {
 	awsS3BucketName := awss3.awsCreds.GetAwsS3BucketName(ctx)
-	objectURL := tenantID + "/" + quoteID
-	var s3Objects []*s3.ObjectIdentifier
-	resp, err := awss3.awsS3API.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(awsS3BucketName),
-		Prefix: aws.String(objectURL)})
+	objectURL, err := folderPrefix(userID)
 	if err != nil {
-		delErr := fmt.Sprintf("Error while listing list items from S3 bucket. Error: %s", err.Error())
-		return fmt.Errorf(delErr)
+		return 0, err
 	}
-	if len(resp.Contents) == 0 {
-		delErr := fmt.Errorf("warning: Got empty list of quote attachments from S3 bucket for quote %s", quoteID)
-		return delErr
-	}
-	for _, item := range resp.Contents {
-		s3Objects = append(s3Objects, &s3.ObjectIdentifier{Key: item.Key})
-	}
-	input := &s3.DeleteObjectsInput{
+	deleted := 0
+	listInput := &s3.ListObjectsV2Input{
 		Bucket: aws.String(awsS3BucketName),
-		Delete: &s3.Delete{
-			Objects: s3Objects,
-			Quiet:   aws.Bool(false),
-		},
+		Prefix: aws.String(objectURL),
 	}
-	_, err = awss3.awsS3API.DeleteObjects(input)
-	if err != nil {
-		delErr := fmt.Sprintf("Error while delete quote attachments for quote %s. Error: %s", quoteID, err.Error())
-		return fmt.Errorf(delErr)
+	for {
+		resp, err := awss3.awsS3API.ListObjectsV2(listInput)
+		if err != nil {
+			delErr := fmt.Sprintf("Error while listing list items from S3 bucket. Error: %s", err.Error())
+			return deleted, fmt.Errorf(delErr)
+		}
+		var s3Objects []*s3.ObjectIdentifier
+		for _, item := range resp.Contents {
+			s3Objects = append(s3Objects, &s3.ObjectIdentifier{Key: item.Key})
+		}
+		if len(s3Objects) > 0 {
+			input := &s3.DeleteObjectsInput{
+				Bucket: aws.String(awsS3BucketName),
+				Delete: &s3.Delete{
+					Objects: s3Objects,
+					Quiet:   aws.Bool(true),
+				},
+			}
+			out, err := awss3.awsS3API.DeleteObjects(input)
+			if err != nil {
+				delErr := fmt.Sprintf("Error while deleting files of user %s. Error: %s", userID, err.Error())
+				return deleted, fmt.Errorf(delErr)
+			}
+			// quiet mode only reports the keys that failed
+			deleted += len(s3Objects) - len(out.Errors)
+			if len(out.Errors) > 0 {
+				return deleted, fmt.Errorf("Error while deleting file %s of user %s. Error: %s",
+					aws.StringValue(out.Errors[0].Key), userID, aws.StringValue(out.Errors[0].Message))
+			}
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			return deleted, nil
+		}
+		listInput.ContinuationToken = resp.NextContinuationToken
 	}
-	return nil
 }
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+)
+
+const (
+	// batchWriteLimit is the most requests a BatchWriteItem call takes
+	batchWriteLimit = 25
+	// maxBatchAttempts limits the retries of requests DynamoDB leaves unprocessed, waiting batchBackoff longer every time
+	maxBatchAttempts = 5
+	batchBackoff     = 100 * time.Millisecond
+)
+
+// DeleteUserDataInDynamoDB deletes the items stored under the user, such as its files, two-factor enrollment and API tokens,
+// and returns how many were deleted. The user item is kept, and so are the session revocations, which expire through TTL
+// and keep the tokens of the user rejected until then.
+func (dbImpl userDynamodbImpl) DeleteUserDataInDynamoDB(ctx context.Context, userID string) (int, error) {
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(userID))
+	proj := expression.NamesList(expression.Name(constants.UsersTablePrimaryKey), expression.Name(constants.UsersTableSortKey))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithProjection(proj).Build()
+	if err != nil {
+		return 0, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+	}
+
+	var deletes []*dynamodb.WriteRequest
+	for {
+		result, err := dbImpl.usrSvc.Query(input)
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range result.Items {
+			sortKey := aws.StringValue(item[constants.UsersTableSortKey].S)
+			if sortKey == constants.TypeUsersForSortKey ||
+				strings.HasPrefix(sortKey, constants.TypeRevokedSessionForSortKey+constants.SortKeySeparator) {
+				continue
+			}
+			deletes = append(deletes, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{Key: item},
+			})
+			// the user leaves its groups too
+			membershipPrefix := constants.TypeGroupMembershipForSortKey + constants.SortKeySeparator
+			if strings.HasPrefix(sortKey, membershipPrefix) {
+				deletes = append(deletes, &dynamodb.WriteRequest{
+					DeleteRequest: &dynamodb.DeleteRequest{Key: groupMemberItemKey(strings.TrimPrefix(sortKey, membershipPrefix), userID)},
+				})
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return batchWriteAll(dbImpl.usrSvc, deletes)
+}
+
+// GetDeactivatedUserIDsInDynamoDB returns the IDs of the users deactivated at or before deactivatedBefore, in epoch seconds.
+// Only the keys are read from the index.
+func (dbImpl userDynamodbImpl) GetDeactivatedUserIDsInDynamoDB(ctx context.Context, deactivatedBefore int64) ([]string, error) {
+	keyCond := expression.Key(constants.UsersTableSortKey).Equal(expression.Value(constants.TypeUsersForSortKey))
+	filt := expression.Name("DeactivatedAt").Between(expression.Value(1), expression.Value(deactivatedBefore))
+	proj := expression.NamesList(expression.Name(constants.UsersTablePrimaryKey))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filt).WithProjection(proj).Build()
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(constants.UsersTableName),
+		IndexName:                 aws.String(constants.UsersTableSortKeyIndex),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+	}
+	var userIDs []string
+	for {
+		result, err := dbImpl.usrSvc.Query(input)
+		if err != nil {
+			return userIDs, err
+		}
+		for _, item := range result.Items {
+			userIDs = append(userIDs, aws.StringValue(item[constants.UsersTablePrimaryKey].S))
+		}
+		if result.LastEvaluatedKey == nil {
+			return userIDs, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// batchWriteAll runs the requests in batches and returns how many were written
+func batchWriteAll(svc dynamodbiface.DynamoDBAPI, requests []*dynamodb.WriteRequest) (int, error) {
+	written := 0
+	for start := 0; start < len(requests); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(requests) {
+			end = len(requests)
+		}
+		unprocessed, err := batchWrite(svc, requests[start:end])
+		if err != nil {
+			return written, err
+		}
+		if len(unprocessed) > 0 {
+			return written, fmt.Errorf("%d items were still unprocessed after %d attempts", len(unprocessed), maxBatchAttempts)
+		}
+		written += end - start
+	}
+	return written, nil
+}
+
+// batchWrite runs the requests, retries the ones DynamoDB leaves unprocessed and returns those still unprocessed.
+// On an error the requests of the failed call are returned as unprocessed.
+func batchWrite(svc dynamodbiface.DynamoDBAPI, requests []*dynamodb.WriteRequest) ([]*dynamodb.WriteRequest, error) {
+	pending := requests
+	for attempt := 0; attempt < maxBatchAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * batchBackoff)
+		}
+		result, err := svc.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{constants.UsersTableName: pending},
+		})
+		if err != nil {
+			return pending, err
+		}
+		pending = result.UnprocessedItems[constants.UsersTableName]
+		if len(pending) == 0 {
+			return nil, nil
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrAPITokenNotFound is returned when the user has no API token with the requested ID
+var ErrAPITokenNotFound = errors.New("API token not found")
+
+// APITokensDynamoDBAPI - holds the functions used to persist personal API tokens
+type APITokensDynamoDBAPI interface {
+	CreateAPITokenInDynamoDB(ctx context.Context, token models.APITokenDynamo) error
+	GetAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) (models.APITokenDynamo, error)
+	GetAPITokensInDynamoDB(ctx context.Context, userID string) ([]models.APITokenDynamo, error)
+	DeleteAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) error
+}
+
+type apiTokenDynamodbImpl struct {
+	apiTokenSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewAPITokensDBImpl gives the dynamodb implementation of APITokensDynamoDBAPI
+func NewAPITokensDBImpl(apiTokenSvc dynamodbiface.DynamoDBAPI) APITokensDynamoDBAPI {
+	return &apiTokenDynamodbImpl{
+		apiTokenSvc: apiTokenSvc,
+	}
+}
+
+// APITokenSortKey returns the sort key of an API token item
+func APITokenSortKey(tokenID string) string {
+	return constants.TypeAPITokenForSortKey + constants.SortKeySeparator + tokenID
+}
+
+func apiTokenItemKey(userID string, tokenID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(APITokenSortKey(tokenID)),
+		},
+	}
+}
+
+// CreateAPITokenInDynamoDB stores a new API token item
+func (dbImpl *apiTokenDynamodbImpl) CreateAPITokenInDynamoDB(ctx context.Context, token models.APITokenDynamo) error {
+	av, err := dynamodbattribute.MarshalMap(token)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(constants.UsersTableName),
+		ConditionExpression: aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")"),
+	}
+	_, err = dbImpl.apiTokenSvc.PutItem(input)
+	return err
+}
+
+// GetAPITokenInDynamoDB gets an API token item of the user
+func (dbImpl *apiTokenDynamodbImpl) GetAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) (models.APITokenDynamo, error) {
+	token := models.APITokenDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       apiTokenItemKey(userID, tokenID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.apiTokenSvc.GetItem(input)
+	if err != nil {
+		return token, err
+	}
+	if result.Item == nil {
+		return token, ErrAPITokenNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &token)
+	if err != nil {
+		return token, err
+	}
+	return token, nil
+}
+
+// GetAPITokensInDynamoDB gets every API token item of the user
+func (dbImpl *apiTokenDynamodbImpl) GetAPITokensInDynamoDB(ctx context.Context, userID string) ([]models.APITokenDynamo, error) {
+	tokens := []models.APITokenDynamo{}
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(userID)).
+		And(expression.Key(constants.UsersTableSortKey).BeginsWith(constants.TypeAPITokenForSortKey + constants.SortKeySeparator))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return tokens, err
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	for {
+		result, err := dbImpl.apiTokenSvc.Query(input)
+		if err != nil {
+			return tokens, err
+		}
+		page := []models.APITokenDynamo{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, page...)
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	return tokens, nil
+}
+
+// DeleteAPITokenInDynamoDB removes an API token item of the user
+func (dbImpl *apiTokenDynamodbImpl) DeleteAPITokenInDynamoDB(ctx context.Context, userID string, tokenID string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:                 apiTokenItemKey(userID, tokenID),
+		TableName:           aws.String(constants.UsersTableName),
+		ConditionExpression: aws.String("attribute_exists(" + constants.UsersTablePrimaryKey + ")"),
+	}
+	_, err := dbImpl.apiTokenSvc.DeleteItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrAPITokenNotFound
+	}
+	return err
+}
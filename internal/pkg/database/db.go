@@ -4,17 +4,18 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
 	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
 	dbModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
 	"github.com/pkg/errors"
-	"log"
 	"net/http"
 	"os"
 )
@@ -26,6 +27,18 @@ const (
 	dynamodbEndpoint = "DYNAMODB_ENDPOINT_URL"
 )
 
+// ErrUserNotFound is returned when no user has the requested email address or ID
+var ErrUserNotFound = errors.New("No user found with this email")
+
+// ErrPasswordChanged is returned when the password hash to replace is no longer the stored one
+var ErrPasswordChanged = errors.New("password was changed meanwhile")
+
+// ErrLastActiveAdmin is returned when the rights of the last active admin would be taken away
+var ErrLastActiveAdmin = errors.New("last active admin")
+
+// revokeAdminAttempts is how often taking away admin rights is tried while the other admins keep changing
+const revokeAdminAttempts = 3
+
 type awsCreds struct{}
 
 // AWSServiceSessions - holds the function to get the AWS credentials
@@ -100,9 +113,27 @@ func (awsCreds *awsCreds) GetDynamodbSVC(httpClient *http.Client) (*dynamodb.Dyn
 type UsersDynamoDBAPI interface {
 	CreateUserInDynamoDB(ctx context.Context, input models.UserDynamo, condition string) (models.UserDynamo, error)
 	GetUserInDynamoDB(ctx context.Context, pkey string, skey string) (models.UserDynamo, error)
-	GetUsersInDynamoDB(ctx context.Context, query dbModels.DatabaseQuery) ([]models.UserDynamo, error)
+	GetUsersInDynamoDB(ctx context.Context, query dbModels.DatabaseQuery) ([]models.UserDynamo, string, error)
 	GetUserCredentials(ctx context.Context, userEmail string) (models.CredIsAdmin , error)
 	DeleteUserInDynamoDB(ctx context.Context, pkey string, skey string) error
+	UpdateUserPasswordInDynamoDB(ctx context.Context, userID string, oldHash []byte, newHash []byte) error
+	CreateNewUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error)
+	ReserveEmailInDynamoDB(ctx context.Context, email string, userID string) error
+	GetEmailReservationsInDynamoDB(ctx context.Context, emails []string) (map[string]string, error)
+	BatchCreateUsersInDynamoDB(ctx context.Context, users []models.UserDynamo) ([]models.UserDynamo, error)
+	DeleteUserAndEmailInDynamoDB(ctx context.Context, userID string, email string) error
+	DeleteDeactivatedUserInDynamoDB(ctx context.Context, userID string, email string, deactivatedAt int64) error
+	UpdateUserProfileInDynamoDB(ctx context.Context, user models.UserDynamo, previousEmail string) error
+	DeleteUserDataInDynamoDB(ctx context.Context, userID string) (int, error)
+	SetUserAttributesInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error
+	UpdateUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error)
+	GetUserFilesInDynamoDB(ctx context.Context, userID string) (map[string]fileModels.FileInfo, error)
+	PutUserFileInDynamoDB(ctx context.Context, user models.UserDynamo, fileInfo fileModels.FileInfo, storageQuota int64) error
+	DeleteUserFileInDynamoDB(ctx context.Context, user models.UserDynamo, fileName string) error
+	UpdateUserFileDescriptionsInDynamoDB(ctx context.Context, user models.UserDynamo, fileNames []string, description string) error
+	MigrateUserFilesInDynamoDB(ctx context.Context, userID string) (int, error)
+	RevokeAdminInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error
+	GetDeactivatedUserIDsInDynamoDB(ctx context.Context, deactivatedBefore int64) ([]string, error)
 }
 
 type userDynamodbImpl struct {
@@ -122,7 +153,6 @@ func (dbImpl userDynamodbImpl) CreateUserInDynamoDB(ctx context.Context, userInp
 	if err != nil {
 		return userOutput, err
 	}
-	log.Printf("Item is printed %v", av)
 	var expr *string
 	if condition != "" {
 		expr = aws.String(condition)
@@ -142,68 +172,47 @@ func (dbImpl userDynamodbImpl) CreateUserInDynamoDB(ctx context.Context, userInp
 	return userInput, nil
 }
 
-// GetUserInDynamoDB gets user from db id
+// GetUserInDynamoDB gets user from db id, together with its files
 func (dbImpl userDynamodbImpl) GetUserInDynamoDB(ctx context.Context, pkey string, skey string) (models.UserDynamo, error) {
-	user := models.UserDynamo{}
-	key := map[string]*dynamodb.AttributeValue{
-		constants.UsersTablePrimaryKey: {
-			S: aws.String(pkey),
-		},
-		constants.UsersTableSortKey: {
-			S: aws.String(skey),
-		},
-	}
-	input := &dynamodb.GetItemInput{
-		Key:       key,
-		TableName: aws.String(constants.UsersTableName),
-	}
-	// Make the DynamoDB Query API call
-	result, err := dbImpl.usrSvc.GetItem(input)
-	if err != nil {
-		return user, err
-	}
-
-	err = dynamodbattribute.UnmarshalMap(result.Item, &user)
-	if err != nil {
+	user, err := dbImpl.getUserItem(pkey, skey)
+	if err != nil || user.UserID == "" {
 		return user, err
 	}
-
-	return user, nil
+	err = dbImpl.withUserFiles(ctx, &user)
+	return user, err
 }
 
+// GetUserCredentials finds the user of an email address through its reservation and returns the login fields
 func (dbImpl userDynamodbImpl) GetUserCredentials(ctx context.Context, userEmail string) (models.CredIsAdmin , error) {
 	userCreds := models.CredIsAdmin{}
-	filt := expression.Name("EmailAddress").Equal(expression.Value(userEmail))
-
-	// Get back the title, year, and rating
-	proj := expression.NamesList(expression.Name("EmailAddress"), expression.Name("Password"), expression.Name("IsAdmin"))
-
-	expr, err := expression.NewBuilder().WithFilter(filt).WithProjection(proj).Build()
+	userID, err := dbImpl.getEmailReservation(userEmail)
 	if err != nil {
 		return userCreds, err
 	}
-	input := &dynamodb.ScanInput{
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		FilterExpression:     expr.Filter(),
-		ProjectionExpression: expr.Projection(),
-		TableName:                 aws.String(constants.UsersTableName),
-	}
 
-	// Make the DynamoDB Query API call
-	result, err := dbImpl.usrSvc.Scan(input)
+	proj := expression.NamesList(expression.Name("UserID"), expression.Name("EmailAddress"), expression.Name("Password"), expression.Name("IsAdmin"),
+		expression.Name("EmailVerificationPending"), expression.Name("TwoFactorEnabled"), expression.Name("Disabled"),
+		expression.Name("PasswordResetRequired"), expression.Name("DeactivatedAt"))
+	expr, err := expression.NewBuilder().WithProjection(proj).Build()
 	if err != nil {
 		return userCreds, err
 	}
+	input := &dynamodb.GetItemInput{
+		Key:                      userItemKey(userID),
+		ExpressionAttributeNames: expr.Names(),
+		ProjectionExpression:     expr.Projection(),
+		TableName:                aws.String(constants.UsersTableName),
+	}
 
-	if len(result.Items) == 0 {
-		return userCreds, errors.New("No user found with this email")
+	result, err := dbImpl.usrSvc.GetItem(input)
+	if err != nil {
+		return userCreds, err
 	}
-	if len(result.Items) > 1 {
-		return userCreds, errors.New("More than one items found for the provided userEmail")
+	// a reservation left behind by a deleted user
+	if result.Item == nil {
+		return userCreds, ErrUserNotFound
 	}
-	fmt.Printf("Result %v", result.Items)
-	err = dynamodbattribute.UnmarshalMap(result.Items[0], &userCreds)
+	err = dynamodbattribute.UnmarshalMap(result.Item, &userCreds)
 	if err != nil {
 		return userCreds, err
 	}
@@ -211,7 +220,6 @@ func (dbImpl userDynamodbImpl) GetUserCredentials(ctx context.Context, userEmail
 	return userCreds, nil
 }
 
-
 // DeleteUserInDynamoDB gets user from db id
 func (dbImpl userDynamodbImpl) DeleteUserInDynamoDB(ctx context.Context, pkey string, skey string) error {
 	key := map[string]*dynamodb.AttributeValue{
@@ -234,8 +242,10 @@ func (dbImpl userDynamodbImpl) DeleteUserInDynamoDB(ctx context.Context, pkey st
 	return nil
 }
 
-// GetUsersInDynamoDBUsingQuery gets users from dynamo db
-func (dbImpl *userDynamodbImpl) GetUsersInDynamoDB(ctx context.Context, query dbModels.DatabaseQuery) ([]models.UserDynamo, error) {
+// GetUsersInDynamoDB gets a page of users from dynamo db together with the cursor of the next page.
+// Reading continues until the page is full, as the filter can leave a page of items read empty.
+// The files of the users are only read with query.WithFiles.
+func (dbImpl *userDynamodbImpl) GetUsersInDynamoDB(ctx context.Context, query dbModels.DatabaseQuery) ([]models.UserDynamo, string, error) {
 	listUsers := []models.UserDynamo{}
 
 	if query.Default.Key == "" || query.Default.Value == "" {
@@ -244,33 +254,66 @@ func (dbImpl *userDynamodbImpl) GetUsersInDynamoDB(ctx context.Context, query db
 			Value: constants.TypeUsersForSortKey,
 		}
 	}
-	input, err := buildQueryDynamoDB(ctx, query, constants.UsersTableName)
+	queryInput, scanInput, err := buildQueryDynamoDB(ctx, query, constants.UsersTableName)
 	if err != nil {
-		return listUsers, errors.Wrap(err, "Error building query expression")
+		return listUsers, "", errors.Wrap(err, "Error building query expression")
+	}
+	startKey, err := DecodeCursor(query.Cursor)
+	if err != nil {
+		return listUsers, "", err
 	}
 
 	for {
-		// Make the DynamoDB Query API call
-		result, err := dbImpl.usrSvc.Scan(input)
-		if err != nil {
-			return listUsers, err
+		var limit *int64
+		if query.Limit > 0 {
+			// only what is missing from the page is read, so the next page starts right after the last user
+			limit = aws.Int64(query.Limit - int64(len(listUsers)))
+		}
+		var items []map[string]*dynamodb.AttributeValue
+		var lastKey map[string]*dynamodb.AttributeValue
+		if queryInput != nil {
+			queryInput.Limit, queryInput.ExclusiveStartKey = limit, startKey
+			result, err := dbImpl.usrSvc.Query(queryInput)
+			if err != nil {
+				return listUsers, "", err
+			}
+			items, lastKey = result.Items, result.LastEvaluatedKey
+		} else {
+			scanInput.Limit, scanInput.ExclusiveStartKey = limit, startKey
+			result, err := dbImpl.usrSvc.Scan(scanInput)
+			if err != nil {
+				return listUsers, "", err
+			}
+			items, lastKey = result.Items, result.LastEvaluatedKey
 		}
 		user := []models.UserDynamo{}
-		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &user)
+		err = dynamodbattribute.UnmarshalListOfMaps(items, &user)
 		if err != nil {
-			return listUsers, err
+			return listUsers, "", err
+		}
+		if query.WithFiles {
+			for i := range user {
+				if err := dbImpl.withUserFiles(ctx, &user[i]); err != nil {
+					return listUsers, "", err
+				}
+			}
 		}
 		listUsers = append(listUsers, user...)
-		if result.LastEvaluatedKey == nil {
-			break
+		if lastKey == nil {
+			return listUsers, "", nil
+		}
+		startKey = lastKey
+		if query.Limit > 0 && int64(len(listUsers)) >= query.Limit {
+			nextCursor, err := EncodeCursor(lastKey)
+			return listUsers, nextCursor, err
 		}
-		input.ExclusiveStartKey = result.LastEvaluatedKey
 	}
-
-	return listUsers, nil
 }
 
-func buildQueryDynamoDB(ctx context.Context, query dbModels.DatabaseQuery, tableName string) (*dynamodb.ScanInput, error) {
+// buildQueryDynamoDB builds the request reading the items of the query. It is a Query when the keys are known, from
+// QueryParams or from a default on the primary or sort key, and a Scan of the table otherwise. The other conditions of
+// the query filter the items.
+func buildQueryDynamoDB(ctx context.Context, query dbModels.DatabaseQuery, tableName string) (*dynamodb.QueryInput, *dynamodb.ScanInput, error) {
 	// Query with sort key as "order" by default, if not specified otherwise
 	if query.Default.Key == "" || query.Default.Value == "" {
 		query.Default = dbModels.DefaultQuery{
@@ -279,14 +322,14 @@ func buildQueryDynamoDB(ctx context.Context, query dbModels.DatabaseQuery, table
 		}
 	}
 
-	filter := expression.Name(query.Default.Key).Equal(expression.Value(query.Default.Value))
+	filters := []expression.ConditionBuilder{}
 	// Set the equal filters
 	for key, vals := range query.Equal {
 		var exprVals []expression.OperandBuilder
 		for _, val := range vals {
 			exprVals = append(exprVals, expression.Value(val))
 		}
-		filter = filter.And(expression.Name(key).In(exprVals[0], exprVals[1:]...))
+		filters = append(filters, expression.Name(key).In(exprVals[0], exprVals[1:]...))
 	}
 
 	// set the not equal filters
@@ -295,19 +338,310 @@ func buildQueryDynamoDB(ctx context.Context, query dbModels.DatabaseQuery, table
 		for _, val := range vals {
 			exprVals = append(exprVals, expression.Value(val))
 		}
-		filter = filter.And(expression.Name(key).In(exprVals[0], exprVals[1:]...).Not())
+		filters = append(filters, expression.Name(key).In(exprVals[0], exprVals[1:]...).Not())
+	}
+	for _, condition := range query.Conditions {
+		conditionFilter, err := buildCondition(condition)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, conditionFilter)
 	}
-	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+
+	// QueryParams brings its own key condition
+	if query.QueryParams != nil {
+		params := *query.QueryParams
+		params.TableName = aws.String(tableName)
+		if len(filters) == 0 {
+			return &params, nil, nil
+		}
+		expr, err := expression.NewBuilder().WithFilter(allOf(filters)).Build()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error building expression")
+		}
+		// the placeholders of built expressions are numbered, so they don't clash with those of QueryParams
+		params.FilterExpression = expr.Filter()
+		params.ExpressionAttributeNames = map[string]*string{}
+		params.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{}
+		for _, names := range []map[string]*string{query.QueryParams.ExpressionAttributeNames, expr.Names()} {
+			for placeholder, name := range names {
+				params.ExpressionAttributeNames[placeholder] = name
+			}
+		}
+		for _, values := range []map[string]*dynamodb.AttributeValue{query.QueryParams.ExpressionAttributeValues, expr.Values()} {
+			for placeholder, value := range values {
+				params.ExpressionAttributeValues[placeholder] = value
+			}
+		}
+		return &params, nil, nil
+	}
+
+	var indexName *string
+	switch query.Default.Key {
+	case constants.UsersTableSortKey:
+		indexName = aws.String(constants.UsersTableSortKeyIndex)
+	case constants.UsersTablePrimaryKey:
+	default:
+		// without a key every item of the table is read
+		filters = append([]expression.ConditionBuilder{expression.Name(query.Default.Key).Equal(expression.Value(query.Default.Value))}, filters...)
+		expr, err := expression.NewBuilder().WithFilter(allOf(filters)).Build()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error building expression")
+		}
+		return nil, &dynamodb.ScanInput{
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			FilterExpression:          expr.Filter(),
+			TableName:                 aws.String(tableName),
+		}, nil
+	}
+	builder := expression.NewBuilder().WithKeyCondition(expression.Key(query.Default.Key).Equal(expression.Value(query.Default.Value)))
+	if len(filters) > 0 {
+		builder = builder.WithFilter(allOf(filters))
+	}
+	expr, err := builder.Build()
 	if err != nil {
-		return &dynamodb.ScanInput{}, errors.Wrap(err, "error building expression")
+		return nil, nil, errors.Wrap(err, "error building expression")
 	}
 
-	params := &dynamodb.ScanInput{
+	params := &dynamodb.QueryInput{
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
 		FilterExpression:          expr.Filter(),
+		IndexName:                 indexName,
 		TableName:                 aws.String(tableName),
 	}
 
-	return params, nil
-}
\ No newline at end of file
+	return params, nil, nil
+}
+
+// allOf joins conditions that all have to match
+func allOf(conditions []expression.ConditionBuilder) expression.ConditionBuilder {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return expression.And(conditions[0], conditions[1], conditions[2:]...)
+}
+
+// buildCondition turns a query condition into a filter
+func buildCondition(condition dbModels.QueryCondition) (expression.ConditionBuilder, error) {
+	wantValues := 1
+	if condition.Operator == dbModels.OpBetween {
+		wantValues = 2
+	}
+	if len(condition.Values) != wantValues {
+		return expression.ConditionBuilder{}, errors.Errorf("%s condition on %s takes %d values, got %d",
+			condition.Operator, condition.Key, wantValues, len(condition.Values))
+	}
+	name := expression.Name(condition.Key)
+	value := expression.Value(condition.Values[0])
+	switch condition.Operator {
+	case dbModels.OpEqual:
+		// attributes are left out of items written before they existed, so false and 0 match a missing attribute
+		switch v := condition.Values[0].(type) {
+		case bool:
+			if !v {
+				return name.AttributeNotExists().Or(name.Equal(value)), nil
+			}
+		case int64:
+			if v == 0 {
+				return name.AttributeNotExists().Or(name.Equal(value)), nil
+			}
+		}
+		return name.Equal(value), nil
+	case dbModels.OpNotEqual:
+		return name.NotEqual(value), nil
+	case dbModels.OpBeginsWith:
+		prefix, ok := condition.Values[0].(string)
+		if !ok {
+			return expression.ConditionBuilder{}, errors.Errorf("%s condition on %s takes a string", condition.Operator, condition.Key)
+		}
+		return name.BeginsWith(prefix), nil
+	case dbModels.OpContains:
+		substr, ok := condition.Values[0].(string)
+		if !ok {
+			return expression.ConditionBuilder{}, errors.Errorf("%s condition on %s takes a string", condition.Operator, condition.Key)
+		}
+		return name.Contains(substr), nil
+	case dbModels.OpGreaterThan:
+		return name.GreaterThan(value), nil
+	case dbModels.OpGreaterThanEqual:
+		return name.GreaterThanEqual(value), nil
+	case dbModels.OpLessThan:
+		return name.LessThan(value), nil
+	case dbModels.OpLessThanEqual:
+		return name.LessThanEqual(value), nil
+	case dbModels.OpBetween:
+		return name.Between(value, expression.Value(condition.Values[1])), nil
+	}
+	return expression.ConditionBuilder{}, errors.Errorf("unknown operator %s", condition.Operator)
+}
+
+// UpdateUserPasswordInDynamoDB replaces the password hash of the user, only if it is still the given old hash.
+// A reset required by an admin is done once the password is replaced.
+func (dbImpl userDynamodbImpl) UpdateUserPasswordInDynamoDB(ctx context.Context, userID string, oldHash []byte, newHash []byte) error {
+	update := expression.Set(expression.Name("Password"), expression.Value(newHash)).
+		Set(expression.Name("PasswordResetRequired"), expression.Value(false)).
+		Add(expression.Name(versionAttribute), expression.Value(1))
+	condition := expression.Name("Password").Equal(expression.Value(oldHash))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			constants.UsersTablePrimaryKey: {
+				S: aws.String(userID),
+			},
+			constants.UsersTableSortKey: {
+				S: aws.String(constants.TypeUsersForSortKey),
+			},
+		},
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.usrSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrPasswordChanged
+	}
+	return err
+}
+
+// SetUserAttributesInDynamoDB sets the given attributes of an existing user
+func (dbImpl userDynamodbImpl) SetUserAttributesInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	expr, err := userAttributesExpression(values)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.UpdateItemInput{
+		Key:                       userItemKey(userID),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.usrSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// RevokeAdminInDynamoDB sets attributes of an existing user that take the rights of an active admin away, e.g. disabling
+// or demoting it, as long as another active admin is left. The other admin is checked in the same transaction, so admins
+// taking away each other's rights at once can't leave no active admin; ErrLastActiveAdmin is returned instead.
+func (dbImpl userDynamodbImpl) RevokeAdminInDynamoDB(ctx context.Context, userID string, values map[string]interface{}) error {
+	expr, err := userAttributesExpression(values)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < revokeAdminAttempts; attempt++ {
+		otherAdmins, err := dbImpl.activeAdminIDs(userID)
+		if err != nil {
+			return err
+		}
+		if len(otherAdmins) == 0 {
+			return ErrLastActiveAdmin
+		}
+		check, err := activeAdminCheck(otherAdmins[0])
+		if err != nil {
+			return err
+		}
+		_, err = dbImpl.usrSvc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Update: &dynamodb.Update{
+					Key:                       userItemKey(userID),
+					TableName:                 aws.String(constants.UsersTableName),
+					ExpressionAttributeNames:  expr.Names(),
+					ExpressionAttributeValues: expr.Values(),
+					UpdateExpression:          expr.Update(),
+					ConditionExpression:       expr.Condition(),
+				}},
+				{ConditionCheck: check},
+			},
+		})
+		if failedCondition(err, 0) {
+			return ErrUserNotFound
+		}
+		// the other admin lost its rights or was written meanwhile, the admins are looked up again
+		if _, canceled := err.(*dynamodb.TransactionCanceledException); !canceled {
+			return err
+		}
+	}
+	return ErrUserChanged
+}
+
+// userAttributesExpression returns the update setting the attributes of an existing user
+func userAttributesExpression(values map[string]interface{}) (expression.Expression, error) {
+	update := expression.Add(expression.Name(versionAttribute), expression.Value(1))
+	for name, value := range values {
+		update = update.Set(expression.Name(name), expression.Value(value))
+	}
+	condition := expression.AttributeExists(expression.Name(constants.UsersTablePrimaryKey))
+	return expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+}
+
+// activeAdminCondition matches admins whose accounts are neither disabled nor deactivated
+func activeAdminCondition() expression.ConditionBuilder {
+	return expression.Name("IsAdmin").Equal(expression.Value(true)).
+		And(expression.Name("Disabled").AttributeNotExists().Or(expression.Name("Disabled").Equal(expression.Value(false)))).
+		And(expression.Name("DeactivatedAt").AttributeNotExists().Or(expression.Name("DeactivatedAt").Equal(expression.Value(0))))
+}
+
+// activeAdminCheck returns the check of a transaction that the user is still an active admin
+func activeAdminCheck(userID string) (*dynamodb.ConditionCheck, error) {
+	expr, err := expression.NewBuilder().WithCondition(activeAdminCondition()).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ConditionCheck{
+		Key:                       userItemKey(userID),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+	}, nil
+}
+
+// activeAdminIDs returns the IDs of the active admins other than the given user
+func (dbImpl userDynamodbImpl) activeAdminIDs(exceptUserID string) ([]string, error) {
+	keyCond := expression.Key(constants.UsersTableSortKey).Equal(expression.Value(constants.TypeUsersForSortKey))
+	proj := expression.NamesList(expression.Name(constants.UsersTablePrimaryKey))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(activeAdminCondition()).WithProjection(proj).Build()
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		IndexName:                 aws.String(constants.UsersTableSortKeyIndex),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	var userIDs []string
+	for {
+		result, err := dbImpl.usrSvc.Query(input)
+		if err != nil {
+			return userIDs, err
+		}
+		for _, item := range result.Items {
+			if userID := aws.StringValue(item[constants.UsersTablePrimaryKey].S); userID != exceptUserID {
+				userIDs = append(userIDs, userID)
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			return userIDs, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
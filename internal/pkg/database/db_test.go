@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	dbModels "github.com/ANANTHUPADHYA/cloud/internal/pkg/models"
+)
+
+func TestBuildConditionOperators(t *testing.T) {
+	tests := []struct {
+		condition dbModels.QueryCondition
+		filter    string
+	}{
+		{dbModels.QueryCondition{Key: "EmailAddress", Operator: dbModels.OpEqual, Values: []interface{}{"ada@example.com"}}, "#0 = :0"},
+		{dbModels.QueryCondition{Key: "EmailAddress", Operator: dbModels.OpNotEqual, Values: []interface{}{"ada@example.com"}}, "#0 <> :0"},
+		{dbModels.QueryCondition{Key: "EmailAddress", Operator: dbModels.OpBeginsWith, Values: []interface{}{"ada@"}}, "begins_with (#0, :0)"},
+		{dbModels.QueryCondition{Key: "LastName", Operator: dbModels.OpContains, Values: []interface{}{"love"}}, "contains (#0, :0)"},
+		{dbModels.QueryCondition{Key: "CreatedAt", Operator: dbModels.OpGreaterThan, Values: []interface{}{int64(1)}}, "#0 > :0"},
+		{dbModels.QueryCondition{Key: "CreatedAt", Operator: dbModels.OpGreaterThanEqual, Values: []interface{}{int64(1)}}, "#0 >= :0"},
+		{dbModels.QueryCondition{Key: "CreatedAt", Operator: dbModels.OpLessThan, Values: []interface{}{int64(1)}}, "#0 < :0"},
+		{dbModels.QueryCondition{Key: "CreatedAt", Operator: dbModels.OpLessThanEqual, Values: []interface{}{int64(1)}}, "#0 <= :0"},
+		{dbModels.QueryCondition{Key: "CreatedAt", Operator: dbModels.OpBetween, Values: []interface{}{int64(1), int64(2)}}, "#0 BETWEEN :0 AND :1"},
+		// false and 0 also match items written before the attribute existed
+		{dbModels.QueryCondition{Key: "IsAdmin", Operator: dbModels.OpEqual, Values: []interface{}{false}}, "(attribute_not_exists (#0)) OR (#0 = :0)"},
+		{dbModels.QueryCondition{Key: "DeactivatedAt", Operator: dbModels.OpEqual, Values: []interface{}{int64(0)}}, "(attribute_not_exists (#0)) OR (#0 = :0)"},
+	}
+	for _, test := range tests {
+		condition, err := buildCondition(test.condition)
+		if err != nil {
+			t.Errorf("%s on %s: %v", test.condition.Operator, test.condition.Key, err)
+			continue
+		}
+		expr, err := expression.NewBuilder().WithFilter(condition).Build()
+		if err != nil {
+			t.Errorf("%s on %s: %v", test.condition.Operator, test.condition.Key, err)
+			continue
+		}
+		if filter := aws.StringValue(expr.Filter()); filter != test.filter {
+			t.Errorf("%s on %s got filter %q, want %q", test.condition.Operator, test.condition.Key, filter, test.filter)
+		}
+	}
+}
+
+func TestBuildConditionRejectsInvalidConditions(t *testing.T) {
+	invalid := map[string]dbModels.QueryCondition{
+		"unknown operator":     {Key: "EmailAddress", Operator: "like", Values: []interface{}{"ada"}},
+		"missing value":        {Key: "EmailAddress", Operator: dbModels.OpEqual},
+		"one between value":    {Key: "CreatedAt", Operator: dbModels.OpBetween, Values: []interface{}{int64(1)}},
+		"prefix not string":    {Key: "CreatedAt", Operator: dbModels.OpBeginsWith, Values: []interface{}{int64(1)}},
+		"substring not string": {Key: "CreatedAt", Operator: dbModels.OpContains, Values: []interface{}{true}},
+	}
+	for name, condition := range invalid {
+		if _, err := buildCondition(condition); err == nil {
+			t.Errorf("%s was accepted", name)
+		}
+	}
+}
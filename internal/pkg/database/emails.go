@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrEmailTaken is returned when the email address is reserved by another user
+var ErrEmailTaken = errors.New("email address is already registered")
+
+// NormalizeEmail returns the form of an email address used to compare addresses
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// EmailKey returns the primary key of the item reserving an email address
+func EmailKey(email string) string {
+	return constants.TypeEmailForSortKey + constants.SortKeySeparator + NormalizeEmail(email)
+}
+
+func emailItemKey(email string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(EmailKey(email)),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeEmailForSortKey),
+		},
+	}
+}
+
+func userItemKey(userID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeUsersForSortKey),
+		},
+	}
+}
+
+func emailReservation(email string, userID string) models.EmailReservationDynamo {
+	return models.EmailReservationDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: EmailKey(email),
+			SKey: constants.TypeEmailForSortKey,
+		},
+		UserID:       userID,
+		EmailAddress: email,
+	}
+}
+
+// CreateNewUserInDynamoDB stores a new user together with the reservation of its email address.
+// Nothing is written when the address is taken.
+func (dbImpl userDynamodbImpl) CreateNewUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error) {
+	userItem, err := dynamodbattribute.MarshalMap(user)
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	emailItem, err := dynamodbattribute.MarshalMap(emailReservation(user.EmailAddress, user.UserID))
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	notExists := aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")")
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:                userItem,
+					TableName:           aws.String(constants.UsersTableName),
+					ConditionExpression: notExists,
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:                emailItem,
+					TableName:           aws.String(constants.UsersTableName),
+					ConditionExpression: notExists,
+				},
+			},
+		},
+	}
+	_, err = dbImpl.usrSvc.TransactWriteItems(input)
+	if failedCondition(err, 1) {
+		return models.UserDynamo{}, ErrEmailTaken
+	}
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	return user, nil
+}
+
+// ReserveEmailInDynamoDB reserves the email address of an existing user, e.g. for users created before reservations existed.
+// Reserving the address again for the same user succeeds.
+func (dbImpl userDynamodbImpl) ReserveEmailInDynamoDB(ctx context.Context, email string, userID string) error {
+	av, err := dynamodbattribute.MarshalMap(emailReservation(email, userID))
+	if err != nil {
+		return err
+	}
+	condition := expression.AttributeNotExists(expression.Name(constants.UsersTablePrimaryKey)).
+		Or(expression.Name("UserID").Equal(expression.Value(userID)))
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                      av,
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.usrSvc.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// DeleteUserAndEmailInDynamoDB deletes a user together with the reservation of its email address
+func (dbImpl userDynamodbImpl) DeleteUserAndEmailInDynamoDB(ctx context.Context, userID string, email string) error {
+	return dbImpl.deleteUserAndEmail(userID, email, nil)
+}
+
+// DeleteDeactivatedUserInDynamoDB deletes a user together with the reservation of its email address, only if the user
+// is still deactivated at deactivatedAt. It fails with ErrUserChanged when the account was restored or deactivated again.
+func (dbImpl userDynamodbImpl) DeleteDeactivatedUserInDynamoDB(ctx context.Context, userID string, email string, deactivatedAt int64) error {
+	condition := expression.Name("DeactivatedAt").Equal(expression.Value(deactivatedAt))
+	return dbImpl.deleteUserAndEmail(userID, email, &condition)
+}
+
+// deleteUserAndEmail deletes the user item, if it matches the condition when one is given, and the reservation of the email address
+func (dbImpl userDynamodbImpl) deleteUserAndEmail(userID string, email string, userCondition *expression.ConditionBuilder) error {
+	userDelete := &dynamodb.Delete{
+		Key:       userItemKey(userID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	if userCondition != nil {
+		userExpr, err := expression.NewBuilder().WithCondition(*userCondition).Build()
+		if err != nil {
+			return err
+		}
+		userDelete.ExpressionAttributeNames = userExpr.Names()
+		userDelete.ExpressionAttributeValues = userExpr.Values()
+		userDelete.ConditionExpression = userExpr.Condition()
+	}
+	condition := expression.Name("UserID").Equal(expression.Value(userID))
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: userDelete,
+			},
+			{
+				// a reservation held by another user is left alone
+				Delete: &dynamodb.Delete{
+					Key:                       emailItemKey(email),
+					TableName:                 aws.String(constants.UsersTableName),
+					ExpressionAttributeNames:  expr.Names(),
+					ExpressionAttributeValues: expr.Values(),
+					ConditionExpression:       expr.Condition(),
+				},
+			},
+		},
+	}
+	_, err = dbImpl.usrSvc.TransactWriteItems(input)
+	if failedCondition(err, 0) {
+		return ErrUserChanged
+	}
+	if failedCondition(err, 1) {
+		// the reservation belongs to another user, the user is deleted on its own under the same condition
+		_, err = dbImpl.usrSvc.DeleteItem(&dynamodb.DeleteItemInput{
+			Key:                       userDelete.Key,
+			TableName:                 userDelete.TableName,
+			ExpressionAttributeNames:  userDelete.ExpressionAttributeNames,
+			ExpressionAttributeValues: userDelete.ExpressionAttributeValues,
+			ConditionExpression:       userDelete.ConditionExpression,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrUserChanged
+		}
+	}
+	return err
+}
+
+// UpdateUserProfileInDynamoDB stores the names, email address and verification state of the user.
+// A changed email address moves the reservation in the same transaction, nothing is written when the new address is taken.
+func (dbImpl userDynamodbImpl) UpdateUserProfileInDynamoDB(ctx context.Context, user models.UserDynamo, previousEmail string) error {
+	update := expression.Set(expression.Name("FirstName"), expression.Value(user.FirstName)).
+		Set(expression.Name("LastName"), expression.Value(user.LastName)).
+		Set(expression.Name("EmailAddress"), expression.Value(user.EmailAddress)).
+		Set(expression.Name("EmailVerificationPending"), expression.Value(user.EmailVerificationPending)).
+		Add(expression.Name(versionAttribute), expression.Value(1))
+	condition := expression.AttributeExists(expression.Name(constants.UsersTablePrimaryKey))
+	userExpr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	userUpdate := &dynamodb.Update{
+		Key:                       userItemKey(user.UserID),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  userExpr.Names(),
+		ExpressionAttributeValues: userExpr.Values(),
+		UpdateExpression:          userExpr.Update(),
+		ConditionExpression:       userExpr.Condition(),
+	}
+
+	if NormalizeEmail(previousEmail) == NormalizeEmail(user.EmailAddress) {
+		_, err = dbImpl.usrSvc.UpdateItem(&dynamodb.UpdateItemInput{
+			Key:                       userUpdate.Key,
+			TableName:                 userUpdate.TableName,
+			ExpressionAttributeNames:  userUpdate.ExpressionAttributeNames,
+			ExpressionAttributeValues: userUpdate.ExpressionAttributeValues,
+			UpdateExpression:          userUpdate.UpdateExpression,
+			ConditionExpression:       userUpdate.ConditionExpression,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	emailItem, err := dynamodbattribute.MarshalMap(emailReservation(user.EmailAddress, user.UserID))
+	if err != nil {
+		return err
+	}
+	// users created before reservations existed have no reservation to delete
+	releaseCondition := expression.AttributeNotExists(expression.Name(constants.UsersTablePrimaryKey)).
+		Or(expression.Name("UserID").Equal(expression.Value(user.UserID)))
+	releaseExpr, err := expression.NewBuilder().WithCondition(releaseCondition).Build()
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: userUpdate,
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:                emailItem,
+					TableName:           aws.String(constants.UsersTableName),
+					ConditionExpression: aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")"),
+				},
+			},
+			{
+				Delete: &dynamodb.Delete{
+					Key:                       emailItemKey(previousEmail),
+					TableName:                 aws.String(constants.UsersTableName),
+					ExpressionAttributeNames:  releaseExpr.Names(),
+					ExpressionAttributeValues: releaseExpr.Values(),
+					ConditionExpression:       releaseExpr.Condition(),
+				},
+			},
+		},
+	}
+	_, err = dbImpl.usrSvc.TransactWriteItems(input)
+	switch {
+	case failedCondition(err, 0):
+		return ErrUserNotFound
+	case failedCondition(err, 1):
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// getEmailReservation returns the user ID the email address is reserved for
+func (dbImpl userDynamodbImpl) getEmailReservation(email string) (string, error) {
+	input := &dynamodb.GetItemInput{
+		Key:                  emailItemKey(email),
+		TableName:            aws.String(constants.UsersTableName),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("UserID"),
+	}
+	result, err := dbImpl.usrSvc.GetItem(input)
+	if err != nil {
+		return "", err
+	}
+	if result.Item == nil {
+		return "", ErrUserNotFound
+	}
+	reservation := models.EmailReservationDynamo{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &reservation); err != nil {
+		return "", err
+	}
+	return reservation.UserID, nil
+}
+
+// failedCondition reports whether a transaction was canceled by the condition of the item at the given index
+func failedCondition(err error, index int) bool {
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok || index >= len(canceled.CancellationReasons) {
+		return false
+	}
+	reason := canceled.CancellationReasons[index]
+	return reason != nil && aws.StringValue(reason.Code) == "ConditionalCheckFailed"
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// transactionTable applies transactions to the keys of the items like the table does. Puts are conditioned on the
+// item not existing and updates on it existing, the other methods of the interface are not used.
+type transactionTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]bool
+}
+
+func itemKey(key map[string]*dynamodb.AttributeValue) string {
+	return aws.StringValue(key[constants.UsersTablePrimaryKey].S) + "|" + aws.StringValue(key[constants.UsersTableSortKey].S)
+}
+
+func (tt *transactionTable) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	reasons := make([]*dynamodb.CancellationReason, len(input.TransactItems))
+	canceled := false
+	for i, item := range input.TransactItems {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+		failed := (item.Put != nil && tt.items[itemKey(item.Put.Item)]) || (item.Update != nil && !tt.items[itemKey(item.Update.Key)])
+		if failed {
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			canceled = true
+		}
+	}
+	if canceled {
+		return nil, &dynamodb.TransactionCanceledException{Message_: aws.String("Transaction cancelled"), CancellationReasons: reasons}
+	}
+	for _, item := range input.TransactItems {
+		switch {
+		case item.Put != nil:
+			tt.items[itemKey(item.Put.Item)] = true
+		case item.Delete != nil:
+			delete(tt.items, itemKey(item.Delete.Key))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func newUserWithEmail(userID string, email string) models.UserDynamo {
+	return models.UserDynamo{
+		DynamoKeys: models.DynamoKeys{PKey: userID, SKey: constants.TypeUsersForSortKey},
+		User:       models.User{UserID: userID, Credentials: models.Credentials{EmailAddress: email}},
+	}
+}
+
+func TestEmailAddressIsRegisteredOnce(t *testing.T) {
+	ctx := context.Background()
+	table := &transactionTable{items: map[string]bool{}}
+	users := NewUsersDBImpl(table)
+
+	if _, err := users.CreateNewUserInDynamoDB(ctx, newUserWithEmail("user-1", "ada@example.com")); err != nil {
+		t.Fatalf("CreateNewUserInDynamoDB: %v", err)
+	}
+	if _, err := users.CreateNewUserInDynamoDB(ctx, newUserWithEmail("user-2", " Ada@Example.com")); err != ErrEmailTaken {
+		t.Errorf("second registration got %v, want ErrEmailTaken", err)
+	}
+	if table.items["user-2|"+constants.TypeUsersForSortKey] {
+		t.Error("user with a taken address was stored")
+	}
+
+	// moving another user to the address is refused the same way, and a free address moves the reservation
+	if _, err := users.CreateNewUserInDynamoDB(ctx, newUserWithEmail("user-2", "grace@example.com")); err != nil {
+		t.Fatalf("CreateNewUserInDynamoDB: %v", err)
+	}
+	moved := newUserWithEmail("user-2", "ADA@example.com")
+	if err := users.UpdateUserProfileInDynamoDB(ctx, moved, "grace@example.com"); err != ErrEmailTaken {
+		t.Errorf("changing to a taken address got %v, want ErrEmailTaken", err)
+	}
+	moved.EmailAddress = "hopper@example.com"
+	if err := users.UpdateUserProfileInDynamoDB(ctx, moved, "grace@example.com"); err != nil {
+		t.Fatalf("UpdateUserProfileInDynamoDB: %v", err)
+	}
+	if table.items[EmailKey("grace@example.com")+"|"+constants.TypeEmailForSortKey] || !table.items[EmailKey("hopper@example.com")+"|"+constants.TypeEmailForSortKey] {
+		t.Error("reservation didn't move to the new address")
+	}
+}
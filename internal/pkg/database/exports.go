@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrExportNotFound is returned when the user has no data export with the requested ID
+var ErrExportNotFound = errors.New("export not found")
+
+// ExportsDynamoDBAPI - holds the functions used to track the data exports of users
+type ExportsDynamoDBAPI interface {
+	PutExportInDynamoDB(ctx context.Context, export models.ExportDynamo) error
+	GetExportInDynamoDB(ctx context.Context, userID string, exportID string) (models.ExportDynamo, error)
+	GetExportsInDynamoDB(ctx context.Context, userID string) ([]models.ExportDynamo, error)
+}
+
+type exportDynamodbImpl struct {
+	exportSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewExportsDBImpl gives the dynamodb implementation of ExportsDynamoDBAPI
+func NewExportsDBImpl(exportSvc dynamodbiface.DynamoDBAPI) ExportsDynamoDBAPI {
+	return &exportDynamodbImpl{
+		exportSvc: exportSvc,
+	}
+}
+
+// ExportSortKey returns the sort key of a data export item
+func ExportSortKey(exportID string) string {
+	return constants.TypeExportForSortKey + constants.SortKeySeparator + exportID
+}
+
+func exportItemKey(userID string, exportID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(ExportSortKey(exportID)),
+		},
+	}
+}
+
+// PutExportInDynamoDB stores a data export item, an existing item with the same ID is replaced
+func (dbImpl *exportDynamodbImpl) PutExportInDynamoDB(ctx context.Context, export models.ExportDynamo) error {
+	export.PKey = export.UserID
+	export.SKey = ExportSortKey(export.ExportID)
+	item, err := dynamodbattribute.MarshalMap(export)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err = dbImpl.exportSvc.PutItem(input)
+	return err
+}
+
+// GetExportInDynamoDB gets a data export item of the user
+func (dbImpl *exportDynamodbImpl) GetExportInDynamoDB(ctx context.Context, userID string, exportID string) (models.ExportDynamo, error) {
+	export := models.ExportDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       exportItemKey(userID, exportID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.exportSvc.GetItem(input)
+	if err != nil {
+		return export, err
+	}
+	if result.Item == nil {
+		return export, ErrExportNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &export)
+	return export, err
+}
+
+// GetExportsInDynamoDB gets every data export item of the user that TTL hasn't removed yet
+func (dbImpl *exportDynamodbImpl) GetExportsInDynamoDB(ctx context.Context, userID string) ([]models.ExportDynamo, error) {
+	exports := []models.ExportDynamo{}
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(userID)).
+		And(expression.Key(constants.UsersTableSortKey).BeginsWith(constants.TypeExportForSortKey + constants.SortKeySeparator))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return exports, err
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	for {
+		result, err := dbImpl.exportSvc.Query(input)
+		if err != nil {
+			return exports, err
+		}
+		page := []models.ExportDynamo{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return exports, err
+		}
+		exports = append(exports, page...)
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	return exports, nil
+}
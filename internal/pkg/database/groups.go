@@ -0,0 +1,465 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	groupModels "github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+)
+
+var (
+	// ErrGroupNotFound is returned when there is no group with the requested ID
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupMemberNotFound is returned when the user isn't a member of the group
+	ErrGroupMemberNotFound = errors.New("group member not found")
+	// ErrGroupFileNotFound is returned when the group has no file with the requested name
+	ErrGroupFileNotFound = errors.New("group file not found")
+	// ErrGroupChanged is returned when the members of the group were written since they were read
+	ErrGroupChanged = errors.New("group members were changed meanwhile")
+)
+
+// membersVersionAttribute counts the member writes of a group
+const membersVersionAttribute = "MembersVersion"
+
+// GroupsDynamoDBAPI - holds the functions used to persist groups, their members and the metadata of their files
+type GroupsDynamoDBAPI interface {
+	CreateGroupInDynamoDB(ctx context.Context, group groupModels.GroupDynamo, creator groupModels.GroupMemberDynamo) error
+	GetGroupInDynamoDB(ctx context.Context, groupID string) (groupModels.GroupDynamo, error)
+	DeleteGroupInDynamoDB(ctx context.Context, groupID string) (int, error)
+	GetGroupMemberInDynamoDB(ctx context.Context, groupID string, userID string) (groupModels.GroupMemberDynamo, error)
+	GetGroupMembersInDynamoDB(ctx context.Context, groupID string) ([]groupModels.GroupMemberDynamo, error)
+	GetUserGroupsInDynamoDB(ctx context.Context, userID string) ([]groupModels.GroupMemberDynamo, error)
+	PutGroupMemberInDynamoDB(ctx context.Context, member groupModels.GroupMemberDynamo, membersVersion int64) error
+	DeleteGroupMemberInDynamoDB(ctx context.Context, groupID string, userID string, membersVersion int64) error
+	PutGroupFileInDynamoDB(ctx context.Context, groupID string, fileInfo fileModels.FileInfo) error
+	UpdateGroupFileDescriptionInDynamoDB(ctx context.Context, groupID string, fileName string, description string, updatedAt string) error
+	DeleteGroupFileInDynamoDB(ctx context.Context, groupID string, fileName string) error
+}
+
+type groupDynamodbImpl struct {
+	groupSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewGroupsDBImpl gives the dynamodb implementation of GroupsDynamoDBAPI
+func NewGroupsDBImpl(groupSvc dynamodbiface.DynamoDBAPI) GroupsDynamoDBAPI {
+	return &groupDynamodbImpl{
+		groupSvc: groupSvc,
+	}
+}
+
+// GroupKey returns the primary key of the items of a group
+func GroupKey(groupID string) string {
+	return constants.TypeGroupForSortKey + constants.SortKeySeparator + groupID
+}
+
+// GroupMemberSortKey returns the sort key of the item of a member under its group
+func GroupMemberSortKey(userID string) string {
+	return constants.TypeGroupMemberForSortKey + constants.SortKeySeparator + userID
+}
+
+// GroupMembershipSortKey returns the sort key of the item of a membership under its user
+func GroupMembershipSortKey(groupID string) string {
+	return constants.TypeGroupMembershipForSortKey + constants.SortKeySeparator + groupID
+}
+
+func groupItemKey(groupID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(GroupKey(groupID)),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeGroupForSortKey),
+		},
+	}
+}
+
+func groupMemberItemKey(groupID string, userID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(GroupKey(groupID)),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(GroupMemberSortKey(userID)),
+		},
+	}
+}
+
+func groupMembershipItemKey(groupID string, userID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(GroupMembershipSortKey(groupID)),
+		},
+	}
+}
+
+// memberItems returns the item of the member under its group and the one under its user
+func memberItems(member groupModels.GroupMemberDynamo) (map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+	member.PKey = GroupKey(member.GroupID)
+	member.SKey = GroupMemberSortKey(member.UserID)
+	memberItem, err := dynamodbattribute.MarshalMap(member)
+	if err != nil {
+		return nil, nil, err
+	}
+	member.PKey = member.UserID
+	member.SKey = GroupMembershipSortKey(member.GroupID)
+	membershipItem, err := dynamodbattribute.MarshalMap(member)
+	if err != nil {
+		return nil, nil, err
+	}
+	return memberItem, membershipItem, nil
+}
+
+// CreateGroupInDynamoDB stores a new group together with its first member
+func (dbImpl *groupDynamodbImpl) CreateGroupInDynamoDB(ctx context.Context, group groupModels.GroupDynamo, creator groupModels.GroupMemberDynamo) error {
+	group.PKey = GroupKey(group.GroupID)
+	group.SKey = constants.TypeGroupForSortKey
+	if group.FileInfo == nil {
+		// file metadata is set by path, which needs the map to exist
+		group.FileInfo = map[string]fileModels.FileInfo{}
+	}
+	groupItem, err := dynamodbattribute.MarshalMap(group)
+	if err != nil {
+		return err
+	}
+	memberItem, membershipItem, err := memberItems(creator)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					Item:                groupItem,
+					TableName:           aws.String(constants.UsersTableName),
+					ConditionExpression: aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")"),
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:      memberItem,
+					TableName: aws.String(constants.UsersTableName),
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:      membershipItem,
+					TableName: aws.String(constants.UsersTableName),
+				},
+			},
+		},
+	}
+	_, err = dbImpl.groupSvc.TransactWriteItems(input)
+	return err
+}
+
+// GetGroupInDynamoDB gets the item of a group
+func (dbImpl *groupDynamodbImpl) GetGroupInDynamoDB(ctx context.Context, groupID string) (groupModels.GroupDynamo, error) {
+	group := groupModels.GroupDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       groupItemKey(groupID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.groupSvc.GetItem(input)
+	if err != nil {
+		return group, err
+	}
+	if result.Item == nil {
+		return group, ErrGroupNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &group)
+	return group, err
+}
+
+// DeleteGroupInDynamoDB deletes the group with its members and the memberships of its members,
+// and returns how many items were deleted
+func (dbImpl *groupDynamodbImpl) DeleteGroupInDynamoDB(ctx context.Context, groupID string) (int, error) {
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(GroupKey(groupID)))
+	proj := expression.NamesList(expression.Name(constants.UsersTablePrimaryKey), expression.Name(constants.UsersTableSortKey),
+		expression.Name("UserID"))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithProjection(proj).Build()
+	if err != nil {
+		return 0, err
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+	}
+
+	var deletes []*dynamodb.WriteRequest
+	for {
+		result, err := dbImpl.groupSvc.Query(input)
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range result.Items {
+			if userID := aws.StringValue(item["UserID"].S); item["UserID"] != nil {
+				deletes = append(deletes, &dynamodb.WriteRequest{
+					DeleteRequest: &dynamodb.DeleteRequest{Key: groupMembershipItemKey(groupID, userID)},
+				})
+			}
+			delete(item, "UserID")
+			deletes = append(deletes, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{Key: item},
+			})
+		}
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	if len(deletes) == 0 {
+		return 0, ErrGroupNotFound
+	}
+	return batchWriteAll(dbImpl.groupSvc, deletes)
+}
+
+// GetGroupMemberInDynamoDB gets the member item of the user in the group
+func (dbImpl *groupDynamodbImpl) GetGroupMemberInDynamoDB(ctx context.Context, groupID string, userID string) (groupModels.GroupMemberDynamo, error) {
+	member := groupModels.GroupMemberDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       groupMemberItemKey(groupID, userID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.groupSvc.GetItem(input)
+	if err != nil {
+		return member, err
+	}
+	if result.Item == nil {
+		return member, ErrGroupMemberNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &member)
+	return member, err
+}
+
+// GetGroupMembersInDynamoDB gets every member item of the group
+func (dbImpl *groupDynamodbImpl) GetGroupMembersInDynamoDB(ctx context.Context, groupID string) ([]groupModels.GroupMemberDynamo, error) {
+	return dbImpl.queryMembers(GroupKey(groupID), constants.TypeGroupMemberForSortKey)
+}
+
+// GetUserGroupsInDynamoDB gets the membership items of every group of the user
+func (dbImpl *groupDynamodbImpl) GetUserGroupsInDynamoDB(ctx context.Context, userID string) ([]groupModels.GroupMemberDynamo, error) {
+	return dbImpl.queryMembers(userID, constants.TypeGroupMembershipForSortKey)
+}
+
+func (dbImpl *groupDynamodbImpl) queryMembers(primaryKey string, sortKeyType string) ([]groupModels.GroupMemberDynamo, error) {
+	members := []groupModels.GroupMemberDynamo{}
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(primaryKey)).
+		And(expression.Key(constants.UsersTableSortKey).BeginsWith(sortKeyType + constants.SortKeySeparator))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return members, err
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	for {
+		result, err := dbImpl.groupSvc.Query(input)
+		if err != nil {
+			return members, err
+		}
+		page := []groupModels.GroupMemberDynamo{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, page...)
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	return members, nil
+}
+
+// PutGroupMemberInDynamoDB adds a member to an existing group or replaces its role. The members have to be
+// unchanged since membersVersion was read, so checks made on them still hold.
+func (dbImpl *groupDynamodbImpl) PutGroupMemberInDynamoDB(ctx context.Context, member groupModels.GroupMemberDynamo, membersVersion int64) error {
+	memberItem, membershipItem, err := memberItems(member)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: membersVersionUpdate(member.GroupID, membersVersion),
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:      memberItem,
+					TableName: aws.String(constants.UsersTableName),
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					Item:      membershipItem,
+					TableName: aws.String(constants.UsersTableName),
+				},
+			},
+		},
+	}
+	_, err = dbImpl.groupSvc.TransactWriteItems(input)
+	if failedCondition(err, 0) {
+		return dbImpl.groupChangedOrGone(member.GroupID)
+	}
+	return err
+}
+
+// DeleteGroupMemberInDynamoDB removes the user from the group, like PutGroupMemberInDynamoDB the members have
+// to be unchanged since membersVersion was read
+func (dbImpl *groupDynamodbImpl) DeleteGroupMemberInDynamoDB(ctx context.Context, groupID string, userID string, membersVersion int64) error {
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					Key:                 groupMemberItemKey(groupID, userID),
+					TableName:           aws.String(constants.UsersTableName),
+					ConditionExpression: aws.String("attribute_exists(" + constants.UsersTablePrimaryKey + ")"),
+				},
+			},
+			{
+				Delete: &dynamodb.Delete{
+					Key:       groupMembershipItemKey(groupID, userID),
+					TableName: aws.String(constants.UsersTableName),
+				},
+			},
+			{
+				Update: membersVersionUpdate(groupID, membersVersion),
+			},
+		},
+	}
+	_, err := dbImpl.groupSvc.TransactWriteItems(input)
+	if failedCondition(err, 0) {
+		return ErrGroupMemberNotFound
+	}
+	if failedCondition(err, 2) {
+		return dbImpl.groupChangedOrGone(groupID)
+	}
+	return err
+}
+
+// membersVersionUpdate bumps the members version of the group, groups created before the version count as 0
+func membersVersionUpdate(groupID string, membersVersion int64) *dynamodb.Update {
+	return &dynamodb.Update{
+		Key:              groupItemKey(groupID),
+		TableName:        aws.String(constants.UsersTableName),
+		UpdateExpression: aws.String("SET #version = :next"),
+		ExpressionAttributeNames: map[string]*string{
+			"#pkey":    aws.String(constants.UsersTablePrimaryKey),
+			"#version": aws.String(membersVersionAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version": {N: aws.String(strconv.FormatInt(membersVersion, 10))},
+			":next":    {N: aws.String(strconv.FormatInt(membersVersion+1, 10))},
+		},
+		ConditionExpression: aws.String("attribute_exists(#pkey) AND (#version = :version OR attribute_not_exists(#version))"),
+	}
+}
+
+// groupChangedOrGone tells why a conditional write of the members of a group failed
+func (dbImpl *groupDynamodbImpl) groupChangedOrGone(groupID string) error {
+	result, err := dbImpl.groupSvc.GetItem(&dynamodb.GetItemInput{
+		Key:                  groupItemKey(groupID),
+		TableName:            aws.String(constants.UsersTableName),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String(constants.UsersTablePrimaryKey),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return ErrGroupNotFound
+	}
+	return ErrGroupChanged
+}
+
+// PutGroupFileInDynamoDB stores the metadata of a file of the group, only the entry of the file is written
+func (dbImpl *groupDynamodbImpl) PutGroupFileInDynamoDB(ctx context.Context, groupID string, fileInfo fileModels.FileInfo) error {
+	info, err := dynamodbattribute.Marshal(fileInfo)
+	if err != nil {
+		return err
+	}
+	// file names can hold dots, so the path is written with placeholders instead of expression.Name
+	input := &dynamodb.UpdateItemInput{
+		Key:              groupItemKey(groupID),
+		TableName:        aws.String(constants.UsersTableName),
+		UpdateExpression: aws.String("SET #files.#name = :info"),
+		ExpressionAttributeNames: map[string]*string{
+			"#files": aws.String("FileInfo"),
+			"#name":  aws.String(fileInfo.FileName),
+			"#pkey":  aws.String(constants.UsersTablePrimaryKey),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":info": info,
+		},
+		ConditionExpression: aws.String("attribute_exists(#pkey)"),
+	}
+	_, err = dbImpl.groupSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrGroupNotFound
+	}
+	return err
+}
+
+// UpdateGroupFileDescriptionInDynamoDB sets the description of a file of the group
+func (dbImpl *groupDynamodbImpl) UpdateGroupFileDescriptionInDynamoDB(ctx context.Context, groupID string, fileName string,
+	description string, updatedAt string) error {
+	input := &dynamodb.UpdateItemInput{
+		Key:              groupItemKey(groupID),
+		TableName:        aws.String(constants.UsersTableName),
+		UpdateExpression: aws.String("SET #files.#name.#description = :description, #files.#name.#updated = :updated"),
+		ExpressionAttributeNames: map[string]*string{
+			"#files":       aws.String("FileInfo"),
+			"#name":        aws.String(fileName),
+			"#description": aws.String("description"),
+			"#updated":     aws.String("updated_at"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":description": {S: aws.String(description)},
+			":updated":     {S: aws.String(updatedAt)},
+		},
+		ConditionExpression: aws.String("attribute_exists(#files.#name)"),
+	}
+	_, err := dbImpl.groupSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrGroupFileNotFound
+	}
+	return err
+}
+
+// DeleteGroupFileInDynamoDB removes the metadata of a file of the group
+func (dbImpl *groupDynamodbImpl) DeleteGroupFileInDynamoDB(ctx context.Context, groupID string, fileName string) error {
+	input := &dynamodb.UpdateItemInput{
+		Key:              groupItemKey(groupID),
+		TableName:        aws.String(constants.UsersTableName),
+		UpdateExpression: aws.String("REMOVE #files.#name"),
+		ExpressionAttributeNames: map[string]*string{
+			"#files": aws.String("FileInfo"),
+			"#name":  aws.String(fileName),
+		},
+		ConditionExpression: aws.String("attribute_exists(#files.#name)"),
+	}
+	_, err := dbImpl.groupSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrGroupFileNotFound
+	}
+	return err
+}
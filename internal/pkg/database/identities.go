@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrIdentityNotFound is returned when an identity provider account isn't linked to a user
+var ErrIdentityNotFound = errors.New("identity is not linked to a user")
+
+// IdentitiesDynamoDBAPI - holds the functions used to link identity provider accounts to users
+type IdentitiesDynamoDBAPI interface {
+	CreateIdentityInDynamoDB(ctx context.Context, identity models.IdentityDynamo) error
+	GetIdentityInDynamoDB(ctx context.Context, issuer string, subject string) (models.IdentityDynamo, error)
+	DeleteIdentityInDynamoDB(ctx context.Context, issuer string, subject string) error
+}
+
+type identityDynamodbImpl struct {
+	identitySvc dynamodbiface.DynamoDBAPI
+}
+
+// NewIdentitiesDBImpl gives the dynamodb implementation of IdentitiesDynamoDBAPI
+func NewIdentitiesDBImpl(identitySvc dynamodbiface.DynamoDBAPI) IdentitiesDynamoDBAPI {
+	return &identityDynamodbImpl{
+		identitySvc: identitySvc,
+	}
+}
+
+// IdentityKey returns the primary key of the item linking an identity provider account
+func IdentityKey(issuer string, subject string) string {
+	return "oidc" + constants.SortKeySeparator + issuer + constants.SortKeySeparator + subject
+}
+
+func identityItemKey(issuer string, subject string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(IdentityKey(issuer, subject)),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeOIDCIdentityForSortKey),
+		},
+	}
+}
+
+// CreateIdentityInDynamoDB stores a new identity link, an existing link is never replaced
+func (dbImpl *identityDynamodbImpl) CreateIdentityInDynamoDB(ctx context.Context, identity models.IdentityDynamo) error {
+	av, err := dynamodbattribute.MarshalMap(identity)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(constants.UsersTableName),
+		ConditionExpression: aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")"),
+	}
+	_, err = dbImpl.identitySvc.PutItem(input)
+	return err
+}
+
+// DeleteIdentityInDynamoDB removes the link of an identity provider account
+func (dbImpl *identityDynamodbImpl) DeleteIdentityInDynamoDB(ctx context.Context, issuer string, subject string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       identityItemKey(issuer, subject),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err := dbImpl.identitySvc.DeleteItem(input)
+	return err
+}
+
+// GetIdentityInDynamoDB gets the link of an identity provider account
+func (dbImpl *identityDynamodbImpl) GetIdentityInDynamoDB(ctx context.Context, issuer string, subject string) (models.IdentityDynamo, error) {
+	identity := models.IdentityDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       identityItemKey(issuer, subject),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.identitySvc.GetItem(input)
+	if err != nil {
+		return identity, err
+	}
+	if result.Item == nil {
+		return identity, ErrIdentityNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &identity)
+	if err != nil {
+		return identity, err
+	}
+	return identity, nil
+}
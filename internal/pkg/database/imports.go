@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// batchGetLimit is the most keys a BatchGetItem call takes
+const batchGetLimit = 100
+
+// GetEmailReservationsInDynamoDB returns the user IDs the email addresses are reserved for, keyed by the normalized address.
+// Addresses without a reservation are left out.
+func (dbImpl userDynamodbImpl) GetEmailReservationsInDynamoDB(ctx context.Context, emails []string) (map[string]string, error) {
+	reservations := map[string]string{}
+	seen := map[string]bool{}
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, email := range emails {
+		if seen[NormalizeEmail(email)] {
+			continue
+		}
+		seen[NormalizeEmail(email)] = true
+		keys = append(keys, emailItemKey(email))
+	}
+	for start := 0; start < len(keys); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+		request := map[string]*dynamodb.KeysAndAttributes{
+			constants.UsersTableName: {
+				Keys:                 keys[start:end],
+				ConsistentRead:       aws.Bool(true),
+				ProjectionExpression: aws.String("UserID, EmailAddress"),
+			},
+		}
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt == maxBatchAttempts {
+				return reservations, errors.New("email reservations were left unprocessed, retry later")
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * batchBackoff)
+			}
+			result, err := dbImpl.usrSvc.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return reservations, err
+			}
+			page := []models.EmailReservationDynamo{}
+			if err := dynamodbattribute.UnmarshalListOfMaps(result.Responses[constants.UsersTableName], &page); err != nil {
+				return reservations, err
+			}
+			for _, reservation := range page {
+				reservations[NormalizeEmail(reservation.EmailAddress)] = reservation.UserID
+			}
+			request = result.UnprocessedKeys
+		}
+	}
+	return reservations, nil
+}
+
+// BatchCreateUsersInDynamoDB writes user items 25 at a time and returns the users that couldn't be written.
+// The writes are unconditional, the email addresses of the users have to be reserved beforehand.
+func (dbImpl userDynamodbImpl) BatchCreateUsersInDynamoDB(ctx context.Context, users []models.UserDynamo) ([]models.UserDynamo, error) {
+	unwritten := []models.UserDynamo{}
+	var firstErr error
+	for start := 0; start < len(users); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(users) {
+			end = len(users)
+		}
+		batch := users[start:end]
+		writes, err := putUserRequests(batch)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			unwritten = append(unwritten, batch...)
+			continue
+		}
+		unprocessed, err := batchWrite(dbImpl.usrSvc, writes)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		unwritten = append(unwritten, unprocessedUsers(unprocessed, batch)...)
+	}
+	return unwritten, firstErr
+}
+
+func putUserRequests(users []models.UserDynamo) ([]*dynamodb.WriteRequest, error) {
+	writes := make([]*dynamodb.WriteRequest, 0, len(users))
+	for _, user := range users {
+		item, err := dynamodbattribute.MarshalMap(user)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+	}
+	return writes, nil
+}
+
+// unprocessedUsers returns the users of the batch whose writes are unprocessed
+func unprocessedUsers(writes []*dynamodb.WriteRequest, batch []models.UserDynamo) []models.UserDynamo {
+	byID := map[string]models.UserDynamo{}
+	for _, user := range batch {
+		byID[user.UserID] = user
+	}
+	users := []models.UserDynamo{}
+	for _, write := range writes {
+		if id := write.PutRequest.Item["UserID"]; id != nil {
+			users = append(users, byID[aws.StringValue(id.S)])
+		}
+	}
+	return users
+}
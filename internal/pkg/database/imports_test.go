@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// throttledTable leaves the write of one user unprocessed every time and the first write of another once,
+// the other methods of the interface are not used
+type throttledTable struct {
+	dynamodbiface.DynamoDBAPI
+	stuckUserID   string
+	delayedUserID string
+	written       map[string]bool
+	calls         int
+}
+
+func (tt *throttledTable) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	tt.calls++
+	requests := input.RequestItems[constants.UsersTableName]
+	if len(requests) > batchWriteLimit {
+		return nil, fmt.Errorf("%d requests in one call", len(requests))
+	}
+	unprocessed := []*dynamodb.WriteRequest{}
+	for _, request := range requests {
+		userID := aws.StringValue(request.PutRequest.Item["UserID"].S)
+		if userID == tt.stuckUserID || (userID == tt.delayedUserID && !tt.written[userID+" seen"]) {
+			tt.written[userID+" seen"] = true
+			unprocessed = append(unprocessed, request)
+			continue
+		}
+		tt.written[userID] = true
+	}
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{}}
+	if len(unprocessed) > 0 {
+		output.UnprocessedItems[constants.UsersTableName] = unprocessed
+	}
+	return output, nil
+}
+
+func TestBatchCreateUsersReturnsUnwrittenUsers(t *testing.T) {
+	table := &throttledTable{stuckUserID: "user-7", delayedUserID: "user-30", written: map[string]bool{}}
+	users := []models.UserDynamo{}
+	for i := 1; i <= 30; i++ {
+		users = append(users, newUserWithEmail(fmt.Sprintf("user-%d", i), fmt.Sprintf("user-%d@example.com", i)))
+	}
+
+	unwritten, err := NewUsersDBImpl(table).BatchCreateUsersInDynamoDB(context.Background(), users)
+	if err != nil {
+		t.Fatalf("BatchCreateUsersInDynamoDB: %v", err)
+	}
+	if len(unwritten) != 1 || unwritten[0].UserID != "user-7" || unwritten[0].EmailAddress != "user-7@example.com" {
+		t.Errorf("got unwritten users %+v, want user-7", unwritten)
+	}
+	if !table.written["user-30"] || !table.written["user-1"] {
+		t.Error("users left unprocessed once weren't written")
+	}
+	// the stuck user is sent maxBatchAttempts times, the delayed one twice
+	if table.calls != maxBatchAttempts+2 {
+		t.Errorf("made %d calls, want %d", table.calls, maxBatchAttempts+2)
+	}
+}
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/pkg/errors"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// LoginAttemptsDynamoDBAPI - holds the functions used to persist failed login tracking
+type LoginAttemptsDynamoDBAPI interface {
+	GetLoginAttemptsInDynamoDB(ctx context.Context, pkeys []string) ([]models.LoginAttemptsDynamo, error)
+	IncrementFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) (models.LoginAttemptsDynamo, error)
+	ResetFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) error
+	SetLoginThrottleInDynamoDB(ctx context.Context, pkey string, failedAttempts int, nextAttemptAt int64, lockedUntil int64) error
+	DeleteLoginAttemptsInDynamoDB(ctx context.Context, pkey string) error
+	GetThrottledLoginAttemptsInDynamoDB(ctx context.Context, now int64) ([]models.LoginAttemptsDynamo, error)
+}
+
+var (
+	// ErrLoginAttemptsExpired is returned when there are no failures left in the window to count a failure to
+	ErrLoginAttemptsExpired = errors.New("failed login attempts expired")
+	// ErrLoginAttemptsChanged is returned when another failure was recorded since the attempts were read
+	ErrLoginAttemptsChanged = errors.New("failed login attempts changed")
+)
+
+type loginAttemptsDynamodbImpl struct {
+	attemptsSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewLoginAttemptsDBImpl gives the dynamodb implementation of LoginAttemptsDynamoDBAPI
+func NewLoginAttemptsDBImpl(attemptsSvc dynamodbiface.DynamoDBAPI) LoginAttemptsDynamoDBAPI {
+	return &loginAttemptsDynamodbImpl{
+		attemptsSvc: attemptsSvc,
+	}
+}
+
+// LoginAttemptsKey returns the primary key of the login attempts item of an email address or IP.
+// Email addresses are normalized like logins resolve them, so every spelling of an address shares its failures.
+func LoginAttemptsKey(subjectType string, subject string) string {
+	if subjectType == constants.LoginSubjectAccount {
+		return subjectType + constants.SortKeySeparator + NormalizeEmail(subject)
+	}
+	return subjectType + constants.SortKeySeparator + strings.ToLower(subject)
+}
+
+func loginAttemptsItemKey(pkey string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(pkey),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeLoginAttemptsForSortKey),
+		},
+	}
+}
+
+// GetLoginAttemptsInDynamoDB gets the login attempts items of the given keys, missing items are skipped
+func (dbImpl *loginAttemptsDynamodbImpl) GetLoginAttemptsInDynamoDB(ctx context.Context, pkeys []string) ([]models.LoginAttemptsDynamo, error) {
+	attempts := []models.LoginAttemptsDynamo{}
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, pkey := range pkeys {
+		keys = append(keys, loginAttemptsItemKey(pkey))
+	}
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			constants.UsersTableName: {
+				Keys:           keys,
+				ConsistentRead: aws.Bool(true),
+			},
+		},
+	}
+	result, err := dbImpl.attemptsSvc.BatchGetItem(input)
+	if err != nil {
+		return attempts, err
+	}
+	if len(result.UnprocessedKeys) > 0 {
+		return attempts, fmt.Errorf("login attempts were not fully read")
+	}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Responses[constants.UsersTableName], &attempts)
+	if err != nil {
+		return attempts, err
+	}
+	return attempts, nil
+}
+
+// IncrementFailedLoginInDynamoDB atomically adds a failure to the login attempts item and returns the updated item.
+// It returns ErrLoginAttemptsExpired when the item is missing, its last failure is before windowStart or its lock ran out.
+func (dbImpl *loginAttemptsDynamodbImpl) IncrementFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) (models.LoginAttemptsDynamo, error) {
+	updated := models.LoginAttemptsDynamo{}
+	update := expression.Add(expression.Name("FailedAttempts"), expression.Value(1)).
+		Set(expression.Name("LastFailureAt"), expression.Value(attempts.LastFailureAt)).
+		Set(expression.Name(constants.UsersTableTTLAttribute), expression.Value(attempts.ExpiresAt))
+	counting := expression.And(
+		expression.AttributeExists(expression.Name(constants.UsersTablePrimaryKey)),
+		expression.Name("LastFailureAt").GreaterThanEqual(expression.Value(windowStart)),
+		expression.Or(
+			expression.Name("LockedUntil").Equal(expression.Value(0)),
+			expression.Name("LockedUntil").GreaterThan(expression.Value(attempts.LastFailureAt)),
+		),
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(counting).Build()
+	if err != nil {
+		return updated, errors.Wrap(err, "error building update expression")
+	}
+	input := &dynamodb.UpdateItemInput{
+		Key:                       loginAttemptsItemKey(attempts.PKey),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	result, err := dbImpl.attemptsSvc.UpdateItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return updated, ErrLoginAttemptsExpired
+		}
+		return updated, err
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &updated)
+	if err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
+
+// ResetFailedLoginInDynamoDB starts counting the failures again with the given item, if the stored item is missing,
+// its last failure is before windowStart or its lock ran out. It returns ErrLoginAttemptsChanged when another
+// failure was counted to the stored item first.
+func (dbImpl *loginAttemptsDynamodbImpl) ResetFailedLoginInDynamoDB(ctx context.Context, attempts models.LoginAttemptsDynamo, windowStart int64) error {
+	av, err := dynamodbattribute.MarshalMap(attempts)
+	if err != nil {
+		return err
+	}
+	expired := expression.Or(
+		expression.AttributeNotExists(expression.Name(constants.UsersTablePrimaryKey)),
+		expression.Name("LastFailureAt").LessThan(expression.Value(windowStart)),
+		expression.And(
+			expression.Name("LockedUntil").NotEqual(expression.Value(0)),
+			expression.Name("LockedUntil").LessThanEqual(expression.Value(attempts.LastFailureAt)),
+		),
+	)
+	expr, err := expression.NewBuilder().WithCondition(expired).Build()
+	if err != nil {
+		return errors.Wrap(err, "error building condition expression")
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                      av,
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.attemptsSvc.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrLoginAttemptsChanged
+	}
+	return err
+}
+
+// SetLoginThrottleInDynamoDB sets the delay and lock of the login attempts item while it holds failedAttempts failures.
+// It returns ErrLoginAttemptsChanged once a later failure was counted, which sets a throttle of its own.
+func (dbImpl *loginAttemptsDynamodbImpl) SetLoginThrottleInDynamoDB(ctx context.Context, pkey string, failedAttempts int, nextAttemptAt int64, lockedUntil int64) error {
+	update := expression.Set(expression.Name("NextAttemptAt"), expression.Value(nextAttemptAt)).
+		Set(expression.Name("LockedUntil"), expression.Value(lockedUntil))
+	unchanged := expression.Name("FailedAttempts").Equal(expression.Value(failedAttempts))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(unchanged).Build()
+	if err != nil {
+		return errors.Wrap(err, "error building update expression")
+	}
+	input := &dynamodb.UpdateItemInput{
+		Key:                       loginAttemptsItemKey(pkey),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.attemptsSvc.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrLoginAttemptsChanged
+	}
+	return err
+}
+
+// DeleteLoginAttemptsInDynamoDB removes the login attempts item, clearing any delay or lock
+func (dbImpl *loginAttemptsDynamodbImpl) DeleteLoginAttemptsInDynamoDB(ctx context.Context, pkey string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       loginAttemptsItemKey(pkey),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err := dbImpl.attemptsSvc.DeleteItem(input)
+	return err
+}
+
+// GetThrottledLoginAttemptsInDynamoDB gets the login attempts items that are delayed or locked at the given time
+func (dbImpl *loginAttemptsDynamodbImpl) GetThrottledLoginAttemptsInDynamoDB(ctx context.Context, now int64) ([]models.LoginAttemptsDynamo, error) {
+	throttled := []models.LoginAttemptsDynamo{}
+	keyCond := expression.Key(constants.UsersTableSortKey).Equal(expression.Value(constants.TypeLoginAttemptsForSortKey))
+	filter := expression.Or(
+		expression.Name("NextAttemptAt").GreaterThan(expression.Value(now)),
+		expression.Name("LockedUntil").GreaterThan(expression.Value(now)),
+	)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filter).Build()
+	if err != nil {
+		return throttled, errors.Wrap(err, "error building filter expression")
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		IndexName:                 aws.String(constants.UsersTableSortKeyIndex),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	for {
+		result, err := dbImpl.attemptsSvc.Query(input)
+		if err != nil {
+			return throttled, err
+		}
+		attempts := []models.LoginAttemptsDynamo{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &attempts)
+		if err != nil {
+			return throttled, err
+		}
+		throttled = append(throttled, attempts...)
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	return throttled, nil
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+)
+
+func TestLoginAttemptsKeySharesSpellingsOfAnAddress(t *testing.T) {
+	want := LoginAttemptsKey(constants.LoginSubjectAccount, "victim@example.com")
+	for _, spelling := range []string{"Victim@Example.com", " victim@example.com", "victim@example.com \t"} {
+		if got := LoginAttemptsKey(constants.LoginSubjectAccount, spelling); got != want {
+			t.Errorf("%q got key %s, want %s", spelling, got, want)
+		}
+	}
+	if LoginAttemptsKey(constants.LoginSubjectIP, "victim@example.com") == want {
+		t.Error("IP and account attempts share a key")
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't returned by a listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// maxCursorAttributes bounds the key attributes a cursor can carry, a table key and an index key
+const maxCursorAttributes = 4
+
+// EncodeCursor turns the LastEvaluatedKey of a page into the opaque cursor of the next page.
+// An empty cursor means there is no next page.
+func EncodeCursor(key map[string]*dynamodb.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	values := make(map[string]string, len(key))
+	for name, value := range key {
+		if value == nil || value.S == nil {
+			return "", errors.Errorf("key attribute %s isn't a string", name)
+		}
+		values[name] = aws.StringValue(value.S)
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor turns a cursor back into the ExclusiveStartKey of the next page
+func DecodeCursor(cursor string) (map[string]*dynamodb.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil || len(values) == 0 || len(values) > maxCursorAttributes {
+		return nil, ErrInvalidCursor
+	}
+	key := make(map[string]*dynamodb.AttributeValue, len(values))
+	for name, value := range values {
+		key[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+	return key, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// SessionsDynamoDBAPI - holds the functions used to persist session revocations
+type SessionsDynamoDBAPI interface {
+	RevokeSessionInDynamoDB(ctx context.Context, revoked models.RevokedSessionDynamo) error
+	GetSessionRevocationsInDynamoDB(ctx context.Context, userID string, sessionID string) ([]models.RevokedSessionDynamo, error)
+}
+
+type sessionDynamodbImpl struct {
+	sessionSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewSessionsDBImpl gives the dynamodb implementation of SessionsDynamoDBAPI
+func NewSessionsDBImpl(sessionSvc dynamodbiface.DynamoDBAPI) SessionsDynamoDBAPI {
+	return &sessionDynamodbImpl{
+		sessionSvc: sessionSvc,
+	}
+}
+
+// RevokedSessionSortKey returns the sort key of the revocation item of a session
+func RevokedSessionSortKey(sessionID string) string {
+	return constants.TypeRevokedSessionForSortKey + constants.SortKeySeparator + sessionID
+}
+
+// RevokeSessionInDynamoDB stores the revocation item of a session
+func (dbImpl *sessionDynamodbImpl) RevokeSessionInDynamoDB(ctx context.Context, revoked models.RevokedSessionDynamo) error {
+	revoked.PKey = revoked.UserID
+	revoked.SKey = RevokedSessionSortKey(revoked.SessionID)
+	av, err := dynamodbattribute.MarshalMap(revoked)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err = dbImpl.sessionSvc.PutItem(input)
+	return err
+}
+
+// GetSessionRevocationsInDynamoDB gets the revocation items of the session and of all sessions of the user
+func (dbImpl *sessionDynamodbImpl) GetSessionRevocationsInDynamoDB(ctx context.Context, userID string, sessionID string) ([]models.RevokedSessionDynamo, error) {
+	revocations := []models.RevokedSessionDynamo{}
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, id := range []string{sessionID, constants.AllSessionsID} {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{
+			constants.UsersTablePrimaryKey: {
+				S: aws.String(userID),
+			},
+			constants.UsersTableSortKey: {
+				S: aws.String(RevokedSessionSortKey(id)),
+			},
+		})
+	}
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			constants.UsersTableName: {
+				Keys:           keys,
+				ConsistentRead: aws.Bool(true),
+			},
+		},
+	}
+	result, err := dbImpl.sessionSvc.BatchGetItem(input)
+	if err != nil {
+		return revocations, err
+	}
+	// fail closed, a session can't be trusted if its revocation items were not read
+	if len(result.UnprocessedKeys) > 0 {
+		return revocations, fmt.Errorf("session revocations of user %s were not fully read", userID)
+	}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Responses[constants.UsersTableName], &revocations)
+	if err != nil {
+		return revocations, err
+	}
+	return revocations, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrStorageLimitsNotFound is returned while no admin has set the default storage limits
+var ErrStorageLimitsNotFound = errors.New("storage limits not found")
+
+// SettingsDynamoDBAPI - holds the functions used to persist the settings admins change at runtime
+type SettingsDynamoDBAPI interface {
+	GetStorageLimitsInDynamoDB(ctx context.Context) (models.StorageLimitsDynamo, error)
+	PutStorageLimitsInDynamoDB(ctx context.Context, limits models.StorageLimitsDynamo) error
+}
+
+type settingsDynamodbImpl struct {
+	settingsSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewSettingsDBImpl gives the dynamodb implementation of SettingsDynamoDBAPI
+func NewSettingsDBImpl(settingsSvc dynamodbiface.DynamoDBAPI) SettingsDynamoDBAPI {
+	return &settingsDynamodbImpl{
+		settingsSvc: settingsSvc,
+	}
+}
+
+func storageLimitsItemKey() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(constants.SettingsPrimaryKey),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeStorageLimitsForSortKey),
+		},
+	}
+}
+
+// GetStorageLimitsInDynamoDB gets the default storage limits
+func (dbImpl *settingsDynamodbImpl) GetStorageLimitsInDynamoDB(ctx context.Context) (models.StorageLimitsDynamo, error) {
+	limits := models.StorageLimitsDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:       storageLimitsItemKey(),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	result, err := dbImpl.settingsSvc.GetItem(input)
+	if err != nil {
+		return limits, err
+	}
+	if result.Item == nil {
+		return limits, ErrStorageLimitsNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &limits)
+	return limits, err
+}
+
+// PutStorageLimitsInDynamoDB stores the default storage limits
+func (dbImpl *settingsDynamodbImpl) PutStorageLimitsInDynamoDB(ctx context.Context, limits models.StorageLimitsDynamo) error {
+	limits.PKey = constants.SettingsPrimaryKey
+	limits.SKey = constants.TypeStorageLimitsForSortKey
+	item, err := dynamodbattribute.MarshalMap(limits)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err = dbImpl.settingsSvc.PutItem(input)
+	return err
+}
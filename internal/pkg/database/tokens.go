@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+// ErrTokenNotFound is returned when a one time token doesn't exist or was already used
+var ErrTokenNotFound = errors.New("token not found")
+
+// OneTimeTokensDynamoDBAPI - holds the functions used to persist single use tokens
+type OneTimeTokensDynamoDBAPI interface {
+	CreateOneTimeTokenInDynamoDB(ctx context.Context, token models.OneTimeTokenDynamo) error
+	ConsumeOneTimeTokenInDynamoDB(ctx context.Context, tokenHash string, tokenType string) (models.OneTimeTokenDynamo, error)
+}
+
+type oneTimeTokenDynamodbImpl struct {
+	tokenSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewOneTimeTokensDBImpl gives the dynamodb implementation of OneTimeTokensDynamoDBAPI
+func NewOneTimeTokensDBImpl(tokenSvc dynamodbiface.DynamoDBAPI) OneTimeTokensDynamoDBAPI {
+	return &oneTimeTokenDynamodbImpl{
+		tokenSvc: tokenSvc,
+	}
+}
+
+// CreateOneTimeTokenInDynamoDB stores a token item keyed by its hash and type
+func (dbImpl *oneTimeTokenDynamodbImpl) CreateOneTimeTokenInDynamoDB(ctx context.Context, token models.OneTimeTokenDynamo) error {
+	av, err := dynamodbattribute.MarshalMap(token)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(constants.UsersTableName),
+		ConditionExpression: aws.String("attribute_not_exists(" + constants.UsersTablePrimaryKey + ")"),
+	}
+	_, err = dbImpl.tokenSvc.PutItem(input)
+	return err
+}
+
+// ConsumeOneTimeTokenInDynamoDB deletes the token item and returns it.
+// The delete is conditional so two concurrent requests can't both use the same token.
+func (dbImpl *oneTimeTokenDynamodbImpl) ConsumeOneTimeTokenInDynamoDB(ctx context.Context, tokenHash string, tokenType string) (models.OneTimeTokenDynamo, error) {
+	token := models.OneTimeTokenDynamo{}
+	input := &dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			constants.UsersTablePrimaryKey: {
+				S: aws.String(tokenHash),
+			},
+			constants.UsersTableSortKey: {
+				S: aws.String(tokenType),
+			},
+		},
+		TableName:           aws.String(constants.UsersTableName),
+		ConditionExpression: aws.String("attribute_exists(" + constants.UsersTablePrimaryKey + ")"),
+		ReturnValues:        aws.String(dynamodb.ReturnValueAllOld),
+	}
+	result, err := dbImpl.tokenSvc.DeleteItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return token, ErrTokenNotFound
+		}
+		return token, err
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &token)
+	if err != nil {
+		return token, err
+	}
+	return token, nil
+}
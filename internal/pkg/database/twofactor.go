@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+var (
+	// ErrTwoFactorNotFound is returned when the user has no TOTP enrollment
+	ErrTwoFactorNotFound = errors.New("two-factor authentication is not set up")
+	// ErrTwoFactorConflict is returned when the enrollment changed since it was read,
+	// e.g. a code or recovery code was used by a concurrent request
+	ErrTwoFactorConflict = errors.New("two-factor enrollment was changed by another request")
+)
+
+// TwoFactorDynamoDBAPI - holds the functions used to persist TOTP enrollments
+type TwoFactorDynamoDBAPI interface {
+	PutTwoFactorInDynamoDB(ctx context.Context, twoFactor models.TwoFactorDynamo) error
+	GetTwoFactorInDynamoDB(ctx context.Context, userID string) (models.TwoFactorDynamo, error)
+	ConfirmTwoFactorInDynamoDB(ctx context.Context, userID string, secret string, step int64, codeHashes []string) error
+	SetRecoveryCodesInDynamoDB(ctx context.Context, userID string, codeHashes []string) error
+	UseTOTPStepInDynamoDB(ctx context.Context, userID string, step int64) error
+	UseRecoveryCodeInDynamoDB(ctx context.Context, userID string, index int, codeHash string) error
+	DeleteTwoFactorInDynamoDB(ctx context.Context, userID string) error
+}
+
+type twoFactorDynamodbImpl struct {
+	twoFactorSvc dynamodbiface.DynamoDBAPI
+}
+
+// NewTwoFactorDBImpl gives the dynamodb implementation of TwoFactorDynamoDBAPI
+func NewTwoFactorDBImpl(twoFactorSvc dynamodbiface.DynamoDBAPI) TwoFactorDynamoDBAPI {
+	return &twoFactorDynamodbImpl{
+		twoFactorSvc: twoFactorSvc,
+	}
+}
+
+func twoFactorItemKey(userID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(constants.TypeTwoFactorForSortKey),
+		},
+	}
+}
+
+// PutTwoFactorInDynamoDB stores the enrollment, replacing any previous one
+func (dbImpl *twoFactorDynamodbImpl) PutTwoFactorInDynamoDB(ctx context.Context, twoFactor models.TwoFactorDynamo) error {
+	av, err := dynamodbattribute.MarshalMap(twoFactor)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err = dbImpl.twoFactorSvc.PutItem(input)
+	return err
+}
+
+// GetTwoFactorInDynamoDB gets the enrollment of the user
+func (dbImpl *twoFactorDynamodbImpl) GetTwoFactorInDynamoDB(ctx context.Context, userID string) (models.TwoFactorDynamo, error) {
+	twoFactor := models.TwoFactorDynamo{}
+	input := &dynamodb.GetItemInput{
+		Key:            twoFactorItemKey(userID),
+		TableName:      aws.String(constants.UsersTableName),
+		ConsistentRead: aws.Bool(true),
+	}
+	result, err := dbImpl.twoFactorSvc.GetItem(input)
+	if err != nil {
+		return twoFactor, err
+	}
+	if result.Item == nil {
+		return twoFactor, ErrTwoFactorNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &twoFactor)
+	if err != nil {
+		return twoFactor, err
+	}
+	return twoFactor, nil
+}
+
+// ConfirmTwoFactorInDynamoDB marks the enrollment confirmed and stores its recovery codes.
+// The update only applies to the unconfirmed enrollment of the given secret, in case it was replaced meanwhile.
+func (dbImpl *twoFactorDynamodbImpl) ConfirmTwoFactorInDynamoDB(ctx context.Context, userID string, secret string, step int64, codeHashes []string) error {
+	update := expression.Set(expression.Name("Confirmed"), expression.Value(true)).
+		Set(expression.Name("LastUsedStep"), expression.Value(step)).
+		Set(expression.Name("RecoveryCodes"), expression.Value(codeHashes))
+	condition := expression.Name("Secret").Equal(expression.Value(secret)).
+		And(expression.Name("Confirmed").Equal(expression.Value(false)))
+	return dbImpl.updateTwoFactor(userID, update, condition)
+}
+
+// SetRecoveryCodesInDynamoDB replaces the recovery codes of a confirmed enrollment
+func (dbImpl *twoFactorDynamodbImpl) SetRecoveryCodesInDynamoDB(ctx context.Context, userID string, codeHashes []string) error {
+	update := expression.Set(expression.Name("RecoveryCodes"), expression.Value(codeHashes))
+	condition := expression.Name("Confirmed").Equal(expression.Value(true))
+	return dbImpl.updateTwoFactor(userID, update, condition)
+}
+
+// UseTOTPStepInDynamoDB records the time step of an accepted code.
+// The update fails if the step or a later one was already used, so a code can't be replayed.
+func (dbImpl *twoFactorDynamodbImpl) UseTOTPStepInDynamoDB(ctx context.Context, userID string, step int64) error {
+	update := expression.Set(expression.Name("LastUsedStep"), expression.Value(step))
+	condition := expression.Name("LastUsedStep").LessThan(expression.Value(step))
+	return dbImpl.updateTwoFactor(userID, update, condition)
+}
+
+// UseRecoveryCodeInDynamoDB removes a recovery code hash from the enrollment.
+// The update only applies while the hash is still at the given index, so a code can be used once.
+func (dbImpl *twoFactorDynamodbImpl) UseRecoveryCodeInDynamoDB(ctx context.Context, userID string, index int, codeHash string) error {
+	code := expression.Name(fmt.Sprintf("RecoveryCodes[%d]", index))
+	return dbImpl.updateTwoFactor(userID, expression.Remove(code), code.Equal(expression.Value(codeHash)))
+}
+
+// DeleteTwoFactorInDynamoDB removes the enrollment of the user
+func (dbImpl *twoFactorDynamodbImpl) DeleteTwoFactorInDynamoDB(ctx context.Context, userID string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       twoFactorItemKey(userID),
+		TableName: aws.String(constants.UsersTableName),
+	}
+	_, err := dbImpl.twoFactorSvc.DeleteItem(input)
+	return err
+}
+
+func (dbImpl *twoFactorDynamodbImpl) updateTwoFactor(userID string, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("error building update expression. %s", err.Error())
+	}
+	input := &dynamodb.UpdateItemInput{
+		Key:                       twoFactorItemKey(userID),
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.twoFactorSvc.UpdateItem(input)
+	return twoFactorConditionalError(err)
+}
+
+func twoFactorConditionalError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrTwoFactorConflict
+	}
+	return err
+}
@@ -0,0 +1,528 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	fileModels "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/models"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/constants"
+	"github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/models"
+)
+
+const (
+	// versionAttribute counts the writes of a user item, a write based on an older read is rejected
+	versionAttribute = "Version"
+	// legacyFilesAttribute holds the file metadata of users stored before files became items
+	legacyFilesAttribute = "files"
+	// storageUsedAttribute holds the total size of the files of the user
+	storageUsedAttribute = "StorageUsedBytes"
+)
+
+// ErrUserChanged is returned when the user was written since it was read
+var ErrUserChanged = errors.New("user was changed meanwhile")
+
+// ErrUserFileNotFound is returned when the user has no file with the requested name
+var ErrUserFileNotFound = errors.New("file not found")
+
+// ErrStorageQuotaExceeded is returned when a file doesn't fit in the storage quota of the user as stored at the write
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// UserFileSortKey returns the sort key of the item holding the metadata of a file
+func UserFileSortKey(fileName string) string {
+	return constants.TypeFileForSortKey + constants.SortKeySeparator + fileName
+}
+
+func userFileItemKey(userID string, fileName string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(userID),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(UserFileSortKey(fileName)),
+		},
+	}
+}
+
+// UpdateUserInDynamoDB replaces the stored user if it is still the version that was read, and returns it with its new version.
+// Users stored before versions existed count as version 0. The files of the user are stored apart and aren't written.
+func (dbImpl userDynamodbImpl) UpdateUserInDynamoDB(ctx context.Context, user models.UserDynamo) (models.UserDynamo, error) {
+	readVersion := user.Version
+	user.Version++
+	av, err := dynamodbattribute.MarshalMap(user)
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	versionCondition := expression.Name(versionAttribute).Equal(expression.Value(readVersion))
+	if readVersion == 0 {
+		versionCondition = expression.Name(versionAttribute).AttributeNotExists().Or(versionCondition)
+	}
+	condition := expression.AttributeExists(expression.Name(constants.UsersTablePrimaryKey)).And(versionCondition)
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:                      av,
+		TableName:                 aws.String(constants.UsersTableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+	}
+	_, err = dbImpl.usrSvc.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return models.UserDynamo{}, dbImpl.userChangedOrGone(user.UserID)
+	}
+	if err != nil {
+		return models.UserDynamo{}, err
+	}
+	return user, nil
+}
+
+// GetUserFilesInDynamoDB gets the metadata of the files of the user stored as items, by file name
+func (dbImpl userDynamodbImpl) GetUserFilesInDynamoDB(ctx context.Context, userID string) (map[string]fileModels.FileInfo, error) {
+	files := map[string]fileModels.FileInfo{}
+	keyCond := expression.Key(constants.UsersTablePrimaryKey).Equal(expression.Value(userID)).
+		And(expression.Key(constants.UsersTableSortKey).BeginsWith(constants.TypeFileForSortKey + constants.SortKeySeparator))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return files, err
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 aws.String(constants.UsersTableName),
+	}
+	for {
+		result, err := dbImpl.usrSvc.Query(input)
+		if err != nil {
+			return files, err
+		}
+		page := []models.UserFileDynamo{}
+		err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return files, err
+		}
+		for _, file := range page {
+			files[file.FileName] = file.FileInfo
+		}
+		if result.LastEvaluatedKey == nil {
+			return files, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// withUserFiles sets FileInfo to the files of the user, both the migrated ones and those still on the user item.
+// A file stored both ways is taken from its item, and its stale legacy entry is dropped.
+func (dbImpl userDynamodbImpl) withUserFiles(ctx context.Context, user *models.UserDynamo) error {
+	files, err := dbImpl.GetUserFilesInDynamoDB(ctx, user.UserID)
+	if err != nil {
+		return err
+	}
+	user.FileInfo = nil
+	if len(files)+len(user.LegacyFileInfo) == 0 {
+		return nil
+	}
+	user.FileInfo = make(map[string]fileModels.FileInfo, len(files)+len(user.LegacyFileInfo))
+	for fileName, fileInfo := range user.LegacyFileInfo {
+		if _, ok := files[fileName]; ok {
+			delete(user.LegacyFileInfo, fileName)
+			continue
+		}
+		user.FileInfo[fileName] = fileInfo
+	}
+	for fileName, fileInfo := range files {
+		user.FileInfo[fileName] = fileInfo
+	}
+	return nil
+}
+
+// PutUserFileInDynamoDB stores the metadata of a file of the user and adds its size to the storage the user uses.
+// user is the user as it was read; when the file it holds under the name isn't the stored one anymore the write
+// fails with ErrUserChanged, so concurrent uploads of the same file can't count its size twice.
+// The storage the user uses is checked against storageQuota by the write itself, so concurrent uploads can't
+// exceed it together; it fails with ErrStorageQuotaExceeded then.
+func (dbImpl userDynamodbImpl) PutUserFileInDynamoDB(ctx context.Context, user models.UserDynamo, fileInfo fileModels.FileInfo,
+	storageQuota int64) error {
+	item, err := dynamodbattribute.MarshalMap(models.UserFileDynamo{
+		DynamoKeys: models.DynamoKeys{
+			PKey: user.UserID,
+			SKey: UserFileSortKey(fileInfo.FileName),
+		},
+		FileInfo: fileInfo,
+	})
+	if err != nil {
+		return err
+	}
+	put := &dynamodb.Put{
+		Item:                     item,
+		TableName:                aws.String(constants.UsersTableName),
+		ConditionExpression:      aws.String("attribute_not_exists(#pkey)"),
+		ExpressionAttributeNames: map[string]*string{"#pkey": aws.String(constants.UsersTablePrimaryKey)},
+	}
+	previous, replaced := user.FileInfo[fileInfo.FileName]
+	legacy := legacyFile(user, fileInfo.FileName)
+	if replaced && legacy == nil {
+		// the item replaces the one that was read
+		put.ExpressionAttributeNames = map[string]*string{}
+		put.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{}
+		put.ConditionExpression = aws.String(fileEntryCondition(put.ExpressionAttributeNames, put.ExpressionAttributeValues, "", previous))
+	}
+	sizeChange := fileInfo.Size - previous.Size
+	update := userFilesUpdate(user.UserID, fileInfo.FileName, sizeChange, legacy)
+	// condition expressions can't add, so the size is taken off the quota here
+	maxUsed := storageQuota - sizeChange
+	if sizeChange > 0 {
+		withStorageQuota(update, maxUsed)
+	}
+	_, err = dbImpl.usrSvc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: put},
+			{Update: update},
+		},
+	})
+	if sizeChange > 0 && failedCondition(err, 1) {
+		return dbImpl.quotaExceededOrChanged(user.UserID, maxUsed)
+	}
+	return dbImpl.userFileWriteError(user.UserID, err)
+}
+
+// DeleteUserFileInDynamoDB removes the metadata of a file of the user and subtracts its size from the storage the user uses.
+// user is the user as it was read, the write fails with ErrUserChanged when the stored file is another.
+func (dbImpl userDynamodbImpl) DeleteUserFileInDynamoDB(ctx context.Context, user models.UserDynamo, fileName string) error {
+	fileInfo, ok := user.FileInfo[fileName]
+	if !ok {
+		return ErrUserFileNotFound
+	}
+	legacy := legacyFile(user, fileName)
+	transactItems := []*dynamodb.TransactWriteItem{
+		{Update: userFilesUpdate(user.UserID, fileName, -fileInfo.Size, legacy)},
+	}
+	if legacy == nil {
+		names := map[string]*string{}
+		values := map[string]*dynamodb.AttributeValue{}
+		transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				Key:                       userFileItemKey(user.UserID, fileName),
+				TableName:                 aws.String(constants.UsersTableName),
+				ConditionExpression:       aws.String(fileEntryCondition(names, values, "", fileInfo)),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		})
+	}
+	_, err := dbImpl.usrSvc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	return dbImpl.userFileWriteError(user.UserID, err)
+}
+
+// UpdateUserFileDescriptionsInDynamoDB sets the description of files of the user, nothing is written when one is missing
+func (dbImpl userDynamodbImpl) UpdateUserFileDescriptionsInDynamoDB(ctx context.Context, user models.UserDynamo, fileNames []string,
+	description string) error {
+	transactItems := []*dynamodb.TransactWriteItem{}
+	legacyNames := []string{}
+	for _, fileName := range fileNames {
+		if _, ok := user.FileInfo[fileName]; !ok {
+			return ErrUserFileNotFound
+		}
+		if legacyFile(user, fileName) != nil {
+			legacyNames = append(legacyNames, fileName)
+			continue
+		}
+		transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				Key:                 userFileItemKey(user.UserID, fileName),
+				TableName:           aws.String(constants.UsersTableName),
+				UpdateExpression:    aws.String("SET #description = :description"),
+				ConditionExpression: aws.String("attribute_exists(#pkey)"),
+				ExpressionAttributeNames: map[string]*string{
+					"#description": aws.String("description"),
+					"#pkey":        aws.String(constants.UsersTablePrimaryKey),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":description": {S: aws.String(description)},
+				},
+			},
+		})
+	}
+	if len(legacyNames) > 0 {
+		transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+			Update: legacyDescriptionsUpdate(user.UserID, legacyNames, description),
+		})
+	}
+	_, err := dbImpl.usrSvc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+	for i := range transactItems {
+		if failedCondition(err, i) {
+			return ErrUserFileNotFound
+		}
+	}
+	return dbImpl.userFileWriteError(user.UserID, err)
+}
+
+// MigrateUserFilesInDynamoDB moves the files stored on the user item to items of their own and returns how many were moved.
+// Files changed while they are moved are left on the user item, and ErrUserChanged is returned once the others are moved.
+func (dbImpl userDynamodbImpl) MigrateUserFilesInDynamoDB(ctx context.Context, userID string) (int, error) {
+	user, err := dbImpl.getUserItem(userID, constants.TypeUsersForSortKey)
+	if err != nil || len(user.LegacyFileInfo) == 0 {
+		return 0, err
+	}
+	files, err := dbImpl.GetUserFilesInDynamoDB(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	var changed error
+	for fileName, fileInfo := range user.LegacyFileInfo {
+		legacy := fileInfo
+		var transactItems []*dynamodb.TransactWriteItem
+		if _, ok := files[fileName]; ok {
+			// the file was written again since it was stored on the user item, its stale entry was counted as well
+			transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+				Update: userFilesUpdate(userID, fileName, -legacy.Size, &legacy),
+			})
+		} else {
+			item, err := dynamodbattribute.MarshalMap(models.UserFileDynamo{
+				DynamoKeys: models.DynamoKeys{
+					PKey: userID,
+					SKey: UserFileSortKey(fileName),
+				},
+				FileInfo: fileInfo,
+			})
+			if err != nil {
+				return moved, err
+			}
+			transactItems = append(transactItems,
+				&dynamodb.TransactWriteItem{Update: userFilesUpdate(userID, fileName, 0, &legacy)},
+				&dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+					Item:                     item,
+					TableName:                aws.String(constants.UsersTableName),
+					ConditionExpression:      aws.String("attribute_not_exists(#pkey)"),
+					ExpressionAttributeNames: map[string]*string{"#pkey": aws.String(constants.UsersTablePrimaryKey)},
+				}},
+			)
+		}
+		_, err := dbImpl.usrSvc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: transactItems})
+		err = dbImpl.userFileWriteError(userID, err)
+		if err == ErrUserChanged {
+			changed = err
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	if changed != nil {
+		return moved, changed
+	}
+	return moved, dbImpl.removeEmptyLegacyFiles(userID)
+}
+
+// getUserItem gets the user item as it is stored, without the files stored as items.
+// The read is consistent, so decisions such as purging an account see the latest writes.
+func (dbImpl userDynamodbImpl) getUserItem(pkey string, skey string) (models.UserDynamo, error) {
+	user := models.UserDynamo{}
+	key := map[string]*dynamodb.AttributeValue{
+		constants.UsersTablePrimaryKey: {
+			S: aws.String(pkey),
+		},
+		constants.UsersTableSortKey: {
+			S: aws.String(skey),
+		},
+	}
+	input := &dynamodb.GetItemInput{
+		Key:            key,
+		TableName:      aws.String(constants.UsersTableName),
+		ConsistentRead: aws.Bool(true),
+	}
+	result, err := dbImpl.usrSvc.GetItem(input)
+	if err != nil {
+		return user, err
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &user)
+	return user, err
+}
+
+// removeEmptyLegacyFiles removes the files attribute from the user item once every file was moved out of it
+func (dbImpl userDynamodbImpl) removeEmptyLegacyFiles(userID string) error {
+	_, err := dbImpl.usrSvc.UpdateItem(&dynamodb.UpdateItemInput{
+		Key:                 userItemKey(userID),
+		TableName:           aws.String(constants.UsersTableName),
+		UpdateExpression:    aws.String("REMOVE #files ADD #version :one"),
+		ConditionExpression: aws.String("size(#files) = :zero"),
+		ExpressionAttributeNames: map[string]*string{
+			"#files":   aws.String(legacyFilesAttribute),
+			"#version": aws.String(versionAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":  {N: aws.String("1")},
+			":zero": {N: aws.String("0")},
+		},
+	})
+	// files were added to the attribute meanwhile, they are moved by the next run
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrUserChanged
+	}
+	return err
+}
+
+// userChangedOrGone tells why a conditional write of an existing user failed
+func (dbImpl userDynamodbImpl) userChangedOrGone(userID string) error {
+	result, err := dbImpl.usrSvc.GetItem(&dynamodb.GetItemInput{
+		Key:                  userItemKey(userID),
+		TableName:            aws.String(constants.UsersTableName),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String(constants.UsersTablePrimaryKey),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return ErrUserNotFound
+	}
+	return ErrUserChanged
+}
+
+// quotaExceededOrChanged tells why the update of the user item adding a file failed, maxUsed is the most storage
+// the user could use before the file to stay in its quota
+func (dbImpl userDynamodbImpl) quotaExceededOrChanged(userID string, maxUsed int64) error {
+	result, err := dbImpl.usrSvc.GetItem(&dynamodb.GetItemInput{
+		Key:                      userItemKey(userID),
+		TableName:                aws.String(constants.UsersTableName),
+		ConsistentRead:           aws.Bool(true),
+		ProjectionExpression:     aws.String("#pkey, #used"),
+		ExpressionAttributeNames: map[string]*string{"#pkey": aws.String(constants.UsersTablePrimaryKey), "#used": aws.String(storageUsedAttribute)},
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return ErrUserNotFound
+	}
+	user := models.UserDynamo{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &user); err != nil {
+		return err
+	}
+	if user.StorageUsedBytes > maxUsed {
+		return ErrStorageQuotaExceeded
+	}
+	return ErrUserChanged
+}
+
+// userFileWriteError tells why a transaction writing files of the user was canceled
+func (dbImpl userDynamodbImpl) userFileWriteError(userID string, err error) error {
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return err
+	}
+	for _, reason := range canceled.CancellationReasons {
+		switch aws.StringValue(reason.Code) {
+		case "ConditionalCheckFailed", "TransactionConflict":
+			return dbImpl.userChangedOrGone(userID)
+		}
+	}
+	return err
+}
+
+// legacyFile returns the entry of a file the user read from the user item, nil when the file is an item of its own
+func legacyFile(user models.UserDynamo, fileName string) *fileModels.FileInfo {
+	fileInfo, ok := user.LegacyFileInfo[fileName]
+	if !ok {
+		return nil
+	}
+	return &fileInfo
+}
+
+// userFilesUpdate returns the update of the user item recording a change of its files: sizeChange is added to the storage
+// the user uses, and a file read from the user item as legacy is removed from it unless it changed since
+func userFilesUpdate(userID string, fileName string, sizeChange int64, legacy *fileModels.FileInfo) *dynamodb.Update {
+	names := map[string]*string{
+		"#pkey":    aws.String(constants.UsersTablePrimaryKey),
+		"#used":    aws.String(storageUsedAttribute),
+		"#version": aws.String(versionAttribute),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":size": {N: aws.String(fmt.Sprint(sizeChange))},
+		":one":  {N: aws.String("1")},
+	}
+	updateExpression := "ADD #used :size, #version :one"
+	condition := "attribute_exists(#pkey)"
+	if legacy != nil {
+		// file names can hold dots, so the path is written with placeholders instead of expression.Name
+		names["#files"] = aws.String(legacyFilesAttribute)
+		names["#name"] = aws.String(fileName)
+		updateExpression += " REMOVE #files.#name"
+		condition += " AND " + fileEntryCondition(names, values, "#files.#name.", *legacy)
+	}
+	return &dynamodb.Update{
+		Key:                       userItemKey(userID),
+		TableName:                 aws.String(constants.UsersTableName),
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+}
+
+// withStorageQuota makes the update of the user item fail unless the user uses at most maxUsed bytes of storage.
+// Users without a recorded usage use none.
+func withStorageQuota(update *dynamodb.Update, maxUsed int64) {
+	update.ExpressionAttributeValues[":maxUsed"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(maxUsed))}
+	quotaCondition := "#used <= :maxUsed"
+	if maxUsed >= 0 {
+		quotaCondition = "(" + quotaCondition + " OR attribute_not_exists(#used))"
+	}
+	update.ConditionExpression = aws.String(aws.StringValue(update.ConditionExpression) + " AND " + quotaCondition)
+}
+
+// legacyDescriptionsUpdate returns the update of the user item setting the description of files stored on it
+func legacyDescriptionsUpdate(userID string, fileNames []string, description string) *dynamodb.Update {
+	names := map[string]*string{
+		"#files":       aws.String(legacyFilesAttribute),
+		"#description": aws.String("description"),
+		"#version":     aws.String(versionAttribute),
+	}
+	sets := []string{}
+	conditions := []string{}
+	for i, fileName := range fileNames {
+		placeholder := fmt.Sprintf("#name%d", i)
+		names[placeholder] = aws.String(fileName)
+		sets = append(sets, fmt.Sprintf("#files.%s.#description = :description", placeholder))
+		conditions = append(conditions, fmt.Sprintf("attribute_exists(#files.%s)", placeholder))
+	}
+	return &dynamodb.Update{
+		Key:                      userItemKey(userID),
+		TableName:                aws.String(constants.UsersTableName),
+		UpdateExpression:         aws.String("SET " + strings.Join(sets, ", ") + " ADD #version :one"),
+		ConditionExpression:      aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":description": {S: aws.String(description)},
+			":one":         {N: aws.String("1")},
+		},
+	}
+}
+
+// fileEntryCondition returns the condition matching the stored metadata of a file at path against the metadata that
+// was read, by its size and update time, and adds the placeholders it uses
+func fileEntryCondition(names map[string]*string, values map[string]*dynamodb.AttributeValue, path string,
+	fileInfo fileModels.FileInfo) string {
+	names["#updated"] = aws.String("updated_at")
+	names["#size"] = aws.String("size")
+	values[":updated"] = &dynamodb.AttributeValue{S: aws.String(fileInfo.UpdatedAt)}
+	condition := path + "#updated = :updated"
+	// sizes of 0 aren't stored
+	if fileInfo.Size == 0 {
+		return condition + " AND attribute_not_exists(" + path + "#size)"
+	}
+	values[":previousSize"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(fileInfo.Size))}
+	return condition + " AND " + path + "#size = :previousSize"
+}
@@ -0,0 +1,114 @@
+// Package clientip finds the address of the client a request came from.
+// Forwarding headers are set by the client, so they are only read when the request came through a trusted proxy.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	trustedProxiesEnv  = "TRUSTED_PROXIES"
+	forwardedForHeader = "X-Forwarded-For"
+	clientIPContextKey = "clientIP"
+)
+
+// Resolver reads the client IP of requests, trusting X-Forwarded-For only from its proxies
+type Resolver struct {
+	trustedProxies []*net.IPNet
+}
+
+// NewResolver creates a resolver trusting the given proxy IPs or CIDR ranges
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	resolver := &Resolver{}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				resolver.trustedProxies = append(resolver.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+				continue
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP or a CIDR range", proxy)
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, ipNet)
+	}
+	return resolver, nil
+}
+
+// NewResolverFromEnv creates a resolver trusting the comma separated proxies of TRUSTED_PROXIES, by default none
+func NewResolverFromEnv() (*Resolver, error) {
+	return NewResolver(strings.Split(utils.GetEnvOrDefault(trustedProxiesEnv, ""), ","))
+}
+
+// ClientIP returns the address the request came from. When that is a trusted proxy, the addresses of
+// X-Forwarded-For are read from the right, and the first one that isn't a trusted proxy is the client.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	remoteIP := remoteAddrIP(req.RemoteAddr)
+	if remoteIP == nil {
+		return ""
+	}
+	clientIP := remoteIP
+	if r.trusted(clientIP) {
+		hops := strings.Split(strings.Join(req.Header.Values(forwardedForHeader), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			// a malformed entry was written by the client, the last proxy that passed it on is all that is known
+			if hop == nil {
+				break
+			}
+			clientIP = hop
+			if !r.trusted(hop) {
+				break
+			}
+		}
+	}
+	return clientIP.String()
+}
+
+// Middleware stores the client IP of the request for Get
+func (r *Resolver) Middleware(c *gin.Context) {
+	c.Set(clientIPContextKey, r.ClientIP(c.Request))
+	c.Next()
+}
+
+// Get returns the client IP stored by the middleware, or the address the request came from without it
+func Get(c *gin.Context) string {
+	if v, ok := c.Get(clientIPContextKey); ok {
+		if clientIP, ok := v.(string); ok {
+			return clientIP
+		}
+	}
+	if ip := remoteAddrIP(c.Request.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func (r *Resolver) trusted(ip net.IP) bool {
+	for _, proxy := range r.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteAddrIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(remoteAddr)
+	}
+	return net.ParseIP(host)
+}
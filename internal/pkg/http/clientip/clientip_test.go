@@ -0,0 +1,50 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustsForwardingOnlyFromProxies(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("NewResolver: %v", err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:41000", nil, "203.0.113.7"},
+		// a client can't pick its address, or another one, by setting the header itself
+		{"header from a client", "203.0.113.7:41000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through a proxy", "10.1.2.3:41000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"entries written by the client are skipped", "10.1.2.3:41000", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"through several proxies", "10.1.2.3:41000", []string{"203.0.113.7, 192.168.1.1", "10.4.5.6"}, "203.0.113.7"},
+		{"malformed entry", "10.1.2.3:41000", []string{"not-an-ip, 10.4.5.6"}, "10.4.5.6"},
+		{"proxy without header", "10.1.2.3:41000", nil, "10.1.2.3"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("PUT", "/v1/login", nil)
+		req.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwardedFor {
+			req.Header.Add(forwardedForHeader, value)
+		}
+		if got := resolver.ClientIP(req); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewResolverRejectsInvalidProxies(t *testing.T) {
+	if _, err := NewResolver([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid CIDR range was accepted")
+	}
+	if _, err := NewResolver([]string{"proxy.example.com"}); err == nil {
+		t.Error("host name was accepted")
+	}
+	if resolver, err := NewResolver([]string{""}); err != nil || len(resolver.trustedProxies) != 0 {
+		t.Errorf("empty list got %v, %v", resolver, err)
+	}
+}
@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	mailTransport   = "MAIL_TRANSPORT"
+	mailFrom        = "MAIL_FROM"
+	mailOutboxDir   = "MAIL_OUTBOX_DIR"
+	smtpHost        = "SMTP_HOST"
+	smtpPort        = "SMTP_PORT"
+	smtpUsername    = "SMTP_USERNAME"
+	smtpPassword    = "SMTP_PASSWORD"
+	defaultSMTPPort = "587"
+
+	// TransportSMTP sends mails through an SMTP relay
+	TransportSMTP = "smtp"
+	// TransportOutbox writes mails to a local directory, for local development and tests
+	TransportOutbox = "outbox"
+
+	defaultMailFrom  = "no-reply@fileexplorerpost.xyz"
+	defaultOutboxDir = "outbox"
+)
+
+// Message is a plain text mail
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer - sends mails to users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailerFromEnv creates the mailer selected by MAIL_TRANSPORT, defaulting to the outbox
+func NewMailerFromEnv() (Mailer, error) {
+	from := utils.GetEnvOrDefault(mailFrom, defaultMailFrom)
+	transport := utils.GetEnvOrDefault(mailTransport, TransportOutbox)
+	switch transport {
+	case TransportSMTP:
+		host, set := os.LookupEnv(smtpHost)
+		if !set {
+			return nil, fmt.Errorf("SMTP host is not set in ENV %s", smtpHost)
+		}
+		return NewSMTPMailer(SMTPConfig{
+			Host:     host,
+			Port:     utils.GetEnvOrDefault(smtpPort, defaultSMTPPort),
+			Username: os.Getenv(smtpUsername),
+			Password: os.Getenv(smtpPassword),
+			From:     from,
+		}), nil
+	case TransportOutbox:
+		return NewOutboxMailer(utils.GetEnvOrDefault(mailOutboxDir, defaultOutboxDir), from)
+	}
+	return nil, fmt.Errorf("unknown mail transport %q in ENV %s", transport, mailTransport)
+}
+
+// format renders the message as an RFC 5322 mail
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
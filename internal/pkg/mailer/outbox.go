@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+type outboxMailer struct {
+	dir  string
+	from string
+}
+
+// NewOutboxMailer gives a Mailer writing every message as an .eml file to dir
+func NewOutboxMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating mail outbox %s. %s", dir, err.Error())
+	}
+	return &outboxMailer{dir: dir, from: from}, nil
+}
+
+// Send writes the message to the outbox directory
+func (om *outboxMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), utils.GenerateUUID())
+	path := filepath.Join(om.dir, name)
+	if err := ioutil.WriteFile(path, format(om.from, msg), 0600); err != nil {
+		return fmt.Errorf("error writing mail %q to %s. %s", msg.Subject, path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPConfig holds the SMTP relay settings
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer gives the SMTP implementation of Mailer
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config}
+}
+
+// Send sends the message through the SMTP relay
+func (sm *smtpMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if sm.config.Username != "" {
+		auth = smtp.PlainAuth("", sm.config.Username, sm.config.Password, sm.config.Host)
+	}
+	addr := net.JoinHostPort(sm.config.Host, sm.config.Port)
+	if err := smtp.SendMail(addr, auth, sm.config.From, msg.To, format(sm.config.From, msg)); err != nil {
+		return fmt.Errorf("error sending mail %q through %s. %s", msg.Subject, addr, err.Error())
+	}
+	return nil
+}
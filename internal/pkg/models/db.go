@@ -4,8 +4,8 @@ import "github.com/aws/aws-sdk-go/service/dynamodb"
 
 // Create a struct that models the structure of a user, both in the request body, and in the DB
 type Credentials struct {
-	Password string `json:"password", db:"password"`
-	Username string `json:"username", db:"username"`
+	Password string `json:"password" db:"password"`
+	Username string `json:"username" db:"username"`
 }
 
 // AwsCredentials are the security details needed to access aws for a specific provider
@@ -21,6 +21,35 @@ type DatabaseQuery struct {
 	NotEqual    QueryMap
 	Default     DefaultQuery
 	QueryParams *dynamodb.QueryInput
+	// Limit is the most items of a page, zero lists every item
+	Limit int64
+	// Cursor is the next cursor returned with the previous page, empty for the first page
+	Cursor string
+	// Conditions filter the items further, all of them have to match
+	Conditions []QueryCondition
+	// WithFiles reads the files of every user listed as well, which takes a query per user
+	WithFiles bool
+}
+
+// Operators of query conditions
+const (
+	OpEqual            = "eq"
+	OpNotEqual         = "ne"
+	OpBeginsWith       = "begins_with"
+	OpContains         = "contains"
+	OpGreaterThan      = "gt"
+	OpGreaterThanEqual = "ge"
+	OpLessThan         = "lt"
+	OpLessThanEqual    = "le"
+	OpBetween          = "between"
+)
+
+// QueryCondition compares an attribute with typed values, between takes two values and the other operators one.
+// An attribute compared equal to false or 0 also matches items without the attribute.
+type QueryCondition struct {
+	Key      string
+	Operator string
+	Values   []interface{}
 }
 
 // QueryMap is query map
@@ -0,0 +1,284 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "RS256"
+	// clockSkew is the difference allowed between our clock and the identity provider clock
+	clockSkew = time.Minute
+	// keysRefreshInterval limits how often an unknown key ID makes us fetch the keys again
+	keysRefreshInterval = time.Minute
+)
+
+// ErrInvalidIDToken is returned when an ID token fails validation
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer     string
+	Subject    string
+	Email      string
+	GivenName  string
+	FamilyName string
+	// EmailVerified is nil when the identity provider doesn't send the claim
+	EmailVerified *bool
+	// Claims holds every claim, for mappings such as the admin claim
+	Claims map[string]interface{}
+}
+
+// ClaimHasValue reports whether the claim equals the value, or contains it when the claim is a list.
+// Boolean and number claims are compared in their JSON form, e.g. "true".
+func (t IDToken) ClaimHasValue(claim string, value string) bool {
+	switch v := t.Claims[claim].(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	case bool, float64:
+		return fmt.Sprint(v) == value
+	}
+	return false
+}
+
+type idTokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   *bool    `json:"email_verified"`
+	GivenName       string   `json:"given_name"`
+	FamilyName      string   `json:"family_name"`
+}
+
+// audience is a single audience or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+type keySet struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// VerifyIDToken checks the signature of the ID token against the provider keys and validates its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (IDToken, error) {
+	idToken := IDToken{}
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return idToken, ErrInvalidIDToken
+	}
+	header := idTokenHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	// the algorithm is pinned, a token can't pick a weaker one such as "none"
+	if header.Algorithm != signingAlgorithm {
+		return idToken, fmt.Errorf("%w, unsupported signing algorithm %q", ErrInvalidIDToken, header.Algorithm)
+	}
+	key, err := p.signingKey(ctx, header.KeyID)
+	if err != nil {
+		return idToken, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return idToken, fmt.Errorf("%w, signature doesn't match", ErrInvalidIDToken)
+	}
+
+	claims := idTokenClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	if err := decodeSegment(parts[1], &idToken.Claims); err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	if err := p.validateClaims(claims, nonce); err != nil {
+		return idToken, err
+	}
+	idToken.Issuer = claims.Issuer
+	idToken.Subject = claims.Subject
+	idToken.Email = claims.Email
+	idToken.EmailVerified = claims.EmailVerified
+	idToken.GivenName = claims.GivenName
+	idToken.FamilyName = claims.FamilyName
+	return idToken, nil
+}
+
+func (p *Provider) validateClaims(claims idTokenClaims, nonce string) error {
+	now := p.now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.config.IssuerURL:
+		return fmt.Errorf("%w, issued by %s", ErrInvalidIDToken, claims.Issuer)
+	case claims.Subject == "":
+		return fmt.Errorf("%w, missing subject", ErrInvalidIDToken)
+	case !claims.Audience.contains(p.config.ClientID):
+		return fmt.Errorf("%w, not issued for this client", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return fmt.Errorf("%w, authorized party is not this client", ErrInvalidIDToken)
+	case now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return fmt.Errorf("%w, token has expired", ErrInvalidIDToken)
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return fmt.Errorf("%w, token is issued in the future", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return fmt.Errorf("%w, nonce doesn't match the login request", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// signingKey returns the provider key with the given ID.
+// The keys are fetched again when the ID is unknown, as providers rotate their keys.
+func (p *Provider) signingKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil {
+		if key, ok := p.keys.lookup(keyID); ok {
+			return key, nil
+		}
+		if p.now().Sub(p.keys.fetchedAt) < keysRefreshInterval {
+			return nil, fmt.Errorf("%w, unknown signing key %q", ErrInvalidIDToken, keyID)
+		}
+	}
+	keys, err := p.fetchKeys(ctx, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key, ok := p.keys.lookup(keyID); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w, unknown signing key %q", ErrInvalidIDToken, keyID)
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (*keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	status, err := p.doJSON(req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("error reading OIDC signing keys. %s", err.Error())
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("OIDC signing keys returned %d", status)
+	}
+	keys := &keySet{
+		keys:      map[string]*rsa.PublicKey{},
+		fetchedAt: p.now(),
+	}
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") || (jwk.Algorithm != "" && jwk.Algorithm != signingAlgorithm) {
+			continue
+		}
+		key, err := jwk.rsaPublicKey()
+		if err != nil {
+			continue
+		}
+		keys.keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+// lookup finds a key by ID. A token without a key ID is accepted only if the provider has a single key.
+func (ks *keySet) lookup(keyID string) (*rsa.PublicKey, bool) {
+	if keyID == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[keyID]
+	return key, ok
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
+)
+
+const (
+	oidcIssuerURL    = "OIDC_ISSUER_URL"
+	oidcClientID     = "OIDC_CLIENT_ID"
+	oidcClientSecret = "OIDC_CLIENT_SECRET"
+	oidcRedirectURL  = "OIDC_REDIRECT_URL"
+	oidcScopes       = "OIDC_SCOPES"
+
+	discoveryPath = "/.well-known/openid-configuration"
+	// maxResponseBytes caps what is read from the identity provider
+	maxResponseBytes = 1 << 20
+)
+
+// Config holds the client registration at the identity provider
+type Config struct {
+	// IssuerURL is the issuer identifier, the discovery document is read from below it
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the page the identity provider sends the authorization code to
+	RedirectURL string
+	Scopes      []string
+}
+
+// ConfigFromEnv reads the client registration from the environment.
+// The second return value is false when OIDC_ISSUER_URL is not set and single sign-on is disabled.
+func ConfigFromEnv(defaultRedirectURL string) (Config, bool, error) {
+	config := Config{
+		IssuerURL:    strings.TrimSuffix(utils.GetEnvOrDefault(oidcIssuerURL, ""), "/"),
+		ClientID:     utils.GetEnvOrDefault(oidcClientID, ""),
+		ClientSecret: utils.GetEnvOrDefault(oidcClientSecret, ""),
+		RedirectURL:  utils.GetEnvOrDefault(oidcRedirectURL, defaultRedirectURL),
+		Scopes:       strings.Fields(utils.GetEnvOrDefault(oidcScopes, "openid email profile")),
+	}
+	if config.IssuerURL == "" {
+		return config, false, nil
+	}
+	if config.ClientID == "" {
+		return config, false, fmt.Errorf("OIDC client ID is not set in ENV %s", oidcClientID)
+	}
+	return config, true, nil
+}
+
+// discoveryDocument holds the fields used from the provider metadata
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider is an OpenID Connect relying party for a single identity provider.
+// Metadata and signing keys are fetched on first use, so the service starts while the provider is unreachable.
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+// NewProvider creates a relying party for the configured identity provider
+func NewProvider(config Config, httpClient *http.Client) *Provider {
+	return &Provider{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// AuthCodeURL returns the URL of the identity provider login page for the authorization code flow with PKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", codeChallengeMethod)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns the verified ID token
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (IDToken, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	token := tokenResponse{}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("error calling token endpoint. %s", err.Error())
+	}
+	if status != http.StatusOK {
+		return IDToken{}, fmt.Errorf("token endpoint returned %d %s %s", status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return IDToken{}, fmt.Errorf("token endpoint returned no id_token")
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// discover reads the provider metadata once and checks it belongs to the configured issuer
+func (p *Provider) discover(ctx context.Context) (discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return *p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.IssuerURL+discoveryPath, nil)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+	discovery := discoveryDocument{}
+	status, err := p.doJSON(req, &discovery)
+	if err != nil {
+		return discovery, fmt.Errorf("error reading OIDC discovery document. %s", err.Error())
+	}
+	if status != http.StatusOK {
+		return discovery, fmt.Errorf("OIDC discovery document returned %d", status)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.IssuerURL {
+		return discovery, fmt.Errorf("OIDC discovery document is for issuer %s, expected %s", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return discovery, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+	p.discovery = &discovery
+	return discovery, nil
+}
+
+func (p *Provider) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,277 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID    = "cloud-app"
+	testRedirectURL = "https://app.example.com/sso/callback"
+	testKeyID       = "key-1"
+	testCode        = "auth-code"
+)
+
+// testIdentityProvider is an identity provider serving discovery, JWKS and the token endpoint over httptest.
+// The token endpoint only answers for testCode and the verifier of the recorded PKCE challenge.
+type testIdentityProvider struct {
+	t              *testing.T
+	server         *httptest.Server
+	key            *rsa.PrivateKey
+	issuer         string
+	discoveryCalls int
+	challenge      string
+	claims         map[string]interface{}
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+	idp := &testIdentityProvider{t: t, key: generateKey(t)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		idp.discoveryCalls++
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 idp.issuer,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKeyID,
+				"use": "sig",
+				"alg": signingAlgorithm,
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != testCode ||
+			r.PostForm.Get("redirect_uri") != testRedirectURL || r.PostForm.Get("client_id") != testClientID {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if idp.challenge == "" || CodeChallenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{
+			"id_token":   idp.sign(map[string]string{"alg": signingAlgorithm, "kid": testKeyID}, idp.claims, idp.key),
+			"token_type": "Bearer",
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdentityProvider) provider() *Provider {
+	return NewProvider(Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email"},
+	}, idp.server.Client())
+}
+
+// validClaims returns the claims of an ID token the provider accepts for the nonce
+func (idp *testIdentityProvider) validClaims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            idp.issuer,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "ada@example.com",
+		"email_verified": true,
+	}
+}
+
+func (idp *testIdentityProvider) sign(header map[string]string, claims map[string]interface{}, key *rsa.PrivateKey) string {
+	idp.t.Helper()
+	signingInput := encodeTestSegment(idp.t, header) + "." + encodeTestSegment(idp.t, claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		idp.t.Fatalf("signing ID token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAuthCodeURLUsesDiscoveryOnce(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallenge("verifier-1"))
+		if err != nil {
+			t.Fatalf("AuthCodeURL: %v", err)
+		}
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", authURL, err)
+		}
+		if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.server.URL+"/authorize" {
+			t.Errorf("authorization endpoint %s, want %s", got, idp.server.URL+"/authorize")
+		}
+		want := map[string]string{
+			"response_type":         "code",
+			"client_id":             testClientID,
+			"redirect_uri":          testRedirectURL,
+			"scope":                 "openid email",
+			"state":                 "state-1",
+			"nonce":                 "nonce-1",
+			"code_challenge":        CodeChallenge("verifier-1"),
+			"code_challenge_method": codeChallengeMethod,
+		}
+		for param, value := range want {
+			if got := parsed.Query().Get(param); got != value {
+				t.Errorf("%s = %q, want %q", param, got, value)
+			}
+		}
+	}
+	if idp.discoveryCalls != 1 {
+		t.Errorf("discovery fetched %d times, want 1", idp.discoveryCalls)
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.issuer = "https://other.example.com"
+	if _, err := idp.provider().AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatal("discovery document of another issuer was accepted")
+	}
+}
+
+func TestCodeChallengeIsS256(t *testing.T) {
+	// the unpadded base64url SHA-256 of the verifier, not the plain verifier
+	if got := CodeChallenge("dBjftJeZ4CVP-mJ92K1qUD2uK1_9KbmS2Cjyd7v2mGE"); got != "bjZP8kSrrkeOe-EOa-LMgYp1AP0sY3ndv_-Iv9ms1N4" {
+		t.Errorf("CodeChallenge = %s", got)
+	}
+	first, err := GenerateRandomValue()
+	if err != nil {
+		t.Fatalf("GenerateRandomValue: %v", err)
+	}
+	second, _ := GenerateRandomValue()
+	if first == second || len(first) != base64.RawURLEncoding.EncodedLen(randomValueBytes) {
+		t.Errorf("random values %q and %q", first, second)
+	}
+}
+
+func TestExchangeChecksPKCEVerifier(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	p := idp.provider()
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallenge("verifier-1"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	// the identity provider records the challenge of the login it was sent to
+	idp.challenge = parsed.Query().Get("code_challenge")
+	idp.claims = idp.validClaims(parsed.Query().Get("nonce"))
+
+	if _, err := p.Exchange(ctx, testCode, "another-verifier", "nonce-1"); err == nil {
+		t.Fatal("code was redeemed with another verifier")
+	}
+	idToken, err := p.Exchange(ctx, testCode, "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if idToken.Issuer != idp.issuer || idToken.Subject != "subject-1" || idToken.Email != "ada@example.com" ||
+		idToken.EmailVerified == nil || !*idToken.EmailVerified {
+		t.Errorf("unexpected ID token %+v", idToken)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	otherKey := generateKey(t)
+	header := map[string]string{"alg": signingAlgorithm, "kid": testKeyID}
+	with := func(claim string, value interface{}) map[string]interface{} {
+		claims := idp.validClaims("nonce-1")
+		claims[claim] = value
+		return claims
+	}
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", idp.sign(header, idp.validClaims("nonce-1"), idp.key), true},
+		{"audience list with authorized party", idp.sign(header, func() map[string]interface{} {
+			claims := with("aud", []string{testClientID, "other-client"})
+			claims["azp"] = testClientID
+			return claims
+		}(), idp.key), true},
+		{"wrong issuer", idp.sign(header, with("iss", "https://other.example.com"), idp.key), false},
+		{"wrong audience", idp.sign(header, with("aud", "other-client"), idp.key), false},
+		{"audience list without authorized party", idp.sign(header, with("aud", []string{testClientID, "other-client"}), idp.key), false},
+		{"expired", idp.sign(header, with("exp", time.Now().Add(-2*clockSkew).Unix()), idp.key), false},
+		{"issued in the future", idp.sign(header, with("iat", time.Now().Add(2*clockSkew).Unix()), idp.key), false},
+		{"bad nonce", idp.sign(header, with("nonce", "nonce-2"), idp.key), false},
+		{"missing subject", idp.sign(header, with("sub", ""), idp.key), false},
+		{"signed with another key", idp.sign(header, idp.validClaims("nonce-1"), otherKey), false},
+		{"unknown key ID", idp.sign(map[string]string{"alg": signingAlgorithm, "kid": "key-2"}, idp.validClaims("nonce-1"), idp.key), false},
+		{"unsigned", encodeTestSegment(t, map[string]string{"alg": "none"}) + "." + encodeTestSegment(t, idp.validClaims("nonce-1")) + ".", false},
+		{"malformed", "not-a-token", false},
+	}
+	p := idp.provider()
+	for _, test := range tests {
+		_, err := p.VerifyIDToken(context.Background(), test.token, "nonce-1")
+		if test.valid && err != nil {
+			t.Errorf("%s: rejected, %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: got %v, want ErrInvalidIDToken", test.name, err)
+		}
+	}
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	return key
+}
+
+func encodeTestSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encoding segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SelectFields keeps the named JSON fields of a value, names the value doesn't encode are left out
+func SelectFields(value interface{}, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if raw, ok := all[field]; ok {
+			selected[field] = raw
+		}
+	}
+	return selected, nil
+}
+
+// UnknownFields returns the fields a struct type doesn't encode, so a misspelled field can be reported
+func UnknownFields(t reflect.Type, fields []string) []string {
+	known := map[string]bool{}
+	for _, name := range JSONFieldNames(t) {
+		known[name] = true
+	}
+	var unknown []string
+	for _, field := range fields {
+		if !known[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	return unknown
+}
+
+// JSONFieldNames returns the names the fields of a struct type are encoded with, fields of untagged embedded structs included
+func JSONFieldNames(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			names = append(names, JSONFieldNames(field.Type)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// SplitFields parses a comma separated fields parameter, an empty parameter gives no fields
+func SplitFields(param string) []string {
+	var fields []string
+	for _, field := range strings.Split(param, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
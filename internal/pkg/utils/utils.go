@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/twinj/uuid"
 )
@@ -15,6 +18,34 @@ func GetEnvOrDefault(envVar string, defaultValue string) string {
 	return defaultValue
 }
 
+// GetDurationEnvOrDefault will return the environmental value of given variable parsed as a duration
+// if not present it'll return the default value
+func GetDurationEnvOrDefault(envVar string, defaultValue time.Duration) (time.Duration, error) {
+	v := os.Getenv(envVar)
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q in ENV %s. %s", v, envVar, err.Error())
+	}
+	return d, nil
+}
+
+// GetIntEnvOrDefault will return the environmental value of given variable parsed as an int
+// if not present it'll return the default value
+func GetIntEnvOrDefault(envVar string, defaultValue int) (int, error) {
+	v := os.Getenv(envVar)
+	if v == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q in ENV %s. %s", v, envVar, err.Error())
+	}
+	return i, nil
+}
+
 func GenerateUUID() string {
 	return uuid.NewV4().String()
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	awss3 "github.com/ANANTHUPADHYA/cloud/internal/pkg/aws-s3"
 	"net/http"
 	_ "net/http/pprof"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,10 +15,16 @@ import (
 
 	fileMgHndlr "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/handlers/v1"
 	fileSvc "github.com/ANANTHUPADHYA/cloud/internal/app/files-manager/services"
+	groupMgHndlr "github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/handlers/v1"
+	groupSvc "github.com/ANANTHUPADHYA/cloud/internal/app/group-manager/services"
 	userMgHndlr "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/handlers/v1"
 	userSvc "github.com/ANANTHUPADHYA/cloud/internal/app/user-manager/services"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/auth"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/database"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/http/clientip"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/http/transport"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/mailer"
+	"github.com/ANANTHUPADHYA/cloud/internal/pkg/oidc"
 	"github.com/ANANTHUPADHYA/cloud/internal/pkg/utils"
 	 cors "github.com/rs/cors/wrapper/gin"
 )
@@ -22,15 +32,25 @@ import (
 var (
 	port            = utils.GetEnvOrDefault("PORT", "3000")
 	healthzEndpoint = "/healthz"
+	// frontendURL and publicAPIURL are used to build the links sent in mails
+	frontendURL  = utils.GetEnvOrDefault("FRONTEND_URL", "http://localhost:4200")
+	publicAPIURL = utils.GetEnvOrDefault("PUBLIC_API_URL", "http://localhost:"+port)
 )
 
 func main() {
 	//create a router and corresponding groups
 	router := gin.New()
+	// forwarding headers are read by the client IP resolver, only when they come from a trusted proxy
+	router.ForwardedByClientIP = false
+	clientIPResolver, err := clientip.NewResolverFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
 	// Recovery middleware recovers from any panics and writes a 500 if there was one.
 	router.Use(gin.Recovery())
 	router.Use(cors.AllowAll())
+	router.Use(clientIPResolver.Middleware)
 
 	//healthz endpoint
 	router.GET(healthzEndpoint, healthzCheck)
@@ -60,9 +80,104 @@ func main() {
 	}
 	s3Svc := awss3.NewAWSS3(s3IfImpl, s3creds)
 
+	tokenManager, err := auth.NewTokenManagerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	passwordHasher, err := auth.NewPasswordHasherFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	passwordPolicy, err := auth.NewPasswordPolicyFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	passwordPolicy.MaxBytes = passwordHasher.MaxPasswordBytes()
 	usersDBImpl := database.NewUsersDBImpl(dynamoDBsvc)
-	userService := userSvc.NewUserService(&usersDBImpl)
-	usersRouter := userMgHndlr.CreateUMSRouter(userService)
+	userService := userSvc.NewUserService(&usersDBImpl, passwordHasher, passwordPolicy)
+	sessionsDBImpl := database.NewSessionsDBImpl(dynamoDBsvc)
+	sessionService := userSvc.NewSessionService(sessionsDBImpl, userService, tokenManager)
+	requireAdmin2FA, err := strconv.ParseBool(utils.GetEnvOrDefault("REQUIRE_ADMIN_2FA", "false"))
+	if err != nil {
+		panic(err)
+	}
+	apiTokenService := userSvc.NewAPITokenService(database.NewAPITokensDBImpl(dynamoDBsvc), userService)
+	authenticator := auth.NewAuthenticator(tokenManager, userService, sessionService, apiTokenService, requireAdmin2FA)
+
+	mail, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	resetTokenTTL, err := utils.GetDurationEnvOrDefault("PASSWORD_RESET_TOKEN_TTL", time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	oneTimeTokensDBImpl := database.NewOneTimeTokensDBImpl(dynamoDBsvc)
+	passwordResetService := userSvc.NewPasswordResetService(oneTimeTokensDBImpl, &usersDBImpl, userService, sessionService, mail,
+		userSvc.PasswordResetConfig{
+			ResetURL: frontendURL + "/login/reset-password",
+			TokenTTL: resetTokenTTL,
+		})
+	verificationTokenTTL, err := utils.GetDurationEnvOrDefault("EMAIL_VERIFICATION_TOKEN_TTL", 48*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	verificationService := userSvc.NewVerificationService(oneTimeTokensDBImpl, &usersDBImpl, userService, mail,
+		userSvc.VerificationConfig{
+			VerifyURL: publicAPIURL + "/v1/verify-email",
+			TokenTTL:  verificationTokenTTL,
+		})
+	lockoutConfig, err := lockoutConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	lockoutService := userSvc.NewLockoutService(database.NewLoginAttemptsDBImpl(dynamoDBsvc), lockoutConfig)
+	twoFactorService := userSvc.NewTwoFactorService(database.NewTwoFactorDBImpl(dynamoDBsvc), userService,
+		userSvc.TwoFactorConfig{
+			Issuer:            utils.GetEnvOrDefault("TOTP_ISSUER", "File Explorer"),
+			RecoveryCodeCount: 10,
+		})
+	ssoService, err := ssoServiceFromEnv(oneTimeTokensDBImpl, database.NewIdentitiesDBImpl(dynamoDBsvc), &usersDBImpl, userService)
+	if err != nil {
+		panic(err)
+	}
+	purgeGracePeriod, err := utils.GetDurationEnvOrDefault("ACCOUNT_PURGE_GRACE_PERIOD", 30*24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	purgeInterval, err := utils.GetDurationEnvOrDefault("ACCOUNT_PURGE_INTERVAL", time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	accountService := userSvc.NewAccountService(&usersDBImpl, userService, sessionService, s3Svc,
+		userSvc.AccountConfig{PurgeGracePeriod: purgeGracePeriod})
+	go purgeDeactivatedAccounts(accountService, purgeInterval)
+	adminService := userSvc.NewAdminService(&usersDBImpl, userService, sessionService, passwordResetService)
+	storageConfig, err := storageConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	storageService := userSvc.NewStorageService(database.NewSettingsDBImpl(dynamoDBsvc), &usersDBImpl, userService, storageConfig)
+	invitationTTL, err := utils.GetDurationEnvOrDefault("INVITATION_TOKEN_TTL", 7*24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	importService := userSvc.NewImportService(&usersDBImpl, userService, oneTimeTokensDBImpl, mail,
+		userSvc.ImportConfig{
+			InviteURL:     frontendURL + "/login/accept-invitation",
+			InvitationTTL: invitationTTL,
+			MaxRows:       1000,
+		})
+	exportTTL, err := utils.GetDurationEnvOrDefault("EXPORT_TTL", 24*time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	exportService := userSvc.NewExportService(database.NewExportsDBImpl(dynamoDBsvc), userService, s3Svc,
+		userSvc.ExportConfig{TTL: exportTTL, MaxRunTime: time.Hour})
+	usersRouter := userMgHndlr.CreateUMSRouter(userService, sessionService, passwordResetService, verificationService,
+		lockoutService, twoFactorService, apiTokenService, ssoService, accountService, adminService, storageService,
+		exportService, importService)
 	log.Print("Starting my service")
 	umsV1.POST("/users",
 		usersRouter.CreateUser,
@@ -72,53 +187,373 @@ func main() {
 		usersRouter.Login,
 	)
 
+	umsV1.PUT("/login/2fa",
+		usersRouter.LoginTwoFactor,
+	)
+
+	if ssoService != nil {
+		umsV1.GET("/oidc/authorize",
+			usersRouter.StartSSOLogin,
+		)
+
+		umsV1.POST("/oidc/callback",
+			usersRouter.CompleteSSOLogin,
+		)
+	}
+
+	umsV1.POST("/token/refresh",
+		usersRouter.RefreshToken,
+	)
+
+	umsV1.POST("/password/forgot",
+		usersRouter.ForgotPassword,
+	)
+
+	umsV1.POST("/password/reset",
+		usersRouter.ResetPassword,
+	)
+
+	umsV1.POST("/invitations/accept",
+		usersRouter.AcceptInvitation,
+	)
+
+	// not under /users, gin can't route a static segment next to the :user_id wildcard
+	umsV1.GET("/verify-email",
+		usersRouter.VerifyEmail,
+	)
+
+	umsV1.POST("/verify-email/resend",
+		usersRouter.ResendVerification,
+	)
+
+	umsV1.POST("/logout",
+		authenticator.Authenticate,
+		usersRouter.Logout,
+	)
+
 	umsV1.GET(
 		"/users/:user_id",
+		authenticator.AuthenticateScoped(auth.ScopeRead),
+		authenticator.RequireSelf,
 		usersRouter.GetUser,
 	)
 
-	filev1 := router.Group("/v1")
-	fileService := fileSvc.NewFileService(userService, s3Svc)
+	umsV1.GET(
+		"/me",
+		authenticator.AuthenticateScoped(auth.ScopeRead),
+		usersRouter.GetMe,
+	)
+
+	umsV1.PATCH(
+		"/users/:user_id",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.UpdateProfile,
+	)
+
+	umsV1.DELETE(
+		"/users/:user_id",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.DeleteAccount,
+	)
+
+	umsV1.PUT(
+		"/users/:user_id/password",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.ChangePassword,
+	)
+
+	// API tokens can't be used to manage API tokens
+	umsV1.POST(
+		"/users/:user_id/api-tokens",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.CreateAPIToken,
+	)
+
+	umsV1.GET(
+		"/users/:user_id/api-tokens",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.GetAPITokens,
+	)
+
+	umsV1.DELETE(
+		"/users/:user_id/api-tokens/:token_id",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.RevokeAPIToken,
+	)
+
+	umsV1.POST(
+		"/users/:user_id/2fa/totp",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.EnrollTOTP,
+	)
+
+	umsV1.POST(
+		"/users/:user_id/2fa/totp/confirm",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.ConfirmTOTP,
+	)
+
+	umsV1.DELETE(
+		"/users/:user_id/2fa/totp",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.DisableTOTP,
+	)
+
+	umsV1.POST(
+		"/users/:user_id/2fa/recovery-codes",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.RegenerateRecoveryCodes,
+	)
+
+	// the listing and admin routes need the access token of a session
+	filev1 := router.Group("/v1", authenticator.Authenticate)
+	fileService := fileSvc.NewFileService(userService, &usersDBImpl, s3Svc, storageService)
 	filesRouter := fileMgHndlr.CreateFileRouter(fileService, userService)
 
 	filev1.GET(
 		"/users",
+		authenticator.RequireAdmin,
 		filesRouter.GetAllUsers)
 
 	filev1.GET(
 		"/files",
+		authenticator.RequireAdmin,
 		filesRouter.GetAllFiles)
 
-	filev1.PUT(
+	// the files of the user can also be reached with an API token carrying the matching scope
+	umsV1.PUT(
 		"/users/:user_id/upload",
+		authenticator.AuthenticateScoped(auth.ScopeUpload),
+		authenticator.RequireSelf,
 		filesRouter.UploadFile,
 	)
 
-	filev1.PATCH(
+	umsV1.PATCH(
 		"/users/:user_id/file-update",
+		authenticator.AuthenticateScoped(auth.ScopeUpload),
+		authenticator.RequireSelf,
 		filesRouter.UpdateFileDescription,
 	)
 
-	filev1.GET(
+	umsV1.GET(
 		"/users/:user_id/download",
+		authenticator.AuthenticateScoped(auth.ScopeRead),
+		authenticator.RequireSelf,
 		filesRouter.DownloadFile,
 	)
 
+	umsV1.GET(
+		"/users/:user_id/usage",
+		authenticator.AuthenticateScoped(auth.ScopeRead),
+		authenticator.RequireSelf,
+		usersRouter.GetStorageUsage,
+	)
+
+	umsV1.POST(
+		"/users/:user_id/export",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.StartExport,
+	)
+
+	umsV1.GET(
+		"/users/:user_id/export/:export_id",
+		authenticator.Authenticate,
+		authenticator.RequireSelf,
+		usersRouter.GetExport,
+	)
+
+	groupsDBImpl := database.NewGroupsDBImpl(dynamoDBsvc)
+	groupService := groupSvc.NewGroupService(groupsDBImpl, userService, s3Svc)
+	groupFileService := groupSvc.NewGroupFileService(groupsDBImpl, groupService, s3Svc)
+	groupsRouter := groupMgHndlr.CreateGroupRouter(groupService, groupFileService, fileService)
+
+	// groups are managed from a session, their files can also be reached with a scoped API token
+	filev1.POST(
+		"/groups",
+		groupsRouter.CreateGroup,
+	)
+
 	filev1.GET(
-		"/admin/users/:user_id/download",
-		filesRouter.DownloadFile,
+		"/groups",
+		groupsRouter.GetGroups,
+	)
+
+	filev1.GET(
+		"/groups/:group_id",
+		groupsRouter.GetGroup,
 	)
 
 	filev1.DELETE(
+		"/groups/:group_id",
+		groupsRouter.DeleteGroup,
+	)
+
+	filev1.PUT(
+		"/groups/:group_id/members/:member_id",
+		groupsRouter.SetMember,
+	)
+
+	filev1.DELETE(
+		"/groups/:group_id/members/:member_id",
+		groupsRouter.RemoveMember,
+	)
+
+	umsV1.PUT(
+		"/groups/:group_id/upload",
+		authenticator.AuthenticateScoped(auth.ScopeUpload),
+		groupsRouter.UploadFile,
+	)
+
+	umsV1.PATCH(
+		"/groups/:group_id/file-update",
+		authenticator.AuthenticateScoped(auth.ScopeUpload),
+		groupsRouter.UpdateFileDescription,
+	)
+
+	umsV1.GET(
+		"/groups/:group_id/download",
+		authenticator.AuthenticateScoped(auth.ScopeRead),
+		groupsRouter.DownloadFile,
+	)
+
+	umsV1.DELETE(
+		"/groups/:group_id/file",
+		authenticator.AuthenticateScoped(auth.ScopeDelete),
+		groupsRouter.DeleteFile,
+	)
+
+	// admin routes act on other users' files, so each action is audited
+	adminv1 := filev1.Group("/admin", authenticator.RequireAdmin, authenticator.AuditAdminAction)
+
+	adminv1.GET(
+		"/users/:user_id/download",
+		filesRouter.DownloadFile,
+	)
+
+	umsV1.DELETE(
 		"/users/:user_id/file",
+		authenticator.AuthenticateScoped(auth.ScopeDelete),
+		authenticator.RequireSelf,
 		filesRouter.DeleteFile,
 	)
 
-	filev1.DELETE(
-		"/admin/users/:user_id/file",
+	adminv1.DELETE(
+		"/users/:user_id/file",
 		filesRouter.DeleteFile,
 	)
 
+	adminv1.DELETE(
+		"/users/:user_id",
+		usersRouter.AdminDeleteAccount,
+	)
+
+	// not under /users, gin can't route a static segment next to the :user_id wildcard
+	adminv1.POST(
+		"/import/users",
+		usersRouter.ImportUsers,
+	)
+
+	adminv1.POST(
+		"/users/:user_id/restore",
+		usersRouter.RestoreAccount,
+	)
+
+	adminv1.GET(
+		"/users/:user_id/status",
+		usersRouter.GetAccountStatus,
+	)
+
+	adminv1.PUT(
+		"/users/:user_id/disabled",
+		usersRouter.DisableUser,
+	)
+
+	adminv1.DELETE(
+		"/users/:user_id/disabled",
+		usersRouter.EnableUser,
+	)
+
+	adminv1.PUT(
+		"/users/:user_id/admin",
+		usersRouter.GrantAdmin,
+	)
+
+	adminv1.DELETE(
+		"/users/:user_id/admin",
+		usersRouter.RevokeAdmin,
+	)
+
+	adminv1.PUT(
+		"/users/:user_id/password-reset",
+		usersRouter.ForcePasswordReset,
+	)
+
+	adminv1.GET(
+		"/users/:user_id/usage",
+		usersRouter.GetStorageUsage,
+	)
+
+	adminv1.PUT(
+		"/users/:user_id/storage-limits",
+		usersRouter.SetUserStorageLimits,
+	)
+
+	adminv1.POST(
+		"/users/:user_id/export",
+		usersRouter.StartExport,
+	)
+
+	adminv1.GET(
+		"/users/:user_id/export/:export_id",
+		usersRouter.GetExport,
+	)
+
+	adminv1.GET(
+		"/storage-limits",
+		usersRouter.GetDefaultStorageLimits,
+	)
+
+	adminv1.PUT(
+		"/storage-limits",
+		usersRouter.SetDefaultStorageLimits,
+	)
+
+	adminv1.DELETE(
+		"/users/:user_id/sessions",
+		usersRouter.RevokeUserSessions,
+	)
+
+	adminv1.PUT(
+		"/users/:user_id/verification",
+		usersRouter.MarkUserVerified,
+	)
+
+	adminv1.DELETE(
+		"/users/:user_id/2fa",
+		usersRouter.ResetUserTwoFactor,
+	)
+
+	adminv1.GET(
+		"/lockouts",
+		usersRouter.GetLockouts,
+	)
+
+	adminv1.DELETE(
+		"/lockouts",
+		usersRouter.ClearLockout,
+	)
+
 	//log.Infof(context.Background(), "Listening on %v", port)
 
 	err = router.Run(":" + port)
@@ -127,6 +562,94 @@ func main() {
 	}
 }
 
+// lockoutConfigFromEnv reads the failed login limits, by default an account is locked
+// for 15 minutes after 5 failures and a client IP after 20
+func lockoutConfigFromEnv() (userSvc.LockoutConfig, error) {
+	var config userSvc.LockoutConfig
+	var err error
+	if config.MaxAccountFailures, err = utils.GetIntEnvOrDefault("LOGIN_MAX_FAILED_ATTEMPTS", 5); err != nil {
+		return config, err
+	}
+	if config.MaxIPFailures, err = utils.GetIntEnvOrDefault("LOGIN_IP_MAX_FAILED_ATTEMPTS", 20); err != nil {
+		return config, err
+	}
+	if config.LockoutDuration, err = utils.GetDurationEnvOrDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute); err != nil {
+		return config, err
+	}
+	if config.FailureWindow, err = utils.GetDurationEnvOrDefault("LOGIN_FAILURE_WINDOW", 15*time.Minute); err != nil {
+		return config, err
+	}
+	if config.BaseDelay, err = utils.GetDurationEnvOrDefault("LOGIN_BASE_DELAY", time.Second); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// purgeDeactivatedAccounts purges the deleted accounts whose grace period ended, once right away and then every interval
+func purgeDeactivatedAccounts(accountService userSvc.AccountService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, errResp := accountService.PurgeDeactivatedAccounts(context.Background())
+		if errResp != nil {
+			log.Errorf("Error purging deactivated accounts. %s", errResp.Message)
+		}
+		if report.Purged > 0 {
+			log.Printf("Purged %d deactivated accounts", report.Purged)
+		}
+		if len(report.FailedUserIDs) > 0 {
+			log.Errorf("Error purging deactivated accounts %s, they are purged on the next run", strings.Join(report.FailedUserIDs, ", "))
+		}
+		<-ticker.C
+	}
+}
+
+// storageConfigFromEnv reads the storage limits that apply until an admin sets other defaults,
+// by default a user can store 1 GB in files of at most 10 MB
+func storageConfigFromEnv() (userSvc.StorageConfig, error) {
+	var config userSvc.StorageConfig
+	quota, err := utils.GetIntEnvOrDefault("STORAGE_QUOTA_BYTES", 1<<30)
+	if err != nil {
+		return config, err
+	}
+	maxFileSize, err := utils.GetIntEnvOrDefault("MAX_FILE_SIZE_BYTES", 10<<20)
+	if err != nil {
+		return config, err
+	}
+	if quota <= 0 || maxFileSize <= 0 {
+		return config, fmt.Errorf("STORAGE_QUOTA_BYTES and MAX_FILE_SIZE_BYTES must be above 0")
+	}
+	config.DefaultStorageQuotaBytes = int64(quota)
+	config.DefaultMaxFileSizeBytes = int64(maxFileSize)
+	return config, nil
+}
+
+// ssoServiceFromEnv sets up single sign-on through the identity provider at OIDC_ISSUER_URL,
+// it returns nil when no identity provider is configured
+func ssoServiceFromEnv(
+	stateDBSvc database.OneTimeTokensDynamoDBAPI,
+	identityDBSvc database.IdentitiesDynamoDBAPI,
+	userDBSvc database.UsersDynamoDBAPI,
+	userService userSvc.UserService,
+) (userSvc.SSOService, error) {
+	config, enabled, err := oidc.ConfigFromEnv(frontendURL + "/login/sso/callback")
+	if err != nil || !enabled {
+		return nil, err
+	}
+	stateTTL, err := utils.GetDurationEnvOrDefault("OIDC_STATE_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	provider := oidc.NewProvider(config, &http.Client{Timeout: 15 * time.Second})
+	log.Printf("Single sign-on enabled with identity provider %s", config.IssuerURL)
+	return userSvc.NewSSOService(provider, stateDBSvc, identityDBSvc, userDBSvc, userService,
+		userSvc.SSOConfig{
+			AdminClaim:      utils.GetEnvOrDefault("OIDC_ADMIN_CLAIM", ""),
+			AdminClaimValue: utils.GetEnvOrDefault("OIDC_ADMIN_CLAIM_VALUE", "true"),
+			StateTTL:        stateTTL,
+		}), nil
+}
+
 //healthzCheck returns the health check status of the user service
 func healthzCheck(c *gin.Context) {
 	//as of now sending ok, in future this may send the